@@ -0,0 +1,131 @@
+package alertiris
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type AbuseIPDBConfig struct {
+	APIKey string `koanf:"api_key"`
+	URL    string `koanf:"url"`
+	// Labels limits the lookups to these labels. All labels holding a public
+	// IP address are looked up when empty.
+	Labels       []string      `koanf:"labels"`
+	MaxAgeInDays int           `koanf:"max_age_in_days"`
+	RateLimit    int           `koanf:"rate_limit"`
+	CacheTTL     time.Duration `koanf:"cache_ttl"`
+	Timeout      time.Duration `koanf:"timeout"`
+}
+
+// abuseIPDB adds the abuse confidence score and report count of IP valued
+// labels to the alert description, and the highest score as a tag.
+type abuseIPDB struct {
+	cfg     AbuseIPDBConfig
+	client  *http.Client
+	cache   *enrichmentCache
+	limiter *lookupLimiter
+}
+
+type abuseReport struct {
+	Score   int    `json:"abuseConfidenceScore"`
+	Reports int    `json:"totalReports"`
+	Country string `json:"countryCode"`
+	ISP     string `json:"isp"`
+}
+
+func newAbuseIPDB(cfg AbuseIPDBConfig, cache *enrichmentCache) *abuseIPDB {
+	if cfg.APIKey == "" {
+		return nil
+	}
+	return &abuseIPDB{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: cfg.Timeout},
+		cache:   cache,
+		limiter: &lookupLimiter{limit: cfg.RateLimit},
+	}
+}
+
+func (a *abuseIPDB) name() string { return "abuseipdb" }
+
+func (a *abuseIPDB) enrich(ctx context.Context, sa *SinkAlert, _ []IOC) string {
+	names := a.cfg.Labels
+	if len(names) == 0 {
+		names = slices.Sorted(maps.Keys(sa.Alert.Labels))
+	}
+	var lines []string
+	top := -1
+	for _, name := range names {
+		ip := sa.Alert.Labels[name]
+		if !publicIP(ip) {
+			continue
+		}
+		r, err := a.lookup(ctx, ip)
+		if err != nil {
+			slog.Warn("abuseipdb lookup failed", "fingerprint", sa.Fingerprint, "ip", ip, "error", err)
+			continue
+		}
+		line := fmt.Sprintf("- %s (%s): confidence %d%%, %d reports", ip, name, r.Score, r.Reports)
+		if r.Country != "" || r.ISP != "" {
+			line += fmt.Sprintf(", %s %s", r.Country, r.ISP)
+		}
+		lines = append(lines, strings.TrimSpace(line))
+		top = max(top, r.Score)
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	sa.Description = strings.TrimRight(sa.Description, "\n") + "\n\nAbuseIPDB:\n" + strings.Join(lines, "\n")
+	sa.Tags = append(sa.Tags, "abuseipdb:"+strconv.Itoa(top))
+	return ""
+}
+
+func (a *abuseIPDB) lookup(ctx context.Context, ip string) (abuseReport, error) {
+	var r abuseReport
+	if a.cache.get("abuseipdb", ip, &r) {
+		enrichmentLookups("abuseipdb", "cached").Inc()
+		return r, nil
+	}
+	if !a.limiter.allow() {
+		enrichmentLookups("abuseipdb", "rate_limited").Inc()
+		return r, fmt.Errorf("rate limit of %d lookups per minute reached", a.cfg.RateLimit)
+	}
+
+	q := url.Values{"ipAddress": {ip}, "maxAgeInDays": {strconv.Itoa(a.cfg.MaxAgeInDays)}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(a.cfg.URL, "/")+"/check?"+q.Encode(), nil)
+	if err != nil {
+		return r, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Key", a.cfg.APIKey)
+	req.Header.Set("Accept", "application/json")
+	resp, err := a.client.Do(req)
+	if err != nil {
+		enrichmentFailed("abuseipdb")
+		return r, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		enrichmentFailed("abuseipdb")
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return r, fmt.Errorf("abuseipdb returned %s: %s", resp.Status, msg)
+	}
+	var body struct {
+		Data abuseReport `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		enrichmentFailed("abuseipdb")
+		return r, fmt.Errorf("decode response: %w", err)
+	}
+	enrichmentLookups("abuseipdb", "ok").Inc()
+	a.cache.set("abuseipdb", ip, body.Data, a.cfg.CacheTTL)
+	return body.Data, nil
+}
@@ -0,0 +1,188 @@
+package alertiris
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// AckConfig maps the state of IRIS alerts back to an acknowledgement. An
+// alert is acknowledged when its status is one of StatusIDs or, with
+// Assigned set, when it has an owner. Polling is disabled when Interval is
+// zero.
+type AckConfig struct {
+	Interval  time.Duration `koanf:"interval"`
+	StatusIDs []int         `koanf:"status_ids"`
+	Assigned  bool          `koanf:"assigned"`
+}
+
+// Acknowledgement is the last seen IRIS state of an alert created by the
+// bridge.
+type Acknowledgement struct {
+	Fingerprint  string    `json:"fingerprint"`
+	CustomerID   int       `json:"customer_id"`
+	AlertID      string    `json:"alert_id"`
+	StatusID     int       `json:"status_id"`
+	OwnerID      int       `json:"owner_id,omitempty"`
+	Acknowledged bool      `json:"acknowledged"`
+	Since        time.Time `json:"since,omitzero"`
+	CheckedAt    time.Time `json:"checked_at"`
+}
+
+func ackKey(fingerprint string, customerID int) []byte {
+	return []byte("ack:" + fingerprint + ":" + strconv.Itoa(customerID))
+}
+
+func (h *Handler) runAcks(ctx context.Context) {
+	ticker := time.NewTicker(h.config.Ack.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if h.held() {
+				continue
+			}
+			if err := h.processAcks(ctx); err != nil {
+				slog.Error("failed to sync acknowledgements", "error", err)
+			}
+		}
+	}
+}
+
+// processAcks refreshes the acknowledgement of every IRIS alert the bridge
+// created.
+func (h *Handler) processAcks(ctx context.Context) error {
+	s := h.sinks["iris"].(*irisSink)
+	mappings, err := ListMappings(h.db, "")
+	if err != nil {
+		return fmt.Errorf("list mappings: %w", err)
+	}
+	for _, m := range mappings {
+		if m.Sink != "iris" {
+			continue
+		}
+		id, err := strconv.Atoi(m.AlertID)
+		if err != nil {
+			continue
+		}
+		a, err := s.client.GetAlert(ctx, id, m.CustomerID)
+		if err != nil {
+			slog.Warn("failed to fetch alert for acknowledgement", "fingerprint", m.Fingerprint, "alert_id", m.AlertID, "error", err)
+			continue
+		}
+
+		prev, _, err := h.loadAck(m.Fingerprint, m.CustomerID)
+		if err != nil {
+			slog.Warn("failed to load acknowledgement", "fingerprint", m.Fingerprint, "error", err)
+			continue
+		}
+		ack := Acknowledgement{
+			Fingerprint:  m.Fingerprint,
+			CustomerID:   m.CustomerID,
+			AlertID:      m.AlertID,
+			StatusID:     a.StatusID,
+			OwnerID:      a.OwnerID,
+			Acknowledged: slices.Contains(h.config.Ack.StatusIDs, a.StatusID) || (h.config.Ack.Assigned && a.OwnerID != 0),
+			CheckedAt:    time.Now(),
+		}
+		if ack.Acknowledged {
+			ack.Since = prev.Since
+			if !prev.Acknowledged {
+				ack.Since = ack.CheckedAt
+				slog.Info("alert acknowledged in iris", "fingerprint", m.Fingerprint, "alert_id", m.AlertID, "status_id", a.StatusID, "owner_id", a.OwnerID)
+				h.recordHistory(HistoryEvent{Fingerprint: m.Fingerprint, Event: "acknowledged", Sink: "iris", CustomerID: m.CustomerID, AlertID: m.AlertID, Detail: fmt.Sprintf("status %d, owner %d", a.StatusID, a.OwnerID)})
+			}
+		}
+		if err := h.storeAck(ack); err != nil {
+			slog.Warn("failed to store acknowledgement", "fingerprint", m.Fingerprint, "error", err)
+		}
+	}
+	return nil
+}
+
+func (h *Handler) loadAck(fingerprint string, customerID int) (Acknowledgement, bool, error) {
+	var ack Acknowledgement
+	found := false
+	err := h.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(ackKey(fingerprint, customerID))
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		found = true
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &ack)
+		})
+	})
+	return ack, found, err
+}
+
+func (h *Handler) storeAck(ack Acknowledgement) error {
+	val, err := json.Marshal(ack)
+	if err != nil {
+		return err
+	}
+	return h.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(ackKey(ack.Fingerprint, ack.CustomerID), val)
+	})
+}
+
+func (h *Handler) clearAck(fingerprint string, customerID int) error {
+	return h.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(ackKey(fingerprint, customerID))
+	})
+}
+
+// ListAcks returns the stored acknowledgements, limited to fingerprint
+// unless it is empty.
+func ListAcks(db *badger.DB, fingerprint string) ([]Acknowledgement, error) {
+	out := []Acknowledgement{}
+	err := db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte("ack:")
+		if fingerprint != "" {
+			opts.Prefix = []byte("ack:" + fingerprint + ":")
+		}
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			var ack Acknowledgement
+			if err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &ack)
+			}); err != nil {
+				return err
+			}
+			out = append(out, ack)
+		}
+		return nil
+	})
+	return out, err
+}
+
+func (h *Handler) adminListAcks(w http.ResponseWriter, r *http.Request) {
+	acks, err := ListAcks(h.db, r.URL.Query().Get("fingerprint"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if v := r.URL.Query().Get("acknowledged"); v != "" {
+		want, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid acknowledged: %w", err))
+			return
+		}
+		acks = slices.DeleteFunc(acks, func(a Acknowledgement) bool { return a.Acknowledged != want })
+	}
+	writeJSON(w, http.StatusOK, acks)
+}
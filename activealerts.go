@@ -0,0 +1,73 @@
+package alertiris
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var irisSeverityNames = map[int]string{
+	1: "unspecified",
+	2: "informational",
+	3: "low",
+	4: "medium",
+	5: "high",
+	6: "critical",
+}
+
+// activeAlertGauges remembers every label set exported, so gauges of
+// severities and sources without open alerts drop to zero.
+var activeAlertGauges sync.Map
+
+func (h *Handler) runActiveAlerts(ctx context.Context) {
+	ticker := time.NewTicker(h.config.ActiveAlertsInterval)
+	defer ticker.Stop()
+	for {
+		if err := h.countActiveAlerts(); err != nil {
+			slog.Error("failed to count active alerts", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// countActiveAlerts sets alertiris_active_alerts to the number of open IRIS
+// alerts created by the bridge, by severity and source.
+func (h *Handler) countActiveAlerts() error {
+	mappings, err := ListMappings(h.db, "")
+	if err != nil {
+		return fmt.Errorf("list mappings: %w", err)
+	}
+	counts := map[string]int{}
+	for _, m := range mappings {
+		if m.Sink != "iris" {
+			continue
+		}
+		severity, ok := irisSeverityNames[m.State.SeverityID]
+		if !ok {
+			severity = strconv.Itoa(m.State.SeverityID)
+		}
+		source := m.State.Source
+		if source == "" {
+			source = "unknown"
+		}
+		counts[fmt.Sprintf(`alertiris_active_alerts{severity=%q,source=%q}`, severity, source)]++
+	}
+
+	for name := range counts {
+		activeAlertGauges.Store(name, struct{}{})
+	}
+	activeAlertGauges.Range(func(name, _ any) bool {
+		metrics.GetOrCreateGauge(name.(string), nil).Set(float64(counts[name.(string)]))
+		return true
+	})
+	return nil
+}
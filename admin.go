@@ -0,0 +1,222 @@
+package alertiris
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+type AdminConfig struct {
+	Listen string `koanf:"listen"`
+	Token  string `koanf:"token"`
+}
+
+var maintenanceKey = []byte("admin:maintenance")
+
+// loadMaintenance restores the maintenance flag so it survives restarts.
+func (h *Handler) loadMaintenance() error {
+	return h.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(maintenanceKey)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			h.maintenance.Store(string(val) == "1")
+			return nil
+		})
+	})
+}
+
+func (h *Handler) setMaintenance(enabled bool) error {
+	val := "0"
+	if enabled {
+		val = "1"
+	}
+	if err := h.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(maintenanceKey, []byte(val))
+	}); err != nil {
+		return err
+	}
+	h.maintenance.Store(enabled)
+	slog.Info("maintenance mode changed", "enabled", enabled)
+	return nil
+}
+
+// newAdminHandler serves the admin API. Every request must carry the
+// configured token as a bearer token.
+func newAdminHandler(h *Handler, token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/mappings", h.adminListMappings)
+	mux.HandleFunc("DELETE /api/mappings/{fingerprint}", h.adminDeleteMappings)
+	mux.HandleFunc("GET /api/dlq", h.adminListDLQ)
+	mux.HandleFunc("POST /api/dlq/{id}/requeue", h.adminRequeueDLQ)
+	mux.HandleFunc("DELETE /api/dlq/{id}", h.adminDeleteDLQ)
+	mux.HandleFunc("POST /api/reconcile", h.adminReconcile)
+	mux.HandleFunc("GET /api/alerts/{fingerprint}/history", h.adminHistory)
+	mux.HandleFunc("GET /api/acks", h.adminListAcks)
+	mux.HandleFunc("GET /api/archive", h.adminListArchive)
+	mux.HandleFunc("POST /api/comments/{fingerprint}", h.adminAddComment)
+	mux.HandleFunc("GET /api/maintenance", h.adminGetMaintenance)
+	mux.HandleFunc("PUT /api/maintenance", h.adminSetMaintenance)
+	mux.HandleFunc("GET /api/hold", h.adminGetHold)
+	mux.HandleFunc("PUT /api/hold", h.adminSetHold)
+	mux.HandleFunc("GET /api/settings", h.adminGetSettings)
+	mux.HandleFunc("GET /api/settings/{name}", h.adminGetSetting)
+	mux.HandleFunc("PUT /api/settings/{name}", h.adminSetSetting)
+	mux.HandleFunc("DELETE /api/settings/{name}", h.adminResetSetting)
+	mux.HandleFunc("POST /api/test-alert", h.adminTestAlert)
+	mux.HandleFunc("POST /api/sync/{fingerprint}", h.adminSync)
+	mux.HandleFunc("POST /api/import", h.adminImport)
+	mux.HandleFunc("GET /api/db/stats", h.adminDBStats)
+	mux.HandleFunc("POST /api/db/compact", h.adminDBCompact)
+	mux.HandleFunc("GET /api/selftest", h.adminSelfTest)
+	mux.HandleFunc("GET /api/rejects", h.adminListRejects)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		want := []byte("Bearer " + token)
+		if subtle.ConstantTimeCompare(got, want) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (h *Handler) adminListMappings(w http.ResponseWriter, r *http.Request) {
+	mappings, err := ListMappings(h.db, r.URL.Query().Get("fingerprint"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, mappings)
+}
+
+func (h *Handler) adminDeleteMappings(w http.ResponseWriter, r *http.Request) {
+	var customerID int
+	if c := r.URL.Query().Get("customer"); c != "" {
+		var err error
+		if customerID, err = strconv.Atoi(c); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid customer: %w", err))
+			return
+		}
+	}
+	deleted, err := DeleteMappings(h.db, r.PathValue("fingerprint"), r.URL.Query().Get("sink"), customerID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(deleted) == 0 {
+		writeError(w, http.StatusNotFound, errors.New("no matching mappings"))
+		return
+	}
+	slog.Info("mappings deleted via admin api", "fingerprint", r.PathValue("fingerprint"), "count", len(deleted))
+	writeJSON(w, http.StatusOK, deleted)
+}
+
+func (h *Handler) adminListDLQ(w http.ResponseWriter, r *http.Request) {
+	entries, err := h.listDLQ()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+func (h *Handler) adminRequeueDLQ(w http.ResponseWriter, r *http.Request) {
+	h.adminDLQAction(w, r, h.requeueDLQ)
+}
+
+func (h *Handler) adminDeleteDLQ(w http.ResponseWriter, r *http.Request) {
+	h.adminDLQAction(w, r, h.deleteDLQ)
+}
+
+func (h *Handler) adminDLQAction(w http.ResponseWriter, r *http.Request, action func(string) error) {
+	err := action(r.PathValue("id"))
+	if err == badger.ErrKeyNotFound {
+		writeError(w, http.StatusNotFound, errors.New("dlq entry not found"))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminReconcile retries every pending sink delivery immediately instead of
+// waiting for its backoff.
+func (h *Handler) adminReconcile(w http.ResponseWriter, r *http.Request) {
+	if err := h.processRetries(r.Context(), true); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) adminDBStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := GetDBStats(h.db)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+func (h *Handler) adminDBCompact(w http.ResponseWriter, r *http.Request) {
+	if err := CompactDB(h.db); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.adminDBStats(w, r)
+}
+
+type maintenanceStatus struct {
+	Enabled bool `json:"enabled"`
+	// Windows lists the maintenance windows open right now.
+	Windows []string `json:"open_windows,omitempty"`
+}
+
+func (h *Handler) adminGetMaintenance(w http.ResponseWriter, r *http.Request) {
+	status := maintenanceStatus{Enabled: h.maintenance.Load()}
+	now := time.Now()
+	for _, mw := range h.windows {
+		if mw.Active(now) {
+			status.Windows = append(status.Windows, mw.Name)
+		}
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (h *Handler) adminSetMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req maintenanceStatus
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("decode request: %w", err))
+		return
+	}
+	if err := h.setMaintenance(req.Enabled); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, req)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
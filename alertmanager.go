@@ -0,0 +1,147 @@
+package alertiris
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	truncatedAlerts = metrics.NewCounter(`alertiris_truncated_alerts_total`)
+	recoveredAlerts = metrics.NewCounter(`alertiris_truncated_alerts_recovered_total`)
+)
+
+type AlertmanagerConfig struct {
+	URL           string        `koanf:"url"`
+	Username      string        `koanf:"username"`
+	Password      string        `koanf:"password"`
+	BearerToken   string        `koanf:"bearer_token"`
+	SkipTLSVerify bool          `koanf:"skip_tls_verify"`
+	Timeout       time.Duration `koanf:"timeout"`
+}
+
+// AlertmanagerClient reads alerts back from the Alertmanager API, used to
+// recover alerts cut from webhooks by max_alerts.
+type AlertmanagerClient struct {
+	cfg    AlertmanagerConfig
+	client *http.Client
+}
+
+func NewAlertmanagerClient(cfg AlertmanagerConfig) *AlertmanagerClient {
+	if cfg.URL == "" {
+		return nil
+	}
+	transport := &http.Transport{}
+	if cfg.SkipTLSVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &AlertmanagerClient{
+		cfg:    cfg,
+		client: &http.Client{Transport: transport, Timeout: cfg.Timeout},
+	}
+}
+
+type gettableAlert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+// GroupAlerts returns the active alerts of the group the payload belongs to.
+// Resolved alerts are no longer returned by Alertmanager and cannot be
+// recovered.
+func (c *AlertmanagerClient) GroupAlerts(ctx context.Context, payload AlertmanagerPayload) ([]Alert, error) {
+	q := url.Values{"active": {"true"}, "silenced": {"false"}, "inhibited": {"false"}}
+	if payload.Receiver != "" {
+		q.Set("receiver", "^(?:"+regexp.QuoteMeta(payload.Receiver)+")$")
+	}
+	for k, v := range payload.GroupLabels {
+		q.Add("filter", fmt.Sprintf("%s=%q", k, v))
+	}
+
+	u := strings.TrimRight(c.cfg.URL, "/") + "/api/v2/alerts?" + q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	if c.cfg.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.BearerToken)
+	} else if c.cfg.Username != "" {
+		req.SetBasicAuth(c.cfg.Username, c.cfg.Password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("alertmanager returned %d: %s", resp.StatusCode, string(msg))
+	}
+
+	var got []gettableAlert
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		return nil, fmt.Errorf("decode alerts: %w", err)
+	}
+	alerts := make([]Alert, 0, len(got))
+	for _, a := range got {
+		alerts = append(alerts, Alert{
+			Status:       "firing",
+			Labels:       a.Labels,
+			Annotations:  a.Annotations,
+			StartsAt:     a.StartsAt,
+			GeneratorURL: a.GeneratorURL,
+			Fingerprint:  a.Fingerprint,
+		})
+	}
+	return alerts, nil
+}
+
+// recoverTruncated adds the alerts Alertmanager left out of the payload
+// because of max_alerts.
+func (h *Handler) recoverTruncated(ctx context.Context, payload AlertmanagerPayload) []Alert {
+	alerts := payload.Alerts
+	if payload.TruncatedAlerts == 0 {
+		return alerts
+	}
+	truncatedAlerts.Add(payload.TruncatedAlerts)
+	if h.alertmanager == nil {
+		slog.Warn("payload was truncated, configure alertmanager.url to recover the missing alerts", "truncated", payload.TruncatedAlerts, "group_key", payload.GroupKey)
+		return alerts
+	}
+
+	fetched, err := h.alertmanager.GroupAlerts(ctx, payload)
+	if err != nil {
+		slog.Error("failed to recover truncated alerts", "truncated", payload.TruncatedAlerts, "group_key", payload.GroupKey, "error", err)
+		return alerts
+	}
+	seen := make(map[string]bool, len(alerts))
+	for _, a := range alerts {
+		seen[a.Fingerprint] = true
+	}
+	recovered := 0
+	for _, a := range fetched {
+		if seen[a.Fingerprint] {
+			continue
+		}
+		alerts = append(alerts, a)
+		recovered++
+	}
+	recoveredAlerts.Add(recovered)
+	slog.Info("recovered truncated alerts", "truncated", payload.TruncatedAlerts, "recovered", recovered, "group_key", payload.GroupKey)
+	return alerts
+}
@@ -0,0 +1,258 @@
+package alertiris
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/dgraph-io/badger/v4"
+)
+
+// App is a complete bridge instance. It can run its own HTTP server with Run
+// or be mounted into an existing server as an http.Handler after Start.
+//
+//	cfg, _ := alertiris.LoadConfig("config.toml")
+//	err := alertiris.New(cfg).Run(ctx)
+type App struct {
+	cfg Config
+
+	db       *badger.DB
+	handler  *Handler
+	plugins  *PluginManager
+	recorder *recorder
+	shipper  *s3Shipper
+	profiler *profiler
+	mux      http.Handler
+}
+
+func New(cfg Config) *App {
+	return &App{cfg: cfg}
+}
+
+// Start opens the state store and starts background workers. An empty
+// db.path keeps the state in memory, which is convenient in tests.
+func (a *App) Start() error {
+	db, err := OpenDB(a.cfg.DB)
+	if err != nil {
+		return fmt.Errorf("open badger db: %w", err)
+	}
+	a.db = db
+	if err := MigrateDB(db); err != nil {
+		a.Close()
+		return fmt.Errorf("migrate badger db: %w", err)
+	}
+
+	if err := a.init(); err != nil {
+		a.Close()
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	err = a.handler.startupCheck(ctx, a.cfg.IRIS.StartupCheck)
+	cancel()
+	if err != nil {
+		a.Close()
+		return err
+	}
+	a.handler.Start()
+	a.plugins.Start()
+	if a.shipper != nil {
+		a.shipper.Start()
+	}
+	if a.profiler != nil {
+		a.profiler.Start()
+	}
+	return nil
+}
+
+func (a *App) init() error {
+	notifier, err := NewNotifier(a.cfg.Notifiers, a.cfg.IRIS.URL)
+	if err != nil {
+		return fmt.Errorf("create notifiers: %w", err)
+	}
+
+	sinks, err := NewSinks(a.cfg, notifier)
+	if err != nil {
+		return fmt.Errorf("create sinks: %w", err)
+	}
+
+	routes, err := NewRoutes(a.cfg.Routes)
+	if err != nil {
+		return fmt.Errorf("load routes: %w", err)
+	}
+
+	am := NewAlertmanagerClient(a.cfg.Alertmanager)
+	grafana := NewGrafanaRenderer(a.cfg.Grafana)
+	a.handler, err = NewHandler(sinks, routes, notifier, am, grafana, a.db, a.cfg.Alerts)
+	if err != nil {
+		return fmt.Errorf("create handler: %w", err)
+	}
+
+	a.plugins, err = NewPluginManager(a.cfg.Plugins, a.handler)
+	if err != nil {
+		return fmt.Errorf("load plugins: %w", err)
+	}
+
+	if a.cfg.Admin.Listen != "" && a.cfg.Admin.Token == "" {
+		return fmt.Errorf("admin.token is required when admin.listen is set")
+	}
+
+	sources := NewSourceRegistry()
+	sources.Register("alertmanager", http.HandlerFunc(a.handler.HandleWebhook))
+	sources.Register("grafana", http.HandlerFunc(a.handler.HandleGrafanaWebhook))
+	if err := a.plugins.Register(sources); err != nil {
+		return fmt.Errorf("load plugins: %w", err)
+	}
+	if err := sources.RegisterTokens(a.cfg.Server.Tokens); err != nil {
+		return fmt.Errorf("server tokens: %w", err)
+	}
+	if err := sources.SetAuth(a.cfg.Server.Auth, a.cfg.Server); err != nil {
+		return fmt.Errorf("server auth: %w", err)
+	}
+	for name := range a.cfg.Alerts.Queue.Concurrency {
+		if !sources.Has(name) {
+			return fmt.Errorf("alerts queue concurrency: %s: unknown source or token", name)
+		}
+	}
+	sources.SetBodyLimit(a.cfg.Server.MaxBodyBytes)
+	scrubber := newRequestScrubber(a.handler.redactor, a.cfg.Server.Auth)
+	if a.cfg.Archive.S3.Bucket != "" {
+		a.shipper, err = newS3Shipper(a.cfg.Archive.S3, a.db)
+		if err != nil {
+			return fmt.Errorf("archive s3: %w", err)
+		}
+		a.handler.shipHistory = true
+	}
+	if a.cfg.Archive.Retention > 0 || a.shipper != nil {
+		sources.Use(newArchiver(a.db, a.cfg.Archive, scrubber).Wrap)
+	}
+	if a.cfg.Record.Path != "" {
+		a.recorder, err = newRecorder(a.cfg.Record, scrubber)
+		if err != nil {
+			return fmt.Errorf("open recording file: %w", err)
+		}
+		sources.Use(a.recorder.Wrap)
+		slog.Info("recording inbound webhooks", "path", a.cfg.Record.Path)
+	}
+	if a.cfg.Profiling.Dir != "" {
+		a.profiler, err = newProfiler(a.cfg.Profiling, a.handler)
+		if err != nil {
+			return fmt.Errorf("profiling: %w", err)
+		}
+		a.handler.profiler = a.profiler
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/webhook/{source}", sources)
+	mux.Handle("/webhook", sourceAlias("alertmanager", sources))
+	mux.HandleFunc("/version", a.handleVersion)
+	mux.HandleFunc("/readyz", a.handleReady)
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		metrics.WritePrometheus(w, true)
+	})
+	a.mux = logRequests(mux)
+	return nil
+}
+
+// ServeHTTP serves the webhook and metrics endpoints. Start must have been
+// called first.
+func (a *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if a.mux == nil {
+		http.Error(w, "not started", http.StatusServiceUnavailable)
+		return
+	}
+	a.mux.ServeHTTP(w, r)
+}
+
+// AdminHandler serves the admin API. Run serves it on admin.listen; when
+// embedding it can be mounted separately. Start must have been called first.
+func (a *App) AdminHandler() http.Handler {
+	return logRequests(newAdminHandler(a.handler, a.cfg.Admin.Token))
+}
+
+// Close stops background workers and closes the state store.
+func (a *App) Close() error {
+	if a.plugins != nil {
+		a.plugins.Stop()
+	}
+	if a.shipper != nil {
+		a.shipper.Close()
+	}
+	if a.profiler != nil {
+		a.profiler.Close()
+	}
+	var errs []error
+	if a.handler != nil {
+		errs = append(errs, a.handler.Close())
+	}
+	if a.recorder != nil {
+		errs = append(errs, a.recorder.Close())
+	}
+	if a.db != nil {
+		errs = append(errs, a.db.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Run starts the app, serves HTTP on server.listen until ctx is cancelled
+// and then shuts down gracefully.
+func (a *App) Run(ctx context.Context) error {
+	if err := a.Start(); err != nil {
+		return err
+	}
+	defer a.Close()
+
+	tlsConfig, err := serverTLSConfig(a.cfg.Server)
+	if err != nil {
+		return fmt.Errorf("server tls: %w", err)
+	}
+	ln, err := net.Listen("tcp", a.cfg.Server.Listen)
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+	servers := []*http.Server{{Handler: a}}
+	listeners := []net.Listener{ln}
+
+	if a.cfg.Admin.Listen != "" {
+		adminLn, err := net.Listen("tcp", a.cfg.Admin.Listen)
+		if err != nil {
+			ln.Close()
+			return fmt.Errorf("admin listen: %w", err)
+		}
+		servers = append(servers, &http.Server{Handler: a.AdminHandler()})
+		listeners = append(listeners, adminLn)
+	}
+
+	errc := make(chan error, len(servers))
+	for i, srv := range servers {
+		go func() {
+			slog.Info("starting server", "listen", listeners[i].Addr().String())
+			errc <- srv.Serve(listeners[i])
+		}()
+	}
+
+	var runErr error
+	select {
+	case err := <-errc:
+		runErr = fmt.Errorf("server error: %w", err)
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, srv := range servers {
+		if err := srv.Shutdown(shutdownCtx); err != nil && runErr == nil {
+			runErr = fmt.Errorf("server shutdown: %w", err)
+		}
+	}
+	return runErr
+}
@@ -0,0 +1,198 @@
+package alertiris
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// ArchiveConfig keeps every authenticated inbound webhook, scrubbed of
+// credentials and redacted, in the state store for Retention. Zero disables
+// the local archive. With an S3 bucket, payloads and alert history are
+// shipped there as well.
+type ArchiveConfig struct {
+	Retention time.Duration `koanf:"retention"`
+	S3        S3Config      `koanf:"s3"`
+}
+
+// ArchivedPayload is an archived webhook. It embeds the Recording, so dumps
+// can be fed to replay.
+type ArchivedPayload struct {
+	Recording
+	Fingerprints []string `json:"fingerprints,omitempty"`
+	// RequestID is the ID the request was logged with.
+	RequestID string `json:"request_id,omitempty"`
+	// Scrubbed is set on payloads archived after authentication with
+	// credentials dropped and the body redacted. Only those are shipped.
+	Scrubbed bool `json:"scrubbed,omitempty"`
+}
+
+// ArchiveFilter selects archived payloads. Zero fields match everything.
+type ArchiveFilter struct {
+	Fingerprint string
+	RequestID   string
+	Since       time.Time
+	Until       time.Time
+}
+
+// archiveSeq keeps keys of payloads received in the same nanosecond apart.
+var archiveSeq atomic.Uint32
+
+// archiver stores payloads under "raw:<time>:<seq>" and indexes them by
+// fingerprint under "rawfp:<fingerprint>:<time>:<seq>". It is used as source
+// middleware, so only authenticated requests are archived, scrubbed.
+type archiver struct {
+	db        *badger.DB
+	retention time.Duration
+	ship      bool
+	scrubber  *requestScrubber
+}
+
+func newArchiver(db *badger.DB, cfg ArchiveConfig, scrubber *requestScrubber) *archiver {
+	return &archiver{db: db, retention: cfg.Retention, ship: cfg.S3.Bucket != "", scrubber: scrubber}
+}
+
+func (a *archiver) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec, body, ok := a.scrubber.record(w, r)
+		if !ok {
+			return
+		}
+		p := ArchivedPayload{Recording: rec, Fingerprints: payloadFingerprints(body), Scrubbed: true}
+		if info := requestInfoFrom(r.Context()); info != nil {
+			p.RequestID = info.id
+		}
+		if err := a.store(p); err != nil {
+			slog.Error("failed to archive request", "path", rec.Path, "error", err)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// payloadFingerprints returns the fingerprints of an Alertmanager style
+// payload. Other payloads have none.
+func payloadFingerprints(body []byte) []string {
+	var payload struct {
+		Alerts []struct {
+			Fingerprint string `json:"fingerprint"`
+		} `json:"alerts"`
+	}
+	if json.Unmarshal(body, &payload) != nil {
+		return nil
+	}
+	var out []string
+	for _, a := range payload.Alerts {
+		if a.Fingerprint != "" {
+			out = append(out, a.Fingerprint)
+		}
+	}
+	return out
+}
+
+func (a *archiver) store(p ArchivedPayload) error {
+	val, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	seq := archiveSeq.Add(1)
+	suffix := fmt.Sprintf("%020d:%05d", p.Time.UnixNano(), seq%100000)
+	key := []byte("raw:" + suffix)
+	return a.db.Update(func(txn *badger.Txn) error {
+		if a.ship && p.Scrubbed {
+			if err := s3Enqueue(txn, "payloads", p.Time, seq, val); err != nil {
+				return err
+			}
+		}
+		if a.retention <= 0 {
+			return nil
+		}
+		if err := txn.SetEntry(badger.NewEntry(key, val).WithTTL(a.retention)); err != nil {
+			return err
+		}
+		for _, fp := range p.Fingerprints {
+			idx := badger.NewEntry([]byte("rawfp:"+fp+":"+suffix), key).WithTTL(a.retention)
+			if err := txn.SetEntry(idx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ListArchive returns the archived payloads matching f, oldest first.
+func ListArchive(db *badger.DB, f ArchiveFilter) ([]ArchivedPayload, error) {
+	out := []ArchivedPayload{}
+	err := db.View(func(txn *badger.Txn) error {
+		prefix := "raw:"
+		if f.Fingerprint != "" {
+			prefix = "rawfp:" + f.Fingerprint + ":"
+		}
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(prefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		seek := prefix
+		if !f.Since.IsZero() {
+			seek += fmt.Sprintf("%020d", f.Since.UnixNano())
+		}
+		for it.Seek([]byte(seek)); it.Valid(); it.Next() {
+			item := it.Item()
+			if f.Fingerprint != "" {
+				key, err := item.ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+				if item, err = txn.Get(key); err == badger.ErrKeyNotFound {
+					continue
+				} else if err != nil {
+					return err
+				}
+			}
+
+			var p ArchivedPayload
+			if err := item.Value(func(val []byte) error {
+				return json.Unmarshal(val, &p)
+			}); err != nil {
+				return err
+			}
+			if !f.Until.IsZero() && p.Time.After(f.Until) {
+				break
+			}
+			if f.RequestID != "" && p.RequestID != f.RequestID {
+				continue
+			}
+			out = append(out, p)
+		}
+		return nil
+	})
+	return out, err
+}
+
+func (h *Handler) adminListArchive(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := ArchiveFilter{Fingerprint: q.Get("fingerprint"), RequestID: q.Get("request_id")}
+	for name, t := range map[string]*time.Time{"since": &f.Since, "until": &f.Until} {
+		v := q.Get(name)
+		if v == "" {
+			continue
+		}
+		var err error
+		if *t, err = time.Parse(time.RFC3339, strings.TrimSpace(v)); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid %s: %w", name, err))
+			return
+		}
+	}
+	payloads, err := ListArchive(h.db, f)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, payloads)
+}
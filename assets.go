@@ -0,0 +1,98 @@
+package alertiris
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// AssetConfig controls linking new IRIS alerts to the host they fire for.
+// The host is looked up in the customer's assets by name and IP address,
+// matches are noted on the alert and an asset is only created when none
+// exists and CreateMissing is set.
+type AssetConfig struct {
+	Enabled        bool     `koanf:"enabled"`
+	HostnameLabels []string `koanf:"hostname_labels"`
+	IPLabels       []string `koanf:"ip_labels"`
+	TypeID         int      `koanf:"type_id"`
+	CreateMissing  bool     `koanf:"create_missing"`
+}
+
+// alertHost returns the host name and IP address of an alert from the first
+// configured labels that are set. Ports are stripped and a host name that is
+// an IP address is returned as the IP.
+func (c AssetConfig) alertHost(labels map[string]string) (string, string) {
+	var host, ip string
+	for _, name := range c.HostnameLabels {
+		if v := labels[name]; v != "" {
+			host = v
+			break
+		}
+	}
+	for _, name := range c.IPLabels {
+		if v := labels[name]; v != "" {
+			ip = v
+			break
+		}
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if _, err := netip.ParseAddr(host); err == nil {
+		ip, host = cmp.Or(ip, host), ""
+	}
+	return host, ip
+}
+
+// resolveAssets links an alert about to be created to the existing assets
+// of its host, or adds a new asset when allowed.
+func (h *Handler) resolveAssets(ctx context.Context, is *irisSink, sa *SinkAlert) {
+	cfg := h.config.Assets
+	host, ip := cfg.alertHost(sa.Alert.Labels)
+	if host == "" && ip == "" {
+		return
+	}
+
+	var found []IRISAsset
+	for _, name := range []string{host, ip} {
+		if name == "" {
+			continue
+		}
+		assets, err := is.client.FindAssets(ctx, name, sa.CustomerID)
+		if err != nil {
+			slog.Warn("failed to look up assets", "fingerprint", sa.Fingerprint, "asset", name, "error", err)
+			return
+		}
+		for _, a := range assets {
+			if !slices.ContainsFunc(found, func(o IRISAsset) bool { return o.ID == a.ID }) {
+				found = append(found, a)
+			}
+		}
+	}
+
+	if len(found) > 0 {
+		lines := make([]string, len(found))
+		for i, a := range found {
+			lines[i] = fmt.Sprintf("- %s (asset %d)", a.Name, a.ID)
+			if a.IP != "" {
+				lines[i] = fmt.Sprintf("- %s, %s (asset %d)", a.Name, a.IP, a.ID)
+			}
+		}
+		appendNoteSection(sa, "Known assets:\n"+strings.Join(lines, "\n"))
+		return
+	}
+	if !cfg.CreateMissing || cfg.TypeID == 0 {
+		return
+	}
+	sa.Assets = append(sa.Assets, IRISAssetRequest{
+		Name:        cmp.Or(host, ip),
+		TypeID:      cfg.TypeID,
+		IP:          ip,
+		Description: "Created by alertiris",
+	})
+}
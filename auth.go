@@ -0,0 +1,163 @@
+package alertiris
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// EndpointAuthConfig is the authentication a webhook endpoint requires.
+// Type is "none", "basic" (Username and Password), "bearer" (Token),
+// "hmac" (a hex HMAC-SHA256 of the body keyed with Secret in Header, after
+// Prefix) or "mtls" (a client certificate verified against
+// server.client_ca_file, optionally with one of Subjects as common name).
+type EndpointAuthConfig struct {
+	Type     string   `koanf:"type"`
+	Username string   `koanf:"username"`
+	Password string   `koanf:"password"`
+	Token    string   `koanf:"token"`
+	Secret   string   `koanf:"secret"`
+	Header   string   `koanf:"header"`
+	Prefix   string   `koanf:"prefix"`
+	Subjects []string `koanf:"subjects"`
+}
+
+func authFailures(endpoint string) *metrics.Counter {
+	return metrics.GetOrCreateCounter(`alertiris_auth_failures_total{endpoint="` + endpoint + `"}`)
+}
+
+func validateEndpointAuth(cfg EndpointAuthConfig, server ServerConfig) error {
+	switch cfg.Type {
+	case "", "none":
+	case "basic":
+		if cfg.Username == "" || cfg.Password == "" {
+			return fmt.Errorf("basic auth requires username and password")
+		}
+	case "bearer":
+		if cfg.Token == "" {
+			return fmt.Errorf("bearer auth requires a token")
+		}
+	case "hmac":
+		if cfg.Secret == "" {
+			return fmt.Errorf("hmac auth requires a secret")
+		}
+	case "mtls":
+		if server.ClientCAFile == "" {
+			return fmt.Errorf("mtls auth requires server.client_ca_file")
+		}
+	default:
+		return fmt.Errorf("unknown auth type %q", cfg.Type)
+	}
+	return nil
+}
+
+// authenticate reports whether r satisfies cfg. HMAC verification reads
+// the body and puts it back for the source.
+func authenticate(cfg EndpointAuthConfig, r *http.Request) (bool, error) {
+	switch cfg.Type {
+	case "basic":
+		user, pass, ok := r.BasicAuth()
+		return ok && secretEqual(user, cfg.Username) && secretEqual(pass, cfg.Password), nil
+	case "bearer":
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		return ok && secretEqual(token, cfg.Token), nil
+	case "hmac":
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return false, fmt.Errorf("read body: %w", err)
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		sig, ok := strings.CutPrefix(r.Header.Get(cfg.signatureHeader()), cfg.Prefix)
+		if !ok {
+			return false, nil
+		}
+		got, err := hex.DecodeString(sig)
+		if err != nil {
+			return false, nil
+		}
+		mac := hmac.New(sha256.New, []byte(cfg.Secret))
+		mac.Write(body)
+		return hmac.Equal(got, mac.Sum(nil)), nil
+	case "mtls":
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			return false, nil
+		}
+		cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+		return len(cfg.Subjects) == 0 || slices.Contains(cfg.Subjects, cn), nil
+	}
+	return true, nil
+}
+
+// signatureHeader is the header carrying the HMAC signature.
+func (cfg EndpointAuthConfig) signatureHeader() string {
+	if cfg.Header == "" {
+		return "X-Signature-256"
+	}
+	return cfg.Header
+}
+
+func secretEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// requireAuth answers requests failing cfg with a 401 and counts them.
+func requireAuth(endpoint string, cfg EndpointAuthConfig, w http.ResponseWriter, r *http.Request) bool {
+	ok, err := authenticate(cfg, r)
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return false
+	}
+	if !ok {
+		authFailures(endpoint).Inc()
+		slog.Warn("webhook authentication failed", "endpoint", endpoint, "auth", cfg.Type, "remote_addr", r.RemoteAddr)
+		if cfg.Type == "basic" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="alertiris"`)
+		}
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// serverTLSConfig returns the TLS configuration of the webhook listener,
+// or nil to serve plain HTTP. Client certificates are requested but only
+// required by endpoints using mtls.
+func serverTLSConfig(cfg ServerConfig) (*tls.Config, error) {
+	if cfg.TLSCertFile == "" {
+		if cfg.ClientCAFile != "" {
+			return nil, fmt.Errorf("client_ca_file requires tls_cert_file")
+		}
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load certificate: %w", err)
+	}
+	tc := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read client ca: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("client ca %s holds no certificates", cfg.ClientCAFile)
+		}
+		tc.ClientCAs = pool
+		tc.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tc, nil
+}
@@ -0,0 +1,239 @@
+package alertiris
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// calendar is an iCal feed whose events open a maintenance window. Recurring
+// events are not expanded; each VEVENT counts once.
+type calendar struct {
+	url      string
+	refresh  time.Duration
+	summary  *regexp.Regexp
+	location *time.Location
+	client   *http.Client
+
+	mu     sync.RWMutex
+	events []calendarEvent
+}
+
+type calendarEvent struct {
+	Summary    string
+	Start, End time.Time
+}
+
+func newCalendar(url string, refresh time.Duration, summaryPattern string, loc *time.Location) (*calendar, error) {
+	c := &calendar{
+		url:      url,
+		refresh:  refresh,
+		location: loc,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+	if c.refresh <= 0 {
+		c.refresh = 15 * time.Minute
+	}
+	if summaryPattern != "" {
+		re, err := regexp.Compile(summaryPattern)
+		if err != nil {
+			return nil, fmt.Errorf("compile summary pattern: %w", err)
+		}
+		c.summary = re
+	}
+	return c, nil
+}
+
+// run fetches the calendar now and then every refresh interval. The last
+// successfully fetched events are kept when a fetch fails.
+func (c *calendar) run(ctx context.Context, window string) {
+	ticker := time.NewTicker(c.refresh)
+	defer ticker.Stop()
+	for {
+		if err := c.fetch(ctx); err != nil {
+			slog.Error("failed to fetch maintenance calendar", "window", window, "url", c.url, "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *calendar) fetch(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("returned %d", resp.StatusCode)
+	}
+	events, err := parseICal(resp.Body, c.location)
+	if err != nil {
+		return fmt.Errorf("parse calendar: %w", err)
+	}
+
+	var kept []calendarEvent
+	for _, e := range events {
+		if c.summary == nil || c.summary.MatchString(e.Summary) {
+			kept = append(kept, e)
+		}
+	}
+	c.mu.Lock()
+	c.events = kept
+	c.mu.Unlock()
+	slog.Debug("fetched maintenance calendar", "url", c.url, "events", len(kept))
+	return nil
+}
+
+// Active returns the event in progress at t, if any.
+func (c *calendar) Active(t time.Time) (calendarEvent, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, e := range c.events {
+		if !t.Before(e.Start) && t.Before(e.End) {
+			return e, true
+		}
+	}
+	return calendarEvent{}, false
+}
+
+// parseICal reads the VEVENTs of an iCalendar (RFC 5545) stream. Floating
+// times and dates are interpreted in loc.
+func parseICal(r io.Reader, loc *time.Location) ([]calendarEvent, error) {
+	var lines []string
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		// Folded lines continue with a leading space or tab.
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	var events []calendarEvent
+	var ev *calendarEvent
+	var duration time.Duration
+	var allDay bool
+	for _, line := range lines {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name, params, _ := strings.Cut(name, ";")
+		switch strings.ToUpper(name) {
+		case "BEGIN":
+			if value == "VEVENT" {
+				ev, duration, allDay = &calendarEvent{}, 0, false
+			}
+		case "END":
+			if value != "VEVENT" || ev == nil {
+				continue
+			}
+			switch {
+			case !ev.End.IsZero():
+			case duration > 0:
+				ev.End = ev.Start.Add(duration)
+			case allDay:
+				ev.End = ev.Start.AddDate(0, 0, 1)
+			}
+			if !ev.Start.IsZero() && ev.End.After(ev.Start) {
+				events = append(events, *ev)
+			}
+			ev = nil
+		case "SUMMARY":
+			if ev != nil {
+				ev.Summary = unescapeICal(value)
+			}
+		case "DTSTART", "DTEND":
+			if ev == nil {
+				continue
+			}
+			t, date, err := parseICalTime(value, params, loc)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			if strings.EqualFold(name, "DTSTART") {
+				ev.Start, allDay = t, date
+			} else {
+				ev.End = t
+			}
+		case "DURATION":
+			if ev == nil {
+				continue
+			}
+			d, err := parseICalDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("DURATION: %w", err)
+			}
+			duration = d
+		}
+	}
+	return events, nil
+}
+
+// parseICalTime parses DATE and DATE-TIME values, reporting whether the value
+// was a date.
+func parseICalTime(value, params string, loc *time.Location) (time.Time, bool, error) {
+	for p := range strings.SplitSeq(params, ";") {
+		if tzid, ok := strings.CutPrefix(p, "TZID="); ok {
+			if l, err := time.LoadLocation(strings.Trim(tzid, `"`)); err == nil {
+				loc = l
+			}
+		}
+	}
+	if len(value) == 8 {
+		t, err := time.ParseInLocation("20060102", value, loc)
+		return t, true, err
+	}
+	if v, ok := strings.CutSuffix(value, "Z"); ok {
+		t, err := time.Parse("20060102T150405", v)
+		return t, false, err
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	return t, false, err
+}
+
+var icalDuration = regexp.MustCompile(`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+func parseICalDuration(value string) (time.Duration, error) {
+	m := icalDuration.FindStringSubmatch(value)
+	if m == nil {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	var d time.Duration
+	for i, unit := range []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		if m[i+2] != "" {
+			n, _ := strconv.Atoi(m[i+2])
+			d += time.Duration(n) * unit
+		}
+	}
+	if m[1] == "-" {
+		d = -d
+	}
+	return d, nil
+}
+
+func unescapeICal(s string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
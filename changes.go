@@ -0,0 +1,134 @@
+package alertiris
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reconcileUpdate adjusts an update of an IRIS alert to the alert IRIS
+// holds: tags already on the alert are kept and, with change notes, the
+// changes are noted.
+func (h *Handler) reconcileUpdate(ctx context.Context, s *irisSink, id string, sa *SinkAlert) error {
+	if !h.config.MergeTags && !h.config.ChangeNotes {
+		return nil
+	}
+	alertID, err := strconv.Atoi(id)
+	if err != nil {
+		return fmt.Errorf("invalid iris alert id %q: %w", id, err)
+	}
+	cur, err := s.client.GetAlert(ctx, alertID, sa.CustomerID)
+	if err != nil {
+		return fmt.Errorf("get alert: %w", err)
+	}
+	if h.config.MergeTags {
+		sa.Tags = mergeTags(splitTags(cur.Tags), sa.Tags)
+	}
+	if h.config.ChangeNotes {
+		return h.changeNote(cur, sa)
+	}
+	return nil
+}
+
+// mergeTags returns the existing tags followed by the new ones not yet
+// present.
+func mergeTags(existing, tags []string) []string {
+	out := existing
+	for _, t := range tags {
+		if !slices.Contains(out, t) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// changeNote compares an update with the alert IRIS holds and, when labels,
+// annotations or the severity changed, sets sa.Note to the IRIS note with
+// the changes appended, so the update records them.
+func (h *Handler) changeNote(cur *IRISAlert, sa *SinkAlert) error {
+	prev, err := decodeSourceContent(cur.SourceContent)
+	if err != nil {
+		return fmt.Errorf("decode source content: %w", err)
+	}
+	next, err := decodeSourceContent(sa.SourceContent)
+	if err != nil {
+		return fmt.Errorf("decode source content: %w", err)
+	}
+
+	changes := diffMap("label", prev.Labels, next.Labels)
+	changes = append(changes, diffMap("annotation", prev.Annotations, next.Annotations)...)
+	if cur.SeverityID != sa.SeverityID {
+		changes = slices.Insert(changes, 0, fmt.Sprintf("severity: %d -> %d", cur.SeverityID, sa.SeverityID))
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	note := strings.TrimRight(cur.Note, "\n")
+	if note != "" {
+		note += "\n"
+	}
+	note += fmt.Sprintf("[%s] Changed since the last notification:\n- %s", h.formatTime(time.Now()), strings.Join(changes, "\n- "))
+	sa.Note = note
+	return nil
+}
+
+// diffMap lists the keys added, removed and changed between a and b.
+func diffMap(kind string, a, b map[string]string) []string {
+	keys := slices.Sorted(maps.Keys(a))
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+
+	var out []string
+	for _, k := range keys {
+		old, hadOld := a[k]
+		cur, hasCur := b[k]
+		switch {
+		case !hadOld:
+			out = append(out, fmt.Sprintf("%s %s added: %q", kind, k, cur))
+		case !hasCur:
+			out = append(out, fmt.Sprintf("%s %s removed (was %q)", kind, k, old))
+		case old != cur:
+			out = append(out, fmt.Sprintf("%s %s: %q -> %q", kind, k, old, cur))
+		}
+	}
+	return out
+}
+
+// decodeSourceContent parses source content as built by sourceContent,
+// including compressed content.
+func decodeSourceContent(raw json.RawMessage) (Alert, error) {
+	var alert Alert
+	if len(raw) == 0 {
+		return alert, nil
+	}
+	var c compressedContent
+	if err := json.Unmarshal(raw, &c); err == nil && c.Encoding == "gzip+base64" {
+		b, err := base64.StdEncoding.DecodeString(c.Content)
+		if err != nil {
+			return alert, err
+		}
+		zr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return alert, err
+		}
+		if raw, err = io.ReadAll(zr); err != nil {
+			return alert, err
+		}
+	}
+	err := json.Unmarshal(raw, &alert)
+	return alert, err
+}
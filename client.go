@@ -1,19 +1,50 @@
-package main
+package alertiris
 
 import (
 	"bytes"
+	"cmp"
+	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"math/rand/v2"
+	"mime/multipart"
+	"net"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
 )
 
 type IRISClient struct {
 	baseURL    string
 	apiKey     string
+	authHeader string
+	authScheme string
+	headers    map[string]string
+	timeout    time.Duration
+	retry      IRISRetryConfig
 	httpClient *http.Client
+
+	// pausedUntil is when IRIS asked us to resume sending, in Unix
+	// nanoseconds.
+	pausedUntil atomic.Int64
+}
+
+var irisRetries = metrics.NewCounter(`alertiris_iris_retries_total`)
+
+// irisRequestDuration is the time from sending a request to IRIS until its
+// answer was read, without retries and rate limit pauses.
+func irisRequestDuration(method string) *metrics.Histogram {
+	return metrics.GetOrCreateHistogram(`alertiris_iris_request_duration_seconds{method="` + method + `"}`)
 }
 
 type IRISAlertRequest struct {
@@ -30,6 +61,28 @@ type IRISAlertRequest struct {
 	ClassificationID int    `json:"alert_classification_id,omitempty"`
 	Note             string `json:"alert_note"`
 	Tags             string `json:"alert_tags,omitempty"`
+	OwnerID          int    `json:"alert_owner_id,omitempty"`
+
+	IOCs   []IRISIOCRequest   `json:"alert_iocs,omitempty"`
+	Assets []IRISAssetRequest `json:"alert_assets,omitempty"`
+}
+
+// IRISAssetRequest is an asset created along with an alert.
+type IRISAssetRequest struct {
+	Name        string `json:"asset_name"`
+	TypeID      int    `json:"asset_type_id"`
+	IP          string `json:"asset_ip,omitempty"`
+	Description string `json:"asset_description,omitempty"`
+	Tags        string `json:"asset_tags,omitempty"`
+}
+
+// IRISIOCRequest is an IOC created along with an alert.
+type IRISIOCRequest struct {
+	Value       string `json:"ioc_value"`
+	TypeID      int    `json:"ioc_type_id"`
+	TLPID       int    `json:"ioc_tlp_id"`
+	Description string `json:"ioc_description,omitempty"`
+	Tags        string `json:"ioc_tags,omitempty"`
 }
 
 type IRISAlertUpdateRequest struct {
@@ -45,6 +98,10 @@ type IRISAlertUpdateRequest struct {
 	CustomerID       *int    `json:"alert_customer_id,omitempty"`
 	ClassificationID *int    `json:"alert_classification_id,omitempty"`
 	Tags             *string `json:"alert_tags,omitempty"`
+	Note             *string `json:"alert_note,omitempty"`
+	OwnerID          *int    `json:"alert_owner_id,omitempty"`
+
+	ResolutionStatusID *int `json:"alert_resolution_status_id,omitempty"`
 }
 
 type IRISResponse struct {
@@ -57,27 +114,84 @@ type IRISAlertData struct {
 	AlertID int `json:"alert_id"`
 }
 
+// IRISAlert is an alert as returned by the filter endpoint.
+type IRISAlert struct {
+	AlertID    int    `json:"alert_id"`
+	Title      string `json:"alert_title"`
+	Source     string `json:"alert_source"`
+	SourceRef  string `json:"alert_source_ref"`
+	SeverityID int    `json:"alert_severity_id"`
+	StatusID   int    `json:"alert_status_id"`
+	CustomerID int    `json:"alert_customer_id"`
+	Tags       string `json:"alert_tags"`
+	OwnerID    int    `json:"alert_owner_id"`
+	Note       string `json:"alert_note"`
+	Cases      []int  `json:"cases"`
+
+	SourceContent json.RawMessage `json:"alert_source_content"`
+	Assets        []IRISAsset     `json:"assets"`
+}
+
+// IRISAsset is an asset linked to an IRIS alert.
+type IRISAsset struct {
+	ID     int    `json:"asset_id"`
+	Name   string `json:"asset_name"`
+	IP     string `json:"asset_ip"`
+	TypeID int    `json:"asset_type_id"`
+}
+
+type irisAlertPage struct {
+	Alerts   []IRISAlert `json:"alerts"`
+	LastPage int         `json:"last_page"`
+}
+
 func NewIRISClient(cfg IRISConfig) *IRISClient {
-	transport := &http.Transport{}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
 	if cfg.SkipTLSVerify {
 		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
 	}
+	if cfg.MaxIdleConns > 0 {
+		transport.MaxIdleConns = cfg.MaxIdleConns
+	}
+	if cfg.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	}
+	if cfg.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = cfg.IdleConnTimeout
+	}
+	if cfg.TLSHandshakeTimeout > 0 {
+		transport.TLSHandshakeTimeout = cfg.TLSHandshakeTimeout
+	}
+	if cfg.DisableHTTP2 {
+		// A non-nil, empty TLSNextProto disables HTTP/2.
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	var rt http.RoundTripper = transport
+	if cfg.Faults.Enabled {
+		rt = newFaultTransport(transport, cfg.Faults)
+	}
 	return &IRISClient{
-		baseURL: strings.TrimRight(cfg.URL, "/"),
-		apiKey:  cfg.APIKey,
+		baseURL:    strings.TrimRight(cfg.URL, "/"),
+		apiKey:     cfg.APIKey,
+		authHeader: cmp.Or(cfg.AuthHeader, "Authorization"),
+		authScheme: cfg.AuthScheme,
+		headers:    cfg.Headers,
+		timeout:    cfg.Timeout,
+		retry:      cfg.Retry,
 		httpClient: &http.Client{
-			Transport: transport,
+			Transport: rt,
 		},
 	}
 }
 
-func (c *IRISClient) CreateAlert(req IRISAlertRequest, cid int) (int, error) {
+func (c *IRISClient) CreateAlert(ctx context.Context, req IRISAlertRequest, cid int) (int, error) {
 	body, err := json.Marshal(req)
 	if err != nil {
 		return 0, fmt.Errorf("marshal create request: %w", err)
 	}
 
-	resp, err := c.do(http.MethodPost, "/alerts/add", body, cid)
+	resp, err := c.do(ctx, http.MethodPost, "/alerts/add", body, cid)
 	if err != nil {
 		return 0, err
 	}
@@ -89,49 +203,328 @@ func (c *IRISClient) CreateAlert(req IRISAlertRequest, cid int) (int, error) {
 	return data.AlertID, nil
 }
 
-func (c *IRISClient) UpdateAlert(alertID int, req IRISAlertUpdateRequest, cid int) error {
+func (c *IRISClient) UpdateAlert(ctx context.Context, alertID int, req IRISAlertUpdateRequest, cid int) error {
 	body, err := json.Marshal(req)
 	if err != nil {
 		return fmt.Errorf("marshal update request: %w", err)
 	}
 
-	_, err = c.do(http.MethodPost, fmt.Sprintf("/alerts/update/%d", alertID), body, cid)
+	_, err = c.do(ctx, http.MethodPost, fmt.Sprintf("/alerts/update/%d", alertID), body, cid)
 	return err
 }
 
-func (c *IRISClient) DeleteAlert(alertID int, cid int) error {
-	_, err := c.do(http.MethodPost, fmt.Sprintf("/alerts/delete/%d", alertID), nil, cid)
+func (c *IRISClient) DeleteAlert(ctx context.Context, alertID int, cid int) error {
+	_, err := c.do(ctx, http.MethodPost, fmt.Sprintf("/alerts/delete/%d", alertID), nil, cid)
 	return err
 }
 
-func (c *IRISClient) do(method, path string, body []byte, cid int) (*IRISResponse, error) {
+func (c *IRISClient) GetAlert(ctx context.Context, alertID, cid int) (*IRISAlert, error) {
+	resp, err := c.do(ctx, http.MethodGet, fmt.Sprintf("/alerts/%d", alertID), nil, cid)
+	if err != nil {
+		return nil, err
+	}
+	var a IRISAlert
+	if err := json.Unmarshal(resp.Data, &a); err != nil {
+		return nil, fmt.Errorf("unmarshal alert: %w", err)
+	}
+	return &a, nil
+}
+
+// IRISEscalateRequest turns an alert into a new case.
+type IRISEscalateRequest struct {
+	CaseTitle        string   `json:"case_title"`
+	CaseTags         string   `json:"case_tags"`
+	Note             string   `json:"note"`
+	ImportAsEvent    bool     `json:"import_as_event"`
+	IOCsImportList   []string `json:"iocs_import_list"`
+	AssetsImportList []string `json:"assets_import_list"`
+}
+
+// EscalateAlert creates a case from an alert and returns the case ID.
+func (c *IRISClient) EscalateAlert(ctx context.Context, alertID int, req IRISEscalateRequest, cid int) (int, error) {
+	if req.IOCsImportList == nil {
+		req.IOCsImportList = []string{}
+	}
+	if req.AssetsImportList == nil {
+		req.AssetsImportList = []string{}
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return 0, fmt.Errorf("marshal escalate request: %w", err)
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, fmt.Sprintf("/alerts/escalate/%d", alertID), body, cid)
+	if err != nil {
+		return 0, err
+	}
+	var cs struct {
+		CaseID int `json:"case_id"`
+	}
+	if err := json.Unmarshal(resp.Data, &cs); err != nil {
+		return 0, fmt.Errorf("unmarshal case: %w", err)
+	}
+	return cs.CaseID, nil
+}
+
+// MergeAlert adds an alert to an existing case.
+func (c *IRISClient) MergeAlert(ctx context.Context, alertID, caseID int, note string, cid int) error {
+	body, err := json.Marshal(map[string]any{
+		"target_case_id":     caseID,
+		"iocs_import_list":   []string{},
+		"assets_import_list": []string{},
+		"note":               note,
+		"import_as_event":    false,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal merge request: %w", err)
+	}
+	_, err = c.do(ctx, http.MethodPost, fmt.Sprintf("/alerts/merge/%d", alertID), body, cid)
+	return err
+}
+
+// IRISComment is a comment on an IRIS alert.
+type IRISComment struct {
+	ID   int    `json:"comment_id"`
+	Text string `json:"comment_text"`
+	Date string `json:"comment_date"`
+	User struct {
+		Name  string `json:"user_name"`
+		Login string `json:"user_login"`
+	} `json:"user"`
+}
+
+func (c *IRISClient) ListAlertComments(ctx context.Context, alertID, cid int) ([]IRISComment, error) {
+	resp, err := c.do(ctx, http.MethodGet, fmt.Sprintf("/alerts/%d/comments/list", alertID), nil, cid)
+	if err != nil {
+		return nil, err
+	}
+	var comments []IRISComment
+	if err := json.Unmarshal(resp.Data, &comments); err != nil {
+		return nil, fmt.Errorf("unmarshal comments: %w", err)
+	}
+	return comments, nil
+}
+
+// UploadEvidence stores a file in the root folder of a case's datastore and
+// returns its file ID.
+func (c *IRISClient) UploadEvidence(ctx context.Context, caseID int, name, description string, content []byte) (int, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/datastore/list/tree", nil, caseID)
+	if err != nil {
+		return 0, fmt.Errorf("list datastore: %w", err)
+	}
+	var tree map[string]json.RawMessage
+	if err := json.Unmarshal(resp.Data, &tree); err != nil {
+		return 0, fmt.Errorf("unmarshal datastore tree: %w", err)
+	}
+	var folderID string
+	for k := range tree {
+		if id, ok := strings.CutPrefix(k, "d-"); ok {
+			folderID = id
+			break
+		}
+	}
+	if folderID == "" {
+		return 0, fmt.Errorf("case %d has no datastore root folder", caseID)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for k, v := range map[string]string{
+		"file_original_name": name,
+		"file_description":   description,
+		"file_password":      "",
+		"file_tags":          "alertiris",
+		"file_is_evidence":   "y",
+		"file_is_ioc":        "n",
+	} {
+		mw.WriteField(k, v)
+	}
+	fw, err := mw.CreateFormFile("file_content", name)
+	if err != nil {
+		return 0, err
+	}
+	fw.Write(content)
+	if err := mw.Close(); err != nil {
+		return 0, err
+	}
+
+	resp, err = c.doWithContentType(ctx, http.MethodPost, "/datastore/file/add/"+folderID, body.Bytes(), caseID, mw.FormDataContentType())
+	if err != nil {
+		return 0, fmt.Errorf("upload file: %w", err)
+	}
+	var file struct {
+		FileID int `json:"file_id"`
+	}
+	if err := json.Unmarshal(resp.Data, &file); err != nil {
+		return 0, fmt.Errorf("unmarshal file: %w", err)
+	}
+	return file.FileID, nil
+}
+
+// FilterAlerts returns every alert matching the filter, fetching all pages.
+func (c *IRISClient) FilterAlerts(ctx context.Context, filter url.Values, cid int) ([]IRISAlert, error) {
+	var out []IRISAlert
+	for page := 1; ; page++ {
+		q := url.Values{}
+		for k, v := range filter {
+			q[k] = v
+		}
+		q.Set("page", strconv.Itoa(page))
+		q.Set("per_page", "100")
+
+		resp, err := c.do(ctx, http.MethodGet, "/alerts/filter?"+q.Encode(), nil, cid)
+		if err != nil {
+			return nil, err
+		}
+		var data irisAlertPage
+		if err := json.Unmarshal(resp.Data, &data); err != nil {
+			return nil, fmt.Errorf("unmarshal alerts: %w", err)
+		}
+		out = append(out, data.Alerts...)
+		if page >= data.LastPage || len(data.Alerts) == 0 {
+			return out, nil
+		}
+	}
+}
+
+// FindAssets returns the assets named name, or with name as IP address, of
+// the customer's alerts IRIS finds with the alert_assets filter.
+func (c *IRISClient) FindAssets(ctx context.Context, name string, customerID int) ([]IRISAsset, error) {
+	alerts, err := c.FilterAlerts(ctx, url.Values{
+		"alert_assets":      {name},
+		"alert_customer_id": {strconv.Itoa(customerID)},
+	}, customerID)
+	if err != nil {
+		return nil, err
+	}
+	var out []IRISAsset
+	for _, a := range alerts {
+		for _, asset := range a.Assets {
+			if (asset.Name == name || asset.IP == name) && !slices.ContainsFunc(out, func(o IRISAsset) bool { return o.ID == asset.ID }) {
+				out = append(out, asset)
+			}
+		}
+	}
+	return out, nil
+}
+
+// Ping checks that IRIS is reachable and accepts the API key.
+func (c *IRISClient) Ping(ctx context.Context) error {
+	_, err := c.do(ctx, http.MethodGet, "/api/ping", nil, 0)
+	return err
+}
+
+// ListIDs returns the objects of a management list endpoint such as
+// /manage/customers/list by ID, with their names.
+func (c *IRISClient) ListIDs(ctx context.Context, path, idField, nameField string) (map[int]string, error) {
+	resp, err := c.do(ctx, http.MethodGet, path, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	var items []map[string]any
+	if err := json.Unmarshal(resp.Data, &items); err != nil {
+		return nil, fmt.Errorf("unmarshal %s: %w", path, err)
+	}
+	ids := make(map[int]string, len(items))
+	for _, item := range items {
+		id, ok := item[idField].(float64)
+		if !ok {
+			continue
+		}
+		name, _ := item[nameField].(string)
+		ids[int(id)] = name
+	}
+	return ids, nil
+}
+
+func (c *IRISClient) do(ctx context.Context, method, path string, body []byte, cid int) (*IRISResponse, error) {
+	return c.doWithContentType(ctx, method, path, body, cid, "application/json")
+}
+
+func (c *IRISClient) doWithContentType(ctx context.Context, method, path string, body []byte, cid int, contentType string) (*IRISResponse, error) {
+	idempotent := isIdempotent(method, path)
+	for attempt := 1; ; attempt++ {
+		resp, err := c.send(ctx, method, path, body, cid, contentType)
+		if err == nil || attempt >= c.retry.Attempts || !retryable(err, idempotent) {
+			return resp, err
+		}
+
+		wait := c.retryBackoff(attempt)
+		var ierr *IRISError
+		if errors.As(err, &ierr) && ierr.RetryAfter > 0 {
+			if ierr.RetryAfter > c.retry.MaxBackoff {
+				return resp, err
+			}
+			wait = max(wait, ierr.RetryAfter)
+		}
+		irisRetries.Inc()
+		slog.Debug("retrying iris request", "method", method, "path", path, "attempt", attempt, "wait", wait, "error", err)
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, err
+		case <-t.C:
+		}
+	}
+}
+
+func (c *IRISClient) send(ctx context.Context, method, path string, body []byte, cid int, contentType string) (*IRISResponse, error) {
+	if err := c.waitRateLimit(ctx, method, path); err != nil {
+		return nil, err
+	}
+
 	var reqBody io.Reader
 	if body != nil {
 		reqBody = bytes.NewReader(body)
 	}
 
-	url := fmt.Sprintf("%s%s?cid=%d", c.baseURL, path, cid)
-	req, err := http.NewRequest(method, url, reqBody)
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	// Management endpoints are not scoped to a customer and get no cid.
+	u := c.baseURL + path
+	if cid > 0 {
+		u += fmt.Sprintf("%scid=%d", sep, cid)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+c.apiKey)
-	req.Header.Set("Content-Type", "application/json")
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+	if c.authScheme != "" {
+		req.Header.Set(c.authHeader, c.authScheme+" "+c.apiKey)
+	} else {
+		req.Header.Set(c.authHeader, c.apiKey)
+	}
+	req.Header.Set("Content-Type", contentType)
 
+	start := time.Now()
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("http %s %s: %w", method, path, err)
 	}
 	defer resp.Body.Close()
+	pause := c.observeRateLimit(resp)
 
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("read response: %w", err)
 	}
+	irisRequestDuration(method).UpdateDuration(start)
 
 	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("iris api %s %s returned %d: %s", method, path, resp.StatusCode, string(respBody))
+		return nil, &IRISError{Method: method, Path: path, StatusCode: resp.StatusCode, Message: string(respBody), RetryAfter: pause}
 	}
 
 	var irisResp IRISResponse
@@ -140,8 +533,83 @@ func (c *IRISClient) do(method, path string, body []byte, cid int) (*IRISRespons
 	}
 
 	if irisResp.Status != "success" {
-		return nil, fmt.Errorf("iris api error: %s", irisResp.Msg)
+		return nil, &IRISError{Method: method, Path: path, StatusCode: resp.StatusCode, Message: irisResp.Msg}
 	}
 
 	return &irisResp, nil
 }
+
+// IRISError is an error response from the IRIS API.
+type IRISError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Message    string
+
+	// RetryAfter is how long IRIS asked to wait before sending again.
+	RetryAfter time.Duration
+}
+
+func (e *IRISError) Error() string {
+	if e.StatusCode < 400 {
+		return "iris api error: " + e.Message
+	}
+	return fmt.Sprintf("iris api %s %s returned %d: %s", e.Method, e.Path, e.StatusCode, e.Message)
+}
+
+// Temporary reports whether the request may succeed when repeated.
+func (e *IRISError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// isPermanent reports whether err is an IRIS error that retrying will not
+// fix, such as a rejected request. Other errors are assumed transient.
+func isPermanent(err error) bool {
+	var ierr *IRISError
+	return errors.As(err, &ierr) && !ierr.Temporary()
+}
+
+// isIdempotent reports whether a request can be repeated without side
+// effects. Requests creating alerts, cases or files are not.
+func isIdempotent(method, path string) bool {
+	if method == http.MethodGet {
+		return true
+	}
+	return strings.HasPrefix(path, "/alerts/update/") || strings.HasPrefix(path, "/alerts/delete/")
+}
+
+// retryable reports whether a failed request should be repeated. Requests
+// that are not idempotent are only repeated when IRIS cannot have acted on
+// them: the connection failed or the request was rate limited.
+func retryable(err error, idempotent bool) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var ierr *IRISError
+	if errors.As(err, &ierr) {
+		if ierr.StatusCode == http.StatusTooManyRequests {
+			return true
+		}
+		return idempotent && ierr.Temporary()
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var urlErr *url.Error
+	return idempotent && errors.As(err, &urlErr)
+}
+
+// retryBackoff doubles the wait for every attempt, up to MaxBackoff, and
+// picks a random point in its upper half so clients do not retry in step.
+func (c *IRISClient) retryBackoff(attempt int) time.Duration {
+	d := c.retry.InitialBackoff
+	for i := 1; i < attempt && d < c.retry.MaxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, c.retry.MaxBackoff)
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cvhariharan/alertiris"
+)
+
+// adminClient talks to the admin API of a running server, which owns the
+// database.
+type adminClient struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+func newAdminClient(cfg alertiris.AdminConfig) *adminClient {
+	addr := cfg.Listen
+	if strings.HasPrefix(addr, ":") {
+		addr = "127.0.0.1" + addr
+	}
+	return &adminClient{
+		baseURL: "http://" + addr,
+		token:   cfg.Token,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (c *adminClient) do(method, path string, query url.Values, out any) error {
+	return c.send(method, path, query, nil, out)
+}
+
+// send is do with a JSON request body, which is omitted when in is nil.
+func (c *adminClient) send(method, path string, query url.Values, in, out any) error {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("admin api: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		var e struct {
+			Error string `json:"error"`
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(body, &e) == nil && e.Error != "" {
+			return fmt.Errorf("admin api returned %d: %s", resp.StatusCode, e.Error)
+		}
+		return fmt.Errorf("admin api returned %d: %s", resp.StatusCode, string(body))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *adminClient) mappings(sub, fingerprint, sink string, customerID int) ([]alertiris.Mapping, error) {
+	var mappings []alertiris.Mapping
+	switch sub {
+	case "list":
+		return mappings, c.do(http.MethodGet, "/api/mappings", nil, &mappings)
+	case "get":
+		err := c.do(http.MethodGet, "/api/mappings", url.Values{"fingerprint": {fingerprint}}, &mappings)
+		if err == nil && len(mappings) == 0 {
+			return nil, fmt.Errorf("no mappings for %s", fingerprint)
+		}
+		return mappings, err
+	case "delete":
+		q := url.Values{}
+		if sink != "" {
+			q.Set("sink", sink)
+		}
+		if customerID != 0 {
+			q.Set("customer", strconv.Itoa(customerID))
+		}
+		return mappings, c.do(http.MethodDelete, "/api/mappings/"+url.PathEscape(fingerprint), q, &mappings)
+	default:
+		return nil, fmt.Errorf("unknown mappings command %q", sub)
+	}
+}
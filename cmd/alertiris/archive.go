@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/cvhariharan/alertiris"
+)
+
+// runArchive dumps archived webhooks as JSON lines, which replay accepts.
+func runArchive(cfg alertiris.Config, args []string) error {
+	fs := flag.NewFlagSet("archive", flag.ExitOnError)
+	fingerprint := fs.String("fingerprint", "", "only payloads containing this fingerprint")
+	requestID := fs.String("request-id", "", "only the payload of this request ID")
+	since := fs.String("since", "", "only payloads received after this time (RFC 3339) or duration ago")
+	until := fs.String("until", "", "only payloads received before this time (RFC 3339) or duration ago")
+	local := fs.Bool("local", false, "open the database directly even if the admin API is configured")
+	fs.Parse(args)
+
+	f := alertiris.ArchiveFilter{Fingerprint: *fingerprint, RequestID: *requestID}
+	var err error
+	if f.Since, err = parseTimeFlag(*since); err != nil {
+		return fmt.Errorf("-since: %w", err)
+	}
+	if f.Until, err = parseTimeFlag(*until); err != nil {
+		return fmt.Errorf("-until: %w", err)
+	}
+
+	var payloads []alertiris.ArchivedPayload
+	if cfg.Admin.Listen != "" && !*local {
+		q := url.Values{}
+		if f.Fingerprint != "" {
+			q.Set("fingerprint", f.Fingerprint)
+		}
+		if f.RequestID != "" {
+			q.Set("request_id", f.RequestID)
+		}
+		if !f.Since.IsZero() {
+			q.Set("since", f.Since.Format(time.RFC3339Nano))
+		}
+		if !f.Until.IsZero() {
+			q.Set("until", f.Until.Format(time.RFC3339Nano))
+		}
+		if err := newAdminClient(cfg.Admin).do(http.MethodGet, "/api/archive", q, &payloads); err != nil {
+			return err
+		}
+	} else {
+		db, err := openDB(cfg.DB)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		if payloads, err = alertiris.ListArchive(db, f); err != nil {
+			return err
+		}
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	for _, p := range payloads {
+		if err := enc.Encode(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseTimeFlag accepts an RFC 3339 time or a duration before now.
+func parseTimeFlag(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/cvhariharan/alertiris"
+	"github.com/cvhariharan/alertiris/mockiris"
+)
+
+// benchLatency are latency percentiles in milliseconds.
+type benchLatency struct {
+	Count uint64  `json:"count"`
+	P50   float64 `json:"p50_ms"`
+	P90   float64 `json:"p90_ms"`
+	P99   float64 `json:"p99_ms"`
+}
+
+// benchReport is the outcome of a benchmark run. With -json it is printed
+// as one line, so runs of different releases can be collected and compared.
+type benchReport struct {
+	Version      string       `json:"version"`
+	Seconds      float64      `json:"seconds"`
+	Alerts       int          `json:"alerts"`
+	AlertsPerSec float64      `json:"alerts_per_second"`
+	Rejected     int          `json:"rejected"`
+	Errors       int          `json:"errors"`
+	Webhook      benchLatency `json:"webhook"`
+	QueueWait    benchLatency `json:"queue_wait"`
+	IRISCalls    benchLatency `json:"iris_calls"`
+	Delivery     benchLatency `json:"delivery"`
+}
+
+// runBench measures the bridge against an in-process mock IRIS: generated
+// payloads are fed to an in-process bridge as fast as it takes them, or at
+// -rate, and the report covers everything from webhook to IRIS call. State
+// is kept in memory and only the iris sink is used; the rest of the
+// configuration, such as the queue, enrichment and templates, applies as
+// configured.
+func runBench(cfg alertiris.Config, args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	irisLatency := fs.Duration("iris-latency", 0, "delay the mock IRIS adds to every request")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	var opts loadOptions
+	def := loadDefaults
+	def.Rate, def.Duration, def.Concurrency, def.Alerts = 0, 30*time.Second, 8, 1000
+	opts.flags(fs, def)
+	fs.Parse(args)
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	// Per-request logs, and warnings about the queue being full, would
+	// measure the terminal rather than the bridge.
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError})))
+
+	srv := httptest.NewServer(mockiris.New(mockiris.Options{APIKey: cfg.IRIS.APIKey, Latency: *irisLatency}))
+	defer srv.Close()
+	cfg.IRIS.URL = srv.URL
+	cfg.IRIS.Faults = alertiris.FaultConfig{}
+	cfg.DB.Path = ""
+	cfg.Admin.Listen = ""
+	cfg.Record.Path = ""
+	cfg.Archive.Retention = 0
+	cfg.Archive.S3.Bucket = ""
+	cfg.Server.Auth = nil
+	cfg.Alerts.Sinks = []string{"iris"}
+	cfg.Alerts.HoldWindows = nil
+
+	app := alertiris.New(cfg)
+	if err := app.Start(); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	// A payload answered with a 429 is sent again shortly after, like a
+	// sender honouring Retry-After but without waiting whole seconds.
+	var rejected atomic.Int64
+	post := func(ctx context.Context, body []byte) (int, error) {
+		for {
+			req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/webhook", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, req)
+			if w.Code != http.StatusTooManyRequests {
+				return w.Code, nil
+			}
+			rejected.Add(1)
+			select {
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "benchmarking for %s against the mock iris\n", opts.Duration)
+	start := time.Now()
+	res := runLoad(ctx, opts, post)
+	// Closing waits for the queued alerts to be processed.
+	if err := app.Close(); err != nil {
+		return err
+	}
+	elapsed := time.Since(start)
+
+	report := benchReport{
+		Version:      alertiris.GetBuildInfo().Version,
+		Seconds:      elapsed.Seconds(),
+		Alerts:       res.Accepted,
+		AlertsPerSec: float64(res.Accepted) / elapsed.Seconds(),
+		Rejected:     int(rejected.Load()),
+		Errors:       res.Errors,
+		Webhook:      durationsLatency(res.Latencies),
+		QueueWait:    histogramLatency(metrics.GetOrCreateHistogram(`alertiris_queue_wait_seconds`)),
+	}
+	var calls, delivery []*metrics.Histogram
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		calls = append(calls, metrics.GetOrCreateHistogram(`alertiris_iris_request_duration_seconds{method="`+method+`"}`))
+	}
+	for _, action := range []string{"create", "update", "resolve"} {
+		delivery = append(delivery, metrics.GetOrCreateHistogram(`alertiris_delivery_latency_seconds{sink="iris",action="`+action+`"}`))
+	}
+	report.IRISCalls = histogramLatency(calls...)
+	report.Delivery = histogramLatency(delivery...)
+
+	if *asJSON {
+		return json.NewEncoder(os.Stdout).Encode(report)
+	}
+	return report.print()
+}
+
+func (r benchReport) print() error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "version\t%s\n", r.Version)
+	fmt.Fprintf(w, "duration\t%.1fs\n", r.Seconds)
+	fmt.Fprintf(w, "alerts\t%d (%.1f/s)\n", r.Alerts, r.AlertsPerSec)
+	if r.Rejected > 0 || r.Errors > 0 {
+		fmt.Fprintf(w, "rejected\t%d times with a 429, %d errors\n", r.Rejected, r.Errors)
+	}
+	fmt.Fprintln(w, "\tcount\tp50\tp90\tp99")
+	for _, l := range []struct {
+		name string
+		benchLatency
+	}{
+		{"webhook", r.Webhook},
+		{"queue wait", r.QueueWait},
+		{"iris calls", r.IRISCalls},
+		{"delivery", r.Delivery},
+	} {
+		if l.Count == 0 {
+			fmt.Fprintf(w, "%s\t0\t-\t-\t-\n", l.name)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%d\t%.2fms\t%.2fms\t%.2fms\n", l.name, l.Count, l.P50, l.P90, l.P99)
+	}
+	return w.Flush()
+}
+
+func durationsLatency(ds []time.Duration) benchLatency {
+	sorted := slices.Sorted(slices.Values(ds))
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	return benchLatency{
+		Count: uint64(len(sorted)),
+		P50:   ms(percentile(sorted, 0.5)),
+		P90:   ms(percentile(sorted, 0.9)),
+		P99:   ms(percentile(sorted, 0.99)),
+	}
+}
+
+// histogramLatency estimates percentiles from the buckets of histograms in
+// seconds. Each is the upper bound of its bucket, so up to about 12% high.
+func histogramLatency(hs ...*metrics.Histogram) benchLatency {
+	type bucket struct {
+		upper float64
+		count uint64
+	}
+	var buckets []bucket
+	var l benchLatency
+	for _, h := range hs {
+		h.VisitNonZeroBuckets(func(vmrange string, count uint64) {
+			_, upper, _ := strings.Cut(vmrange, "...")
+			v, err := strconv.ParseFloat(upper, 64)
+			if err != nil {
+				return
+			}
+			buckets = append(buckets, bucket{v, count})
+			l.Count += count
+		})
+	}
+	slices.SortFunc(buckets, func(a, b bucket) int { return cmp.Compare(a.upper, b.upper) })
+	quantile := func(q float64) float64 {
+		target := uint64(math.Ceil(q * float64(l.Count)))
+		var seen uint64
+		for _, b := range buckets {
+			seen += b.count
+			if seen >= target {
+				return b.upper * 1000
+			}
+		}
+		return 0
+	}
+	if l.Count > 0 {
+		l.P50, l.P90, l.P99 = quantile(0.5), quantile(0.9), quantile(0.99)
+	}
+	return l
+}
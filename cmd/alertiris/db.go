@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/cvhariharan/alertiris"
+)
+
+func runDB(cfg alertiris.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: alertiris db stats|compact [flags]")
+	}
+	sub := args[0]
+
+	fs := flag.NewFlagSet("db "+sub, flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print JSON instead of a table")
+	local := fs.Bool("local", false, "open the database directly even if the admin API is configured")
+	fs.Parse(args[1:])
+
+	var path string
+	switch sub {
+	case "stats":
+		path = "/api/db/stats"
+	case "compact":
+		path = "/api/db/compact"
+	default:
+		return fmt.Errorf("unknown db command %q", sub)
+	}
+
+	var stats alertiris.DBStats
+	if cfg.Admin.Listen != "" && !*local {
+		method := http.MethodGet
+		if sub == "compact" {
+			method = http.MethodPost
+		}
+		if err := newAdminClient(cfg.Admin).do(method, path, nil, &stats); err != nil {
+			return err
+		}
+		return printDBStats(stats, *asJSON)
+	}
+
+	db, err := openDB(cfg.DB)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if sub == "compact" {
+		if err := alertiris.CompactDB(db); err != nil {
+			return err
+		}
+	}
+	if stats, err = alertiris.GetDBStats(db); err != nil {
+		return err
+	}
+	return printDBStats(stats, *asJSON)
+}
+
+func printDBStats(stats alertiris.DBStats, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(stats)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PREFIX\tKEYS")
+	for _, prefix := range slices.Sorted(maps.Keys(stats.Keys)) {
+		fmt.Fprintf(w, "%s\t%d\n", prefix, stats.Keys[prefix])
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "LSM size\t%s\n", formatBytes(stats.LSMSize))
+	fmt.Fprintf(w, "Value log size\t%s\n", formatBytes(stats.ValueLogSize))
+	fmt.Fprintf(w, "Schema version\t%d\n", stats.SchemaVersion)
+	return w.Flush()
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
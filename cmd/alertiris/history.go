@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cvhariharan/alertiris"
+)
+
+func runHistory(cfg alertiris.Config, args []string) error {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print JSON instead of a table")
+	local := fs.Bool("local", false, "open the database directly even if the admin API is configured")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: alertiris history <fingerprint>")
+	}
+	fingerprint := fs.Arg(0)
+
+	var events []alertiris.HistoryEvent
+	if cfg.Admin.Listen != "" && !*local {
+		path := "/api/alerts/" + url.PathEscape(fingerprint) + "/history"
+		if err := newAdminClient(cfg.Admin).do(http.MethodGet, path, nil, &events); err != nil {
+			return err
+		}
+	} else {
+		db, err := openDB(cfg.DB)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		if events, err = alertiris.ListHistory(db, fingerprint); err != nil {
+			return err
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(events)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tEVENT\tSINK\tCUSTOMER\tALERT ID\tDETAIL")
+	for _, e := range events {
+		detail := e.Detail
+		if e.Error != "" {
+			detail = e.Error
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n", e.Time.Format(time.RFC3339), e.Event, e.Sink, e.CustomerID, e.AlertID, detail)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/cvhariharan/alertiris"
+)
+
+// runHold switches hold mode of the running server, which stops sending to
+// IRIS and queues deliveries durably until it is switched off, e.g. for an
+// IRIS upgrade.
+func runHold(cfg alertiris.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: alertiris hold on|off|status [flags]")
+	}
+	sub := args[0]
+	fs := flag.NewFlagSet("hold "+sub, flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print JSON instead of text")
+	fs.Parse(args[1:])
+
+	if cfg.Admin.Listen == "" {
+		return errors.New("hold changes the running server and needs admin.listen")
+	}
+	client := newAdminClient(cfg.Admin)
+	var status alertiris.HoldStatus
+	var err error
+	switch sub {
+	case "on", "off":
+		err = client.send(http.MethodPut, "/api/hold", nil, alertiris.HoldStatus{Enabled: sub == "on"}, &status)
+	case "status":
+		err = client.do(http.MethodGet, "/api/hold", nil, &status)
+	default:
+		return fmt.Errorf("unknown hold command %q", sub)
+	}
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(status)
+	}
+	if status.Enabled {
+		fmt.Printf("hold mode on since %s", status.Since.Format(time.RFC3339))
+	} else {
+		fmt.Print("hold mode off")
+	}
+	if status.Window != "" {
+		fmt.Printf(", hold window %s open", status.Window)
+	}
+	fmt.Printf(", %d deliveries queued for IRIS\n", status.Held)
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/cvhariharan/alertiris"
+)
+
+func runImport(cfg alertiris.Config, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	overwrite := fs.Bool("overwrite", false, "replace mappings that already exist")
+	dryRun := fs.Bool("dry-run", false, "show what would be imported without writing")
+	asJSON := fs.Bool("json", false, "print JSON instead of a table")
+	local := fs.Bool("local", false, "open the database directly even if the admin API is configured")
+	fs.Parse(args)
+
+	var res alertiris.ImportResult
+	if cfg.Admin.Listen != "" && !*local {
+		q := url.Values{}
+		if *overwrite {
+			q.Set("overwrite", "true")
+		}
+		if *dryRun {
+			q.Set("dry_run", "true")
+		}
+		if err := newAdminClient(cfg.Admin).do(http.MethodPost, "/api/import", q, &res); err != nil {
+			return err
+		}
+	} else {
+		cfg.Record.Path = ""
+		app := alertiris.New(cfg)
+		if err := app.Start(); err != nil {
+			return err
+		}
+		defer app.Close()
+		var err error
+		if res, err = app.ImportIRIS(context.Background(), *overwrite, *dryRun); err != nil {
+			return err
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res)
+	}
+	if err := printMappings(res.Imported, false); err != nil {
+		return err
+	}
+	fmt.Printf("\n%d imported, %d already mapped, %d skipped\n", len(res.Imported), res.Existing, res.Skipped)
+	return nil
+}
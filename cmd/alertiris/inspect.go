@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cvhariharan/alertiris"
+)
+
+type inspection struct {
+	Mappings []alertiris.Mapping         `json:"mappings,omitempty"`
+	Queue    []alertiris.QueueEntry      `json:"queue,omitempty"`
+	Archive  []alertiris.ArchivedPayload `json:"archive,omitempty"`
+}
+
+// runInspect prints the state store without changing it. It opens the
+// database read-only, so the server has to be stopped or a copy inspected.
+func runInspect(cfg alertiris.Config, args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print JSON instead of tables")
+	fingerprint := fs.String("fingerprint", "", "only entries of this fingerprint")
+	sections := fs.String("sections", "mappings,queue,archive", "comma separated sections to print")
+	since := fs.String("since", "24h", "only archived payloads received after this time (RFC 3339) or duration ago")
+	path := fs.String("path", "", "database path, instead of db.path")
+	fs.Parse(args)
+
+	want := strings.Split(*sections, ",")
+	for _, s := range want {
+		if !slices.Contains([]string{"mappings", "queue", "archive"}, s) {
+			return fmt.Errorf("unknown section %q", s)
+		}
+	}
+	f := alertiris.ArchiveFilter{Fingerprint: *fingerprint}
+	var err error
+	if f.Since, err = parseTimeFlag(*since); err != nil {
+		return fmt.Errorf("-since: %w", err)
+	}
+
+	if *path != "" {
+		cfg.DB.Path = *path
+	}
+	db, err := alertiris.OpenDBReadOnly(cfg.DB)
+	if err != nil {
+		if strings.Contains(err.Error(), "directory lock") {
+			return fmt.Errorf("database %s is in use, stop the server or inspect a copy: %w", cfg.DB.Path, err)
+		}
+		return fmt.Errorf("open badger db: %w", err)
+	}
+	defer db.Close()
+
+	var out inspection
+	if slices.Contains(want, "mappings") {
+		if out.Mappings, err = alertiris.ListMappings(db, *fingerprint); err != nil {
+			return fmt.Errorf("mappings: %w", err)
+		}
+	}
+	if slices.Contains(want, "queue") {
+		if out.Queue, err = alertiris.ListQueue(db, *fingerprint); err != nil {
+			return fmt.Errorf("queue: %w", err)
+		}
+	}
+	if slices.Contains(want, "archive") {
+		if out.Archive, err = alertiris.ListArchive(db, f); err != nil {
+			return fmt.Errorf("archive: %w", err)
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	if slices.Contains(want, "mappings") {
+		fmt.Fprintf(w, "Mappings (%d)\n", len(out.Mappings))
+		fmt.Fprintln(w, "SINK\tFINGERPRINT\tCUSTOMER\tALERT ID")
+		for _, m := range out.Mappings {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", m.Sink, m.Fingerprint, m.CustomerID, m.AlertID)
+		}
+		fmt.Fprintln(w)
+	}
+	if slices.Contains(want, "queue") {
+		fmt.Fprintf(w, "Queue (%d)\n", len(out.Queue))
+		fmt.Fprintln(w, "QUEUE\tSINK\tSTATUS\tFINGERPRINT\tCUSTOMER\tATTEMPTS\tNEXT ATTEMPT\tLAST ERROR")
+		for _, q := range out.Queue {
+			next := q.NextAttempt.Format(time.RFC3339)
+			if q.Queue == "dlq" {
+				next = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%s\t%s\n", q.Queue, q.Sink, q.Status, q.Fingerprint, q.CustomerID, q.Attempts, next, q.LastError)
+		}
+		fmt.Fprintln(w)
+	}
+	if slices.Contains(want, "archive") {
+		fmt.Fprintf(w, "Archive (%d)\n", len(out.Archive))
+		fmt.Fprintln(w, "TIME\tREQUEST\tSIZE\tFINGERPRINTS")
+		for _, p := range out.Archive {
+			fmt.Fprintf(w, "%s\t%s %s\t%s\t%s\n", p.Time.Format(time.RFC3339), p.Method, p.Path, formatBytes(int64(len(p.Body))), strings.Join(p.Fingerprints, ","))
+		}
+	}
+	return w.Flush()
+}
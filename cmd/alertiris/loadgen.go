@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"maps"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cvhariharan/alertiris"
+)
+
+// loadAlertNames are the alert names generated alerts cycle through.
+var loadAlertNames = []string{
+	"HighCPUUsage", "HighMemoryUsage", "DiskSpaceLow", "NodeDown", "TargetDown",
+	"HighErrorRate", "HighLatency", "PodCrashLooping", "CertificateExpiring", "SuspiciousLogin",
+}
+
+var loadSeverities = []string{"info", "warning", "warning", "critical"}
+
+// loadOptions shape the generated traffic.
+type loadOptions struct {
+	Rate        float64
+	Duration    time.Duration
+	Count       int
+	Concurrency int
+	Alerts      int
+	Batch       int
+	ResolveRate float64
+	Labels      int
+	Cardinality int
+	Run         string
+}
+
+var loadDefaults = loadOptions{
+	Rate:        10,
+	Duration:    time.Minute,
+	Concurrency: 4,
+	Alerts:      100,
+	Batch:       1,
+	ResolveRate: 0.3,
+	Labels:      2,
+	Cardinality: 10,
+}
+
+func (o *loadOptions) flags(fs *flag.FlagSet, def loadOptions) {
+	fs.Float64Var(&o.Rate, "rate", def.Rate, "payloads per second, 0 for as fast as possible")
+	fs.DurationVar(&o.Duration, "duration", def.Duration, "stop after this long, 0 for no limit")
+	fs.IntVar(&o.Count, "count", def.Count, "stop after this many payloads, 0 for no limit")
+	fs.IntVar(&o.Concurrency, "concurrency", def.Concurrency, "payloads in flight at once")
+	fs.IntVar(&o.Alerts, "alerts", def.Alerts, "distinct alerts, each with its own fingerprint")
+	fs.IntVar(&o.Batch, "batch", def.Batch, "alerts per payload")
+	fs.Float64Var(&o.ResolveRate, "resolve-rate", def.ResolveRate, "chance a firing alert is resolved when picked again (0-1)")
+	fs.IntVar(&o.Labels, "labels", def.Labels, "extra labels per alert")
+	fs.IntVar(&o.Cardinality, "cardinality", def.Cardinality, "distinct values of each extra label")
+	fs.StringVar(&o.Run, "run", "", "value of the loadgen_run label, random by default so every run creates new alerts")
+}
+
+func (o *loadOptions) validate() error {
+	switch {
+	case o.Rate < 0:
+		return errors.New("-rate must not be negative")
+	case o.Duration == 0 && o.Count == 0:
+		return errors.New("one of -duration and -count is required")
+	case o.Concurrency < 1:
+		return errors.New("-concurrency must be at least 1")
+	case o.Alerts < 1:
+		return errors.New("-alerts must be at least 1")
+	case o.Batch < 1 || o.Batch > o.Alerts:
+		return errors.New("-batch must be between 1 and -alerts")
+	case o.ResolveRate < 0 || o.ResolveRate > 1:
+		return errors.New("-resolve-rate must be between 0 and 1")
+	case o.Labels < 0 || o.Cardinality < 1:
+		return errors.New("-labels must not be negative and -cardinality must be at least 1")
+	}
+	if o.Run == "" {
+		o.Run = strconv.FormatUint(rand.Uint64()&0xffffff, 16)
+	}
+	return nil
+}
+
+// loadAlert is one of the generated alerts. startsAt is set while it fires.
+type loadAlert struct {
+	labels   map[string]string
+	fp       string
+	startsAt time.Time
+}
+
+// loadGenerator builds Alertmanager payloads the way Alertmanager groups
+// them: each payload holds alerts sharing an alertname. Alerts fire and,
+// when picked again, resolve with ResolveRate, so the bridge sees creates,
+// updates and resolves.
+type loadGenerator struct {
+	opts   loadOptions
+	alerts []*loadAlert
+}
+
+func newLoadGenerator(opts loadOptions) *loadGenerator {
+	g := &loadGenerator{opts: opts}
+	for i := range opts.Alerts {
+		name := loadAlertNames[i%len(loadAlertNames)]
+		labels := map[string]string{
+			"alertname":   name,
+			"instance":    fmt.Sprintf("node-%03d:9100", i/len(loadAlertNames)),
+			"job":         "node",
+			"severity":    loadSeverities[i%len(loadSeverities)],
+			"cluster":     fmt.Sprintf("cluster-%d", i%3),
+			"environment": []string{"prod", "staging"}[i%2],
+			"loadgen_run": opts.Run,
+		}
+		for l := range opts.Labels {
+			labels[fmt.Sprintf("label_%d", l)] = fmt.Sprintf("value-%d", rand.IntN(opts.Cardinality))
+		}
+		g.alerts = append(g.alerts, &loadAlert{labels: labels, fp: labelsSignature(labels)})
+	}
+	return g
+}
+
+// labelsSignature is Alertmanager's fingerprint, a 64-bit FNV-1a hash of
+// the sorted label pairs.
+func labelsSignature(labels map[string]string) string {
+	h := fnv.New64a()
+	for _, k := range slices.Sorted(maps.Keys(labels)) {
+		h.Write([]byte(k))
+		h.Write([]byte{0xff})
+		h.Write([]byte(labels[k]))
+		h.Write([]byte{0xff})
+	}
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// next returns the next payload and the number of firing and resolved
+// alerts in it. It is not safe for concurrent use.
+func (g *loadGenerator) next(now time.Time) ([]byte, int, int) {
+	// Alerts with the same name are len(loadAlertNames) apart.
+	start := rand.IntN(len(g.alerts))
+	step := len(loadAlertNames)
+	if len(g.alerts) < step*g.opts.Batch {
+		step = 1
+	}
+	payload := alertiris.AlertmanagerPayload{
+		Receiver:    "alertiris",
+		Status:      "resolved",
+		ExternalURL: "http://alertmanager.loadgen:9093",
+		Version:     "4",
+	}
+	var firing, resolved int
+	seen := map[int]bool{}
+	for n := range g.opts.Batch {
+		i := (start + n*step) % len(g.alerts)
+		if seen[i] {
+			continue
+		}
+		seen[i] = true
+		a := g.alerts[i]
+		alert := alertiris.Alert{
+			Labels:       a.labels,
+			Annotations:  map[string]string{"summary": fmt.Sprintf("%s on %s", a.labels["alertname"], a.labels["instance"]), "description": "Generated by alertiris loadgen."},
+			GeneratorURL: "http://prometheus.loadgen:9090/graph?g0.expr=up",
+			Fingerprint:  a.fp,
+		}
+		if !a.startsAt.IsZero() && rand.Float64() < g.opts.ResolveRate {
+			alert.Status = "resolved"
+			alert.StartsAt = a.startsAt
+			alert.EndsAt = now
+			a.startsAt = time.Time{}
+			resolved++
+		} else {
+			if a.startsAt.IsZero() {
+				a.startsAt = now
+			}
+			alert.Status = "firing"
+			alert.StartsAt = a.startsAt
+			payload.Status = "firing"
+			firing++
+		}
+		payload.Alerts = append(payload.Alerts, alert)
+	}
+
+	first := payload.Alerts[0].Labels
+	payload.GroupLabels = map[string]string{"alertname": first["alertname"]}
+	payload.GroupKey = fmt.Sprintf(`{}:{alertname=%q}`, first["alertname"])
+	payload.CommonLabels = maps.Clone(first)
+	payload.CommonAnnotations = map[string]string{}
+	for _, alert := range payload.Alerts[1:] {
+		maps.DeleteFunc(payload.CommonLabels, func(k, v string) bool { return alert.Labels[k] != v })
+	}
+	body, _ := json.Marshal(payload)
+	return body, firing, resolved
+}
+
+// loadResult summarizes a load run. Accepted counts the alerts of payloads
+// answered with a 2xx.
+type loadResult struct {
+	Elapsed   time.Duration
+	Payloads  int
+	Firing    int
+	Resolved  int
+	Accepted  int
+	Errors    int
+	Statuses  map[int]int
+	Latencies []time.Duration
+}
+
+// runLoad posts generated payloads with post, paced at Rate, until
+// Duration or Count is reached or ctx is done. Payloads in flight when
+// Duration is up are still waited for.
+func runLoad(ctx context.Context, opts loadOptions, post func(ctx context.Context, body []byte) (int, error)) loadResult {
+	genCtx := ctx
+	if opts.Duration > 0 {
+		var cancel context.CancelFunc
+		genCtx, cancel = context.WithTimeout(ctx, opts.Duration)
+		defer cancel()
+	}
+
+	type job struct {
+		body   []byte
+		alerts int
+	}
+	jobs := make(chan job)
+	res := loadResult{Statuses: map[int]int{}}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for range opts.Concurrency {
+		wg.Go(func() {
+			for j := range jobs {
+				start := time.Now()
+				status, err := post(ctx, j.body)
+				took := time.Since(start)
+				mu.Lock()
+				if err != nil {
+					if ctx.Err() == nil {
+						res.Errors++
+					}
+				} else {
+					res.Statuses[status]++
+					if status >= 200 && status < 300 {
+						res.Accepted += j.alerts
+					}
+					res.Latencies = append(res.Latencies, took)
+				}
+				mu.Unlock()
+			}
+		})
+	}
+
+	gen := newLoadGenerator(opts)
+	var tick <-chan time.Time
+	if opts.Rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / opts.Rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	start := time.Now()
+loop:
+	for opts.Count == 0 || res.Payloads < opts.Count {
+		if tick != nil {
+			select {
+			case <-genCtx.Done():
+				break loop
+			case <-tick:
+			}
+		}
+		body, firing, resolved := gen.next(time.Now())
+		select {
+		case <-genCtx.Done():
+			break loop
+		case jobs <- job{body: body, alerts: firing + resolved}:
+		}
+		res.Payloads++
+		res.Firing += firing
+		res.Resolved += resolved
+	}
+	close(jobs)
+	wg.Wait()
+	res.Elapsed = time.Since(start)
+	return res
+}
+
+// percentile returns the p-th percentile of sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[min(len(sorted)-1, int(float64(len(sorted))*p))]
+}
+
+func (r loadResult) print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	secs := r.Elapsed.Seconds()
+	fmt.Fprintf(tw, "duration\t%s\n", r.Elapsed.Round(time.Millisecond))
+	fmt.Fprintf(tw, "payloads\t%d (%.1f/s)\n", r.Payloads, float64(r.Payloads)/secs)
+	fmt.Fprintf(tw, "alerts\t%d (%.1f/s), %d firing, %d resolved\n", r.Firing+r.Resolved, float64(r.Firing+r.Resolved)/secs, r.Firing, r.Resolved)
+	for _, code := range slices.Sorted(maps.Keys(r.Statuses)) {
+		fmt.Fprintf(tw, "status %d\t%d\n", code, r.Statuses[code])
+	}
+	if r.Errors > 0 {
+		fmt.Fprintf(tw, "errors\t%d\n", r.Errors)
+	}
+	lat := slices.Sorted(slices.Values(r.Latencies))
+	if len(lat) > 0 {
+		fmt.Fprintf(tw, "latency\tp50 %s, p90 %s, p99 %s, max %s\n", percentile(lat, 0.5), percentile(lat, 0.9), percentile(lat, 0.99), lat[len(lat)-1])
+	}
+	return tw.Flush()
+}
+
+// runLoadgen sends generated Alertmanager payloads to a running bridge for
+// capacity testing.
+func runLoadgen(args []string) error {
+	fs := flag.NewFlagSet("loadgen", flag.ExitOnError)
+	target := fs.String("url", "http://127.0.0.1:8080/webhook", "webhook URL to send the payloads to")
+	headers := http.Header{}
+	fs.Func("header", "extra request header as \"Name: value\", repeatable", func(s string) error {
+		name, value, ok := strings.Cut(s, ":")
+		if !ok {
+			return errors.New("want Name: value")
+		}
+		headers.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+		return nil
+	})
+	var opts loadOptions
+	opts.flags(fs, loadDefaults)
+	fs.Parse(args)
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	post := func(ctx context.Context, body []byte) (int, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, *target, bytes.NewReader(body))
+		if err != nil {
+			return 0, err
+		}
+		req.Header = headers.Clone()
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+
+	fmt.Fprintf(os.Stderr, "sending to %s, run %s\n", *target, opts.Run)
+	return runLoad(ctx, opts, post).print(os.Stdout)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/cvhariharan/alertiris"
+)
+
+const usage = `usage: alertiris [command]
+
+commands:
+  serve                  run the bridge (default)
+  mappings list          list fingerprint to alert mappings
+  mappings get <fp>      show the mappings of a fingerprint
+  mappings delete <fp>   delete the mappings of a fingerprint
+  history <fp>           show what the bridge did with a fingerprint
+  sync <fp>              resend the last payload of a fingerprint
+  import                 seed mappings from the open alerts in IRIS
+  db stats               show key counts and database sizes
+  db compact             compact the database and reclaim space
+  hold on|off|status     pause sending to IRIS, queuing deliveries, or resume
+  replay <file>          feed recorded webhooks through the pipeline
+  archive                dump archived raw webhooks as JSON lines
+  inspect                print mappings, queues and archive read-only
+  selftest               send a test alert through the bridge and check IRIS
+  loadgen                send generated Alertmanager payloads for load testing
+  bench                  measure throughput and latency against a mock IRIS
+  mock-iris              run a fake IRIS alert API for testing
+  version, --version     print version information
+
+The configuration is read from $ALERTIRIS_CONFIG (default config.toml).
+`
+
+func main() {
+	cmd, args := "serve", []string(nil)
+	if len(os.Args) > 1 {
+		cmd, args = os.Args[1], os.Args[2:]
+	}
+
+	var err error
+	switch cmd {
+	case "serve":
+		serve(loadConfig())
+	case "mappings":
+		err = runMappings(loadConfig(), args)
+	case "history":
+		err = runHistory(loadConfig(), args)
+	case "sync":
+		err = runSync(loadConfig(), args)
+	case "import":
+		err = runImport(loadConfig(), args)
+	case "db":
+		err = runDB(loadConfig(), args)
+	case "hold":
+		err = runHold(loadConfig(), args)
+	case "replay":
+		err = runReplay(loadConfig(), args)
+	case "archive":
+		err = runArchive(loadConfig(), args)
+	case "inspect":
+		err = runInspect(loadConfig(), args)
+	case "selftest":
+		err = runSelfTest(loadConfig(), args)
+	case "loadgen":
+		err = runLoadgen(args)
+	case "bench":
+		err = runBench(loadConfig(), args)
+	case "mock-iris":
+		err = runMockIRIS(args)
+	case "version", "-version", "--version":
+		info := alertiris.GetBuildInfo()
+		fmt.Printf("alertiris %s (commit %s, built %s, %s)\n", info.Version, info.Commit, info.BuildDate, info.GoVersion)
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func loadConfig() alertiris.Config {
+	configPath := "config.toml"
+	if p := os.Getenv("ALERTIRIS_CONFIG"); p != "" {
+		configPath = p
+	}
+
+	cfg, err := alertiris.LoadConfig(configPath)
+	if err != nil {
+		slog.Error("failed to load config", "error", err)
+		os.Exit(1)
+	}
+	return cfg
+}
+
+func serve(cfg alertiris.Config) {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := alertiris.New(cfg).Run(ctx); err != nil {
+		slog.Error("alertiris stopped", "error", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/cvhariharan/alertiris"
+	"github.com/dgraph-io/badger/v4"
+)
+
+func runMappings(cfg alertiris.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: alertiris mappings list|get|delete [flags] [fingerprint]")
+	}
+	sub := args[0]
+
+	fs := flag.NewFlagSet("mappings "+sub, flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print JSON instead of a table")
+	sink := fs.String("sink", "", "only delete the mapping of this sink")
+	customer := fs.Int("customer", 0, "only delete the mapping of this customer ID")
+	local := fs.Bool("local", false, "open the database directly even if the admin API is configured")
+	fs.Parse(args[1:])
+
+	fingerprint := fs.Arg(0)
+	if sub != "list" && fingerprint == "" {
+		return fmt.Errorf("usage: alertiris mappings %s [flags] <fingerprint>", sub)
+	}
+
+	var (
+		mappings []alertiris.Mapping
+		err      error
+	)
+	if cfg.Admin.Listen != "" && !*local {
+		mappings, err = newAdminClient(cfg.Admin).mappings(sub, fingerprint, *sink, *customer)
+		if err != nil {
+			return err
+		}
+		return printMappings(mappings, *asJSON)
+	}
+
+	db, err := openDB(cfg.DB)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch sub {
+	case "list":
+		mappings, err = alertiris.ListMappings(db, "")
+	case "get":
+		mappings, err = alertiris.ListMappings(db, fingerprint)
+		if err == nil && len(mappings) == 0 {
+			return fmt.Errorf("no mappings for %s", fingerprint)
+		}
+	case "delete":
+		mappings, err = alertiris.DeleteMappings(db, fingerprint, *sink, *customer)
+		if err == nil && len(mappings) == 0 {
+			return fmt.Errorf("no matching mappings for %s", fingerprint)
+		}
+	default:
+		return fmt.Errorf("unknown mappings command %q", sub)
+	}
+	if err != nil {
+		return err
+	}
+	return printMappings(mappings, *asJSON)
+}
+
+func openDB(cfg alertiris.DBConfig) (*badger.DB, error) {
+	if cfg.Path == "" {
+		return nil, errors.New("db.path is not set")
+	}
+	db, err := alertiris.OpenDB(cfg)
+	if err != nil {
+		if strings.Contains(err.Error(), "directory lock") {
+			return nil, fmt.Errorf("database %s is in use, stop the server first: %w", cfg.Path, err)
+		}
+		return nil, fmt.Errorf("open badger db: %w", err)
+	}
+	if err := alertiris.MigrateDB(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate badger db: %w", err)
+	}
+	return db, nil
+}
+
+func printMappings(mappings []alertiris.Mapping, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(mappings)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SINK\tFINGERPRINT\tCUSTOMER\tALERT ID")
+	for _, m := range mappings {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", m.Sink, m.Fingerprint, m.CustomerID, m.AlertID)
+	}
+	return w.Flush()
+}
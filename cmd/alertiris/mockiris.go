@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/cvhariharan/alertiris/mockiris"
+)
+
+func runMockIRIS(args []string) error {
+	fs := flag.NewFlagSet("mock-iris", flag.ExitOnError)
+	listen := fs.String("listen", "127.0.0.1:8000", "address to listen on")
+	var opts mockiris.Options
+	fs.StringVar(&opts.APIKey, "api-key", "", "require this API key as a bearer token")
+	fs.Float64Var(&opts.ErrorRate, "error-rate", 0, "fraction of requests answered with a 500 (0-1)")
+	fs.DurationVar(&opts.Latency, "latency", 0, "delay added to every request")
+	fs.DurationVar(&opts.Jitter, "jitter", 0, "random extra delay up to this duration")
+	fs.Parse(args)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	srv := &http.Server{Addr: *listen, Handler: mockiris.New(opts)}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("starting mock iris", "listen", *listen)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
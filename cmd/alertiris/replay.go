@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cvhariharan/alertiris"
+)
+
+// runReplay feeds recorded webhooks back through the pipeline, either in
+// process with the configured sinks and state store, or by posting them to a
+// running server.
+func runReplay(cfg alertiris.Config, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	target := fs.String("url", "", "send the requests to a running server at this base URL instead")
+	realtime := fs.Bool("realtime", false, "keep the original delays between requests")
+	headers := http.Header{}
+	fs.Func("header", "with -url, add this \"Name: value\" header to every request, e.g. credentials; repeatable", func(v string) error {
+		name, value, ok := strings.Cut(v, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return fmt.Errorf("want Name: value, got %q", v)
+		}
+		headers.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+		return nil
+	})
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: alertiris replay [-url http://host:port] [-header 'Name: value'] [-realtime] <file>")
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var serve func(alertiris.Recording) (int, error)
+	if *target != "" {
+		client := &http.Client{Timeout: 30 * time.Second}
+		base := strings.TrimRight(*target, "/")
+		serve = func(rec alertiris.Recording) (int, error) {
+			u := base + rec.Path
+			if rec.Query != "" {
+				u += "?" + rec.Query
+			}
+			req, err := http.NewRequest(rec.Method, u, bytes.NewReader(rec.Body))
+			if err != nil {
+				return 0, err
+			}
+			// Recordings hold no credentials, so they are added from -header.
+			req.Header = rec.Headers.Clone()
+			for name, values := range headers {
+				req.Header[name] = values
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				return 0, err
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			return resp.StatusCode, nil
+		}
+	} else {
+		// Replayed requests must not be recorded or archived again.
+		cfg.Record.Path = ""
+		cfg.Archive.Retention = 0
+		cfg.Archive.S3.Bucket = ""
+		// Recordings hold no credentials; they were authenticated when
+		// recorded.
+		cfg.Server.Auth = nil
+		app := alertiris.New(cfg)
+		if err := app.Start(); err != nil {
+			return err
+		}
+		defer app.Close()
+		serve = func(rec alertiris.Recording) (int, error) {
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, rec.Request())
+			return w.Code, nil
+		}
+	}
+
+	var last time.Time
+	count := 0
+	err = alertiris.ReadRecordings(f, func(rec alertiris.Recording) error {
+		if *realtime && !last.IsZero() && rec.Time.After(last) {
+			time.Sleep(rec.Time.Sub(last))
+		}
+		last = rec.Time
+
+		status, err := serve(rec)
+		if err != nil {
+			return fmt.Errorf("replay %s %s: %w", rec.Method, rec.Path, err)
+		}
+		count++
+		fmt.Printf("%s %s %s -> %d\n", rec.Time.Format(time.RFC3339), rec.Method, rec.Path, status)
+		return nil
+	})
+	fmt.Printf("replayed %d requests\n", count)
+	return err
+}
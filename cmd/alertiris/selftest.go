@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cvhariharan/alertiris"
+	"github.com/cvhariharan/alertiris/mockiris"
+)
+
+// runSelfTest sends a synthetic alert, firing and then resolved, through an
+// in-process bridge and checks the result in IRIS. The state is kept in
+// memory, so it can run next to a live server, and the pipeline is reduced
+// to the iris sink with nothing that would hold the alert back.
+func runSelfTest(cfg alertiris.Config, args []string) error {
+	fs := flag.NewFlagSet("selftest", flag.ExitOnError)
+	mock := fs.Bool("mock", false, "test against an in-process mock IRIS instead of the configured one")
+	timeout := fs.Duration("timeout", 2*time.Minute, "give up after this long")
+	asJSON := fs.Bool("json", false, "print JSON instead of a table")
+	fs.Parse(args)
+
+	if *mock {
+		srv := httptest.NewServer(mockiris.New(mockiris.Options{APIKey: cfg.IRIS.APIKey}))
+		defer srv.Close()
+		cfg.IRIS.URL = srv.URL
+	}
+	cfg.DB.Path = ""
+	cfg.Admin.Listen = ""
+	cfg.Record.Path = ""
+	cfg.Archive.Retention = 0
+	cfg.Archive.S3.Bucket = ""
+	cfg.Alerts.Sinks = []string{"iris"}
+	cfg.Alerts.Queue = alertiris.QueueConfig{}
+	cfg.Alerts.OccurrenceThreshold = 0
+	cfg.Alerts.MaintenanceWindows = nil
+	cfg.Alerts.HoldWindows = nil
+
+	app := alertiris.New(cfg)
+	if err := app.Start(); err != nil {
+		return err
+	}
+	defer app.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	report := app.SmokeTest(ctx)
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, c := range report.Checks {
+			result := "ok"
+			if !c.OK {
+				result = "FAIL"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", c.Name, result, c.Detail)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	if !report.OK {
+		return errors.New("self-test failed")
+	}
+	fmt.Fprintf(os.Stderr, "self-test passed in %s\n", report.Duration)
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/cvhariharan/alertiris"
+)
+
+// runSync forces the last payload of a fingerprint through the pipeline, on
+// the running server when the admin API is configured and in process
+// otherwise.
+func runSync(cfg alertiris.Config, args []string) error {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	recreate := fs.Bool("recreate", false, "drop the existing mappings so the alert is created again")
+	sink := fs.String("sink", "", "with -recreate, only recreate the alert in this sink")
+	customer := fs.Int("customer", 0, "sync the payload of this customer when the fingerprint has several")
+	asJSON := fs.Bool("json", false, "print JSON instead of a table")
+	local := fs.Bool("local", false, "open the database directly even if the admin API is configured")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: alertiris sync [-recreate] [-sink name] [-customer id] <fingerprint>")
+	}
+	fingerprint := fs.Arg(0)
+
+	var mappings []alertiris.Mapping
+	if cfg.Admin.Listen != "" && !*local {
+		q := url.Values{}
+		if *recreate {
+			q.Set("recreate", "true")
+		}
+		if *sink != "" {
+			q.Set("sink", *sink)
+		}
+		if *customer != 0 {
+			q.Set("customer", strconv.Itoa(*customer))
+		}
+		err := newAdminClient(cfg.Admin).do(http.MethodPost, "/api/sync/"+url.PathEscape(fingerprint), q, &mappings)
+		if err != nil {
+			return err
+		}
+		return printMappings(mappings, *asJSON)
+	}
+
+	cfg.Record.Path = ""
+	app := alertiris.New(cfg)
+	if err := app.Start(); err != nil {
+		return err
+	}
+	defer app.Close()
+	mappings, err := app.Sync(context.Background(), fingerprint, *sink, *customer, *recreate)
+	if err != nil {
+		return err
+	}
+	return printMappings(mappings, *asJSON)
+}
@@ -0,0 +1,256 @@
+package alertiris
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// CommentsConfig enables the comment sync. New comments on IRIS alerts are
+// posted to the Notify notifiers every Interval; comments sent to the admin
+// API are appended to the IRIS alert note.
+type CommentsConfig struct {
+	Interval time.Duration `koanf:"interval"`
+	Notify   []string      `koanf:"notify"`
+}
+
+func validateComments(cfg CommentsConfig, sinks map[string]Sink, notifier *Notifier) error {
+	if cfg.Interval <= 0 {
+		return nil
+	}
+	if _, ok := sinks["iris"].(*irisSink); !ok {
+		return fmt.Errorf("comment sync requires the iris sink")
+	}
+	if len(cfg.Notify) == 0 {
+		return fmt.Errorf("notify is required")
+	}
+	for _, n := range cfg.Notify {
+		if !notifier.has(n) {
+			return fmt.Errorf("unknown notifier %q", n)
+		}
+	}
+	return nil
+}
+
+// commentKey holds the ID of the last comment pushed for an alert.
+func commentKey(fingerprint string, customerID int) []byte {
+	return []byte("cmt:" + fingerprint + ":" + strconv.Itoa(customerID))
+}
+
+func (h *Handler) runComments(ctx context.Context) {
+	ticker := time.NewTicker(h.config.Comments.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if h.held() {
+				continue
+			}
+			if err := h.processComments(ctx); err != nil {
+				slog.Error("failed to sync comments", "error", err)
+			}
+		}
+	}
+}
+
+// processComments pushes the comments added to IRIS alerts since the last
+// run. Alerts seen for the first time only record their latest comment, so
+// enabling the sync does not replay old comments.
+func (h *Handler) processComments(ctx context.Context) error {
+	s := h.sinks["iris"].(*irisSink)
+	mappings, err := ListMappings(h.db, "")
+	if err != nil {
+		return fmt.Errorf("list mappings: %w", err)
+	}
+	for _, m := range mappings {
+		if m.Sink != "iris" {
+			continue
+		}
+		id, err := strconv.Atoi(m.AlertID)
+		if err != nil {
+			continue
+		}
+		log := slog.With("fingerprint", m.Fingerprint, "alert_id", m.AlertID)
+
+		lastID, seen, err := h.lastCommentID(m.Fingerprint, m.CustomerID)
+		if err != nil {
+			log.Warn("failed to load comment state", "error", err)
+			continue
+		}
+		comments, err := s.client.ListAlertComments(ctx, id, m.CustomerID)
+		if err != nil {
+			log.Warn("failed to list alert comments", "error", err)
+			continue
+		}
+
+		var title, severity string
+		latest := lastID
+		for _, c := range comments {
+			if c.ID <= lastID {
+				continue
+			}
+			latest = max(latest, c.ID)
+			if !seen {
+				continue
+			}
+			if title == "" {
+				title = m.Fingerprint
+				if a, err := s.client.GetAlert(ctx, id, m.CustomerID); err == nil {
+					title, severity = a.Title, strconv.Itoa(a.SeverityID)
+				}
+			}
+			author := c.User.Name
+			if author == "" {
+				author = c.User.Login
+			}
+			h.notifier.NotifyChannels(h.config.Comments.Notify, Notification{
+				Event:       "commented",
+				Title:       title,
+				Severity:    severity,
+				Fingerprint: m.Fingerprint,
+				CustomerID:  m.CustomerID,
+				AlertID:     m.AlertID,
+				Link:        h.notifier.AlertLink(m.AlertID, m.CustomerID),
+				Text:        fmt.Sprintf("%s: %s", author, c.Text),
+			})
+			log.Info("pushed iris comment", "comment_id", c.ID)
+		}
+		if latest != lastID || !seen {
+			if err := h.storeCommentID(m.Fingerprint, m.CustomerID, latest); err != nil {
+				log.Warn("failed to store comment state", "error", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (h *Handler) lastCommentID(fingerprint string, customerID int) (int, bool, error) {
+	id, seen := 0, false
+	err := h.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(commentKey(fingerprint, customerID))
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		seen = true
+		return item.Value(func(val []byte) error {
+			id, err = strconv.Atoi(string(val))
+			return err
+		})
+	})
+	return id, seen, err
+}
+
+func (h *Handler) storeCommentID(fingerprint string, customerID, id int) error {
+	return h.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(commentKey(fingerprint, customerID), []byte(strconv.Itoa(id)))
+	})
+}
+
+// startComments marks a new alert so its first comments are pushed.
+func (h *Handler) startComments(fingerprint string, customerID int) error {
+	if h.config.Comments.Interval <= 0 {
+		return nil
+	}
+	return h.storeCommentID(fingerprint, customerID, 0)
+}
+
+func (h *Handler) clearComments(fingerprint string, customerID int) error {
+	return h.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(commentKey(fingerprint, customerID))
+	})
+}
+
+type commentRequest struct {
+	Author     string `json:"author"`
+	Text       string `json:"text"`
+	CustomerID int    `json:"customer_id"`
+}
+
+// AddComment appends a comment to the note of the IRIS alerts of
+// fingerprint, optionally only the one of customerID, and returns the
+// updated mappings.
+func (h *Handler) AddComment(ctx context.Context, fingerprint string, customerID int, author, text string) ([]Mapping, error) {
+	s, ok := h.sinks["iris"].(*irisSink)
+	if !ok {
+		return nil, fmt.Errorf("the iris sink is not configured")
+	}
+	mappings, err := ListMappings(h.db, fingerprint)
+	if err != nil {
+		return nil, err
+	}
+
+	line := fmt.Sprintf("[%s] %s", h.formatTime(time.Now()), text)
+	if author != "" {
+		line = fmt.Sprintf("[%s] %s: %s", h.formatTime(time.Now()), author, text)
+	}
+	var updated []Mapping
+	var errs []error
+	for _, m := range mappings {
+		if m.Sink != "iris" || (customerID != 0 && m.CustomerID != customerID) {
+			continue
+		}
+		id, err := strconv.Atoi(m.AlertID)
+		if err != nil {
+			continue
+		}
+		if err := appendNote(ctx, s.client, id, m.CustomerID, line); err != nil {
+			errs = append(errs, fmt.Errorf("alert %s: %w", m.AlertID, err))
+			continue
+		}
+		slog.Info("added comment to alert note", "fingerprint", fingerprint, "alert_id", m.AlertID, "author", author)
+		updated = append(updated, m)
+	}
+	return updated, errors.Join(errs...)
+}
+
+// appendNote adds a line to the note of an IRIS alert.
+func appendNote(ctx context.Context, client *IRISClient, alertID, cid int, line string) error {
+	a, err := client.GetAlert(ctx, alertID, cid)
+	if err != nil {
+		return fmt.Errorf("get alert: %w", err)
+	}
+	note := strings.TrimRight(a.Note, "\n")
+	if note != "" {
+		note += "\n"
+	}
+	note += line
+	if err := client.UpdateAlert(ctx, alertID, IRISAlertUpdateRequest{Note: &note}, cid); err != nil {
+		return fmt.Errorf("update alert: %w", err)
+	}
+	return nil
+}
+
+func (h *Handler) adminAddComment(w http.ResponseWriter, r *http.Request) {
+	var req commentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("decode request: %w", err))
+		return
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		writeError(w, http.StatusBadRequest, errors.New("text is required"))
+		return
+	}
+	updated, err := h.AddComment(r.Context(), r.PathValue("fingerprint"), req.CustomerID, req.Author, req.Text)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	if len(updated) == 0 {
+		writeError(w, http.StatusNotFound, errors.New("no iris alert for fingerprint"))
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
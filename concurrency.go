@@ -0,0 +1,68 @@
+package alertiris
+
+import (
+	"context"
+	"sync"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// sourceLimits caps the webhooks of each source or URL token that are
+// queued or being processed, so a flood from one producer cannot take all
+// the workers and queue space from the others.
+type sourceLimits struct {
+	mu       sync.Mutex
+	limits   map[string]int
+	inflight map[string]int
+}
+
+func newSourceLimits(limits map[string]int) *sourceLimits {
+	return &sourceLimits{limits: limits, inflight: make(map[string]int)}
+}
+
+func sourceLimited(endpoint string) *metrics.Counter {
+	return metrics.GetOrCreateCounter(`alertiris_source_limited_total{endpoint="` + endpoint + `"}`)
+}
+
+func sourceInflight(endpoint string) *metrics.Gauge {
+	return metrics.GetOrCreateGauge(`alertiris_source_inflight{endpoint="`+endpoint+`"}`, nil)
+}
+
+// acquire takes a slot of the source and of the URL token the request came
+// in through, when they have a limit. It returns the function giving them
+// back, or the name of the endpoint at its limit.
+func (l *sourceLimits) acquire(ctx context.Context, source string) (func(), string) {
+	if l == nil {
+		return func() {}, ""
+	}
+	names := []string{source}
+	if t := tokenFrom(ctx); t != nil {
+		names = append(names, t.Name)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var held []string
+	for _, name := range names {
+		limit, ok := l.limits[name]
+		if !ok {
+			continue
+		}
+		if l.inflight[name] >= limit {
+			return nil, name
+		}
+		held = append(held, name)
+	}
+	for _, name := range held {
+		l.inflight[name]++
+		sourceInflight(name).Set(float64(l.inflight[name]))
+	}
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for _, name := range held {
+			l.inflight[name]--
+			sourceInflight(name).Set(float64(l.inflight[name]))
+		}
+	}, ""
+}
@@ -0,0 +1,338 @@
+package alertiris
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/knadh/koanf/parsers/toml"
+	"github.com/knadh/koanf/providers/confmap"
+	"github.com/knadh/koanf/providers/env"
+	"github.com/knadh/koanf/providers/file"
+	"github.com/knadh/koanf/v2"
+)
+
+type ServerConfig struct {
+	Listen string           `koanf:"listen"`
+	Tokens []URLTokenConfig `koanf:"tokens"`
+
+	// TLSCertFile and TLSKeyFile serve the webhook listener over TLS.
+	// ClientCAFile verifies client certificates for endpoints using mtls.
+	TLSCertFile  string `koanf:"tls_cert_file"`
+	TLSKeyFile   string `koanf:"tls_key_file"`
+	ClientCAFile string `koanf:"client_ca_file"`
+
+	// Auth is the authentication required per endpoint, by source or URL
+	// token name. Endpoints not listed need none.
+	Auth map[string]EndpointAuthConfig `koanf:"auth"`
+
+	// MaxBodyBytes limits webhook bodies; larger ones are refused with a
+	// 413. Zero is unlimited.
+	MaxBodyBytes int64 `koanf:"max_body_bytes"`
+}
+
+type IRISConfig struct {
+	URL           string `koanf:"url"`
+	APIKey        string `koanf:"api_key"`
+	SkipTLSVerify bool   `koanf:"skip_tls_verify"`
+
+	// AuthHeader and AuthScheme carry the API key, "Authorization: Bearer
+	// <key>" by default. An empty AuthScheme sends the bare key. Headers are
+	// added to every request, e.g. for a reverse proxy in front of IRIS.
+	AuthHeader string            `koanf:"auth_header"`
+	AuthScheme string            `koanf:"auth_scheme"`
+	Headers    map[string]string `koanf:"headers"`
+
+	// Timeout limits each request to IRIS. Zero disables it.
+	Timeout time.Duration   `koanf:"timeout"`
+	Retry   IRISRetryConfig `koanf:"retry"`
+
+	// StartupCheck runs the self-test when the bridge starts: "strict"
+	// refuses to start when a check fails, "lenient" logs the failures and
+	// "off" skips it.
+	StartupCheck string `koanf:"startup_check"`
+
+	// Connection pool tuning. Zero values keep Go's defaults.
+	MaxIdleConns        int           `koanf:"max_idle_conns"`
+	MaxIdleConnsPerHost int           `koanf:"max_idle_conns_per_host"`
+	IdleConnTimeout     time.Duration `koanf:"idle_conn_timeout"`
+	TLSHandshakeTimeout time.Duration `koanf:"tls_handshake_timeout"`
+	DisableHTTP2        bool          `koanf:"disable_http2"`
+
+	// Faults injects artificial failures for resilience testing.
+	Faults FaultConfig `koanf:"faults"`
+}
+
+// IRISRetryConfig controls how often a request failing with a transient
+// error is sent to IRIS before the error is returned.
+type IRISRetryConfig struct {
+	Attempts       int           `koanf:"attempts"`
+	InitialBackoff time.Duration `koanf:"initial_backoff"`
+	MaxBackoff     time.Duration `koanf:"max_backoff"`
+}
+
+type DBConfig struct {
+	Path string `koanf:"path"`
+
+	// The state store is encrypted with AES when a key is set, read from
+	// EncryptionKeyFile or the environment variable EncryptionKeyEnv. The
+	// data keys derived from it are rotated every EncryptionKeyRotation.
+	EncryptionKeyFile     string        `koanf:"encryption_key_file"`
+	EncryptionKeyEnv      string        `koanf:"encryption_key_env"`
+	EncryptionKeyRotation time.Duration `koanf:"encryption_key_rotation"`
+}
+
+type AlertConfig struct {
+	Source            string                   `koanf:"source"`
+	CustomerID        int                      `koanf:"customer_id"`
+	ClassificationID  int                      `koanf:"classification_id"`
+	StatusIDNew       int                      `koanf:"status_id_new"`
+	StatusIDResolved  int                      `koanf:"status_id_resolved"`
+	ResolvedAction    string                   `koanf:"resolved_action"`
+	DefaultSeverityID int                      `koanf:"default_severity_id"`
+	SeverityMap       map[string]int           `koanf:"severity_map"`
+	SeverityOverrides []SeverityOverrideConfig `koanf:"severity_overrides"`
+	UnknownSeverity   UnknownSeverityConfig    `koanf:"unknown_severity"`
+	GroupCustomerMap  map[string]int           `koanf:"group_customer_map"`
+	CustomerRules     []CustomerRuleConfig     `koanf:"customer_rules"`
+	Ownership         OwnershipConfig          `koanf:"ownership"`
+
+	// ActiveAlertsInterval is how often the active alert gauges are
+	// recounted from the state store. Zero disables them.
+	ActiveAlertsInterval time.Duration `koanf:"active_alerts_interval"`
+
+	// LatencySLO counts deliveries taking longer from webhook receipt to
+	// the sink accepting them. Zero disables the count.
+	LatencySLO time.Duration `koanf:"latency_slo"`
+
+	// StatusIDMap maps IRIS severity IDs to the status new alerts are
+	// created with instead of StatusIDNew.
+	StatusIDMap map[string]int `koanf:"status_id_map"`
+
+	// ResolutionStatusID is set as alert_resolution_status_id when an
+	// alert is resolved, e.g. "Not applicable". Zero leaves it unset.
+	ResolutionStatusID int `koanf:"resolution_status_id"`
+
+	Timezone          string             `koanf:"timezone"`
+	TimeFormat        string             `koanf:"time_format"`
+	DescriptionFields []DescriptionField `koanf:"description_fields"`
+	Templates         TemplatesConfig    `koanf:"templates"`
+	Runbook           RunbookConfig      `koanf:"runbook"`
+
+	OccurrenceThreshold int           `koanf:"occurrence_threshold"`
+	OccurrenceWindow    time.Duration `koanf:"occurrence_window"`
+
+	SourceContent SourceContentConfig `koanf:"source_content"`
+	IOCs          IOCConfig           `koanf:"iocs"`
+	Enrichment    EnrichmentConfig    `koanf:"enrichment"`
+	Assets        AssetConfig         `koanf:"assets"`
+	Kubernetes    KubernetesConfig    `koanf:"kubernetes"`
+	Prometheus    PrometheusConfig    `koanf:"prometheus"`
+	Loki          LokiConfig          `koanf:"loki"`
+	Traces        TracesConfig        `koanf:"traces"`
+
+	// ChangeNotes notes what changed on the IRIS alert when it is updated.
+	ChangeNotes bool `koanf:"change_notes"`
+	// RequestIDNote notes the ID of the request that created the IRIS
+	// alert, to find its logs and archived payload.
+	RequestIDNote bool `koanf:"request_id_note"`
+	// MergeTags keeps the tags already on an IRIS alert when updating it.
+	MergeTags bool `koanf:"merge_tags"`
+
+	Tags TagsConfig `koanf:"tags"`
+
+	LastPayloadTTL time.Duration `koanf:"last_payload_ttl"`
+	HistoryTTL     time.Duration `koanf:"history_ttl"`
+
+	RepeatEscalation RepeatEscalationConfig `koanf:"repeat_escalation"`
+
+	MaintenanceWindows []MaintenanceWindowConfig `koanf:"maintenance_windows"`
+	HoldWindows        []HoldWindowConfig        `koanf:"hold_windows"`
+	TimeRules          []TimeRuleConfig          `koanf:"time_rules"`
+
+	Escalation  EscalationConfig  `koanf:"escalation"`
+	Correlation CorrelationConfig `koanf:"correlation"`
+	Ack         AckConfig         `koanf:"acknowledgement"`
+	Comments    CommentsConfig    `koanf:"comments"`
+
+	Redaction RedactionConfig `koanf:"redaction"`
+	Transform TransformConfig `koanf:"transform"`
+	Wasm      []WasmConfig    `koanf:"wasm"`
+	Lua       LuaConfig       `koanf:"lua"`
+
+	Sinks    []string    `koanf:"sinks"`
+	Pipeline []string    `koanf:"pipeline"`
+	Retry    RetryConfig `koanf:"retry"`
+	Queue    QueueConfig `koanf:"queue"`
+
+	// Parallelism is how many alerts of one payload are processed at once.
+	Parallelism int `koanf:"parallelism"`
+}
+
+type Config struct {
+	Admin        AdminConfig        `koanf:"admin"`
+	Server       ServerConfig       `koanf:"server"`
+	IRIS         IRISConfig         `koanf:"iris"`
+	Alertmanager AlertmanagerConfig `koanf:"alertmanager"`
+	Grafana      GrafanaConfig      `koanf:"grafana"`
+	DB           DBConfig           `koanf:"db"`
+	Alerts       AlertConfig        `koanf:"alerts"`
+	TheHive      TheHiveConfig      `koanf:"thehive"`
+	Plugins      []PluginConfig     `koanf:"plugins"`
+	Notifiers    []NotifierConfig   `koanf:"notifiers"`
+	FileSink     FileSinkConfig     `koanf:"file_sink"`
+	Routes       []RouteConfig      `koanf:"routes"`
+	Record       RecordConfig       `koanf:"record"`
+	Archive      ArchiveConfig      `koanf:"archive"`
+	Profiling    ProfilingConfig    `koanf:"profiling"`
+}
+
+// LoadConfig returns the configuration with defaults applied, overridden by
+// the TOML file at path (if any) and ALERTIRIS_ environment variables.
+func LoadConfig(path string) (Config, error) {
+	k := koanf.New(".")
+
+	k.Load(confmap.Provider(map[string]any{
+		"server.listen":                               ":8080",
+		"server.max_body_bytes":                       10 << 20,
+		"archive.s3.interval":                         "1m",
+		"archive.s3.batch_size":                       1000,
+		"archive.s3.timeout":                          "30s",
+		"profiling.for":                               "2m",
+		"profiling.cpu_duration":                      "30s",
+		"profiling.min_interval":                      "1h",
+		"db.encryption_key_rotation":                  "240h",
+		"iris.auth_header":                            "Authorization",
+		"iris.auth_scheme":                            "Bearer",
+		"iris.retry.attempts":                         3,
+		"iris.retry.initial_backoff":                  "500ms",
+		"iris.retry.max_backoff":                      "5s",
+		"iris.startup_check":                          "lenient",
+		"iris.timeout":                                "30s",
+		"iris.max_idle_conns":                         100,
+		"iris.max_idle_conns_per_host":                32,
+		"iris.idle_conn_timeout":                      "90s",
+		"iris.tls_handshake_timeout":                  "10s",
+		"iris.faults.status":                          503,
+		"db.path":                                     "./data/badger",
+		"alerts.source":                               "alertmanager",
+		"alerts.customer_id":                          1,
+		"alerts.status_id_new":                        2,
+		"alerts.status_id_resolved":                   6,
+		"alerts.resolved_action":                      "update",
+		"alerts.default_severity_id":                  4,
+		"alerts.timezone":                             "UTC",
+		"alerts.time_format":                          "2006-01-02 15:04:05 MST",
+		"alerts.templates.reload":                     "10s",
+		"alerts.occurrence_threshold":                 1,
+		"alerts.occurrence_window":                    "1h",
+		"alerts.last_payload_ttl":                     "168h",
+		"alerts.request_id_note":                      true,
+		"alerts.merge_tags":                           true,
+		"alerts.tags.format":                          "key=value",
+		"alerts.tags.replacement":                     "_",
+		"alerts.history_ttl":                          "720h",
+		"alerts.repeat_escalation.max_severity_id":    6,
+		"alerts.ownership.annotations":                []string{"owner", "team"},
+		"alerts.traces.trace_labels":                  []string{"trace_id", "traceID", "traceId"},
+		"alerts.traces.span_labels":                   []string{"span_id", "spanID", "spanId"},
+		"alerts.loki.lookback":                        "15m",
+		"alerts.loki.limit":                           50,
+		"alerts.loki.target":                          "note",
+		"alerts.loki.timeout":                         "10s",
+		"alerts.prometheus.timeout":                   "10s",
+		"alerts.prometheus.max_series":                10,
+		"alerts.kubernetes.pod_label":                 "pod",
+		"alerts.kubernetes.namespace_label":           "namespace",
+		"alerts.kubernetes.node_label":                "node",
+		"alerts.kubernetes.label_prefix":              "k8s_",
+		"alerts.kubernetes.cache_ttl":                 "5m",
+		"alerts.kubernetes.timeout":                   "5s",
+		"alerts.active_alerts_interval":               "30s",
+		"alerts.assets.hostname_labels":               []string{"hostname", "host", "instance", "node"},
+		"alerts.assets.ip_labels":                     []string{"ip", "host_ip", "instance_ip"},
+		"alerts.enrichment.abuseipdb.url":             "https://api.abuseipdb.com/api/v2",
+		"alerts.enrichment.abuseipdb.max_age_in_days": 90,
+		"alerts.enrichment.abuseipdb.rate_limit":      60,
+		"alerts.enrichment.abuseipdb.cache_ttl":       "24h",
+		"alerts.enrichment.abuseipdb.timeout":         "10s",
+		"alerts.enrichment.internetdb.url":            "https://internetdb.shodan.io",
+		"alerts.enrichment.internetdb.rate_limit":     60,
+		"alerts.enrichment.internetdb.cache_ttl":      "24h",
+		"alerts.enrichment.internetdb.max_lookups":    10,
+		"alerts.enrichment.internetdb.timeout":        "10s",
+		"alerts.enrichment.misp.tag_prefix":           "misp-event:",
+		"alerts.enrichment.misp.cache_ttl":            "1h",
+		"alerts.enrichment.misp.max_lookups":          20,
+		"alerts.enrichment.misp.timeout":              "10s",
+		"alerts.enrichment.netbox.hostname_labels":    []string{"instance", "host", "hostname", "node"},
+		"alerts.enrichment.netbox.ip_labels":          []string{"ip", "host_ip"},
+		"alerts.enrichment.netbox.cache_ttl":          "1h",
+		"alerts.enrichment.netbox.timeout":            "10s",
+		"alerts.enrichment.nvd.url":                   "https://services.nvd.nist.gov/rest/json/cves/2.0",
+		"alerts.enrichment.nvd.rate_limit":            10,
+		"alerts.enrichment.nvd.cache_ttl":             "168h",
+		"alerts.enrichment.nvd.max_lookups":           5,
+		"alerts.enrichment.nvd.timeout":               "10s",
+		"alerts.enrichment.nvd.max_summary":           300,
+		"alerts.enrichment.rdap.url":                  "https://rdap.org",
+		"alerts.enrichment.rdap.new_domain_age":       "720h",
+		"alerts.enrichment.rdap.new_domain_tag":       "newly-registered-domain",
+		"alerts.enrichment.rdap.rate_limit":           30,
+		"alerts.enrichment.rdap.cache_ttl":            "720h",
+		"alerts.enrichment.rdap.max_lookups":          5,
+		"alerts.enrichment.rdap.timeout":              "10s",
+		"alerts.enrichment.virustotal.url":            "https://www.virustotal.com/api/v3",
+		"alerts.enrichment.virustotal.rate_limit":     4,
+		"alerts.enrichment.virustotal.cache_ttl":      "24h",
+		"alerts.enrichment.virustotal.max_lookups":    10,
+		"alerts.enrichment.virustotal.timeout":        "10s",
+		"alerts.iocs.tlp_id":                          2,
+		"alerts.redaction.replacement":                "[REDACTED]",
+		"alerts.runbook.annotation":                   "runbook_url",
+		"alerts.runbook.description":                  true,
+		"alerts.runbook.source_link":                  "auto",
+		"alerts.sinks":                                []string{"iris"},
+		"alerts.retry.max_attempts":                   10,
+		"alerts.retry.initial_backoff":                "30s",
+		"alerts.retry.max_backoff":                    "30m",
+		"alerts.retry.interval":                       "15s",
+		"alerts.queue.workers":                        4,
+		"alerts.parallelism":                          4,
+		"alerts.queue.retry_after":                    "30s",
+		"alerts.escalation.interval":                  "1m",
+		"alerts.acknowledgement.status_ids":           []int{3, 4},
+		"alerts.acknowledgement.assigned":             true,
+		"alertmanager.timeout":                        "10s",
+		"grafana.dashboard_annotation":                "__dashboardUid__",
+		"grafana.panel_annotation":                    "__panelId__",
+		"grafana.range":                               "1h",
+		"grafana.width":                               1000,
+		"grafana.height":                              500,
+		"grafana.timeout":                             "30s",
+		"thehive.type":                                "alertmanager",
+		"thehive.resolved_action":                     "update",
+		"thehive.resolved_status":                     "Ignored",
+	}, "."), nil)
+
+	if path != "" {
+		if err := k.Load(file.Provider(path), toml.Parser()); err != nil {
+			slog.Warn("could not load config file, using defaults", "path", path, "error", err)
+		}
+	}
+
+	k.Load(env.Provider("ALERTIRIS_", ".", func(s string) string {
+		return strings.Replace(
+			strings.ToLower(strings.TrimPrefix(s, "ALERTIRIS_")),
+			"__", ".", -1,
+		)
+	}), nil)
+
+	var cfg Config
+	if err := k.Unmarshal("", &cfg); err != nil {
+		return Config{}, fmt.Errorf("unmarshal config: %w", err)
+	}
+	return cfg, nil
+
+}
@@ -0,0 +1,158 @@
+package alertiris
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/dgraph-io/badger/v4"
+)
+
+var (
+	correlatedCases  = metrics.NewCounter(`alertiris_correlation_cases_total`)
+	correlatedAlerts = metrics.NewCounter(`alertiris_correlation_merged_alerts_total`)
+)
+
+// CorrelationConfig groups IRIS alerts that share the values of Labels into
+// one case. A group is closed when no alert joined it for Window, unless
+// Window is zero.
+type CorrelationConfig struct {
+	Labels    []string      `koanf:"labels"`
+	Window    time.Duration `koanf:"window"`
+	MinAlerts int           `koanf:"min_alerts"`
+	CaseTags  string        `koanf:"case_tags"`
+}
+
+// correlationGroup is the state of one correlation key. Alerts holds the
+// IRIS alerts waiting for MinAlerts before a case is created.
+type correlationGroup struct {
+	CaseID   int       `json:"case_id,omitempty"`
+	Alerts   []int     `json:"alerts,omitempty"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+func validateCorrelation(cfg CorrelationConfig, sinks map[string]Sink) error {
+	if len(cfg.Labels) == 0 {
+		return nil
+	}
+	if _, ok := sinks["iris"].(*irisSink); !ok {
+		return fmt.Errorf("correlation requires the iris sink")
+	}
+	if cfg.Window < 0 {
+		return fmt.Errorf("window must not be negative")
+	}
+	return nil
+}
+
+// correlationKey joins the correlation labels of the alert, or returns false
+// when one of them is missing.
+func (h *Handler) correlationKey(labels map[string]string) (string, bool) {
+	var parts []string
+	for _, name := range h.config.Correlation.Labels {
+		v := labels[name]
+		if v == "" {
+			return "", false
+		}
+		parts = append(parts, name+"="+v)
+	}
+	return strings.Join(parts, ","), len(parts) > 0
+}
+
+// correlate adds a newly created IRIS alert to the case of its correlation
+// group, creating the case from the group's alerts once enough have arrived.
+// Failures are logged and leave the alert on its own.
+func (h *Handler) correlate(ctx context.Context, alertID string, sa *SinkAlert) {
+	key, ok := h.correlationKey(sa.Alert.Labels)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(alertID)
+	if err != nil {
+		return
+	}
+	s := h.sinks["iris"].(*irisSink)
+	log := slog.With("fingerprint", sa.Fingerprint, "alert_id", alertID, "correlation_key", key)
+
+	h.correlationMu.Lock()
+	defer h.correlationMu.Unlock()
+
+	dbKey := []byte("corr:" + strconv.Itoa(sa.CustomerID) + ":" + key)
+	var g correlationGroup
+	if err := h.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(dbKey)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &g)
+		})
+	}); err != nil {
+		log.Warn("failed to load correlation group", "error", err)
+		return
+	}
+
+	now := time.Now()
+	if w := h.config.Correlation.Window; w > 0 && !g.LastSeen.IsZero() && now.Sub(g.LastSeen) > w {
+		g = correlationGroup{}
+	}
+	g.LastSeen = now
+
+	switch {
+	case g.CaseID != 0:
+		note := fmt.Sprintf("Correlated by alertiris on %s", key)
+		if err := s.client.MergeAlert(ctx, id, g.CaseID, note, sa.CustomerID); err != nil {
+			log.Error("failed to merge alert into correlated case", "case_id", g.CaseID, "error", err)
+		} else {
+			log.Info("merged alert into correlated case", "case_id", g.CaseID)
+			h.recordHistory(HistoryEvent{Fingerprint: sa.Fingerprint, Event: "correlated", Sink: "iris", CustomerID: sa.CustomerID, AlertID: alertID, Detail: fmt.Sprintf("merged into case %d on %s", g.CaseID, key)})
+			correlatedAlerts.Inc()
+		}
+	case len(g.Alerts)+1 >= max(h.config.Correlation.MinAlerts, 1):
+		alerts := append(g.Alerts, id)
+		caseID, err := s.client.EscalateAlert(ctx, alerts[0], IRISEscalateRequest{
+			CaseTitle: fmt.Sprintf("Correlated alerts: %s", key),
+			CaseTags:  h.config.Correlation.CaseTags,
+			Note:      fmt.Sprintf("Created by alertiris for alerts sharing %s", key),
+		}, sa.CustomerID)
+		if err != nil {
+			log.Error("failed to create correlated case", "error", err)
+			g.Alerts = alerts
+			break
+		}
+		log.Info("created correlated case", "case_id", caseID, "alerts", len(alerts))
+		h.recordHistory(HistoryEvent{Fingerprint: sa.Fingerprint, Event: "correlated", Sink: "iris", CustomerID: sa.CustomerID, AlertID: alertID, Detail: fmt.Sprintf("case %d created on %s", caseID, key)})
+		correlatedCases.Inc()
+		g.CaseID, g.Alerts = caseID, nil
+		for _, other := range alerts[1:] {
+			if err := s.client.MergeAlert(ctx, other, caseID, fmt.Sprintf("Correlated by alertiris on %s", key), sa.CustomerID); err != nil {
+				log.Error("failed to merge alert into correlated case", "case_id", caseID, "merged_alert_id", other, "error", err)
+				continue
+			}
+			correlatedAlerts.Inc()
+		}
+	default:
+		g.Alerts = append(g.Alerts, id)
+	}
+
+	val, err := json.Marshal(g)
+	if err != nil {
+		return
+	}
+	if err := h.db.Update(func(txn *badger.Txn) error {
+		e := badger.NewEntry(dbKey, val)
+		if w := h.config.Correlation.Window; w > 0 {
+			e = e.WithTTL(w)
+		}
+		return txn.SetEntry(e)
+	}); err != nil {
+		log.Warn("failed to store correlation group", "error", err)
+	}
+}
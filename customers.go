@@ -0,0 +1,71 @@
+package alertiris
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// CustomerRuleConfig maps alerts to a customer by matching a regular
+// expression against a label. With Lookup, the customer is looked up by the
+// "customer" named group, or else the first group, of the match and
+// CustomerID is the fallback for values missing from the table.
+type CustomerRuleConfig struct {
+	Label      string         `koanf:"label"`
+	Regex      string         `koanf:"regex"`
+	CustomerID int            `koanf:"customer_id"`
+	Lookup     map[string]int `koanf:"lookup"`
+}
+
+type customerRule struct {
+	CustomerRuleConfig
+	re    *regexp.Regexp
+	group int
+}
+
+func newCustomerRules(cfgs []CustomerRuleConfig) ([]*customerRule, error) {
+	var out []*customerRule
+	for i, cfg := range cfgs {
+		if cfg.Label == "" {
+			return nil, fmt.Errorf("customer rule %d: label is required", i)
+		}
+		re, err := regexp.Compile(cfg.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("customer rule %d: %w", i, err)
+		}
+		r := &customerRule{CustomerRuleConfig: cfg, re: re}
+		if len(cfg.Lookup) > 0 {
+			if re.NumSubexp() > 0 {
+				r.group = 1
+			}
+			if n := re.SubexpIndex("customer"); n > 0 {
+				r.group = n
+			}
+		} else if cfg.CustomerID <= 0 {
+			return nil, fmt.Errorf("customer rule %d: customer_id or lookup is required", i)
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// matchCustomerRule returns the customer of the first rule matching the
+// labels.
+func matchCustomerRule(rules []*customerRule, labels map[string]string) (int, bool) {
+	for _, r := range rules {
+		value, ok := labels[r.Label]
+		if !ok {
+			continue
+		}
+		m := r.re.FindStringSubmatch(value)
+		if m == nil {
+			continue
+		}
+		if id, ok := r.Lookup[m[r.group]]; ok {
+			return id, true
+		}
+		if r.CustomerID > 0 {
+			return r.CustomerID, true
+		}
+	}
+	return 0, false
+}
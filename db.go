@@ -0,0 +1,142 @@
+package alertiris
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+func OpenDB(cfg DBConfig) (*badger.DB, error) {
+	opts, err := dbOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return badger.Open(opts)
+}
+
+// OpenDBReadOnly opens the state store without changing it, for inspection.
+// It fails while the store is open for writing elsewhere.
+func OpenDBReadOnly(cfg DBConfig) (*badger.DB, error) {
+	if cfg.Path == "" {
+		return nil, errors.New("an in-memory database cannot be opened read-only")
+	}
+	opts, err := dbOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return badger.Open(opts.WithReadOnly(true))
+}
+
+func dbOptions(cfg DBConfig) (badger.Options, error) {
+	opts := badger.DefaultOptions(cfg.Path).WithLogger(nil)
+	if cfg.Path == "" {
+		opts = opts.WithInMemory(true)
+	}
+	key, err := encryptionKey(cfg)
+	if err != nil {
+		return opts, fmt.Errorf("encryption key: %w", err)
+	}
+	if key != nil {
+		// Badger needs an index cache to open encrypted tables.
+		opts = opts.WithEncryptionKey(key).WithIndexCacheSize(64 << 20)
+		if cfg.EncryptionKeyRotation > 0 {
+			opts = opts.WithEncryptionKeyRotationDuration(cfg.EncryptionKeyRotation)
+		}
+	}
+	return opts, nil
+}
+
+// encryptionKey reads the AES key of the state store. The key is 16, 24 or
+// 32 bytes, given raw or hex or base64 encoded. nil means no encryption.
+func encryptionKey(cfg DBConfig) ([]byte, error) {
+	var raw string
+	switch {
+	case cfg.EncryptionKeyFile != "" && cfg.EncryptionKeyEnv != "":
+		return nil, errors.New("set only one of encryption_key_file and encryption_key_env")
+	case cfg.EncryptionKeyFile != "":
+		b, err := os.ReadFile(cfg.EncryptionKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		raw = string(b)
+	case cfg.EncryptionKeyEnv != "":
+		raw = os.Getenv(cfg.EncryptionKeyEnv)
+		if raw == "" {
+			return nil, fmt.Errorf("environment variable %s is not set", cfg.EncryptionKeyEnv)
+		}
+	default:
+		return nil, nil
+	}
+
+	raw = strings.TrimSpace(raw)
+	var candidates [][]byte
+	if b, err := hex.DecodeString(raw); err == nil {
+		candidates = append(candidates, b)
+	}
+	if b, err := base64.StdEncoding.DecodeString(raw); err == nil {
+		candidates = append(candidates, b)
+	}
+	for _, key := range append(candidates, []byte(raw)) {
+		switch len(key) {
+		case 16, 24, 32:
+			return key, nil
+		}
+	}
+	return nil, errors.New("key must be 16, 24 or 32 bytes, raw or hex or base64 encoded")
+}
+
+type DBStats struct {
+	// Keys counts keys by prefix, the part before the first ":".
+	Keys          map[string]int `json:"keys"`
+	LSMSize       int64          `json:"lsm_size"`
+	ValueLogSize  int64          `json:"value_log_size"`
+	SchemaVersion int            `json:"schema_version"`
+}
+
+func GetDBStats(db *badger.DB) (DBStats, error) {
+	stats := DBStats{Keys: make(map[string]int)}
+	err := db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			prefix, _, _ := strings.Cut(string(it.Item().Key()), ":")
+			stats.Keys[prefix]++
+		}
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+	stats.LSMSize, stats.ValueLogSize = db.Size()
+	stats.SchemaVersion, err = GetSchemaVersion(db)
+	return stats, err
+}
+
+// CompactDB merges the LSM tree into a single level and garbage collects the
+// value log until no more space can be reclaimed.
+func CompactDB(db *badger.DB) error {
+	if err := db.Flatten(2); err != nil {
+		return fmt.Errorf("flatten: %w", err)
+	}
+	rounds := 0
+	for {
+		err := db.RunValueLogGC(0.5)
+		if errors.Is(err, badger.ErrNoRewrite) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("value log gc: %w", err)
+		}
+		rounds++
+	}
+	slog.Info("database compacted", "value_log_gc_rounds", rounds)
+	return nil
+}
@@ -0,0 +1,91 @@
+package alertiris
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// DescriptionField is one line of the alert description. Exactly one of
+// Label, Annotation and Field selects the value; Field is one of status,
+// starts_at, ends_at, fingerprint and generator_url.
+type DescriptionField struct {
+	Name       string `koanf:"name"`
+	Label      string `koanf:"label"`
+	Annotation string `koanf:"annotation"`
+	Field      string `koanf:"field"`
+}
+
+var defaultDescriptionFields = []DescriptionField{
+	{Name: "Alert", Label: "alertname"},
+	{Name: "Severity", Label: "severity"},
+	{Name: "Description", Annotation: "description"},
+	{Name: "Summary", Annotation: "summary"},
+	{Name: "Hostname", Label: "hostname"},
+	{Name: "Instance", Label: "instance_name"},
+	{Name: "Service", Label: "service"},
+	{Name: "Group", Label: "group"},
+	{Name: "Tier", Label: "tier"},
+	{Name: "Load", Annotation: "load"},
+	{Name: "Started At", Field: "starts_at"},
+	{Name: "Fingerprint", Field: "fingerprint"},
+	{Name: "Generator URL", Field: "generator_url"},
+}
+
+var descriptionBuiltins = []string{"status", "starts_at", "ends_at", "fingerprint", "generator_url"}
+
+func validateDescriptionFields(fields []DescriptionField) error {
+	for i, f := range fields {
+		set := 0
+		for _, v := range []string{f.Label, f.Annotation, f.Field} {
+			if v != "" {
+				set++
+			}
+		}
+		if set != 1 {
+			return fmt.Errorf("description field %d (%q): set exactly one of label, annotation and field", i, f.Name)
+		}
+		if f.Field != "" && !slices.Contains(descriptionBuiltins, f.Field) {
+			return fmt.Errorf("description field %d (%q): unknown field %q", i, f.Name, f.Field)
+		}
+		if f.Name == "" {
+			return fmt.Errorf("description field %d: name is required", i)
+		}
+	}
+	return nil
+}
+
+func (h *Handler) descriptionValue(f DescriptionField, alert Alert) string {
+	switch {
+	case f.Label != "":
+		return alert.Labels[f.Label]
+	case f.Annotation != "":
+		return alert.Annotations[f.Annotation]
+	}
+	switch f.Field {
+	case "status":
+		return alert.Status
+	case "starts_at":
+		return h.formatTime(alert.StartsAt)
+	case "ends_at":
+		return h.formatTime(alert.EndsAt)
+	case "fingerprint":
+		return alert.Fingerprint
+	case "generator_url":
+		return alert.GeneratorURL
+	}
+	return ""
+}
+
+func (h *Handler) alertDescription(alert Alert) string {
+	if desc, ok := h.templates.description(alert); ok {
+		return desc
+	}
+	var lines []string
+	for _, f := range h.descriptionFields {
+		if val := h.descriptionValue(f, alert); val != "" {
+			lines = append(lines, f.Name+": "+val)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,166 @@
+package alertiris
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/dgraph-io/badger/v4"
+)
+
+// EnrichmentConfig configures lookups of external context that is added to
+// new IRIS alerts.
+type EnrichmentConfig struct {
+	VirusTotal VirusTotalConfig `koanf:"virustotal"`
+	AbuseIPDB  AbuseIPDBConfig  `koanf:"abuseipdb"`
+	InternetDB InternetDBConfig `koanf:"internetdb"`
+	MISP       MISPConfig       `koanf:"misp"`
+	NVD        NVDConfig        `koanf:"nvd"`
+	RDAP       RDAPConfig       `koanf:"rdap"`
+	NetBox     NetBoxConfig     `koanf:"netbox"`
+}
+
+// enrichment looks up context for the IOCs of an alert. It may change the
+// alert and returns a section for the alert note, or "".
+type enrichment interface {
+	name() string
+	enrich(ctx context.Context, sa *SinkAlert, iocs []IOC) string
+}
+
+func newEnrichments(cfg EnrichmentConfig, db *badger.DB) []enrichment {
+	cache := &enrichmentCache{db: db}
+	var out []enrichment
+	if vt := newVirusTotal(cfg.VirusTotal, cache); vt != nil {
+		out = append(out, vt)
+	}
+	if a := newAbuseIPDB(cfg.AbuseIPDB, cache); a != nil {
+		out = append(out, a)
+	}
+	if d := newInternetDB(cfg.InternetDB, cache); d != nil {
+		out = append(out, d)
+	}
+	if m := newMISP(cfg.MISP, cache); m != nil {
+		out = append(out, m)
+	}
+	if n := newNVD(cfg.NVD, cache); n != nil {
+		out = append(out, n)
+	}
+	if r := newRDAP(cfg.RDAP, cache); r != nil {
+		out = append(out, r)
+	}
+	if n := newNetBox(cfg.NetBox, cache); n != nil {
+		out = append(out, n)
+	}
+	return out
+}
+
+// enrich runs the enrichments for an alert about to be created in IRIS and
+// puts their findings in the alert note.
+func (h *Handler) enrich(ctx context.Context, sa *SinkAlert) {
+	if len(h.enrichments) == 0 {
+		return
+	}
+	iocs := sa.IOCs
+	if iocs == nil {
+		iocs = alertIOCs(sa.Alert, h.iocRules)
+	}
+	for _, e := range h.enrichments {
+		if section := e.enrich(ctx, sa, iocs); section != "" {
+			appendNoteSection(sa, section)
+		}
+	}
+}
+
+// appendNoteSection adds a section to the note of an alert about to be
+// created.
+func appendNoteSection(sa *SinkAlert, section string) {
+	if sa.Note != "" {
+		sa.Note += "\n\n"
+	}
+	sa.Note += section
+}
+
+// publicIP reports whether value is an IP address worth looking up
+// externally.
+func publicIP(value string) bool {
+	addr, err := netip.ParseAddr(value)
+	return err == nil && addr.IsGlobalUnicast() && !addr.IsPrivate()
+}
+
+// enrichmentFailed counts a failed lookup, also as an enrichment error.
+func enrichmentFailed(provider string) {
+	enrichmentLookups(provider, "error").Inc()
+	errorsTotal(ErrorEnrichment).Inc()
+}
+
+func enrichmentLookups(provider, result string) *metrics.Counter {
+	return metrics.GetOrCreateCounter(`alertiris_enrichment_lookups_total{provider="` + provider + `",result="` + result + `"}`)
+}
+
+// enrichmentCache keeps lookup results in the state store under
+// enr:<provider>:<key> so repeated alerts do not use up API quotas.
+type enrichmentCache struct {
+	db *badger.DB
+}
+
+func (c *enrichmentCache) get(provider, key string, v any) bool {
+	err := c.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte("enr:" + provider + ":" + key))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, v)
+		})
+	})
+	if err != nil && err != badger.ErrKeyNotFound {
+		slog.Warn("failed to read enrichment cache", "provider", provider, "key", key, "error", err)
+	}
+	return err == nil
+}
+
+func (c *enrichmentCache) set(provider, key string, v any, ttl time.Duration) {
+	val, err := json.Marshal(v)
+	if err == nil {
+		err = c.db.Update(func(txn *badger.Txn) error {
+			e := badger.NewEntry([]byte("enr:"+provider+":"+key), val)
+			if ttl > 0 {
+				e = e.WithTTL(ttl)
+			}
+			return txn.SetEntry(e)
+		})
+	}
+	if err != nil {
+		slog.Warn("failed to write enrichment cache", "provider", provider, "key", key, "error", err)
+	}
+}
+
+// lookupLimiter allows a number of lookups per minute. Lookups over the
+// limit are skipped rather than delaying the alert.
+type lookupLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Time
+	count  int
+}
+
+func (l *lookupLimiter) allow() bool {
+	if l.limit <= 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if now.Sub(l.window) >= time.Minute {
+		l.window, l.count = now, 0
+	}
+	if l.count >= l.limit {
+		return false
+	}
+	l.count++
+	return true
+}
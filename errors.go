@@ -0,0 +1,80 @@
+package alertiris
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// ErrorCategory is the kind of failure an error represents, used to count
+// and log failures so they can be triaged without reading messages.
+type ErrorCategory string
+
+const (
+	ErrorPayload    ErrorCategory = "payload"
+	ErrorRouting    ErrorCategory = "routing"
+	ErrorEnrichment ErrorCategory = "enrichment"
+	ErrorIRIS4xx    ErrorCategory = "iris_4xx"
+	ErrorIRIS5xx    ErrorCategory = "iris_5xx"
+	ErrorNetwork    ErrorCategory = "network"
+	ErrorStore      ErrorCategory = "store"
+	ErrorOther      ErrorCategory = "other"
+)
+
+// CategorizedError marks an error with its category where it cannot be
+// told from the error itself, such as state store failures.
+type CategorizedError struct {
+	Category ErrorCategory
+	Err      error
+}
+
+func (e *CategorizedError) Error() string { return e.Err.Error() }
+
+func (e *CategorizedError) Unwrap() error { return e.Err }
+
+func categorize(category ErrorCategory, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &CategorizedError{Category: category, Err: err}
+}
+
+// ErrorCategoryOf classifies err. Explicit categories win, then rejected
+// payloads, IRIS responses by status code and transport failures.
+func ErrorCategoryOf(err error) ErrorCategory {
+	var cerr *CategorizedError
+	if errors.As(err, &cerr) {
+		return cerr.Category
+	}
+	var perr *PayloadError
+	if errors.As(err, &perr) {
+		return ErrorPayload
+	}
+	var ierr *IRISError
+	if errors.As(err, &ierr) {
+		if ierr.StatusCode >= 500 {
+			return ErrorIRIS5xx
+		}
+		return ErrorIRIS4xx
+	}
+	var uerr *url.Error
+	var nerr net.Error
+	if errors.As(err, &uerr) || errors.As(err, &nerr) || errors.Is(err, context.DeadlineExceeded) {
+		return ErrorNetwork
+	}
+	return ErrorOther
+}
+
+func errorsTotal(category ErrorCategory) *metrics.Counter {
+	return metrics.GetOrCreateCounter(`alertiris_errors_total{category="` + string(category) + `"}`)
+}
+
+// countError counts err by category and returns the category for logging.
+func countError(err error) ErrorCategory {
+	category := ErrorCategoryOf(err)
+	errorsTotal(category).Inc()
+	return category
+}
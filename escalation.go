@@ -0,0 +1,353 @@
+package alertiris
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/dgraph-io/badger/v4"
+)
+
+var (
+	escalationSeverity = metrics.NewCounter(`alertiris_escalations_total{action="severity"}`)
+	escalationTags     = metrics.NewCounter(`alertiris_escalations_total{action="tags"}`)
+	escalationOwner    = metrics.NewCounter(`alertiris_escalations_total{action="owner"}`)
+	escalationNotify   = metrics.NewCounter(`alertiris_escalations_total{action="notify"}`)
+	escalationCase     = metrics.NewCounter(`alertiris_escalations_total{action="case"}`)
+)
+
+// EscalationConfig holds the default escalation rules and named policies
+// that routes can select with escalation_policy.
+type EscalationConfig struct {
+	Interval time.Duration      `koanf:"interval"`
+	Rules    []EscalationRule   `koanf:"rules"`
+	Policies []EscalationPolicy `koanf:"policies"`
+}
+
+type EscalationPolicy struct {
+	Name  string           `koanf:"name"`
+	Rules []EscalationRule `koanf:"rules"`
+}
+
+// EscalationRule acts on IRIS alerts that have stayed in the new status for
+// After. SeverityID limits the rule to alerts currently at that severity.
+type EscalationRule struct {
+	SeverityID    int           `koanf:"severity_id"`
+	After         time.Duration `koanf:"after"`
+	SetSeverityID int           `koanf:"set_severity_id"`
+	AddTags       []string      `koanf:"add_tags"`
+	OwnerID       int           `koanf:"owner_id"`
+	Notify        []string      `koanf:"notify"`
+	CreateCase    bool          `koanf:"create_case"`
+	CaseTags      string        `koanf:"case_tags"`
+}
+
+// escalationState tracks an IRIS alert in the new status. Applied holds the
+// indexes of the policy rules already acted on.
+type escalationState struct {
+	Policy     string    `json:"policy,omitempty"`
+	NewSince   time.Time `json:"new_since"`
+	SeverityID int       `json:"severity_id,omitempty"`
+	Tags       []string  `json:"tags,omitempty"`
+	Applied    []int     `json:"applied,omitempty"`
+}
+
+// newEscalationPolicies maps policy names to their rules, with the default
+// rules under "". It returns nil when no rules are configured.
+func newEscalationPolicies(cfg EscalationConfig, routes []*Route, sinks map[string]Sink, notifier *Notifier) (map[string][]EscalationRule, error) {
+	policies := map[string][]EscalationRule{"": cfg.Rules}
+	for _, p := range cfg.Policies {
+		if p.Name == "" {
+			return nil, fmt.Errorf("policy name is required")
+		}
+		if _, ok := policies[p.Name]; ok {
+			return nil, fmt.Errorf("duplicate policy %q", p.Name)
+		}
+		policies[p.Name] = p.Rules
+	}
+	for _, r := range routes {
+		if _, ok := policies[r.EscalationPolicy]; !ok {
+			return nil, fmt.Errorf("route %q: unknown policy %q", r.Name, r.EscalationPolicy)
+		}
+	}
+
+	enabled := false
+	for name, rules := range policies {
+		for i, r := range rules {
+			if r.After <= 0 {
+				return nil, fmt.Errorf("policy %q rule %d: after must be positive", name, i)
+			}
+			if r.SetSeverityID == 0 && len(r.AddTags) == 0 && r.OwnerID == 0 && len(r.Notify) == 0 && !r.CreateCase {
+				return nil, fmt.Errorf("policy %q rule %d: no action configured", name, i)
+			}
+			for _, n := range r.Notify {
+				if !notifier.has(n) {
+					return nil, fmt.Errorf("policy %q rule %d: unknown notifier %q", name, i, n)
+				}
+			}
+			enabled = true
+		}
+	}
+	if !enabled {
+		return nil, nil
+	}
+	if _, ok := sinks["iris"].(*irisSink); !ok {
+		return nil, fmt.Errorf("escalation rules require the iris sink")
+	}
+	if cfg.Interval <= 0 {
+		return nil, fmt.Errorf("interval must be positive")
+	}
+	return policies, nil
+}
+
+func escalationKey(fingerprint string, customerID int) []byte {
+	return []byte("esc:" + fingerprint + ":" + strconv.Itoa(customerID))
+}
+
+func (h *Handler) runEscalations(ctx context.Context) {
+	ticker := time.NewTicker(h.config.Escalation.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if h.held() {
+				continue
+			}
+			if err := h.processEscalations(ctx); err != nil {
+				slog.Error("failed to process escalations", "error", err)
+			}
+		}
+	}
+}
+
+// processEscalations polls every IRIS alert created by the bridge and applies
+// the escalation rules that are due.
+func (h *Handler) processEscalations(ctx context.Context) error {
+	mappings, err := ListMappings(h.db, "")
+	if err != nil {
+		return fmt.Errorf("list mappings: %w", err)
+	}
+	for _, m := range mappings {
+		if m.Sink == "iris" {
+			h.escalate(ctx, m)
+		}
+	}
+	return nil
+}
+
+func (h *Handler) escalate(ctx context.Context, m Mapping) {
+	s := h.sinks["iris"].(*irisSink)
+	log := slog.With("fingerprint", m.Fingerprint, "alert_id", m.AlertID)
+	id, err := strconv.Atoi(m.AlertID)
+	if err != nil {
+		return
+	}
+
+	a, err := s.client.GetAlert(ctx, id, m.CustomerID)
+	if err != nil {
+		log.Warn("failed to fetch alert for escalation", "error", err)
+		return
+	}
+	st, err := h.loadEscalation(m.Fingerprint, m.CustomerID)
+	if err != nil {
+		log.Warn("failed to load escalation state", "error", err)
+		return
+	}
+	if a.StatusID != h.config.StatusIDNew {
+		// Picked up by an analyst, so the clock restarts if it returns to
+		// new. Raised severity and added tags are kept.
+		if !st.NewSince.IsZero() {
+			st.NewSince, st.Applied = time.Time{}, nil
+			if err := h.storeEscalation(m.Fingerprint, m.CustomerID, st); err != nil {
+				log.Warn("failed to store escalation state", "error", err)
+			}
+		}
+		return
+	}
+
+	rules, ok := h.escalation[st.Policy]
+	if !ok {
+		log.Warn("unknown escalation policy", "policy", st.Policy)
+		return
+	}
+	now := time.Now()
+	if st.NewSince.IsZero() {
+		st.NewSince = now
+	}
+	age := now.Sub(st.NewSince).Round(time.Second)
+	log = log.With("policy", st.Policy, "age", age)
+
+	for i, r := range rules {
+		if slices.Contains(st.Applied, i) || age < r.After {
+			continue
+		}
+		if r.SeverityID != 0 && r.SeverityID != a.SeverityID {
+			continue
+		}
+
+		var req IRISAlertUpdateRequest
+		tags := splitTags(a.Tags)
+		if r.SetSeverityID != 0 && r.SetSeverityID != a.SeverityID {
+			req.SeverityID = &r.SetSeverityID
+		}
+		for _, t := range r.AddTags {
+			if !slices.Contains(tags, t) {
+				tags = append(tags, t)
+			}
+		}
+		if len(tags) > len(splitTags(a.Tags)) {
+			joined := strings.Join(tags, ",")
+			req.Tags = &joined
+		}
+		if r.OwnerID != 0 {
+			req.OwnerID = &r.OwnerID
+		}
+		if req != (IRISAlertUpdateRequest{}) {
+			if err := s.client.UpdateAlert(ctx, id, req, m.CustomerID); err != nil {
+				log.Error("failed to update unacknowledged alert", "error", err)
+				continue
+			}
+			if req.SeverityID != nil {
+				log.Info("raised severity of unacknowledged alert", "from", a.SeverityID, "to", r.SetSeverityID)
+				h.recordHistory(HistoryEvent{Fingerprint: m.Fingerprint, Event: "escalated", Sink: "iris", CustomerID: m.CustomerID, AlertID: m.AlertID, Detail: fmt.Sprintf("severity %d to %d after %s", a.SeverityID, r.SetSeverityID, age)})
+				a.SeverityID = r.SetSeverityID
+				st.SeverityID = r.SetSeverityID
+				escalationSeverity.Inc()
+				// Keep the change detection in step so the next update is
+				// not reported as an escalation again.
+				if _, err := h.trackSeverity(m.Fingerprint, m.CustomerID, a.SeverityID); err != nil {
+					log.Warn("failed to track severity", "error", err)
+				}
+			}
+			if req.Tags != nil {
+				log.Info("tagged unacknowledged alert", "tags", r.AddTags)
+				h.recordHistory(HistoryEvent{Fingerprint: m.Fingerprint, Event: "escalated", Sink: "iris", CustomerID: m.CustomerID, AlertID: m.AlertID, Detail: fmt.Sprintf("tagged %s after %s", strings.Join(r.AddTags, ","), age)})
+				a.Tags = *req.Tags
+				for _, t := range r.AddTags {
+					if !slices.Contains(st.Tags, t) {
+						st.Tags = append(st.Tags, t)
+					}
+				}
+				escalationTags.Inc()
+			}
+			if req.OwnerID != nil {
+				log.Info("reassigned unacknowledged alert", "owner_id", r.OwnerID)
+				h.recordHistory(HistoryEvent{Fingerprint: m.Fingerprint, Event: "escalated", Sink: "iris", CustomerID: m.CustomerID, AlertID: m.AlertID, Detail: fmt.Sprintf("assigned to user %d after %s", r.OwnerID, age)})
+				escalationOwner.Inc()
+			}
+		}
+		if len(r.Notify) > 0 {
+			h.notifier.NotifyChannels(r.Notify, Notification{
+				Event:       fmt.Sprintf("unacknowledged for %s", age),
+				Title:       a.Title,
+				Severity:    strconv.Itoa(a.SeverityID),
+				Fingerprint: m.Fingerprint,
+				CustomerID:  m.CustomerID,
+				AlertID:     m.AlertID,
+				Link:        h.notifier.AlertLink(m.AlertID, m.CustomerID),
+			})
+			escalationNotify.Inc()
+			h.recordHistory(HistoryEvent{Fingerprint: m.Fingerprint, Event: "escalated", Sink: "iris", CustomerID: m.CustomerID, AlertID: m.AlertID, Detail: fmt.Sprintf("notified %s after %s", strings.Join(r.Notify, ","), age)})
+		}
+		if r.CreateCase {
+			caseID, err := s.client.EscalateAlert(ctx, id, IRISEscalateRequest{
+				CaseTitle: a.Title,
+				CaseTags:  r.CaseTags,
+				Note:      fmt.Sprintf("Escalated by alertiris after %s in the new status", age),
+			}, m.CustomerID)
+			if err != nil {
+				log.Error("failed to escalate alert to a case", "error", err)
+				continue
+			}
+			log.Info("escalated unacknowledged alert to a case", "case_id", caseID)
+			h.recordHistory(HistoryEvent{Fingerprint: m.Fingerprint, Event: "escalated", Sink: "iris", CustomerID: m.CustomerID, AlertID: m.AlertID, Detail: fmt.Sprintf("case %d created after %s", caseID, age)})
+			escalationCase.Inc()
+		}
+		st.Applied = append(st.Applied, i)
+	}
+
+	if err := h.storeEscalation(m.Fingerprint, m.CustomerID, st); err != nil {
+		log.Warn("failed to store escalation state", "error", err)
+	}
+}
+
+func splitTags(s string) []string {
+	var out []string
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// startEscalation starts the clock for an alert the bridge just created.
+func (h *Handler) startEscalation(sa *SinkAlert) error {
+	if h.escalation == nil {
+		return nil
+	}
+	return h.storeEscalation(sa.Fingerprint, sa.CustomerID, escalationState{
+		Policy:   sa.EscalationPolicy,
+		NewSince: time.Now(),
+	})
+}
+
+// applyEscalation keeps the severity and tags set by escalation from being
+// reverted by the next update of the alert.
+func (h *Handler) applyEscalation(sa *SinkAlert) {
+	if h.escalation == nil {
+		return
+	}
+	st, err := h.loadEscalation(sa.Fingerprint, sa.CustomerID)
+	if err != nil {
+		slog.Warn("failed to load escalation state", "fingerprint", sa.Fingerprint, "error", err)
+		return
+	}
+	sa.SeverityID = max(sa.SeverityID, st.SeverityID)
+	for _, t := range st.Tags {
+		if !slices.Contains(sa.Tags, t) {
+			sa.Tags = append(sa.Tags, t)
+		}
+	}
+}
+
+func (h *Handler) loadEscalation(fingerprint string, customerID int) (escalationState, error) {
+	var st escalationState
+	err := h.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(escalationKey(fingerprint, customerID))
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &st)
+		})
+	})
+	return st, err
+}
+
+func (h *Handler) storeEscalation(fingerprint string, customerID int, st escalationState) error {
+	val, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return h.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(escalationKey(fingerprint, customerID), val)
+	})
+}
+
+func (h *Handler) clearEscalation(fingerprint string, customerID int) error {
+	return h.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(escalationKey(fingerprint, customerID))
+	})
+}
@@ -0,0 +1,145 @@
+package alertiris
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// FaultConfig injects artificial IRIS failures, for exercising the retry
+// queue and dead letter queue in staging. Never enable it in production.
+// Each rate is the fraction of requests, between 0 and 1, that get the
+// fault: a connection error (NetworkRate), an error response with Status
+// (ErrorRate), a Latency delay (LatencyRate) or, after IRIS answered, a
+// body that is not JSON (MalformedRate). Paths limits faults to requests
+// whose path starts with one of them.
+type FaultConfig struct {
+	Enabled       bool          `koanf:"enabled"`
+	NetworkRate   float64       `koanf:"network_rate"`
+	ErrorRate     float64       `koanf:"error_rate"`
+	Status        int           `koanf:"status"`
+	LatencyRate   float64       `koanf:"latency_rate"`
+	Latency       time.Duration `koanf:"latency"`
+	MalformedRate float64       `koanf:"malformed_rate"`
+	Paths         []string      `koanf:"paths"`
+}
+
+func injectedFaults(kind string) *metrics.Counter {
+	return metrics.GetOrCreateCounter(`alertiris_injected_faults_total{kind="` + kind + `"}`)
+}
+
+func validateFaults(cfg FaultConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	for name, rate := range map[string]float64{
+		"network_rate":   cfg.NetworkRate,
+		"error_rate":     cfg.ErrorRate,
+		"latency_rate":   cfg.LatencyRate,
+		"malformed_rate": cfg.MalformedRate,
+	} {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("%s must be between 0 and 1", name)
+		}
+	}
+	if cfg.NetworkRate+cfg.ErrorRate > 1 {
+		return fmt.Errorf("network_rate and error_rate add up to more than 1")
+	}
+	if cfg.ErrorRate > 0 && (cfg.Status < 400 || cfg.Status > 599) {
+		return fmt.Errorf("status must be an HTTP error status")
+	}
+	if cfg.LatencyRate > 0 && cfg.Latency <= 0 {
+		return fmt.Errorf("latency_rate requires latency")
+	}
+	return nil
+}
+
+// faultTransport injects the faults of cfg into requests to IRIS.
+type faultTransport struct {
+	next http.RoundTripper
+	cfg  FaultConfig
+}
+
+func newFaultTransport(next http.RoundTripper, cfg FaultConfig) *faultTransport {
+	slog.Warn("fault injection enabled, requests to iris will fail on purpose",
+		"network_rate", cfg.NetworkRate, "error_rate", cfg.ErrorRate, "latency_rate", cfg.LatencyRate, "malformed_rate", cfg.MalformedRate)
+	return &faultTransport{next: next, cfg: cfg}
+}
+
+func (t *faultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if len(t.cfg.Paths) > 0 && !t.matches(req.URL.Path) {
+		return t.next.RoundTrip(req)
+	}
+
+	if t.cfg.LatencyRate > 0 && rand.Float64() < t.cfg.LatencyRate {
+		injectedFaults("latency").Inc()
+		timer := time.NewTimer(t.cfg.Latency)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			closeBody(req)
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+
+	r := rand.Float64()
+	switch {
+	case r < t.cfg.NetworkRate:
+		injectedFaults("network").Inc()
+		closeBody(req)
+		return nil, fmt.Errorf("injected fault: connection reset")
+	case r < t.cfg.NetworkRate+t.cfg.ErrorRate:
+		injectedFaults("error").Inc()
+		closeBody(req)
+		return fakeResponse(req, t.cfg.Status, `{"status":"error","message":"injected fault","data":null}`), nil
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || t.cfg.MalformedRate == 0 || rand.Float64() >= t.cfg.MalformedRate {
+		return resp, err
+	}
+	injectedFaults("malformed").Inc()
+	resp.Body.Close()
+	return fakeResponse(req, resp.StatusCode, "<html>injected fault: malformed response"), nil
+}
+
+func (t *faultTransport) matches(path string) bool {
+	for _, p := range t.cfg.Paths {
+		if strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+func fakeResponse(req *http.Request, status int, body string) *http.Response {
+	header := http.Header{"Content-Type": {"application/json"}}
+	if status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable {
+		header.Set("Retry-After", "1")
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader([]byte(body))),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,152 @@
+package alertiris
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type GrafanaConfig struct {
+	URL                 string        `koanf:"url"`
+	Token               string        `koanf:"token"`
+	DashboardAnnotation string        `koanf:"dashboard_annotation"`
+	PanelAnnotation     string        `koanf:"panel_annotation"`
+	Range               time.Duration `koanf:"range"`
+	Width               int           `koanf:"width"`
+	Height              int           `koanf:"height"`
+	Timeout             time.Duration `koanf:"timeout"`
+	// CaseID is the case whose datastore receives snapshots of alerts that
+	// are not part of a case yet.
+	CaseID int `koanf:"case_id"`
+}
+
+// GrafanaRenderer fetches panel images through the Grafana image renderer.
+type GrafanaRenderer struct {
+	cfg    GrafanaConfig
+	client *http.Client
+}
+
+func NewGrafanaRenderer(cfg GrafanaConfig) *GrafanaRenderer {
+	if cfg.URL == "" {
+		return nil
+	}
+	return &GrafanaRenderer{cfg: cfg, client: &http.Client{Timeout: cfg.Timeout}}
+}
+
+// panel returns the dashboard UID and panel ID an alert refers to.
+func (g *GrafanaRenderer) panel(alert Alert) (string, string, bool) {
+	uid := alert.Annotations[g.cfg.DashboardAnnotation]
+	panelID := alert.Annotations[g.cfg.PanelAnnotation]
+	return uid, panelID, uid != "" && panelID != ""
+}
+
+// Render returns a PNG of the panel covering the range before the alert
+// started up to now.
+func (g *GrafanaRenderer) Render(ctx context.Context, alert Alert) ([]byte, error) {
+	uid, panelID, ok := g.panel(alert)
+	if !ok {
+		return nil, fmt.Errorf("alert has no dashboard and panel annotations")
+	}
+	to := time.Now()
+	if !alert.EndsAt.IsZero() && alert.EndsAt.Before(to) {
+		to = alert.EndsAt
+	}
+	q := url.Values{
+		"panelId": {panelID},
+		"from":    {strconv.FormatInt(alert.StartsAt.Add(-g.cfg.Range).UnixMilli(), 10)},
+		"to":      {strconv.FormatInt(to.UnixMilli(), 10)},
+		"width":   {strconv.Itoa(g.cfg.Width)},
+		"height":  {strconv.Itoa(g.cfg.Height)},
+		"tz":      {"UTC"},
+	}
+	u := fmt.Sprintf("%s/render/d-solo/%s/_?%s", strings.TrimRight(g.cfg.URL, "/"), url.PathEscape(uid), q.Encode())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	if g.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.cfg.Token)
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("grafana returned %d: %s", resp.StatusCode, string(msg))
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "image/") {
+		return nil, fmt.Errorf("grafana returned %q instead of an image", ct)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 20<<20))
+}
+
+// attachSnapshot renders the Grafana panel of a newly created IRIS alert and
+// uploads it to the datastore of the alert's case, or of the configured
+// evidence case, noting the file on the alert. It runs in the background so
+// a slow renderer does not hold up delivery.
+func (h *Handler) attachSnapshot(ctx context.Context, alertID string, sa *SinkAlert) {
+	if h.grafana == nil {
+		return
+	}
+	if _, _, ok := h.grafana.panel(sa.Alert); !ok {
+		return
+	}
+	s, ok := h.sinks["iris"].(*irisSink)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(alertID)
+	if err != nil {
+		return
+	}
+
+	// The upload outlives the webhook request that created the alert.
+	ctx = context.WithoutCancel(ctx)
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		log := slog.With("fingerprint", sa.Fingerprint, "alert_id", alertID)
+
+		renderCtx, cancel := context.WithTimeout(ctx, h.grafana.cfg.Timeout)
+		defer cancel()
+		img, err := h.grafana.Render(renderCtx, sa.Alert)
+		if err != nil {
+			log.Error("failed to render grafana panel", "error", err)
+			return
+		}
+
+		caseID := h.grafana.cfg.CaseID
+		if a, err := s.client.GetAlert(ctx, id, sa.CustomerID); err != nil {
+			log.Warn("failed to look up alert case", "error", err)
+		} else if len(a.Cases) > 0 {
+			caseID = a.Cases[0]
+		}
+		if caseID == 0 {
+			log.Info("alert is not part of a case and grafana.case_id is not set, not uploading snapshot")
+			return
+		}
+
+		name := fmt.Sprintf("grafana-%s-%d.png", sa.Fingerprint, time.Now().Unix())
+		fileID, err := s.client.UploadEvidence(ctx, caseID, name, fmt.Sprintf("Grafana panel snapshot for IRIS alert %s: %s", alertID, sa.Title), img)
+		if err != nil {
+			log.Error("failed to upload grafana snapshot", "case_id", caseID, "error", err)
+			return
+		}
+
+		note := fmt.Sprintf("Grafana panel snapshot: datastore file %d in case %d (%s)", fileID, caseID, name)
+		if err := appendNote(ctx, s.client, id, sa.CustomerID, note); err != nil {
+			log.Warn("failed to add snapshot note to alert", "error", err)
+		}
+		log.Info("attached grafana snapshot", "case_id", caseID, "file_id", fileID)
+		h.recordHistory(HistoryEvent{Fingerprint: sa.Fingerprint, Event: "snapshot attached", Sink: "iris", CustomerID: sa.CustomerID, AlertID: alertID, Detail: fmt.Sprintf("file %d in case %d", fileID, caseID)})
+	}()
+}
@@ -1,12 +1,17 @@
-package main
+package alertiris
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"net/http"
-	"strconv"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/dgraph-io/badger/v4"
 )
@@ -28,20 +33,323 @@ type Alert struct {
 	Status       string            `json:"status"`
 	Labels       map[string]string `json:"labels"`
 	Annotations  map[string]string `json:"annotations"`
-	StartsAt     string            `json:"startsAt"`
-	EndsAt       string            `json:"endsAt"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
 	GeneratorURL string            `json:"generatorURL"`
 	Fingerprint  string            `json:"fingerprint"`
 }
 
 type Handler struct {
-	iris   *IRISClient
-	db     *badger.DB
-	config AlertConfig
+	sinks        map[string]Sink
+	sinkNames    []string
+	routes       []*Route
+	notifier     *Notifier
+	alertmanager *AlertmanagerClient
+	grafana      *GrafanaRenderer
+	db           *badger.DB
+	config       AlertConfig
+	location     *time.Location
+	redactor     *Redactor
+	wasm         *WasmTransformer
+	transformer  *Transformer
+	lua          *LuaHooks
+	pipeline     *Pipeline
+
+	descriptionFields []DescriptionField
+	templates         *alertTemplates
+	runbook           *runbook
+	escalation        map[string][]EscalationRule
+	windows           []*maintenanceWindow
+	timeRules         []*TimeRule
+	customerRules     []*customerRule
+	iocRules          []*iocRule
+	severityOverrides []*severityOverride
+	enrichments       []enrichment
+	kubernetes        *kubernetes
+	prometheus        *prometheus
+	loki              *loki
+	traces            *traceLinker
+	queries           []*alertQuery
+
+	// correlationMu serialises updates of correlation groups.
+	correlationMu sync.Mutex
+
+	// queue holds the alerts of accepted webhooks when processing is
+	// asynchronous, and is nil otherwise.
+	queue  *workQueue
+	limits *sourceLimits
+	order  *fingerprintOrder
+
+	// maintenance suppresses the creation of new alerts while set.
+	maintenance atomic.Bool
+	// holdSince is when hold mode was enabled in Unix nanoseconds, or 0.
+	// retryNow wakes the retry loop when it, or a hold window, ends.
+	holdSince   atomic.Int64
+	retryNow    chan struct{}
+	holdWindows []*maintenanceWindow
+	// holdWindow is the name of the open hold window, if any.
+	holdWindow atomic.Pointer[string]
+
+	// runtime holds the settings that can be changed through the admin
+	// API; settingsMu serializes changes.
+	runtime    atomic.Pointer[settings]
+	settingsMu sync.Mutex
+
+	// shipHistory queues history events for the S3 archive.
+	shipHistory bool
+
+	// profiler is told the delivery latencies when profiling is set up.
+	profiler *profiler
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
 }
 
-func NewHandler(iris *IRISClient, db *badger.DB, config AlertConfig) *Handler {
-	return &Handler{iris: iris, db: db, config: config}
+func NewHandler(sinks map[string]Sink, routes []*Route, notifier *Notifier, am *AlertmanagerClient, grafana *GrafanaRenderer, db *badger.DB, config AlertConfig) (*Handler, error) {
+	loc, err := time.LoadLocation(config.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("load timezone %q: %w", config.Timezone, err)
+	}
+	redactor, err := NewRedactor(config.Redaction)
+	if err != nil {
+		return nil, fmt.Errorf("redaction: %w", err)
+	}
+	transformer, err := NewTransformer(config.Transform)
+	if err != nil {
+		return nil, fmt.Errorf("transform: %w", err)
+	}
+	wasm, err := NewWasmTransformer(config.Wasm)
+	if err != nil {
+		return nil, fmt.Errorf("wasm: %w", err)
+	}
+	fields := config.DescriptionFields
+	if len(fields) == 0 {
+		fields = defaultDescriptionFields
+	}
+	if err := validateDescriptionFields(fields); err != nil {
+		return nil, err
+	}
+	if err := validateTags(config.Tags); err != nil {
+		return nil, fmt.Errorf("tags: %w", err)
+	}
+	rb, err := newRunbook(config.Runbook)
+	if err != nil {
+		return nil, fmt.Errorf("runbook: %w", err)
+	}
+	if err := validateResolvedAction(config.ResolvedAction); err != nil {
+		return nil, err
+	}
+	escalation, err := newEscalationPolicies(config.Escalation, routes, sinks, notifier)
+	if err != nil {
+		return nil, fmt.Errorf("escalation: %w", err)
+	}
+	if _, ok := sinks["iris"].(*irisSink); !ok && config.Ack.Interval > 0 {
+		return nil, fmt.Errorf("acknowledgement: requires the iris sink")
+	}
+	if err := validateComments(config.Comments, sinks, notifier); err != nil {
+		return nil, fmt.Errorf("comments: %w", err)
+	}
+	if err := validateOwnership(config.Ownership, routes, notifier); err != nil {
+		return nil, fmt.Errorf("ownership: %w", err)
+	}
+	if err := validateUnknownSeverity(config.UnknownSeverity, routes); err != nil {
+		return nil, fmt.Errorf("unknown severity: %w", err)
+	}
+	if config.Parallelism < 1 {
+		return nil, fmt.Errorf("parallelism must be at least 1")
+	}
+	if err := validateQueue(config.Queue); err != nil {
+		return nil, fmt.Errorf("queue: %w", err)
+	}
+	if err := validateCorrelation(config.Correlation, sinks); err != nil {
+		return nil, fmt.Errorf("correlation: %w", err)
+	}
+	windows, err := newMaintenanceWindows(config.MaintenanceWindows)
+	if err != nil {
+		return nil, fmt.Errorf("maintenance windows: %w", err)
+	}
+	holdWindows, err := newHoldWindows(config.HoldWindows)
+	if err != nil {
+		return nil, fmt.Errorf("hold windows: %w", err)
+	}
+	customerRules, err := newCustomerRules(config.CustomerRules)
+	if err != nil {
+		return nil, err
+	}
+	iocRules, err := newIOCRules(config.IOCs.Rules)
+	if err != nil {
+		return nil, err
+	}
+	kube, err := newKubernetes(config.Kubernetes, &enrichmentCache{db: db})
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes: %w", err)
+	}
+	queries, err := newAlertQueries(config.Prometheus.Queries)
+	if err != nil {
+		return nil, fmt.Errorf("prometheus: %w", err)
+	}
+	if config.Prometheus.URL == "" && (len(queries) > 0 || slices.ContainsFunc(routes, func(r *Route) bool { return len(r.queries) > 0 })) {
+		return nil, fmt.Errorf("prometheus: queries require a url")
+	}
+	traces, err := newTraceLinker(config.Traces)
+	if err != nil {
+		return nil, fmt.Errorf("traces: %w", err)
+	}
+	lk, err := newLoki(config.Loki)
+	if err != nil {
+		return nil, fmt.Errorf("loki: %w", err)
+	}
+	severityOverrides, err := newSeverityOverrides(config.SeverityOverrides)
+	if err != nil {
+		return nil, err
+	}
+	timeRules, err := NewTimeRules(config.TimeRules, routes)
+	if err != nil {
+		return nil, err
+	}
+	hooks, err := NewLuaHooks(config.Lua)
+	if err != nil {
+		return nil, fmt.Errorf("lua: %w", err)
+	}
+	h := &Handler{
+		sinks:        sinks,
+		sinkNames:    slices.Sorted(maps.Keys(sinks)),
+		routes:       routes,
+		notifier:     notifier,
+		alertmanager: am,
+		grafana:      grafana,
+		db:           db,
+		config:       config,
+		location:     loc,
+		redactor:     redactor,
+		wasm:         wasm,
+		transformer:  transformer,
+		lua:          hooks,
+
+		descriptionFields: fields,
+		runbook:           rb,
+		escalation:        escalation,
+		windows:           windows,
+		timeRules:         timeRules,
+		customerRules:     customerRules,
+		iocRules:          iocRules,
+		severityOverrides: severityOverrides,
+		kubernetes:        kube,
+		prometheus:        newPrometheus(config.Prometheus),
+		queries:           queries,
+		loki:              lk,
+		traces:            traces,
+		enrichments:       newEnrichments(config.Enrichment, db),
+		order:             newFingerprintOrder(),
+		retryNow:          make(chan struct{}, 1),
+		holdWindows:       holdWindows,
+	}
+	funcs := templateFuncs()
+	funcs["formatTime"] = h.formatTime
+	if h.templates, err = newAlertTemplates(config.Templates, funcs); err != nil {
+		return nil, fmt.Errorf("templates: %w", err)
+	}
+	if h.pipeline, err = h.buildPipeline(config.Pipeline); err != nil {
+		return nil, fmt.Errorf("pipeline: %w", err)
+	}
+	if err := h.loadMaintenance(); err != nil {
+		return nil, fmt.Errorf("load maintenance mode: %w", err)
+	}
+	if err := h.loadHold(); err != nil {
+		return nil, fmt.Errorf("load hold mode: %w", err)
+	}
+	if err := h.loadSettings(); err != nil {
+		return nil, fmt.Errorf("load settings: %w", err)
+	}
+	if config.Queue.Depth > 0 {
+		h.queue = newWorkQueue(config.Queue, h.order)
+	}
+	if len(config.Queue.Concurrency) > 0 {
+		h.limits = newSourceLimits(config.Queue.Concurrency)
+	}
+	return h, nil
+}
+
+func (h *Handler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	h.cancel = cancel
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		h.runRetries(ctx)
+	}()
+	if h.queue != nil {
+		for range h.config.Queue.Workers {
+			h.wg.Add(1)
+			go func() {
+				defer h.wg.Done()
+				h.runQueueWorker()
+			}()
+		}
+	}
+	if h.templates != nil && len(h.templates.files) > 0 {
+		h.wg.Add(1)
+		go func() {
+			defer h.wg.Done()
+			h.templates.watch(ctx)
+		}()
+	}
+	if len(h.holdWindows) > 0 {
+		h.wg.Add(1)
+		go func() {
+			defer h.wg.Done()
+			h.runHoldWindows(ctx)
+		}()
+	}
+	for _, w := range h.windows {
+		if w.calendar != nil {
+			h.wg.Add(1)
+			go func() {
+				defer h.wg.Done()
+				w.calendar.run(ctx, w.Name)
+			}()
+		}
+	}
+	if h.config.Comments.Interval > 0 {
+		h.wg.Add(1)
+		go func() {
+			defer h.wg.Done()
+			h.runComments(ctx)
+		}()
+	}
+	if h.config.Ack.Interval > 0 {
+		h.wg.Add(1)
+		go func() {
+			defer h.wg.Done()
+			h.runAcks(ctx)
+		}()
+	}
+	if h.escalation != nil {
+		h.wg.Add(1)
+		go func() {
+			defer h.wg.Done()
+			h.runEscalations(ctx)
+		}()
+	}
+	if h.config.ActiveAlertsInterval > 0 {
+		h.wg.Add(1)
+		go func() {
+			defer h.wg.Done()
+			h.runActiveAlerts(ctx)
+		}()
+	}
+}
+
+func (h *Handler) Close() error {
+	if h.cancel != nil {
+		h.cancel()
+		if h.queue != nil {
+			h.queue.close()
+		}
+		h.wg.Wait()
+	}
+	h.lua.Close()
+	return h.wasm.Close()
 }
 
 func (h *Handler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
@@ -50,198 +358,404 @@ func (h *Handler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var payload AlertmanagerPayload
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		slog.Error("failed to decode payload", "error", err)
-		http.Error(w, "bad request", http.StatusBadRequest)
+	payload, ok := readPayload(w, r, alertmanagerPayloadVersion)
+	if !ok {
 		return
 	}
 
-	customerID := h.config.CustomerID
-	if group := r.URL.Query().Get("group"); group != "" {
-		if id, ok := h.config.GroupCustomerMap[group]; ok {
-			customerID = id
-		} else {
-			slog.Warn("unknown group, using default customer", "group", group)
-		}
-	}
-
-	for _, alert := range payload.Alerts {
-		if err := h.processAlert(alert, customerID); err != nil {
-			slog.Error("failed to process alert", "fingerprint", alert.Fingerprint, "error", err)
-		}
-	}
+	alerts := h.recoverTruncated(r.Context(), payload)
+	h.accept(w, r, alerts, "alertmanager", r.URL.Query().Get("group"), h.config.CustomerID)
+}
 
-	w.WriteHeader(http.StatusOK)
+// processAlerts runs the alerts of a payload through the pipeline, up to
+// alerts.parallelism at a time, and returns the errors of all of them.
+func (h *Handler) processAlerts(ctx context.Context, alerts []Alert, source, group string, customerID int) error {
+	return h.processInOrder(ctx, alerts, h.order.reserve(alerts, group, tokenCustomer(ctx, customerID)), source, group, customerID)
 }
 
-func (h *Handler) processAlert(alert Alert, customerID int) error {
-	fp := alert.Fingerprint
-	existingID, err := h.getAlertID(fp, customerID)
-	if err != nil && err != badger.ErrKeyNotFound {
-		return fmt.Errorf("db lookup: %w", err)
+// processInOrder is processAlerts for alerts whose turns were reserved on
+// arrival. Each alert waits for the earlier ones with its fingerprint;
+// coalesced alerts only wait for the result of the one they joined.
+func (h *Handler) processInOrder(ctx context.Context, alerts []Alert, turns []*turn, source, group string, customerID int) error {
+	errs := make([]error, len(alerts))
+	receivedAt := time.Now()
+	reqID := processingID(ctx)
+	token := tokenFrom(ctx)
+	customerID = tokenCustomer(ctx, customerID)
+	process := func(i int, alert Alert) {
+		t := turns[i]
+		if t.shared != nil {
+			slog.Debug("coalesced with a pending delivery of the same alert", "fingerprint", alert.Fingerprint, "status", alert.Status, "request_id", reqID)
+			h.recordHistory(HistoryEvent{Fingerprint: alert.Fingerprint, Event: "received", CustomerID: customerID, RequestID: reqID, Detail: fmt.Sprintf("%s from %s, coalesced with a pending delivery", alert.Status, source)})
+			if err := t.result(); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", alert.Fingerprint, err)
+			}
+			return
+		}
+		t.wait()
+		var err error
+		defer func() { h.order.release(t, err) }()
+		ev := &Event{
+			Alert:      normalizeTimes(alert, receivedAt),
+			Source:     source,
+			Group:      group,
+			CustomerID: customerID,
+			ReceivedAt: receivedAt,
+			RequestID:  reqID,
+		}
+		if token != nil {
+			ev.Tags = token.Tags
+		}
+		h.recordHistory(HistoryEvent{Fingerprint: ev.Alert.Fingerprint, Event: "received", CustomerID: customerID, RequestID: reqID, Detail: fmt.Sprintf("%s from %s", ev.Alert.Status, source)})
+		// The payload is taken before the stages change the alert and stored
+		// once routing has picked the customer, failed or not.
+		last, lastErr := h.encodeLastPayload(ev)
+		if err = h.pipeline.Run(ctx, ev); err != nil {
+			slog.Error("failed to process alert", "fingerprint", ev.Alert.Fingerprint, "request_id", ev.RequestID, "error", err, "error_category", countError(err))
+			errs[i] = fmt.Errorf("%s: %w", ev.Alert.Fingerprint, err)
+		}
+		if lastErr == nil {
+			lastErr = h.storeLastPayload(alert.Fingerprint, ev.CustomerID, last)
+		}
+		if lastErr != nil {
+			slog.Warn("failed to store last payload", "fingerprint", alert.Fingerprint, "request_id", ev.RequestID, "error", lastErr)
+		}
 	}
-	exists := err == nil
 
-	switch alert.Status {
-	case "firing":
-		if exists {
-			return h.updateAlert(existingID, alert, customerID)
+	if h.config.Parallelism <= 1 || len(alerts) == 1 {
+		for i, alert := range alerts {
+			process(i, alert)
 		}
-		return h.createAlert(alert, customerID)
-	case "resolved":
-		if !exists {
-			slog.Warn("resolved alert not found in db, skipping", "fingerprint", fp)
-			return nil
-		}
-		return h.resolveAlert(existingID, alert, customerID)
-	default:
-		slog.Warn("unknown alert status", "status", alert.Status, "fingerprint", fp)
-		return nil
+		return errors.Join(errs...)
 	}
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, h.config.Parallelism)
+	for i, alert := range alerts {
+		slots <- struct{}{}
+		wg.Go(func() {
+			defer func() { <-slots }()
+			process(i, alert)
+		})
+	}
+	wg.Wait()
+	return errors.Join(errs...)
 }
 
-func (h *Handler) createAlert(alert Alert, customerID int) error {
-	sourceContent, _ := json.Marshal(alert)
-
-	req := IRISAlertRequest{
-		Title:            alert.Labels["alertname"],
-		Description:      alertDescription(alert),
-		Source:           h.config.Source,
-		SourceRef:        alert.Fingerprint,
-		SourceLink:       alert.GeneratorURL,
-		SourceEventTime:  alert.StartsAt,
-		SourceContent:    json.RawMessage(sourceContent),
-		SeverityID:       h.severityID(alert),
-		StatusID:         h.config.StatusIDNew,
-		CustomerID:       customerID,
-		Tags:             alert.Labels["alertname"],
+func (h *Handler) sinkAlert(alert Alert, customerID int) *SinkAlert {
+	sa := &SinkAlert{
+		Fingerprint:   alert.Fingerprint,
+		Title:         h.title(alert),
+		Description:   h.alertDescription(alert),
+		Source:        h.config.Source,
+		SourceLink:    h.runbook.sourceLink(alert),
+		EventTime:     alert.StartsAt.In(h.location),
+		SourceContent: h.sourceContent(alert),
+		SeverityID:    h.severityID(alert),
+		CustomerID:    customerID,
+		Tags:          append(h.tags(alert), h.config.Tags.labelTags(alert)...),
+		Alert:         alert,
 	}
-
-	alertID, err := h.iris.CreateAlert(req, customerID)
-	if err != nil {
-		return fmt.Errorf("create iris alert: %w", err)
+	if h.config.IOCs.Enabled {
+		sa.IOCs = alertIOCs(alert, h.iocRules)
 	}
-
-	if err := h.storeAlertID(alert.Fingerprint, alertID, customerID); err != nil {
-		return fmt.Errorf("store alert mapping: %w", err)
+	if links := h.traces.links(alert); links != "" {
+		sa.Description = strings.TrimRight(sa.Description, "\n") + "\n\n" + links
 	}
-
-	slog.Info("created iris alert", "fingerprint", alert.Fingerprint, "alert_id", alertID)
-	return nil
+	h.runbook.apply(sa, h.descriptionFields)
+	return sa
 }
 
-func (h *Handler) updateAlert(alertID int, alert Alert, customerID int) error {
-	sourceContent, _ := json.Marshal(alert)
-	desc := alertDescription(alert)
-	sevID := h.severityID(alert)
-	tags := alert.Labels["alertname"]
-
-	req := IRISAlertUpdateRequest{
-		Description:     &desc,
-		SourceEventTime: &alert.StartsAt,
-		SourceContent:   json.RawMessage(sourceContent),
-		SeverityID:      &sevID,
-		Tags:            &tags,
+func (h *Handler) deliverAlert(ctx context.Context, ids map[string]string, names []string, base *SinkAlert) error {
+	var errs []error
+	created := false
+	for _, name := range names {
+		s, ok := h.sinks[name]
+		if !ok {
+			errs = append(errs, categorize(ErrorRouting, fmt.Errorf("sink %q is not configured", name)))
+			continue
+		}
+		if name == "iris" && h.held() {
+			h.holdDelivery(name, "firing", base)
+			continue
+		}
+		isNew, err := h.deliverToSink(ctx, s, ids[name], base)
+		if err != nil {
+			h.recordHistory(HistoryEvent{Fingerprint: base.Fingerprint, Event: "delivery failed", Sink: name, CustomerID: base.CustomerID, AlertID: ids[name], Error: err.Error()})
+			errs = append(errs, err)
+			h.scheduleRetry(name, "firing", base, err)
+			continue
+		}
+		h.clearRetry(name, base.Fingerprint, base.CustomerID)
+		created = created || isNew
 	}
 
-	if err := h.iris.UpdateAlert(alertID, req, customerID); err != nil {
-		return fmt.Errorf("update iris alert %d: %w", alertID, err)
+	if created {
+		if err := h.clearOccurrences(base.Fingerprint, base.CustomerID); err != nil {
+			slog.Warn("failed to clear occurrence counter", "fingerprint", base.Fingerprint, "request_id", base.RequestID, "error", err)
+		}
 	}
-
-	slog.Info("updated iris alert", "fingerprint", alert.Fingerprint, "alert_id", alertID)
-	return nil
+	return errors.Join(errs...)
 }
 
-func (h *Handler) resolveAlert(alertID int, alert Alert, customerID int) error {
-	if h.config.ResolvedAction == "delete" {
-		if err := h.iris.DeleteAlert(alertID, customerID); err != nil {
-			return fmt.Errorf("delete iris alert %d: %w", alertID, err)
+// deliverToSink updates the sink's alert when id is set and creates it
+// otherwise, reporting whether a new alert was created.
+func (h *Handler) deliverToSink(ctx context.Context, s Sink, id string, base *SinkAlert) (bool, error) {
+	fp := base.Fingerprint
+	if id != "" {
+		sa, proceed, err := h.runHook("pre_update", s.Name(), base)
+		if err != nil {
+			return false, err
+		}
+		if !proceed {
+			slog.Info("update cancelled by lua hook", "sink", s.Name(), "fingerprint", fp, "request_id", base.RequestID, "alert_id", id)
+			h.recordHistory(HistoryEvent{Fingerprint: fp, Event: "cancelled", Sink: s.Name(), CustomerID: base.CustomerID, AlertID: id, Detail: "pre_update lua hook"})
+			return false, nil
+		}
+		var repeat *repeatState
+		var raisedBy string
+		if s.Name() == "iris" {
+			if repeat, raisedBy, err = h.repeatEscalation(sa); err != nil {
+				slog.Warn("failed to load repeat state", "fingerprint", fp, "request_id", base.RequestID, "error", err)
+			}
+			h.applyEscalation(sa)
+			if is, ok := s.(*irisSink); ok {
+				if err := h.reconcileUpdate(ctx, is, id, sa); err != nil {
+					slog.Warn("failed to look up current alert", "fingerprint", fp, "request_id", base.RequestID, "alert_id", id, "error", err)
+				}
+			}
+		}
+		if err := s.Update(ctx, id, sa); err != nil {
+			return false, fmt.Errorf("update %s alert %s: %w", s.Name(), id, err)
+		}
+		slog.Info("updated alert", "sink", s.Name(), "fingerprint", fp, "request_id", base.RequestID, "alert_id", id)
+		h.observeLatency(s.Name(), "update", sa)
+		if err := h.storeAlertState(s.Name(), fp, base.CustomerID, id, sa); err != nil {
+			slog.Warn("failed to store alert state", "sink", s.Name(), "fingerprint", fp, "request_id", base.RequestID, "error", err)
+		}
+		h.recordHistory(HistoryEvent{Fingerprint: fp, Event: "updated", Sink: s.Name(), CustomerID: base.CustomerID, AlertID: id, RequestID: base.RequestID})
+		if repeat != nil {
+			if err := h.storeRepeat(fp, base.CustomerID, repeat); err != nil {
+				slog.Warn("failed to store repeat state", "fingerprint", fp, "request_id", base.RequestID, "error", err)
+			}
 		}
-		slog.Info("deleted iris alert", "fingerprint", alert.Fingerprint, "alert_id", alertID)
-	} else {
-		statusID := h.config.StatusIDResolved
-		req := IRISAlertUpdateRequest{
-			StatusID: &statusID,
+		if raisedBy != "" {
+			h.noteRepeatEscalation(ctx, s, id, sa, raisedBy)
 		}
-		if err := h.iris.UpdateAlert(alertID, req, customerID); err != nil {
-			return fmt.Errorf("resolve iris alert %d: %w", alertID, err)
+		if s.Name() == "iris" {
+			escalated, err := h.trackSeverity(fp, sa.CustomerID, sa.SeverityID)
+			if err != nil {
+				slog.Warn("failed to track severity", "fingerprint", fp, "request_id", base.RequestID, "error", err)
+			}
+			if escalated {
+				h.notifyIRIS("escalated", id, sa)
+			}
 		}
-		slog.Info("resolved iris alert", "fingerprint", alert.Fingerprint, "alert_id", alertID)
+		return false, nil
 	}
 
-	if err := h.deleteAlertID(alert.Fingerprint, customerID); err != nil {
-		return fmt.Errorf("delete alert mapping: %w", err)
+	sa, proceed, err := h.runHook("pre_create", s.Name(), base)
+	if err != nil {
+		return false, err
 	}
-	return nil
+	if !proceed {
+		slog.Info("create cancelled by lua hook", "sink", s.Name(), "fingerprint", fp, "request_id", base.RequestID)
+		h.recordHistory(HistoryEvent{Fingerprint: fp, Event: "cancelled", Sink: s.Name(), CustomerID: base.CustomerID, Detail: "pre_create lua hook"})
+		return false, nil
+	}
+	if s.Name() == "iris" {
+		if note := h.templates.note(sa.Alert); note != "" {
+			appendNoteSection(sa, note)
+		}
+		h.enrich(ctx, sa)
+		h.runQueries(ctx, sa)
+		h.noteLogs(ctx, sa)
+		if h.config.RequestIDNote && sa.RequestID != "" {
+			appendNoteSection(sa, fmt.Sprintf("Alertiris:\n- request id: %s\n- fingerprint: %s", sa.RequestID, fp))
+		}
+		if is, ok := s.(*irisSink); ok && h.config.Assets.Enabled {
+			h.resolveAssets(ctx, is, sa)
+		}
+	}
+	id, err = s.Create(ctx, sa)
+	if err != nil {
+		return false, fmt.Errorf("create %s alert: %w", s.Name(), err)
+	}
+	if err := h.storeAlertState(s.Name(), fp, base.CustomerID, id, sa); err != nil {
+		return false, categorize(ErrorStore, fmt.Errorf("store %s alert mapping: %w", s.Name(), err))
+	}
+	slog.Info("created alert", "sink", s.Name(), "fingerprint", fp, "request_id", base.RequestID, "alert_id", id)
+	h.observeLatency(s.Name(), "create", sa)
+	h.recordHistory(HistoryEvent{Fingerprint: fp, Event: "created", Sink: s.Name(), CustomerID: base.CustomerID, AlertID: id, RequestID: base.RequestID})
+	if s.Name() == "iris" {
+		if _, err := h.trackSeverity(fp, sa.CustomerID, sa.SeverityID); err != nil {
+			slog.Warn("failed to track severity", "fingerprint", fp, "request_id", base.RequestID, "error", err)
+		}
+		if err := h.startEscalation(base); err != nil {
+			slog.Warn("failed to start escalation clock", "fingerprint", fp, "request_id", base.RequestID, "error", err)
+		}
+		if err := h.startComments(fp, base.CustomerID); err != nil {
+			slog.Warn("failed to start comment sync", "fingerprint", fp, "request_id", base.RequestID, "error", err)
+		}
+		h.notifyIRIS("created", id, sa)
+		h.notifyTeam(id, sa)
+		h.attachSnapshot(ctx, id, sa)
+		h.uploadLogs(ctx, id, sa)
+		h.correlate(ctx, id, sa)
+	}
+	return true, nil
 }
 
-func (h *Handler) severityID(alert Alert) int {
-	if sev, ok := alert.Labels["severity"]; ok {
-		if id, ok := h.config.SeverityMap[sev]; ok {
-			return id
+func (h *Handler) resolveAlert(ctx context.Context, ids map[string]string, base *SinkAlert) error {
+	var errs []error
+	for _, name := range h.sinkNames {
+		id, ok := ids[name]
+		if !ok {
+			// Nothing was created in this sink, so a pending create is moot.
+			h.clearRetry(name, base.Fingerprint, base.CustomerID)
+			continue
+		}
+		if name == "iris" && h.held() {
+			h.holdDelivery(name, "resolved", base)
+			continue
+		}
+		if err := h.resolveInSink(ctx, h.sinks[name], id, base); err != nil {
+			h.recordHistory(HistoryEvent{Fingerprint: base.Fingerprint, Event: "resolve failed", Sink: name, CustomerID: base.CustomerID, AlertID: id, Error: err.Error()})
+			errs = append(errs, err)
+			h.scheduleRetry(name, "resolved", base, err)
+			continue
 		}
+		h.clearRetry(name, base.Fingerprint, base.CustomerID)
 	}
-	return h.config.DefaultSeverityID
+	return errors.Join(errs...)
 }
 
-func (h *Handler) getAlertID(fingerprint string, customerID int) (int, error) {
-	var alertID int
-	err := h.db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get(dbKey(fingerprint, customerID))
-		if err != nil {
-			return err
+func (h *Handler) resolveInSink(ctx context.Context, s Sink, id string, base *SinkAlert) error {
+	fp := base.Fingerprint
+	sa, proceed, err := h.runHook("pre_resolve", s.Name(), base)
+	if err != nil {
+		return err
+	}
+	if !proceed {
+		slog.Info("resolve cancelled by lua hook", "sink", s.Name(), "fingerprint", fp, "request_id", base.RequestID, "alert_id", id)
+		h.recordHistory(HistoryEvent{Fingerprint: fp, Event: "cancelled", Sink: s.Name(), CustomerID: base.CustomerID, AlertID: id, Detail: "pre_resolve lua hook"})
+		return nil
+	}
+	if err := s.Resolve(ctx, id, sa); err != nil {
+		return fmt.Errorf("resolve %s alert %s: %w", s.Name(), id, err)
+	}
+	if err := h.deleteSinkID(s.Name(), fp, base.CustomerID); err != nil {
+		return categorize(ErrorStore, fmt.Errorf("delete %s alert mapping: %w", s.Name(), err))
+	}
+	slog.Info("resolved alert", "sink", s.Name(), "fingerprint", fp, "request_id", base.RequestID, "alert_id", id)
+	h.observeLatency(s.Name(), "resolve", sa)
+	h.recordHistory(HistoryEvent{Fingerprint: fp, Event: "resolved", Sink: s.Name(), CustomerID: base.CustomerID, AlertID: id, RequestID: base.RequestID})
+	if s.Name() == "iris" {
+		if err := h.clearSeverity(fp, base.CustomerID); err != nil {
+			slog.Warn("failed to clear severity", "fingerprint", fp, "request_id", base.RequestID, "error", err)
 		}
-		return item.Value(func(val []byte) error {
-			id, err := strconv.Atoi(string(val))
-			if err != nil {
-				return err
-			}
-			alertID = id
-			return nil
-		})
-	})
-	return alertID, err
+		if err := h.clearEscalation(fp, base.CustomerID); err != nil {
+			slog.Warn("failed to clear escalation state", "fingerprint", fp, "request_id", base.RequestID, "error", err)
+		}
+		if err := h.clearAck(fp, base.CustomerID); err != nil {
+			slog.Warn("failed to clear acknowledgement", "fingerprint", fp, "request_id", base.RequestID, "error", err)
+		}
+		if err := h.clearComments(fp, base.CustomerID); err != nil {
+			slog.Warn("failed to clear comment state", "fingerprint", fp, "request_id", base.RequestID, "error", err)
+		}
+		if err := h.clearRepeat(fp, base.CustomerID); err != nil {
+			slog.Warn("failed to clear repeat state", "fingerprint", fp, "request_id", base.RequestID, "error", err)
+		}
+	}
+	return nil
 }
 
-func (h *Handler) storeAlertID(fingerprint string, alertID int, customerID int) error {
-	return h.db.Update(func(txn *badger.Txn) error {
-		return txn.Set(dbKey(fingerprint, customerID), []byte(strconv.Itoa(alertID)))
-	})
+// runHook gives the Lua hook its own copy of the request so changes made for
+// one sink do not leak into the next.
+func (h *Handler) runHook(hook, sink string, base *SinkAlert) (*SinkAlert, bool, error) {
+	sa := *base
+	sa.Tags = slices.Clone(base.Tags)
+	proceed, err := h.lua.Run(hook, sink, &sa)
+	if err != nil {
+		return nil, false, fmt.Errorf("lua hook: %w", err)
+	}
+	return &sa, proceed, nil
 }
 
-func (h *Handler) deleteAlertID(fingerprint string, customerID int) error {
-	return h.db.Update(func(txn *badger.Txn) error {
-		return txn.Delete(dbKey(fingerprint, customerID))
-	})
+func (h *Handler) title(alert Alert) string {
+	if title, ok := h.templates.title(alert); ok {
+		return title
+	}
+	title, ok, err := h.transformer.Title(alert)
+	if err != nil {
+		slog.Warn("title expression failed, using alertname", "fingerprint", alert.Fingerprint, "error", err)
+	}
+	if ok {
+		return title
+	}
+	return alert.Labels["alertname"]
 }
 
-func dbKey(fingerprint string, customerID int) []byte {
-	return []byte("fp:" + fingerprint + ":" + strconv.Itoa(customerID))
+func (h *Handler) tags(alert Alert) []string {
+	if tags, ok := h.templates.tags(alert); ok {
+		return tags
+	}
+	tags, ok, err := h.transformer.Tags(alert)
+	if err != nil {
+		slog.Warn("tags expression failed, using alertname", "fingerprint", alert.Fingerprint, "error", err)
+	}
+	if ok {
+		return tags
+	}
+	if name := alert.Labels["alertname"]; name != "" {
+		return []string{name}
+	}
+	return nil
 }
 
-func alertDescription(alert Alert) string {
-	var lines []string
+func (h *Handler) severityID(alert Alert) int {
+	return overrideSeverity(h.severityOverrides, alert.Labels, h.baseSeverityID(alert))
+}
 
-	add := func(key, val string) {
-		if val != "" {
-			lines = append(lines, key+": "+val)
+// baseSeverityID returns the severity of an alert from the transform or
+// the severity map.
+func (h *Handler) baseSeverityID(alert Alert) int {
+	sev, ok, err := h.transformer.Severity(alert)
+	if err != nil {
+		slog.Warn("severity expression failed, using severity map", "fingerprint", alert.Fingerprint, "error", err)
+	}
+	if ok {
+		switch sev := sev.(type) {
+		case int:
+			return sev
+		case string:
+			if id, ok := h.settings().SeverityMap[sev]; ok {
+				return id
+			}
+			slog.Warn("severity expression returned unknown severity", "fingerprint", alert.Fingerprint, "severity", sev)
+		}
+	}
+	if sev, ok := alert.Labels["severity"]; ok {
+		if id, ok := h.settings().SeverityMap[sev]; ok {
+			return id
 		}
 	}
+	return h.config.DefaultSeverityID
+}
 
-	add("Alert", alert.Labels["alertname"])
-	add("Severity", alert.Labels["severity"])
-	add("Description", alert.Annotations["description"])
-	add("Summary", alert.Annotations["summary"])
-	add("Hostname", alert.Labels["hostname"])
-	add("Instance", alert.Labels["instance_name"])
-	add("Service", alert.Labels["service"])
-	add("Group", alert.Labels["group"])
-	add("Tier", alert.Labels["tier"])
-	add("Load", alert.Annotations["load"])
-	add("Started At", alert.StartsAt)
-	add("Fingerprint", alert.Fingerprint)
-	add("Generator URL", alert.GeneratorURL)
+func normalizeTimes(alert Alert, receivedAt time.Time) Alert {
+	if alert.StartsAt.IsZero() {
+		slog.Warn("alert has no start time, using receive time", "fingerprint", alert.Fingerprint)
+		alert.StartsAt = receivedAt
+	}
+	if alert.Status == "resolved" && alert.EndsAt.IsZero() {
+		alert.EndsAt = receivedAt
+	}
+	return alert
+}
 
-	return strings.Join(lines, "\n")
+func (h *Handler) formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.In(h.location).Format(h.config.TimeFormat)
 }
@@ -0,0 +1,88 @@
+package alertiris
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// HistoryEvent is one step the bridge took for an alert.
+type HistoryEvent struct {
+	Time        time.Time `json:"time"`
+	Fingerprint string    `json:"fingerprint"`
+	Event       string    `json:"event"`
+	Sink        string    `json:"sink,omitempty"`
+	CustomerID  int       `json:"customer_id,omitempty"`
+	AlertID     string    `json:"alert_id,omitempty"`
+	RequestID   string    `json:"request_id,omitempty"`
+	Detail      string    `json:"detail,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// historySeq keeps keys of events recorded in the same nanosecond apart.
+var historySeq atomic.Uint32
+
+// recordHistory stores ev for alerts.history_ttl and queues it for S3 when
+// shipping. Failures are only logged.
+func (h *Handler) recordHistory(ev HistoryEvent) {
+	ttl := h.config.HistoryTTL
+	if (ttl <= 0 && !h.shipHistory) || ev.Fingerprint == "" {
+		return
+	}
+	ev.Time = time.Now()
+	val, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	seq := historySeq.Add(1)
+	key := fmt.Sprintf("hist:%s:%020d:%05d", ev.Fingerprint, ev.Time.UnixNano(), seq%100000)
+	if err := h.db.Update(func(txn *badger.Txn) error {
+		if h.shipHistory {
+			if err := s3Enqueue(txn, "history", ev.Time, seq, val); err != nil {
+				return err
+			}
+		}
+		if ttl <= 0 {
+			return nil
+		}
+		return txn.SetEntry(badger.NewEntry([]byte(key), val).WithTTL(ttl))
+	}); err != nil {
+		slog.Warn("failed to record history", "fingerprint", ev.Fingerprint, "event", ev.Event, "error", err)
+	}
+}
+
+// ListHistory returns the recorded events of fingerprint, oldest first.
+func ListHistory(db *badger.DB, fingerprint string) ([]HistoryEvent, error) {
+	out := []HistoryEvent{}
+	err := db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte("hist:" + fingerprint + ":")
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			var ev HistoryEvent
+			if err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &ev)
+			}); err != nil {
+				return err
+			}
+			out = append(out, ev)
+		}
+		return nil
+	})
+	return out, err
+}
+
+func (h *Handler) adminHistory(w http.ResponseWriter, r *http.Request) {
+	events, err := ListHistory(h.db, r.PathValue("fingerprint"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, events)
+}
@@ -0,0 +1,258 @@
+package alertiris
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/dgraph-io/badger/v4"
+)
+
+// holdKey stores when hold mode was enabled, so it survives restarts.
+var holdKey = []byte("admin:hold")
+
+var (
+	holdGauge      = metrics.GetOrCreateGauge(`alertiris_hold`, nil)
+	heldDeliveries = metrics.NewCounter(`alertiris_held_deliveries_total`)
+)
+
+// HoldStatus reports hold mode. While it is enabled, or a hold window is
+// open, nothing is sent to IRIS: deliveries are parked in the retry queue
+// and sent once it ends. Held is the number of IRIS deliveries in the
+// retry queue.
+type HoldStatus struct {
+	Enabled bool      `json:"enabled"`
+	Since   time.Time `json:"since,omitzero"`
+	Window  string    `json:"window,omitempty"`
+	Held    int       `json:"held"`
+}
+
+// HoldWindowConfig is a window during which delivery to IRIS is held, such
+// as a nightly IRIS backup: either a fixed interval (Start, End) or a
+// five-field cron Schedule opening it for Duration.
+type HoldWindowConfig struct {
+	Name     string        `koanf:"name"`
+	Start    time.Time     `koanf:"start"`
+	End      time.Time     `koanf:"end"`
+	Schedule string        `koanf:"schedule"`
+	Duration time.Duration `koanf:"duration"`
+	Timezone string        `koanf:"timezone"`
+}
+
+// newHoldWindows builds hold windows on maintenance windows, which open and
+// close the same way.
+func newHoldWindows(cfgs []HoldWindowConfig) ([]*maintenanceWindow, error) {
+	var mcfgs []MaintenanceWindowConfig
+	for i, cfg := range cfgs {
+		if cfg.Name == "" {
+			cfg.Name = fmt.Sprintf("hold-%d", i)
+		}
+		mcfgs = append(mcfgs, MaintenanceWindowConfig{Name: cfg.Name, Start: cfg.Start, End: cfg.End, Schedule: cfg.Schedule, Duration: cfg.Duration, Timezone: cfg.Timezone})
+	}
+	return newMaintenanceWindows(mcfgs)
+}
+
+func (h *Handler) held() bool {
+	return h.holdSince.Load() != 0 || h.holdWindow.Load() != nil
+}
+
+// runHoldWindows tracks the open hold window. When the last one closes the
+// deliveries queued meanwhile are sent right away, in retry queue order.
+func (h *Handler) runHoldWindows(ctx context.Context) {
+	ticker := time.NewTicker(15 * time.Second)
+	defer ticker.Stop()
+	for {
+		var open *string
+		now := time.Now()
+		for _, w := range h.holdWindows {
+			if w.Active(now) {
+				open = &w.Name
+				break
+			}
+		}
+		prev := h.holdWindow.Swap(open)
+		switch {
+		case open != nil && prev == nil:
+			slog.Info("hold window opened, queuing deliveries to iris", "window", *open)
+		case open == nil && prev != nil:
+			slog.Info("hold window closed, sending queued deliveries", "window", *prev)
+			h.wakeRetries()
+		}
+		h.setHoldGauge()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *Handler) setHoldGauge() {
+	if h.held() {
+		holdGauge.Set(1)
+	} else {
+		holdGauge.Set(0)
+	}
+}
+
+// wakeRetries sends what was held right away rather than on the next tick.
+func (h *Handler) wakeRetries() {
+	select {
+	case h.retryNow <- struct{}{}:
+	default:
+	}
+}
+
+func (h *Handler) loadHold() error {
+	return h.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(holdKey)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			since, err := time.Parse(time.RFC3339Nano, string(val))
+			if err != nil {
+				return fmt.Errorf("parse hold time: %w", err)
+			}
+			h.holdSince.Store(since.UnixNano())
+			h.setHoldGauge()
+			slog.Warn("hold mode is enabled, not sending to iris", "since", since)
+			return nil
+		})
+	})
+}
+
+func (h *Handler) setHold(enabled bool) error {
+	if enabled == (h.holdSince.Load() != 0) {
+		return nil
+	}
+	now := time.Now()
+	err := h.db.Update(func(txn *badger.Txn) error {
+		if !enabled {
+			return txn.Delete(holdKey)
+		}
+		return txn.Set(holdKey, []byte(now.Format(time.RFC3339Nano)))
+	})
+	if err != nil {
+		return err
+	}
+	if enabled {
+		h.holdSince.Store(now.UnixNano())
+	} else {
+		h.holdSince.Store(0)
+		h.wakeRetries()
+	}
+	h.setHoldGauge()
+	slog.Info("hold mode changed", "enabled", enabled)
+	return nil
+}
+
+func (h *Handler) holdStatus() (HoldStatus, error) {
+	status := HoldStatus{Enabled: h.holdSince.Load() != 0}
+	if status.Enabled {
+		status.Since = time.Unix(0, h.holdSince.Load())
+	}
+	if w := h.holdWindow.Load(); w != nil {
+		status.Window = *w
+	}
+	err := h.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte("retry:iris:")
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			status.Held++
+		}
+		return nil
+	})
+	return status, err
+}
+
+// holdDelivery parks a delivery in the retry queue without counting an
+// attempt. A later delivery of the same alert replaces it, so only the
+// latest state is sent when hold mode ends.
+func (h *Handler) holdDelivery(sink, status string, sa *SinkAlert) {
+	key := retryKey(sink, sa.Fingerprint, sa.CustomerID)
+	err := h.db.Update(func(txn *badger.Txn) error {
+		entry := retryEntry{Sink: sink, Status: status, Alert: sa, LastError: "held", NextAttempt: time.Now()}
+		item, err := txn.Get(key)
+		if err != nil && err != badger.ErrKeyNotFound {
+			return err
+		}
+		if err == nil {
+			var prev retryEntry
+			if err := item.Value(func(val []byte) error {
+				return json.Unmarshal(val, &prev)
+			}); err != nil {
+				return err
+			}
+			if prev.Status == status {
+				entry.Attempts = prev.Attempts
+			}
+		}
+		val, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		return txn.Set(key, val)
+	})
+	if err != nil {
+		slog.Error("failed to hold delivery", "sink", sink, "fingerprint", sa.Fingerprint, "request_id", sa.RequestID, "error", err)
+		return
+	}
+	heldDeliveries.Inc()
+	slog.Info("holding delivery, queued until hold ends", "sink", sink, "status", status, "fingerprint", sa.Fingerprint, "request_id", sa.RequestID)
+	h.recordHistory(HistoryEvent{Fingerprint: sa.Fingerprint, Event: "held", Sink: sink, CustomerID: sa.CustomerID, RequestID: sa.RequestID, Detail: status})
+}
+
+func (h *Handler) adminGetHold(w http.ResponseWriter, r *http.Request) {
+	status, err := h.holdStatus()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (h *Handler) adminSetHold(w http.ResponseWriter, r *http.Request) {
+	var req HoldStatus
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("decode request: %w", err))
+		return
+	}
+	if err := h.setHold(req.Enabled); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.adminGetHold(w, r)
+}
+
+// readiness is served at /readyz. Hold mode does not make the bridge
+// unready, webhooks are still accepted and queued, but is reported.
+type readiness struct {
+	Status string      `json:"status"`
+	Hold   *HoldStatus `json:"hold,omitempty"`
+}
+
+func (a *App) handleReady(w http.ResponseWriter, r *http.Request) {
+	ready := readiness{Status: "ready"}
+	if a.handler.held() {
+		status, err := a.handler.holdStatus()
+		if err != nil {
+			writeError(w, http.StatusServiceUnavailable, err)
+			return
+		}
+		ready.Status = "hold"
+		ready.Hold = &status
+	}
+	writeJSON(w, http.StatusOK, ready)
+}
@@ -0,0 +1,101 @@
+package alertiris
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+type ImportResult struct {
+	Imported []Mapping `json:"imported"`
+	Existing int       `json:"existing"`
+	Skipped  int       `json:"skipped"`
+}
+
+// importIRIS seeds the IRIS mappings from the open alerts in IRIS created by
+// this bridge, so a fresh database does not duplicate alerts that are still
+// firing. IRIS alerts carry the fingerprint as their source reference.
+func (h *Handler) importIRIS(ctx context.Context, overwrite, dryRun bool) (ImportResult, error) {
+	var res ImportResult
+	s, ok := h.sinks["iris"].(*irisSink)
+	if !ok {
+		return res, fmt.Errorf("the iris sink is not configured")
+	}
+
+	alerts, err := s.client.FilterAlerts(ctx, url.Values{"alert_source": {h.config.Source}}, h.config.CustomerID)
+	if err != nil {
+		return res, fmt.Errorf("list iris alerts: %w", err)
+	}
+
+	err = h.db.Update(func(txn *badger.Txn) error {
+		for _, a := range alerts {
+			if a.SourceRef == "" || a.Source != h.config.Source || a.StatusID == h.config.StatusIDResolved {
+				res.Skipped++
+				continue
+			}
+
+			key := mappingKey("iris", a.SourceRef, a.CustomerID)
+			if !overwrite {
+				_, err := txn.Get(key)
+				if err == nil {
+					res.Existing++
+					continue
+				}
+				if err != badger.ErrKeyNotFound {
+					return err
+				}
+			}
+
+			m := Mapping{Sink: "iris", Fingerprint: a.SourceRef, CustomerID: a.CustomerID, AlertID: strconv.Itoa(a.AlertID)}
+			res.Imported = append(res.Imported, m)
+			if dryRun {
+				continue
+			}
+			st := AlertState{AlertID: m.AlertID, Status: "firing", SeverityID: a.SeverityID}
+			var alert Alert
+			if json.Unmarshal(a.SourceContent, &alert) == nil {
+				st.Labels, st.Annotations = alert.Labels, alert.Annotations
+				st.StartsAt, st.EndsAt = alert.StartsAt, alert.EndsAt
+			}
+			val, err := json.Marshal(st)
+			if err != nil {
+				return err
+			}
+			if err := txn.Set(key, val); err != nil {
+				return err
+			}
+			// Seed the severity too so escalations are detected.
+			sevKey := []byte("sev:" + a.SourceRef + ":" + strconv.Itoa(a.CustomerID))
+			if err := txn.Set(sevKey, []byte(strconv.Itoa(a.SeverityID))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return res, err
+	}
+	slog.Info("imported iris mappings", "imported", len(res.Imported), "existing", res.Existing, "skipped", res.Skipped, "dry_run", dryRun)
+	return res, nil
+}
+
+func (h *Handler) adminImport(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	res, err := h.importIRIS(r.Context(), q.Get("overwrite") == "true", q.Get("dry_run") == "true")
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// ImportIRIS seeds the fingerprint mappings from the open IRIS alerts.
+func (a *App) ImportIRIS(ctx context.Context, overwrite, dryRun bool) (ImportResult, error) {
+	return a.handler.importIRIS(ctx, overwrite, dryRun)
+}
@@ -0,0 +1,139 @@
+package alertiris
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type InternetDBConfig struct {
+	Enabled    bool          `koanf:"enabled"`
+	URL        string        `koanf:"url"`
+	RateLimit  int           `koanf:"rate_limit"`
+	CacheTTL   time.Duration `koanf:"cache_ttl"`
+	MaxLookups int           `koanf:"max_lookups"`
+	Timeout    time.Duration `koanf:"timeout"`
+}
+
+// internetDB adds the open ports, hostnames and known CVEs Shodan has seen
+// on public IPs to the alert note. It needs no API key.
+type internetDB struct {
+	cfg     InternetDBConfig
+	client  *http.Client
+	cache   *enrichmentCache
+	limiter *lookupLimiter
+}
+
+type internetDBHost struct {
+	Found     bool     `json:"found"`
+	Ports     []int    `json:"ports"`
+	Hostnames []string `json:"hostnames"`
+	Vulns     []string `json:"vulns"`
+	Tags      []string `json:"tags"`
+}
+
+func newInternetDB(cfg InternetDBConfig, cache *enrichmentCache) *internetDB {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &internetDB{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: cfg.Timeout},
+		cache:   cache,
+		limiter: &lookupLimiter{limit: cfg.RateLimit},
+	}
+}
+
+func (d *internetDB) name() string { return "internetdb" }
+
+func (d *internetDB) enrich(ctx context.Context, sa *SinkAlert, iocs []IOC) string {
+	var lines []string
+	lookups := 0
+	for _, ioc := range iocs {
+		if (ioc.Type != IOCIPv4 && ioc.Type != IOCIPv6) || !publicIP(ioc.Value) {
+			continue
+		}
+		if d.cfg.MaxLookups > 0 && lookups >= d.cfg.MaxLookups {
+			break
+		}
+		lookups++
+		host, err := d.lookup(ctx, ioc.Value)
+		if err != nil {
+			slog.Warn("internetdb lookup failed", "fingerprint", sa.Fingerprint, "ip", ioc.Value, "error", err)
+			continue
+		}
+		if !host.Found {
+			lines = append(lines, fmt.Sprintf("- %s: no information", ioc.Value))
+			continue
+		}
+		ports := make([]string, len(host.Ports))
+		for i, p := range host.Ports {
+			ports[i] = strconv.Itoa(p)
+		}
+		line := fmt.Sprintf("- %s: ports %s", ioc.Value, orNone(ports))
+		line += "; hostnames " + orNone(host.Hostnames)
+		line += "; vulns " + orNone(host.Vulns)
+		if len(host.Tags) > 0 {
+			line += "; tags " + strings.Join(host.Tags, ", ")
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return "Shodan InternetDB:\n" + strings.Join(lines, "\n")
+}
+
+func orNone(values []string) string {
+	if len(values) == 0 {
+		return "none"
+	}
+	return strings.Join(values, ", ")
+}
+
+func (d *internetDB) lookup(ctx context.Context, ip string) (internetDBHost, error) {
+	var host internetDBHost
+	if d.cache.get("internetdb", ip, &host) {
+		enrichmentLookups("internetdb", "cached").Inc()
+		return host, nil
+	}
+	if !d.limiter.allow() {
+		enrichmentLookups("internetdb", "rate_limited").Inc()
+		return host, fmt.Errorf("rate limit of %d lookups per minute reached", d.cfg.RateLimit)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(d.cfg.URL, "/")+"/"+url.PathEscape(ip), nil)
+	if err != nil {
+		return host, fmt.Errorf("create request: %w", err)
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		enrichmentFailed("internetdb")
+		return host, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if err := json.NewDecoder(resp.Body).Decode(&host); err != nil {
+			enrichmentFailed("internetdb")
+			return host, fmt.Errorf("decode response: %w", err)
+		}
+		host.Found = true
+	case http.StatusNotFound:
+	default:
+		enrichmentFailed("internetdb")
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return host, fmt.Errorf("internetdb returned %s: %s", resp.Status, msg)
+	}
+	enrichmentLookups("internetdb", "ok").Inc()
+	d.cache.set("internetdb", ip, host, d.cfg.CacheTTL)
+	return host, nil
+}
@@ -0,0 +1,278 @@
+package alertiris
+
+import (
+	"fmt"
+	"maps"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// IOC types detected by ExtractIOCs.
+const (
+	IOCIPv4   = "ipv4"
+	IOCIPv6   = "ipv6"
+	IOCDomain = "domain"
+	IOCURL    = "url"
+	IOCEmail  = "email"
+	IOCMD5    = "md5"
+	IOCSHA1   = "sha1"
+	IOCSHA256 = "sha256"
+	IOCCVE    = "cve"
+)
+
+// IOC is an indicator of compromise found in alert text.
+type IOC struct {
+	Type  string `json:"type" expr:"type"`
+	Value string `json:"value" expr:"value"`
+}
+
+var (
+	urlRe    = regexp.MustCompile(`(?i)\b(?:https?|ftp)://[^\s<>"'` + "`" + `]+`)
+	emailRe  = regexp.MustCompile(`(?i)\b[a-z0-9._%+-]+@(?:[a-z0-9-]+\.)+[a-z]{2,63}\b`)
+	ipv4Re   = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+	ipv6Re   = regexp.MustCompile(`(?i)(?:[0-9a-f]{0,4}:){2,7}[0-9a-f]{0,4}(?:%[0-9a-z]+)?`)
+	hashRe   = regexp.MustCompile(`(?i)\b[0-9a-f]{32}(?:[0-9a-f]{8})?(?:[0-9a-f]{24})?\b`)
+	cveRe    = regexp.MustCompile(`(?i)\bCVE-\d{4}-\d{4,}\b`)
+	domainRe = regexp.MustCompile(`(?i)\b(?:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}\b`)
+)
+
+// notTLDs are suffixes that look like top level domains but are usually
+// file names or cluster internal names.
+var notTLDs = map[string]bool{
+	"txt": true, "log": true, "json": true, "yaml": true, "yml": true, "xml": true,
+	"html": true, "htm": true, "js": true, "ts": true, "py": true, "go": true,
+	"sh": true, "md": true, "php": true, "asp": true, "aspx": true, "jsp": true, "conf": true, "cfg": true, "ini": true, "exe": true,
+	"dll": true, "so": true, "tmp": true, "bak": true, "zip": true, "gz": true,
+	"tar": true, "csv": true, "pdf": true, "png": true, "jpg": true, "svg": true,
+	"local": true, "internal": true, "svc": true, "cluster": true, "lan": true,
+	"localdomain": true,
+}
+
+var refanger = strings.NewReplacer(
+	"hxxps", "https", "hXXps", "https", "hxxp", "http", "hXXp", "http",
+	"[.]", ".", "(.)", ".", "{.}", ".", "[dot]", ".", "(dot)", ".",
+	"[:]", ":", "[://]", "://",
+	"[@]", "@", "[at]", "@", "(at)", "@",
+)
+
+// Refang undoes common defanging (hxxp, [.], [at], ...).
+func Refang(s string) string {
+	return refanger.Replace(s)
+}
+
+// Defang makes URLs, domains, IPs and email addresses in s safe to display
+// by replacing http with hxxp and dots with [.]. Hashes and CVEs are kept.
+func Defang(s string) string {
+	for _, ioc := range ExtractIOCs(s) {
+		switch ioc.Type {
+		case IOCURL, IOCDomain, IOCIPv4, IOCEmail:
+			s = strings.ReplaceAll(s, ioc.Value, defangValue(ioc.Value))
+		case IOCIPv6:
+			s = strings.ReplaceAll(s, ioc.Value, strings.ReplaceAll(ioc.Value, ":", "[:]"))
+		}
+	}
+	return s
+}
+
+func defangValue(v string) string {
+	v = strings.Replace(v, "http", "hxxp", 1)
+	v = strings.Replace(v, "ftp", "fxp", 1)
+	return strings.ReplaceAll(v, ".", "[.]")
+}
+
+// ExtractIOCs returns the IOCs found in the texts, refanged, without
+// duplicates, in order of appearance. Domains and IPs that are part of a
+// URL or email address are reported as well.
+func ExtractIOCs(texts ...string) []IOC {
+	var out []IOC
+	add := func(typ, value string) {
+		ioc := IOC{Type: typ, Value: value}
+		if !slices.Contains(out, ioc) {
+			out = append(out, ioc)
+		}
+	}
+	for _, text := range texts {
+		text = Refang(text)
+		for _, m := range urlRe.FindAllString(text, -1) {
+			add(IOCURL, strings.TrimRight(m, ".,;:!?)]}"))
+		}
+		for _, m := range emailRe.FindAllString(text, -1) {
+			add(IOCEmail, m)
+		}
+		for _, m := range ipv4Re.FindAllString(text, -1) {
+			if addr, err := netip.ParseAddr(m); err == nil && addr.Is4() {
+				add(IOCIPv4, m)
+			}
+		}
+		for _, m := range ipv6Re.FindAllString(text, -1) {
+			if addr, err := netip.ParseAddr(m); err == nil && addr.Is6() && !addr.Is4In6() {
+				add(IOCIPv6, m)
+			}
+		}
+		for _, loc := range domainRe.FindAllStringIndex(text, -1) {
+			// Skip file names in URL and file paths, but not URL hosts.
+			if start := loc[0]; start > 0 && (text[start-1] == '/' || text[start-1] == '\\') &&
+				!strings.HasSuffix(text[:start], "//") {
+				continue
+			}
+			m := text[loc[0]:loc[1]]
+			tld := m[strings.LastIndexByte(m, '.')+1:]
+			if !notTLDs[strings.ToLower(tld)] {
+				add(IOCDomain, strings.ToLower(m))
+			}
+		}
+		for _, m := range hashRe.FindAllString(text, -1) {
+			switch len(m) {
+			case 32:
+				add(IOCMD5, strings.ToLower(m))
+			case 40:
+				add(IOCSHA1, strings.ToLower(m))
+			case 64:
+				add(IOCSHA256, strings.ToLower(m))
+			}
+		}
+		for _, m := range cveRe.FindAllString(text, -1) {
+			add(IOCCVE, strings.ToUpper(m))
+		}
+	}
+	return out
+}
+
+// alertIOCs returns the IOCs in the label and annotation values of alert,
+// in label then annotation name order, followed by the matches of rules.
+func alertIOCs(alert Alert, rules []*iocRule) []IOC {
+	var texts []string
+	for _, m := range []map[string]string{alert.Labels, alert.Annotations} {
+		for _, k := range slices.Sorted(maps.Keys(m)) {
+			texts = append(texts, m[k])
+		}
+	}
+	out := ExtractIOCs(texts...)
+	for _, r := range rules {
+		for _, ioc := range r.extract(alert) {
+			if !slices.Contains(out, ioc) {
+				out = append(out, ioc)
+			}
+		}
+	}
+	return out
+}
+
+// IOCRuleConfig extracts organization specific indicators. The IOC value is
+// the "ioc" named group, or else the first group, or else the whole match
+// of Regex. Field is "labels.<name>" or "annotations.<name>" and limits the
+// rule to one value, all label and annotation values are searched when it is
+// empty. Name is used as the IOC type.
+type IOCRuleConfig struct {
+	Name   string `koanf:"name"`
+	Regex  string `koanf:"regex"`
+	TypeID int    `koanf:"type_id"`
+	Field  string `koanf:"field"`
+}
+
+type iocRule struct {
+	IOCRuleConfig
+	re    *regexp.Regexp
+	group int
+	// source is "labels" or "annotations" and key the name within it, both
+	// empty for rules without a field.
+	source, key string
+}
+
+func newIOCRules(cfgs []IOCRuleConfig) ([]*iocRule, error) {
+	var out []*iocRule
+	for i, cfg := range cfgs {
+		if cfg.Name == "" {
+			return nil, fmt.Errorf("ioc rule %d: name is required", i)
+		}
+		re, err := regexp.Compile(cfg.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("ioc rule %q: %w", cfg.Name, err)
+		}
+		r := &iocRule{IOCRuleConfig: cfg, re: re}
+		if re.NumSubexp() > 0 {
+			r.group = 1
+		}
+		if n := re.SubexpIndex("ioc"); n > 0 {
+			r.group = n
+		}
+		if cfg.Field != "" {
+			var ok bool
+			r.source, r.key, ok = strings.Cut(cfg.Field, ".")
+			if !ok || r.key == "" || (r.source != "labels" && r.source != "annotations") {
+				return nil, fmt.Errorf(`ioc rule %q: field must be "labels.<name>" or "annotations.<name>", got %q`, cfg.Name, cfg.Field)
+			}
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+func (r *iocRule) extract(alert Alert) []IOC {
+	var texts []string
+	switch r.source {
+	case "labels":
+		texts = []string{alert.Labels[r.key]}
+	case "annotations":
+		texts = []string{alert.Annotations[r.key]}
+	default:
+		for _, m := range []map[string]string{alert.Labels, alert.Annotations} {
+			for _, k := range slices.Sorted(maps.Keys(m)) {
+				texts = append(texts, m[k])
+			}
+		}
+	}
+	var out []IOC
+	for _, text := range texts {
+		for _, m := range r.re.FindAllStringSubmatch(text, -1) {
+			if v := m[r.group]; v != "" {
+				out = append(out, IOC{Type: r.Name, Value: v})
+			}
+		}
+	}
+	return out
+}
+
+// IOCConfig controls pushing the IOCs found in an alert to IRIS when the
+// alert is created. TypeIDs maps IOC types to the IRIS IOC type IDs of the
+// install, types without an ID are not pushed.
+type IOCConfig struct {
+	Enabled bool            `koanf:"enabled"`
+	TypeIDs map[string]int  `koanf:"type_ids"`
+	TLPID   int             `koanf:"tlp_id"`
+	Rules   []IOCRuleConfig `koanf:"rules"`
+}
+
+// typeID returns the IRIS IOC type ID of an IOC type or rule name.
+func (c IOCConfig) typeID(typ string) (int, bool) {
+	if id, ok := c.TypeIDs[typ]; ok {
+		return id, true
+	}
+	for _, r := range c.Rules {
+		if r.Name == typ && r.TypeID > 0 {
+			return r.TypeID, true
+		}
+	}
+	return 0, false
+}
+
+// iocRequests returns the IRIS IOCs to create with an alert.
+func (c IOCConfig) iocRequests(iocs []IOC) []IRISIOCRequest {
+	var out []IRISIOCRequest
+	for _, ioc := range iocs {
+		typeID, ok := c.typeID(ioc.Type)
+		if !ok {
+			continue
+		}
+		out = append(out, IRISIOCRequest{
+			Value:       ioc.Value,
+			TypeID:      typeID,
+			TLPID:       c.TLPID,
+			Description: "Extracted by alertiris",
+			Tags:        ioc.Type,
+		})
+	}
+	return out
+}
@@ -0,0 +1,268 @@
+package alertiris
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// KubernetesConfig adds the owning workload, node labels and workload
+// annotations of the pod or node an alert is about as labels. Without URL
+// the in-cluster service account is used.
+type KubernetesConfig struct {
+	Enabled       bool   `koanf:"enabled"`
+	URL           string `koanf:"url"`
+	Token         string `koanf:"token"`
+	CAFile        string `koanf:"ca_file"`
+	SkipTLSVerify bool   `koanf:"skip_tls_verify"`
+
+	PodLabel       string `koanf:"pod_label"`
+	NamespaceLabel string `koanf:"namespace_label"`
+	NodeLabel      string `koanf:"node_label"`
+
+	// WorkloadAnnotations and NodeLabels are copied to the alert, named
+	// LabelPrefix followed by the sanitized key.
+	WorkloadAnnotations []string      `koanf:"workload_annotations"`
+	NodeLabels          []string      `koanf:"node_labels"`
+	LabelPrefix         string        `koanf:"label_prefix"`
+	CacheTTL            time.Duration `koanf:"cache_ttl"`
+	Timeout             time.Duration `koanf:"timeout"`
+}
+
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+type kubernetes struct {
+	cfg    KubernetesConfig
+	client *http.Client
+	cache  *enrichmentCache
+}
+
+// k8sObject is the metadata alertiris reads from pods, nodes and workloads.
+type k8sObject struct {
+	Metadata struct {
+		Name            string            `json:"name"`
+		Labels          map[string]string `json:"labels"`
+		Annotations     map[string]string `json:"annotations"`
+		OwnerReferences []struct {
+			Kind       string `json:"kind"`
+			Name       string `json:"name"`
+			Controller bool   `json:"controller"`
+		} `json:"ownerReferences"`
+	} `json:"metadata"`
+	Spec struct {
+		NodeName string `json:"nodeName"`
+	} `json:"spec"`
+}
+
+func newKubernetes(cfg KubernetesConfig, cache *enrichmentCache) (*kubernetes, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	if cfg.URL == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" {
+			return nil, fmt.Errorf("url is required outside a cluster")
+		}
+		cfg.URL = "https://" + net.JoinHostPort(host, port)
+		if cfg.CAFile == "" {
+			cfg.CAFile = serviceAccountDir + "/ca.crt"
+		}
+	}
+	if cfg.Token == "" {
+		if token, err := os.ReadFile(serviceAccountDir + "/token"); err == nil {
+			cfg.Token = strings.TrimSpace(string(token))
+		}
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.SkipTLSVerify}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca file: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", cfg.CAFile)
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &kubernetes{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout, Transport: transport},
+		cache:  cache,
+	}, nil
+}
+
+var invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+func (k *kubernetes) label(key string) string {
+	return k.cfg.LabelPrefix + invalidLabelChars.ReplaceAllString(key, "_")
+}
+
+// metadata returns the labels to add to an alert.
+func (k *kubernetes) metadata(ctx context.Context, labels map[string]string) (map[string]string, error) {
+	out := map[string]string{}
+	ns, pod, node := labels[k.cfg.NamespaceLabel], labels[k.cfg.PodLabel], labels[k.cfg.NodeLabel]
+
+	if ns != "" && pod != "" {
+		p, err := k.get(ctx, "/api/v1/namespaces/"+url.PathEscape(ns)+"/pods/"+url.PathEscape(pod))
+		if err != nil {
+			return nil, fmt.Errorf("get pod: %w", err)
+		}
+		if p != nil {
+			node = p.Spec.NodeName
+			kind, name, workload, err := k.workload(ctx, ns, p)
+			if err != nil {
+				return nil, err
+			}
+			if kind != "" {
+				out[k.label("owner_kind")] = kind
+				out[k.label("owner")] = name
+			}
+			for _, key := range k.cfg.WorkloadAnnotations {
+				if v, ok := workload.Metadata.Annotations[key]; ok {
+					out[k.label(key)] = v
+				}
+			}
+		}
+	}
+
+	if node != "" {
+		out[k.label("node")] = node
+		n, err := k.get(ctx, "/api/v1/nodes/"+url.PathEscape(node))
+		if err != nil {
+			return nil, fmt.Errorf("get node: %w", err)
+		}
+		if n != nil {
+			for _, key := range k.cfg.NodeLabels {
+				if v, ok := n.Metadata.Labels[key]; ok {
+					out[k.label(key)] = v
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+// workload follows the controller of a pod up to its deployment, stateful
+// set, daemon set, job or cron job, and returns its kind, name and object.
+// Pods without a controller are their own workload.
+func (k *kubernetes) workload(ctx context.Context, ns string, obj *k8sObject) (string, string, *k8sObject, error) {
+	kind, name := "", ""
+	for range 3 {
+		var next string
+		for _, ref := range obj.Metadata.OwnerReferences {
+			if ref.Controller {
+				kind, name = ref.Kind, ref.Name
+				next = ref.Kind
+			}
+		}
+		var path string
+		switch next {
+		case "ReplicaSet":
+			path = "/apis/apps/v1/namespaces/" + url.PathEscape(ns) + "/replicasets/" + url.PathEscape(name)
+		case "Job":
+			path = "/apis/batch/v1/namespaces/" + url.PathEscape(ns) + "/jobs/" + url.PathEscape(name)
+		case "Deployment", "StatefulSet", "DaemonSet", "CronJob":
+			group := "apps/v1"
+			if next == "CronJob" {
+				group = "batch/v1"
+			}
+			path = "/apis/" + group + "/namespaces/" + url.PathEscape(ns) + "/" + strings.ToLower(next) + "s/" + url.PathEscape(name)
+		default:
+			return kind, name, obj, nil
+		}
+		owner, err := k.get(ctx, path)
+		if err != nil {
+			return "", "", nil, fmt.Errorf("get %s: %w", strings.ToLower(next), err)
+		}
+		if owner == nil {
+			return kind, name, obj, nil
+		}
+		obj = owner
+		if next != "ReplicaSet" && next != "Job" {
+			return kind, name, obj, nil
+		}
+	}
+	return kind, name, obj, nil
+}
+
+// get fetches an object, returning nil when it does not exist.
+func (k *kubernetes) get(ctx context.Context, path string) (*k8sObject, error) {
+	var obj k8sObject
+	if k.cache.get("k8s", path, &obj) {
+		if obj.Metadata.Name == "" {
+			return nil, nil
+		}
+		return &obj, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(k.cfg.URL, "/")+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	if k.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+k.cfg.Token)
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		enrichmentFailed("kubernetes")
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if err := json.NewDecoder(resp.Body).Decode(&obj); err != nil {
+			enrichmentFailed("kubernetes")
+			return nil, fmt.Errorf("decode response: %w", err)
+		}
+	case http.StatusNotFound:
+	default:
+		enrichmentFailed("kubernetes")
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("kubernetes returned %s: %s", resp.Status, msg)
+	}
+	enrichmentLookups("kubernetes", "ok").Inc()
+	k.cache.set("k8s", path, obj, k.cfg.CacheTTL)
+	if obj.Metadata.Name == "" {
+		return nil, nil
+	}
+	return &obj, nil
+}
+
+// kubernetesStage adds Kubernetes metadata to alerts as labels, before they
+// are routed and templated. Labels already on the alert are kept.
+func (h *Handler) kubernetesStage(ctx context.Context, ev *Event, next Next) error {
+	if h.kubernetes == nil {
+		return next(ctx, ev)
+	}
+	extra, err := h.kubernetes.metadata(ctx, ev.Alert.Labels)
+	if err != nil {
+		slog.Warn("failed to look up kubernetes metadata", "fingerprint", ev.Alert.Fingerprint, "error", err)
+		return next(ctx, ev)
+	}
+	if len(extra) > 0 {
+		labels := maps.Clone(ev.Alert.Labels)
+		for k, v := range extra {
+			if _, ok := labels[k]; !ok {
+				labels[k] = v
+			}
+		}
+		ev.Alert.Labels = labels
+	}
+	return next(ctx, ev)
+}
@@ -0,0 +1,27 @@
+package alertiris
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// observeLatency records the time from webhook receipt until a sink accepted
+// an alert, including the time spent waiting in the retry queue. The
+// histogram can be aggregated, the summary reports percentiles directly.
+func (h *Handler) observeLatency(sink, action string, sa *SinkAlert) {
+	if sa.ReceivedAt.IsZero() {
+		return
+	}
+	d := time.Since(sa.ReceivedAt)
+	h.profiler.observe(d)
+	labels := fmt.Sprintf(`{sink=%q,action=%q}`, sink, action)
+	metrics.GetOrCreateHistogram(`alertiris_delivery_latency_seconds` + labels).Update(d.Seconds())
+	metrics.GetOrCreateSummary(`alertiris_delivery_latency_quantiles_seconds` + labels).Update(d.Seconds())
+	if h.config.LatencySLO > 0 && d > h.config.LatencySLO {
+		metrics.GetOrCreateCounter(`alertiris_delivery_slo_exceeded_total` + labels).Inc()
+		slog.Warn("delivery latency exceeded slo", "sink", sink, "action", action, "fingerprint", sa.Fingerprint, "request_id", sa.RequestID, "latency", d, "slo", h.config.LatencySLO)
+	}
+}
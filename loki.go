@@ -0,0 +1,208 @@
+package alertiris
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// LokiConfig attaches the last log lines matching a LogQL query templated
+// with the alert, e.g. '{namespace="{{ .Labels.namespace }}"} |= "error"',
+// to new IRIS alerts. Target "note" adds them to the alert note, "file"
+// uploads them to the datastore of the alert's case or of CaseID.
+type LokiConfig struct {
+	URL      string        `koanf:"url"`
+	Token    string        `koanf:"token"`
+	TenantID string        `koanf:"tenant_id"`
+	Query    string        `koanf:"query"`
+	Lookback time.Duration `koanf:"lookback"`
+	Limit    int           `koanf:"limit"`
+	Target   string        `koanf:"target"`
+	CaseID   int           `koanf:"case_id"`
+	Timeout  time.Duration `koanf:"timeout"`
+}
+
+type loki struct {
+	cfg    LokiConfig
+	client *http.Client
+	query  *template.Template
+}
+
+func newLoki(cfg LokiConfig) (*loki, error) {
+	if cfg.URL == "" {
+		return nil, nil
+	}
+	if cfg.Target != "note" && cfg.Target != "file" {
+		return nil, fmt.Errorf("target must be note or file, got %q", cfg.Target)
+	}
+	tmpl, err := template.New("loki").Option("missingkey=zero").Parse(cfg.Query)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	return &loki{cfg: cfg, client: &http.Client{Timeout: cfg.Timeout}, query: tmpl}, nil
+}
+
+// logs returns the last log lines for an alert, oldest first, and the
+// query that found them. An empty query skips the alert.
+func (l *loki) logs(ctx context.Context, alert Alert) ([]string, string, error) {
+	var b strings.Builder
+	if err := l.query.Execute(&b, alert); err != nil {
+		return nil, "", fmt.Errorf("render query: %w", err)
+	}
+	query := strings.TrimSpace(b.String())
+	if query == "" {
+		return nil, "", nil
+	}
+	end := time.Now()
+	if !alert.EndsAt.IsZero() && alert.EndsAt.Before(end) {
+		end = alert.EndsAt
+	}
+	q := url.Values{
+		"query":     {query},
+		"start":     {strconv.FormatInt(alert.StartsAt.Add(-l.cfg.Lookback).UnixNano(), 10)},
+		"end":       {strconv.FormatInt(end.UnixNano(), 10)},
+		"limit":     {strconv.Itoa(l.cfg.Limit)},
+		"direction": {"backward"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(l.cfg.URL, "/")+"/loki/api/v1/query_range?"+q.Encode(), nil)
+	if err != nil {
+		return nil, query, fmt.Errorf("create request: %w", err)
+	}
+	if l.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+l.cfg.Token)
+	}
+	if l.cfg.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", l.cfg.TenantID)
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return nil, query, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, query, fmt.Errorf("loki returned %s: %s", resp.Status, msg)
+	}
+	var body struct {
+		Data struct {
+			ResultType string `json:"resultType"`
+			Result     []struct {
+				Values [][2]string `json:"values"`
+			} `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, query, fmt.Errorf("decode response: %w", err)
+	}
+	if body.Data.ResultType != "streams" {
+		return nil, query, fmt.Errorf("query returned %s, not log lines", body.Data.ResultType)
+	}
+
+	type entry struct {
+		ts   int64
+		line string
+	}
+	var entries []entry
+	for _, s := range body.Data.Result {
+		for _, v := range s.Values {
+			ts, _ := strconv.ParseInt(v[0], 10, 64)
+			entries = append(entries, entry{ts, v[1]})
+		}
+	}
+	slices.SortStableFunc(entries, func(a, b entry) int { return cmp.Compare(b.ts, a.ts) })
+	entries = entries[:min(len(entries), l.cfg.Limit)]
+	lines := make([]string, len(entries))
+	for i, e := range entries {
+		lines[len(entries)-1-i] = time.Unix(0, e.ts).UTC().Format(time.RFC3339Nano) + " " + e.line
+	}
+	return lines, query, nil
+}
+
+// noteLogs adds the alert's log lines to the note of an alert about to be
+// created.
+func (h *Handler) noteLogs(ctx context.Context, sa *SinkAlert) {
+	if h.loki == nil || h.loki.cfg.Target != "note" {
+		return
+	}
+	lines, query, err := h.loki.logs(ctx, sa.Alert)
+	if err != nil {
+		errorsTotal(ErrorEnrichment).Inc()
+		slog.Warn("failed to query loki", "fingerprint", sa.Fingerprint, "error", err, "error_category", ErrorEnrichment)
+		return
+	}
+	if query == "" {
+		return
+	}
+	if len(lines) == 0 {
+		lines = []string{"no log lines"}
+	}
+	appendNoteSection(sa, "Logs ("+query+"):\n"+strings.Join(lines, "\n"))
+}
+
+// uploadLogs uploads the alert's log lines to the datastore of its case in
+// the background.
+func (h *Handler) uploadLogs(ctx context.Context, alertID string, sa *SinkAlert) {
+	if h.loki == nil || h.loki.cfg.Target != "file" {
+		return
+	}
+	s, ok := h.sinks["iris"].(*irisSink)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(alertID)
+	if err != nil {
+		return
+	}
+
+	// The upload outlives the webhook request that created the alert.
+	ctx = context.WithoutCancel(ctx)
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		log := slog.With("fingerprint", sa.Fingerprint, "alert_id", alertID)
+
+		lines, query, err := h.loki.logs(ctx, sa.Alert)
+		if err != nil {
+			errorsTotal(ErrorEnrichment).Inc()
+			log.Error("failed to query loki", "error", err, "error_category", ErrorEnrichment)
+			return
+		}
+		if len(lines) == 0 {
+			return
+		}
+
+		caseID := h.loki.cfg.CaseID
+		if a, err := s.client.GetAlert(ctx, id, sa.CustomerID); err != nil {
+			log.Warn("failed to look up alert case", "error", err)
+		} else if len(a.Cases) > 0 {
+			caseID = a.Cases[0]
+		}
+		if caseID == 0 {
+			log.Info("alert is not part of a case and loki.case_id is not set, not uploading logs")
+			return
+		}
+
+		name := fmt.Sprintf("loki-%s-%d.log", sa.Fingerprint, time.Now().Unix())
+		content := []byte("# " + query + "\n" + strings.Join(lines, "\n") + "\n")
+		fileID, err := s.client.UploadEvidence(ctx, caseID, name, fmt.Sprintf("Loki logs for IRIS alert %s: %s", alertID, sa.Title), content)
+		if err != nil {
+			log.Error("failed to upload loki logs", "case_id", caseID, "error", err)
+			return
+		}
+		note := fmt.Sprintf("Loki logs: datastore file %d in case %d (%s)", fileID, caseID, name)
+		if err := appendNote(ctx, s.client, id, sa.CustomerID, note); err != nil {
+			log.Warn("failed to add logs note to alert", "error", err)
+		}
+		log.Info("uploaded loki logs", "case_id", caseID, "file_id", fileID)
+	}()
+}
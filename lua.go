@@ -0,0 +1,154 @@
+package alertiris
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+type LuaConfig struct {
+	Script  string        `koanf:"script"`
+	Timeout time.Duration `koanf:"timeout"`
+}
+
+// LuaHooks calls the pre_create, pre_update and pre_resolve functions of a
+// user script with (alert, request, sink). Hooks may modify the request table
+// and return false to cancel the action for that sink.
+type LuaHooks struct {
+	mu      sync.Mutex
+	state   *lua.LState
+	timeout time.Duration
+}
+
+func NewLuaHooks(cfg LuaConfig) (*LuaHooks, error) {
+	if cfg.Script == "" {
+		return &LuaHooks{}, nil
+	}
+
+	L := lua.NewState()
+	if err := L.DoFile(cfg.Script); err != nil {
+		L.Close()
+		return nil, fmt.Errorf("load %s: %w", cfg.Script, err)
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = time.Second
+	}
+	return &LuaHooks{state: L, timeout: timeout}, nil
+}
+
+func (l *LuaHooks) Close() {
+	if l.state != nil {
+		l.state.Close()
+	}
+}
+
+func (l *LuaHooks) Run(hook, sink string, sa *SinkAlert) (bool, error) {
+	if l.state == nil {
+		return true, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	L := l.state
+	fn, ok := L.GetGlobal(hook).(*lua.LFunction)
+	if !ok {
+		return true, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
+	defer cancel()
+	L.SetContext(ctx)
+	defer L.RemoveContext()
+
+	req := sinkAlertTable(L, sa)
+	if err := L.CallByParam(lua.P{Fn: fn, NRet: 1, Protect: true}, alertTable(L, sa.Alert), req, lua.LString(sink)); err != nil {
+		return false, fmt.Errorf("%s: %w", hook, err)
+	}
+	ret := L.Get(-1)
+	L.Pop(1)
+
+	if err := readSinkAlertTable(req, sa); err != nil {
+		return false, fmt.Errorf("%s: %w", hook, err)
+	}
+	return ret != lua.LFalse, nil
+}
+
+func stringMapTable(L *lua.LState, m map[string]string) *lua.LTable {
+	t := L.NewTable()
+	for k, v := range m {
+		t.RawSetString(k, lua.LString(v))
+	}
+	return t
+}
+
+func alertTable(L *lua.LState, alert Alert) *lua.LTable {
+	t := L.NewTable()
+	t.RawSetString("status", lua.LString(alert.Status))
+	t.RawSetString("fingerprint", lua.LString(alert.Fingerprint))
+	t.RawSetString("generator_url", lua.LString(alert.GeneratorURL))
+	t.RawSetString("starts_at", lua.LString(alert.StartsAt.Format(time.RFC3339)))
+	t.RawSetString("ends_at", lua.LString(alert.EndsAt.Format(time.RFC3339)))
+	t.RawSetString("labels", stringMapTable(L, alert.Labels))
+	t.RawSetString("annotations", stringMapTable(L, alert.Annotations))
+	return t
+}
+
+func sinkAlertTable(L *lua.LState, sa *SinkAlert) *lua.LTable {
+	t := L.NewTable()
+	t.RawSetString("title", lua.LString(sa.Title))
+	t.RawSetString("description", lua.LString(sa.Description))
+	t.RawSetString("source", lua.LString(sa.Source))
+	t.RawSetString("source_link", lua.LString(sa.SourceLink))
+	t.RawSetString("severity_id", lua.LNumber(sa.SeverityID))
+	t.RawSetString("customer_id", lua.LNumber(sa.CustomerID))
+	tags := L.NewTable()
+	for _, tag := range sa.Tags {
+		tags.Append(lua.LString(tag))
+	}
+	t.RawSetString("tags", tags)
+	return t
+}
+
+func readSinkAlertTable(t *lua.LTable, sa *SinkAlert) error {
+	str := func(key string, dst *string) {
+		if v, ok := t.RawGetString(key).(lua.LString); ok {
+			*dst = string(v)
+		}
+	}
+	num := func(key string, dst *int) {
+		if v, ok := t.RawGetString(key).(lua.LNumber); ok {
+			*dst = int(v)
+		}
+	}
+
+	str("title", &sa.Title)
+	str("description", &sa.Description)
+	str("source", &sa.Source)
+	str("source_link", &sa.SourceLink)
+	num("severity_id", &sa.SeverityID)
+	num("customer_id", &sa.CustomerID)
+
+	switch tags := t.RawGetString("tags").(type) {
+	case *lua.LTable:
+		sa.Tags = nil
+		var err error
+		tags.ForEach(func(_, v lua.LValue) {
+			s, ok := v.(lua.LString)
+			if !ok {
+				err = fmt.Errorf("tags must be strings, got %s", v.Type())
+				return
+			}
+			sa.Tags = append(sa.Tags, string(s))
+		})
+		return err
+	case *lua.LNilType:
+		sa.Tags = nil
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package alertiris
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaintenanceWindowConfig is either a fixed interval (Start, End), a
+// recurring window opening on a five-field cron Schedule for Duration, or the
+// events of an iCal Calendar, optionally only those whose summary matches
+// SummaryPattern.
+// Matching alerts are not created during the window when Action is
+// "suppress", or created with Tag added when it is "tag".
+type MaintenanceWindowConfig struct {
+	Name     string            `koanf:"name"`
+	Matchers map[string]string `koanf:"matchers"`
+	Action   string            `koanf:"action"`
+	Tag      string            `koanf:"tag"`
+	Start    time.Time         `koanf:"start"`
+	End      time.Time         `koanf:"end"`
+	Schedule string            `koanf:"schedule"`
+	Duration time.Duration     `koanf:"duration"`
+	Timezone string            `koanf:"timezone"`
+
+	Calendar        string        `koanf:"calendar"`
+	CalendarRefresh time.Duration `koanf:"calendar_refresh"`
+	SummaryPattern  string        `koanf:"summary_pattern"`
+}
+
+type maintenanceWindow struct {
+	MaintenanceWindowConfig
+	matchers Matchers
+	schedule *cronSchedule
+	calendar *calendar
+	location *time.Location
+}
+
+func newMaintenanceWindows(cfgs []MaintenanceWindowConfig) ([]*maintenanceWindow, error) {
+	var out []*maintenanceWindow
+	for i, cfg := range cfgs {
+		if cfg.Name == "" {
+			cfg.Name = fmt.Sprintf("window-%d", i)
+		}
+		w := &maintenanceWindow{MaintenanceWindowConfig: cfg, location: time.UTC}
+
+		switch cfg.Action {
+		case "", "suppress":
+			w.Action = "suppress"
+		case "tag":
+			if w.Tag == "" {
+				w.Tag = "maintenance"
+			}
+		default:
+			return nil, fmt.Errorf("window %q: unknown action %q", cfg.Name, cfg.Action)
+		}
+
+		var err error
+		if w.matchers, err = NewMatchers(cfg.Matchers); err != nil {
+			return nil, fmt.Errorf("window %q: %w", cfg.Name, err)
+		}
+		if cfg.Timezone != "" {
+			if w.location, err = time.LoadLocation(cfg.Timezone); err != nil {
+				return nil, fmt.Errorf("window %q: load timezone: %w", cfg.Name, err)
+			}
+		}
+
+		switch {
+		case cfg.Calendar != "":
+			if w.calendar, err = newCalendar(cfg.Calendar, cfg.CalendarRefresh, cfg.SummaryPattern, w.location); err != nil {
+				return nil, fmt.Errorf("window %q: %w", cfg.Name, err)
+			}
+		case cfg.Schedule != "":
+			if cfg.Duration <= 0 {
+				return nil, fmt.Errorf("window %q: duration is required with schedule", cfg.Name)
+			}
+			if w.schedule, err = parseCron(cfg.Schedule); err != nil {
+				return nil, fmt.Errorf("window %q: %w", cfg.Name, err)
+			}
+		case !cfg.Start.IsZero() && !cfg.End.IsZero():
+			if !cfg.End.After(cfg.Start) {
+				return nil, fmt.Errorf("window %q: end must be after start", cfg.Name)
+			}
+		default:
+			return nil, fmt.Errorf("window %q: calendar, schedule or start and end are required", cfg.Name)
+		}
+		out = append(out, w)
+	}
+	return out, nil
+}
+
+// Active reports whether the window is open at t.
+func (w *maintenanceWindow) Active(t time.Time) bool {
+	if w.calendar != nil {
+		_, ok := w.calendar.Active(t)
+		return ok
+	}
+	if w.schedule == nil {
+		return !t.Before(w.Start) && t.Before(w.End)
+	}
+	// Look for a scheduled start within the last Duration.
+	t = t.In(w.location)
+	earliest := t.Add(-w.Duration)
+	for m := t.Truncate(time.Minute); m.After(earliest); m = m.Add(-time.Minute) {
+		if w.schedule.match(m) {
+			return true
+		}
+	}
+	return false
+}
+
+// activeWindow returns the first window open at t that matches the alert.
+func activeWindow(windows []*maintenanceWindow, labels map[string]string, t time.Time) *maintenanceWindow {
+	for _, w := range windows {
+		if w.Active(t) && w.matchers.Match(labels) {
+			return w
+		}
+	}
+	return nil
+}
+
+// cronSchedule is a standard five-field cron expression: minute, hour, day of
+// month, month and day of week.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// anyDay is set when either day field is "*", in which case both must
+	// match. Otherwise matching either day field is enough, as in cron.
+	anyDay bool
+}
+
+func parseCron(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("schedule %q: expected 5 fields", expr)
+	}
+	var s cronSchedule
+	var err error
+	bounds := []struct {
+		dst      *uint64
+		min, max int
+	}{
+		{&s.minute, 0, 59}, {&s.hour, 0, 23}, {&s.dom, 1, 31}, {&s.month, 1, 12}, {&s.dow, 0, 7},
+	}
+	for i, b := range bounds {
+		if *b.dst, err = parseCronField(fields[i], b.min, b.max); err != nil {
+			return nil, fmt.Errorf("schedule %q: %w", expr, err)
+		}
+	}
+	// Sunday may be written as 0 or 7.
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.anyDay = fields[2] == "*" || fields[4] == "*"
+	return &s, nil
+}
+
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for part := range strings.SplitSeq(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepStr); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+		}
+
+		lo, hi := min, max
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(a); err != nil {
+				return 0, fmt.Errorf("invalid value in %q", part)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(b); err != nil {
+					return 0, fmt.Errorf("invalid value in %q", part)
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func (s *cronSchedule) match(t time.Time) bool {
+	if s.minute&(1<<t.Minute()) == 0 || s.hour&(1<<t.Hour()) == 0 || s.month&(1<<int(t.Month())) == 0 {
+		return false
+	}
+	dom := s.dom&(1<<t.Day()) != 0
+	dow := s.dow&(1<<int(t.Weekday())) != 0
+	if s.anyDay {
+		return dom && dow
+	}
+	return dom || dow
+}
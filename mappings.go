@@ -0,0 +1,113 @@
+package alertiris
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Mapping links an alert fingerprint to the alert created for it in a sink.
+type Mapping struct {
+	Sink        string `json:"sink"`
+	Fingerprint string `json:"fingerprint"`
+	CustomerID  int    `json:"customer_id"`
+	AlertID     string `json:"alert_id"`
+
+	State AlertState `json:"state"`
+}
+
+// ListMappings returns the mappings of every sink, limited to fingerprint
+// unless it is empty.
+func ListMappings(db *badger.DB, fingerprint string) ([]Mapping, error) {
+	out := []Mapping{}
+	err := db.View(func(txn *badger.Txn) error {
+		for _, prefix := range []string{"fp:", "sink:"} {
+			opts := badger.DefaultIteratorOptions
+			opts.Prefix = []byte(prefix)
+			it := txn.NewIterator(opts)
+			for it.Rewind(); it.Valid(); it.Next() {
+				m, ok := parseMappingKey(string(it.Item().Key()))
+				if !ok || (fingerprint != "" && m.Fingerprint != fingerprint) {
+					continue
+				}
+				if err := it.Item().Value(func(val []byte) error {
+					var err error
+					m.State, err = parseAlertState(val)
+					return err
+				}); err != nil {
+					it.Close()
+					return err
+				}
+				m.AlertID = m.State.AlertID
+				out = append(out, m)
+			}
+			it.Close()
+		}
+		return nil
+	})
+	return out, err
+}
+
+// DeleteMappings removes the mappings of fingerprint, optionally only those
+// of one sink and customer, and returns what was deleted. Deleting a mapping
+// makes the next firing notification create a new alert.
+func DeleteMappings(db *badger.DB, fingerprint, sink string, customerID int) ([]Mapping, error) {
+	if fingerprint == "" {
+		return nil, fmt.Errorf("fingerprint is required")
+	}
+	mappings, err := ListMappings(db, fingerprint)
+	if err != nil {
+		return nil, err
+	}
+
+	var deleted []Mapping
+	err = db.Update(func(txn *badger.Txn) error {
+		for _, m := range mappings {
+			if (sink != "" && m.Sink != sink) || (customerID != 0 && m.CustomerID != customerID) {
+				continue
+			}
+			if err := txn.Delete(mappingKey(m.Sink, m.Fingerprint, m.CustomerID)); err != nil {
+				return err
+			}
+			deleted = append(deleted, m)
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+// parseMappingKey parses "fp:<fp>:<cid>" and "sink:<name>:<fp>:<cid>" keys.
+// The sink name is everything between the prefix and the fingerprint.
+func parseMappingKey(key string) (Mapping, bool) {
+	var m Mapping
+	rest, ok := strings.CutPrefix(key, "fp:")
+	if ok {
+		m.Sink = "iris"
+	} else if rest, ok = strings.CutPrefix(key, "sink:"); !ok {
+		return m, false
+	}
+
+	i := strings.LastIndexByte(rest, ':')
+	if i < 0 {
+		return m, false
+	}
+	cid, err := strconv.Atoi(rest[i+1:])
+	if err != nil {
+		return m, false
+	}
+	m.CustomerID = cid
+	rest = rest[:i]
+
+	if m.Sink == "" {
+		i = strings.LastIndexByte(rest, ':')
+		if i < 0 {
+			return m, false
+		}
+		m.Sink = rest[:i]
+		rest = rest[i+1:]
+	}
+	m.Fingerprint = rest
+	return m, m.Fingerprint != ""
+}
@@ -0,0 +1,196 @@
+package alertiris
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// schemaVersionKey holds the version of the key formats and values in the
+// state store. Databases written before it existed are version 0.
+var schemaVersionKey = []byte("meta:schema_version")
+
+// migration upgrades the state store from version-1 to version. Migrations
+// run in order, each committing its own transactions, and the version is
+// recorded after each one so an interrupted upgrade resumes where it
+// stopped. Migrations must be safe to run again on partially migrated data.
+type migration struct {
+	version int
+	name    string
+	up      func(db *badger.DB) error
+}
+
+var migrations = []migration{
+	{1, "record the schema version", func(*badger.DB) error { return nil }},
+	{2, "store alert state in mappings", func(db *badger.DB) error {
+		if err := rewriteKeys(db, "fp:", alertStateFromID); err != nil {
+			return err
+		}
+		return rewriteKeys(db, "sink:", alertStateFromID)
+	}},
+	{3, "key last payloads by customer", func(db *badger.DB) error {
+		return rewriteKeys(db, "last:", lastPayloadByCustomer)
+	}},
+}
+
+// SchemaVersion is the schema version this build reads and writes.
+func SchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// GetSchemaVersion returns the schema version recorded in db.
+func GetSchemaVersion(db *badger.DB) (int, error) {
+	version := 0
+	err := db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(schemaVersionKey)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			version, err = strconv.Atoi(string(val))
+			return err
+		})
+	})
+	return version, err
+}
+
+func setSchemaVersion(db *badger.DB, version int) error {
+	return db.Update(func(txn *badger.Txn) error {
+		return txn.Set(schemaVersionKey, []byte(strconv.Itoa(version)))
+	})
+}
+
+// MigrateDB upgrades db to SchemaVersion. A new, empty database is stamped
+// with the current version without running migrations. Databases written by
+// a newer build are refused rather than misread.
+func MigrateDB(db *badger.DB) error {
+	version, err := GetSchemaVersion(db)
+	if err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+	latest := SchemaVersion()
+	if version > latest {
+		return fmt.Errorf("database schema version %d is newer than the supported version %d", version, latest)
+	}
+	if version == latest {
+		return nil
+	}
+	if version == 0 {
+		empty, err := dbEmpty(db)
+		if err != nil {
+			return err
+		}
+		if empty {
+			return setSchemaVersion(db, latest)
+		}
+	}
+
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+		slog.Info("migrating database", "from", version, "to", m.version, "migration", m.name)
+		if err := m.up(db); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+		if err := setSchemaVersion(db, m.version); err != nil {
+			return fmt.Errorf("record schema version %d: %w", m.version, err)
+		}
+		version = m.version
+	}
+	return nil
+}
+
+func dbEmpty(db *badger.DB) (bool, error) {
+	empty := true
+	err := db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		it.Rewind()
+		empty = !it.Valid()
+		return nil
+	})
+	return empty, err
+}
+
+// rewriteKeys calls fn for every key with prefix and replaces the entry with
+// the returned key and value, or deletes it when key is nil. Expiry times are
+// kept. Entries are rewritten in batches, so fn may be called again for an
+// entry after a failure.
+func rewriteKeys(db *badger.DB, prefix string, fn func(key, val []byte) (newKey, newVal []byte, err error)) error {
+	type entry struct {
+		key, val  []byte
+		expiresAt uint64
+	}
+	var entries []entry
+	err := db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(prefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			val, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry{it.Item().KeyCopy(nil), val, it.Item().ExpiresAt()})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	wb := db.NewWriteBatch()
+	defer wb.Cancel()
+	for _, e := range entries {
+		key, val, err := fn(e.key, e.val)
+		if err != nil {
+			return fmt.Errorf("key %s: %w", e.key, err)
+		}
+		if key == nil || string(key) != string(e.key) {
+			if err := wb.Delete(e.key); err != nil {
+				return err
+			}
+		}
+		if key == nil {
+			continue
+		}
+		ne := badger.NewEntry(key, val)
+		if e.expiresAt > 0 {
+			ttl := time.Until(time.Unix(int64(e.expiresAt), 0))
+			if ttl <= 0 {
+				continue
+			}
+			ne = ne.WithTTL(ttl)
+		}
+		if err := wb.SetEntry(ne); err != nil {
+			return err
+		}
+	}
+	return wb.Flush()
+}
+
+// lastPayloadByCustomer moves a "last:<fp>" payload to its customer's key.
+// Keys with a customer already are left alone.
+func lastPayloadByCustomer(key, val []byte) ([]byte, []byte, error) {
+	fingerprint := strings.TrimPrefix(string(key), "last:")
+	if strings.Contains(fingerprint, ":") {
+		return key, val, nil
+	}
+	var p lastPayload
+	if err := json.Unmarshal(val, &p); err != nil {
+		return nil, nil, err
+	}
+	return lastPayloadKey(fingerprint, p.CustomerID), val, nil
+}
@@ -0,0 +1,154 @@
+package alertiris
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+type MISPConfig struct {
+	URL           string `koanf:"url"`
+	APIKey        string `koanf:"api_key"`
+	SkipTLSVerify bool   `koanf:"skip_tls_verify"`
+	// Types limits the searched IOC types, all are searched when empty.
+	Types []string `koanf:"types"`
+	// SeverityID is the IRIS severity alerts with hits are raised to. Zero
+	// leaves the severity alone.
+	SeverityID int           `koanf:"severity_id"`
+	TagPrefix  string        `koanf:"tag_prefix"`
+	CacheTTL   time.Duration `koanf:"cache_ttl"`
+	MaxLookups int           `koanf:"max_lookups"`
+	Timeout    time.Duration `koanf:"timeout"`
+}
+
+// misp searches a MISP instance for the IOCs of an alert. Hits raise the
+// severity, tag the alert with the MISP events and link them in the note.
+type misp struct {
+	cfg    MISPConfig
+	client *http.Client
+	cache  *enrichmentCache
+}
+
+type mispEvent struct {
+	ID   string `json:"id"`
+	Info string `json:"info"`
+}
+
+func newMISP(cfg MISPConfig, cache *enrichmentCache) *misp {
+	if cfg.URL == "" || cfg.APIKey == "" {
+		return nil
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.SkipTLSVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &misp{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout, Transport: transport},
+		cache:  cache,
+	}
+}
+
+func (m *misp) name() string { return "misp" }
+
+func (m *misp) enrich(ctx context.Context, sa *SinkAlert, iocs []IOC) string {
+	var lines []string
+	seen := map[string]bool{}
+	lookups := 0
+	for _, ioc := range iocs {
+		if len(m.cfg.Types) > 0 && !slices.Contains(m.cfg.Types, ioc.Type) {
+			continue
+		}
+		if m.cfg.MaxLookups > 0 && lookups >= m.cfg.MaxLookups {
+			break
+		}
+		lookups++
+		events, err := m.search(ctx, ioc.Value)
+		if err != nil {
+			slog.Warn("misp search failed", "fingerprint", sa.Fingerprint, "ioc", ioc.Value, "error", err)
+			continue
+		}
+		for _, e := range events {
+			lines = append(lines, fmt.Sprintf("- %s (%s): event %s %q %s/events/view/%s",
+				ioc.Value, ioc.Type, e.ID, e.Info, strings.TrimRight(m.cfg.URL, "/"), e.ID))
+			if !seen[e.ID] {
+				seen[e.ID] = true
+				sa.Tags = append(sa.Tags, m.cfg.TagPrefix+e.ID)
+			}
+		}
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	if m.cfg.SeverityID > sa.SeverityID {
+		sa.SeverityID = m.cfg.SeverityID
+	}
+	slog.Info("misp hits found", "fingerprint", sa.Fingerprint, "events", len(seen))
+	return "MISP:\n" + strings.Join(lines, "\n")
+}
+
+// search returns the MISP events with an attribute of the given value.
+func (m *misp) search(ctx context.Context, value string) ([]mispEvent, error) {
+	var events []mispEvent
+	if m.cache.get("misp", value, &events) {
+		enrichmentLookups("misp", "cached").Inc()
+		return events, nil
+	}
+
+	body, _ := json.Marshal(map[string]any{
+		"value":        value,
+		"returnFormat": "json",
+		"limit":        20,
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(m.cfg.URL, "/")+"/attributes/restSearch", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Authorization", m.cfg.APIKey)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		enrichmentFailed("misp")
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		enrichmentFailed("misp")
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("misp returned %s: %s", resp.Status, msg)
+	}
+	var result struct {
+		Response struct {
+			Attribute []struct {
+				EventID string    `json:"event_id"`
+				Event   mispEvent `json:"Event"`
+			} `json:"Attribute"`
+		} `json:"response"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		enrichmentFailed("misp")
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	events = []mispEvent{}
+	for _, a := range result.Response.Attribute {
+		e := a.Event
+		if e.ID == "" {
+			e.ID = a.EventID
+		}
+		if !slices.ContainsFunc(events, func(o mispEvent) bool { return o.ID == e.ID }) {
+			events = append(events, e)
+		}
+	}
+	enrichmentLookups("misp", "ok").Inc()
+	m.cache.set("misp", value, events, m.cfg.CacheTTL)
+	return events, nil
+}
@@ -0,0 +1,462 @@
+// Package mockiris is a fake of the DFIR-IRIS alert API for integration tests
+// and local development. Alerts are kept in memory.
+package mockiris
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Options struct {
+	// APIKey, when set, must be sent as a bearer token.
+	APIKey string
+	// ErrorRate is the fraction of requests answered with a 500.
+	ErrorRate float64
+	// Latency is added to every request, plus a random delay up to Jitter.
+	Latency time.Duration
+	Jitter  time.Duration
+}
+
+// Alert is an IRIS alert as stored by the mock.
+type Alert struct {
+	ID               int             `json:"alert_id"`
+	Title            string          `json:"alert_title"`
+	Description      string          `json:"alert_description"`
+	Source           string          `json:"alert_source"`
+	SourceRef        string          `json:"alert_source_ref"`
+	SourceLink       string          `json:"alert_source_link"`
+	SourceEventTime  string          `json:"alert_source_event_time"`
+	SourceContent    json.RawMessage `json:"alert_source_content,omitempty"`
+	SeverityID       int             `json:"alert_severity_id"`
+	StatusID         int             `json:"alert_status_id"`
+	CustomerID       int             `json:"alert_customer_id"`
+	OwnerID          int             `json:"alert_owner_id"`
+	ClassificationID int             `json:"alert_classification_id"`
+	ResolutionID     int             `json:"alert_resolution_status_id,omitempty"`
+	IOCs             json.RawMessage `json:"alert_iocs,omitempty"`
+	NewAssets        []Asset         `json:"alert_assets,omitempty"`
+	Assets           []Asset         `json:"assets"`
+	Note             string          `json:"alert_note"`
+	Tags             string          `json:"alert_tags"`
+	CreationTime     time.Time       `json:"alert_creation_time"`
+	Cases            []int           `json:"cases"`
+}
+
+// File is a file uploaded to a case datastore.
+type File struct {
+	ID          int    `json:"file_id"`
+	CaseID      int    `json:"case_id"`
+	Name        string `json:"file_original_name"`
+	Description string `json:"file_description"`
+	Size        int    `json:"file_size"`
+}
+
+type Server struct {
+	opts Options
+	mux  *http.ServeMux
+
+	mu     sync.Mutex
+	alerts map[int]*Alert
+	nextID int
+	files  []File
+	cases  int
+
+	comments      map[int][]Comment
+	nextCommentID int
+	nextAssetID   int
+}
+
+// Asset is an asset linked to an alert. Assets sent in alert_assets are
+// given an ID and returned in assets.
+type Asset struct {
+	ID          int    `json:"asset_id"`
+	Name        string `json:"asset_name"`
+	TypeID      int    `json:"asset_type_id"`
+	IP          string `json:"asset_ip,omitempty"`
+	Description string `json:"asset_description,omitempty"`
+}
+
+// Comment is a comment on an alert.
+type Comment struct {
+	ID   int       `json:"comment_id"`
+	Text string    `json:"comment_text"`
+	Date time.Time `json:"comment_date"`
+	User struct {
+		Name  string `json:"user_name"`
+		Login string `json:"user_login"`
+	} `json:"user"`
+}
+
+func New(opts Options) *Server {
+	s := &Server{opts: opts, alerts: make(map[int]*Alert), nextID: 1, comments: make(map[int][]Comment), nextCommentID: 1}
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("POST /alerts/add", s.add)
+	s.mux.HandleFunc("POST /alerts/update/{id}", s.update)
+	s.mux.HandleFunc("POST /alerts/delete/{id}", s.delete)
+	s.mux.HandleFunc("GET /alerts/filter", s.filter)
+	s.mux.HandleFunc("GET /alerts/{id}", s.get)
+	s.mux.HandleFunc("GET /alerts/{id}/comments/list", s.listComments)
+	s.mux.HandleFunc("POST /alerts/{id}/comments/add", s.addComment)
+	s.mux.HandleFunc("POST /alerts/escalate/{id}", s.escalate)
+	s.mux.HandleFunc("POST /alerts/merge/{id}", s.merge)
+	s.mux.HandleFunc("GET /datastore/list/tree", s.datastoreTree)
+	s.mux.HandleFunc("POST /datastore/file/add/{folder}", s.datastoreAdd)
+	s.mux.HandleFunc("GET /api/ping", s.ping)
+	s.mux.HandleFunc("GET /manage/customers/list", s.list("customer_id", "customer_name", "IrisInitialClient"))
+	s.mux.HandleFunc("GET /manage/alert-status/list", s.list("status_id", "status_name", "Unspecified", "New", "Assigned", "In progress", "Pending", "Closed", "Merged", "Escalated"))
+	s.mux.HandleFunc("GET /manage/severities/list", s.list("severity_id", "severity_name", "Unspecified", "Informational", "Low", "Medium", "High", "Critical"))
+	s.mux.HandleFunc("GET /manage/case-classifications/list", s.list("id", "name", "other:other", "abusive-content:spam", "malicious-code:malware", "intrusions:compromised-system"))
+	s.mux.HandleFunc("GET /manage/alert-resolutions/list", s.list("resolution_status_id", "resolution_status_name", "False Positive", "True Positive With Impact", "True Positive Without Impact", "Not Applicable", "Unknown"))
+	return s
+}
+
+// Alerts returns a snapshot of the stored alerts ordered by ID.
+func (s *Server) Alerts() []Alert {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Alert, 0, len(s.alerts))
+	for _, a := range s.alerts {
+		out = append(out, *a)
+	}
+	slices.SortFunc(out, func(a, b Alert) int { return a.ID - b.ID })
+	return out
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	delay := s.opts.Latency
+	if s.opts.Jitter > 0 {
+		delay += rand.N(s.opts.Jitter)
+	}
+	time.Sleep(delay)
+
+	if s.opts.APIKey != "" && r.Header.Get("Authorization") != "Bearer "+s.opts.APIKey {
+		writeError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+	if s.opts.ErrorRate > 0 && rand.Float64() < s.opts.ErrorRate {
+		slog.Info("injecting error", "method", r.Method, "path", r.URL.Path)
+		writeError(w, http.StatusInternalServerError, "injected error")
+		return
+	}
+	slog.Info("request", "method", r.Method, "path", r.URL.Path, "cid", r.URL.Query().Get("cid"))
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) add(w http.ResponseWriter, r *http.Request) {
+	var a Alert
+	if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	var missing []string
+	if a.Title == "" {
+		missing = append(missing, "alert_title")
+	}
+	if a.SeverityID == 0 {
+		missing = append(missing, "alert_severity_id")
+	}
+	if a.StatusID == 0 {
+		missing = append(missing, "alert_status_id")
+	}
+	if a.CustomerID == 0 {
+		missing = append(missing, "alert_customer_id")
+	}
+	if len(missing) > 0 {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("missing required fields: %v", missing))
+		return
+	}
+
+	s.mu.Lock()
+	a.ID = s.nextID
+	s.nextID++
+	a.CreationTime = time.Now().UTC()
+	for _, asset := range a.NewAssets {
+		s.nextAssetID++
+		asset.ID = s.nextAssetID
+		a.Assets = append(a.Assets, asset)
+	}
+	a.NewAssets = nil
+	s.alerts[a.ID] = &a
+	s.mu.Unlock()
+
+	writeData(w, "Alert added", a)
+}
+
+func (s *Server) update(w http.ResponseWriter, r *http.Request) {
+	var fields map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&fields); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+
+	// Apply only the fields present, as IRIS does for partial updates.
+	updated := *a
+	cur, _ := json.Marshal(updated)
+	var merged map[string]json.RawMessage
+	json.Unmarshal(cur, &merged)
+	for k, v := range fields {
+		if k == "alert_id" || k == "alert_creation_time" {
+			continue
+		}
+		merged[k] = v
+	}
+	b, _ := json.Marshal(merged)
+	if err := json.Unmarshal(b, &updated); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid field: "+err.Error())
+		return
+	}
+	*a = updated
+	writeData(w, "Alert updated", a)
+}
+
+func (s *Server) delete(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	delete(s.alerts, a.ID)
+	writeData(w, "Alert deleted", map[string]int{"alert_id": a.ID})
+}
+
+func (s *Server) get(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a, ok := s.lookup(w, r); ok {
+		writeData(w, "", a)
+	}
+}
+
+func (s *Server) listComments(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a, ok := s.lookup(w, r); ok {
+		writeData(w, "", append([]Comment{}, s.comments[a.ID]...))
+	}
+}
+
+// addComment adds a comment by the "mock" user.
+func (s *Server) addComment(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Text string `json:"comment_text"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	c := Comment{ID: s.nextCommentID, Text: req.Text, Date: time.Now().UTC()}
+	c.User.Name, c.User.Login = "Mock User", "mock"
+	s.nextCommentID++
+	s.comments[a.ID] = append(s.comments[a.ID], c)
+	writeData(w, "Comment added", c)
+}
+
+// Alert statuses set on merge and escalation, matching a default IRIS
+// install.
+const (
+	MergedStatusID    = 7
+	EscalatedStatusID = 8
+)
+
+// escalate records a new case for the alert. Cases are not stored beyond
+// their ID.
+func (s *Server) escalate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Title string `json:"case_title"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	s.cases++
+	a.Cases = append(a.Cases, s.cases)
+	a.StatusID = EscalatedStatusID
+	writeData(w, "Alert escalated", map[string]any{"case_id": s.cases, "case_name": req.Title})
+}
+
+// merge adds the alert to a case created by escalate.
+func (s *Server) merge(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		CaseID int `json:"target_case_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	if req.CaseID <= 0 || req.CaseID > s.cases {
+		writeError(w, http.StatusBadRequest, "case not found")
+		return
+	}
+	a.Cases = append(a.Cases, req.CaseID)
+	a.StatusID = MergedStatusID
+	writeData(w, "Alert merged", map[string]int{"case_id": req.CaseID})
+}
+
+// filter supports the alert_source, source_ref, alert_status_id,
+// alert_customer_id and alert_assets (comma separated asset names) filters with page/per_page pagination.
+func (s *Server) filter(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	page, _ := strconv.Atoi(q.Get("page"))
+	page = max(page, 1)
+	perPage, _ := strconv.Atoi(q.Get("per_page"))
+	if perPage <= 0 {
+		perPage = 10
+	}
+
+	var matched []Alert
+	for _, a := range s.Alerts() {
+		if v := q.Get("alert_source"); v != "" && a.Source != v {
+			continue
+		}
+		if v := q.Get("source_ref"); v != "" && a.SourceRef != v {
+			continue
+		}
+		if v := q.Get("alert_status_id"); v != "" && strconv.Itoa(a.StatusID) != v {
+			continue
+		}
+		if v := q.Get("alert_customer_id"); v != "" && strconv.Itoa(a.CustomerID) != v {
+			continue
+		}
+		if v := q.Get("alert_assets"); v != "" && !slices.ContainsFunc(a.Assets, func(asset Asset) bool {
+			return slices.Contains(strings.Split(v, ","), asset.Name)
+		}) {
+			continue
+		}
+		matched = append(matched, a)
+	}
+
+	lastPage := max((len(matched)+perPage-1)/perPage, 1)
+	start := min((page-1)*perPage, len(matched))
+	end := min(start+perPage, len(matched))
+	writeData(w, "", map[string]any{
+		"alerts":       matched[start:end],
+		"total":        len(matched),
+		"current_page": page,
+		"last_page":    lastPage,
+	})
+}
+
+// Files returns the files uploaded to case datastores.
+func (s *Server) Files() []File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.files)
+}
+
+// datastoreTree returns a datastore with only a root folder; every case has
+// one.
+func (s *Server) datastoreTree(w http.ResponseWriter, r *http.Request) {
+	writeData(w, "", map[string]any{
+		"d-1": map[string]any{"name": "Root", "type": "directory", "is_root": true, "children": map[string]any{}},
+	})
+}
+
+func (s *Server) datastoreAdd(w http.ResponseWriter, r *http.Request) {
+	caseID, err := strconv.Atoi(r.URL.Query().Get("cid"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid case id")
+		return
+	}
+	f, hdr, err := r.FormFile("file_content")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "missing file_content")
+		return
+	}
+	f.Close()
+
+	s.mu.Lock()
+	file := File{
+		ID:          len(s.files) + 1,
+		CaseID:      caseID,
+		Name:        r.FormValue("file_original_name"),
+		Description: r.FormValue("file_description"),
+		Size:        int(hdr.Size),
+	}
+	s.files = append(s.files, file)
+	s.mu.Unlock()
+
+	writeData(w, "File saved in datastore", file)
+}
+
+func (s *Server) ping(w http.ResponseWriter, r *http.Request) {
+	writeData(w, "pong", []any{})
+}
+
+// list serves a management list of the given names, numbered from 1 like a
+// fresh IRIS install.
+func (s *Server) list(idField, nameField string, names ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		items := make([]map[string]any, len(names))
+		for i, name := range names {
+			items[i] = map[string]any{idField: i + 1, nameField: name}
+		}
+		writeData(w, "", items)
+	}
+}
+
+// lookup must be called with s.mu held.
+func (s *Server) lookup(w http.ResponseWriter, r *http.Request) (*Alert, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid alert id")
+		return nil, false
+	}
+	a, ok := s.alerts[id]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Alert not found")
+		return nil, false
+	}
+	if cid := r.URL.Query().Get("cid"); cid != "" && cid != strconv.Itoa(a.CustomerID) {
+		writeError(w, http.StatusBadRequest, "Alert not found")
+		return nil, false
+	}
+	return a, true
+}
+
+func writeData(w http.ResponseWriter, msg string, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"status": "success", "message": msg, "data": data})
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"status": "error", "message": msg, "data": []any{}})
+}
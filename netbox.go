@@ -0,0 +1,231 @@
+package alertiris
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type NetBoxConfig struct {
+	URL            string        `koanf:"url"`
+	Token          string        `koanf:"token"`
+	HostnameLabels []string      `koanf:"hostname_labels"`
+	IPLabels       []string      `koanf:"ip_labels"`
+	TagPrefix      string        `koanf:"tag_prefix"`
+	CacheTTL       time.Duration `koanf:"cache_ttl"`
+	Timeout        time.Duration `koanf:"timeout"`
+}
+
+// netBox adds the site, rack, role and tenant of the device or virtual
+// machine an alert fires for to the alert note. Hosts are looked up by name,
+// then by the IP addresses assigned to their interfaces.
+type netBox struct {
+	cfg    NetBoxConfig
+	client *http.Client
+	cache  *enrichmentCache
+}
+
+type netBoxRef struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+type netBoxHost struct {
+	Found   bool       `json:"found"`
+	Kind    string     `json:"kind"`
+	ID      int        `json:"id"`
+	Name    string     `json:"name"`
+	URL     string     `json:"display_url"`
+	Site    *netBoxRef `json:"site"`
+	Rack    *netBoxRef `json:"rack"`
+	Role    *netBoxRef `json:"role"`
+	Tenant  *netBoxRef `json:"tenant"`
+	Cluster *netBoxRef `json:"cluster"`
+
+	// DeviceRole is the role of devices before NetBox 4.0.
+	DeviceRole *netBoxRef `json:"device_role"`
+}
+
+type netBoxIP struct {
+	AssignedObject struct {
+		Device         *netBoxRef `json:"device"`
+		VirtualMachine *netBoxRef `json:"virtual_machine"`
+	} `json:"assigned_object"`
+}
+
+func newNetBox(cfg NetBoxConfig, cache *enrichmentCache) *netBox {
+	if cfg.URL == "" {
+		return nil
+	}
+	return &netBox{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		cache:  cache,
+	}
+}
+
+func (n *netBox) name() string { return "netbox" }
+
+func (n *netBox) enrich(ctx context.Context, sa *SinkAlert, _ []IOC) string {
+	hostname, ip := AssetConfig{HostnameLabels: n.cfg.HostnameLabels, IPLabels: n.cfg.IPLabels}.alertHost(sa.Alert.Labels)
+	key := cmp.Or(hostname, ip)
+	if key == "" {
+		return ""
+	}
+	host, err := n.lookup(ctx, hostname, ip)
+	if err != nil {
+		slog.Warn("netbox lookup failed", "fingerprint", sa.Fingerprint, "host", key, "error", err)
+		return ""
+	}
+	if !host.Found {
+		return fmt.Sprintf("NetBox:\n- %s: not found", key)
+	}
+
+	role := cmp.Or(host.Role, host.DeviceRole)
+	line := fmt.Sprintf("- %s %s: site %s", host.Kind, host.Name, refName(host.Site))
+	if host.Kind == "device" {
+		line += ", rack " + refName(host.Rack)
+	} else {
+		line += ", cluster " + refName(host.Cluster)
+	}
+	line += ", role " + refName(role) + ", tenant " + refName(host.Tenant)
+	if host.URL != "" {
+		line += "\n  " + host.URL
+	}
+	if n.cfg.TagPrefix != "" {
+		for i, ref := range []*netBoxRef{host.Site, role, host.Tenant} {
+			if ref != nil {
+				kind := [...]string{"site", "role", "tenant"}[i]
+				sa.Tags = append(sa.Tags, n.cfg.TagPrefix+kind+":"+cmp.Or(ref.Slug, ref.Name))
+			}
+		}
+	}
+	return "NetBox:\n" + line
+}
+
+func refName(ref *netBoxRef) string {
+	if ref == nil {
+		return "none"
+	}
+	return ref.Name
+}
+
+// lookup finds the device or virtual machine named hostname, falling back to
+// the one ip is assigned to.
+func (n *netBox) lookup(ctx context.Context, hostname, ip string) (netBoxHost, error) {
+	var host netBoxHost
+	key := hostname + "|" + ip
+	if n.cache.get("netbox", key, &host) {
+		enrichmentLookups("netbox", "cached").Inc()
+		return host, nil
+	}
+
+	var err error
+	if hostname != "" {
+		host, err = n.byName(ctx, hostname)
+	}
+	if err == nil && !host.Found && ip != "" {
+		host, err = n.byIP(ctx, ip)
+	}
+	if err != nil {
+		enrichmentFailed("netbox")
+		return host, err
+	}
+	enrichmentLookups("netbox", "ok").Inc()
+	n.cache.set("netbox", key, host, n.cfg.CacheTTL)
+	return host, nil
+}
+
+func (n *netBox) byName(ctx context.Context, name string) (netBoxHost, error) {
+	for _, kind := range []string{"device", "virtual machine"} {
+		var hosts []netBoxHost
+		if err := n.get(ctx, netBoxPath(kind), url.Values{"name__ie": {name}, "limit": {"1"}}, &hosts); err != nil {
+			return netBoxHost{}, err
+		}
+		if len(hosts) > 0 {
+			hosts[0].Found, hosts[0].Kind = true, kind
+			return hosts[0], nil
+		}
+	}
+	return netBoxHost{}, nil
+}
+
+func (n *netBox) byIP(ctx context.Context, ip string) (netBoxHost, error) {
+	var ips []netBoxIP
+	if err := n.get(ctx, "/api/ipam/ip-addresses/", url.Values{"address": {ip}}, &ips); err != nil {
+		return netBoxHost{}, err
+	}
+	for _, addr := range ips {
+		kind, ref := "device", addr.AssignedObject.Device
+		if ref == nil {
+			kind, ref = "virtual machine", addr.AssignedObject.VirtualMachine
+		}
+		if ref == nil {
+			continue
+		}
+		var host netBoxHost
+		if err := n.get(ctx, fmt.Sprintf("%s%d/", netBoxPath(kind), ref.ID), nil, &host); err != nil {
+			return host, err
+		}
+		host.Found, host.Kind = true, kind
+		return host, nil
+	}
+	return netBoxHost{}, nil
+}
+
+func netBoxPath(kind string) string {
+	if kind == "device" {
+		return "/api/dcim/devices/"
+	}
+	return "/api/virtualization/virtual-machines/"
+}
+
+// get fetches path into v, which receives the results of list endpoints.
+func (n *netBox) get(ctx context.Context, path string, query url.Values, v any) error {
+	u := strings.TrimRight(n.cfg.URL, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if n.cfg.Token != "" {
+		req.Header.Set("Authorization", "Token "+n.cfg.Token)
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("netbox returned %s: %s", resp.Status, msg)
+	}
+
+	if query == nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			return fmt.Errorf("decode response: %w", err)
+		}
+		return nil
+	}
+	var list struct {
+		Results json.RawMessage `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	if err := json.Unmarshal(list.Results, v); err != nil {
+		return fmt.Errorf("decode results: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,323 @@
+package alertiris
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+type NotifierConfig struct {
+	Name        string   `koanf:"name"`
+	Type        string   `koanf:"type"`
+	URL         string   `koanf:"url"`
+	Events      []string `koanf:"events"`
+	Homeserver  string   `koanf:"homeserver"`
+	RoomID      string   `koanf:"room_id"`
+	AccessToken string   `koanf:"access_token"`
+}
+
+type Notification struct {
+	Event       string
+	Title       string
+	Severity    string
+	Fingerprint string
+	CustomerID  int
+	AlertID     string
+	Link        string
+	// Text is an optional message body, such as a comment.
+	Text string
+}
+
+type Notifier struct {
+	irisURL  string
+	channels []notifyChannel
+	client   *http.Client
+}
+
+type notifyChannel struct {
+	cfg  NotifierConfig
+	send func(client *http.Client, n Notification) error
+}
+
+func NewNotifier(cfgs []NotifierConfig, irisURL string) (*Notifier, error) {
+	n := &Notifier{
+		irisURL: strings.TrimRight(irisURL, "/"),
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+	for _, cfg := range cfgs {
+		if len(cfg.Events) == 0 {
+			cfg.Events = []string{"created", "escalated"}
+		}
+
+		ch := notifyChannel{cfg: cfg}
+		switch cfg.Type {
+		case "slack":
+			ch.send = cfg.sendSlack
+		case "mattermost":
+			ch.send = cfg.sendMattermost
+		case "teams":
+			ch.send = cfg.sendTeams
+		case "matrix":
+			if cfg.Homeserver == "" || cfg.RoomID == "" || cfg.AccessToken == "" {
+				return nil, fmt.Errorf("notifier %q: matrix requires homeserver, room_id and access_token", cfg.Name)
+			}
+			ch.send = cfg.sendMatrix
+		default:
+			return nil, fmt.Errorf("notifier %q: unknown type %q", cfg.Name, cfg.Type)
+		}
+		if cfg.Type != "matrix" && cfg.URL == "" {
+			return nil, fmt.Errorf("notifier %q: url is required", cfg.Name)
+		}
+		n.channels = append(n.channels, ch)
+	}
+	return n, nil
+}
+
+func (n *Notifier) AlertLink(alertID string, customerID int) string {
+	return fmt.Sprintf("%s/alerts?alert_ids=%s&cid=%d", n.irisURL, alertID, customerID)
+}
+
+func (n *Notifier) Notify(notification Notification) {
+	for _, ch := range n.channels {
+		if !slices.Contains(ch.cfg.Events, notification.Event) {
+			continue
+		}
+		go func() {
+			if err := ch.send(n.client, notification); err != nil {
+				slog.Error("failed to send notification", "notifier", ch.cfg.Name, "event", notification.Event, "fingerprint", notification.Fingerprint, "error", err)
+			}
+		}()
+	}
+}
+
+// NotifyChannels sends to the named notifiers regardless of their events.
+func (n *Notifier) NotifyChannels(names []string, notification Notification) {
+	for _, ch := range n.channels {
+		if !slices.Contains(names, ch.cfg.Name) {
+			continue
+		}
+		go func() {
+			if err := ch.send(n.client, notification); err != nil {
+				slog.Error("failed to send notification", "notifier", ch.cfg.Name, "event", notification.Event, "fingerprint", notification.Fingerprint, "error", err)
+			}
+		}()
+	}
+}
+
+func (n Notification) headline() string {
+	if n.AlertID == "" {
+		return fmt.Sprintf("Alert %s: %s (severity %s, customer %d)", n.Event, n.Title, n.Severity, n.CustomerID)
+	}
+	return fmt.Sprintf("IRIS alert %s %s: %s (severity %s, customer %d)", n.AlertID, n.Event, n.Title, n.Severity, n.CustomerID)
+}
+
+// details returns Text on a line of its own, or nothing.
+func (n Notification) details() string {
+	if n.Text == "" {
+		return ""
+	}
+	return "\n" + n.Text
+}
+
+func (n Notification) linkText() string {
+	if n.AlertID == "" {
+		return "Open source"
+	}
+	return "Open in IRIS"
+}
+
+func (n *Notifier) has(name string) bool {
+	return slices.ContainsFunc(n.channels, func(ch notifyChannel) bool { return ch.cfg.Name == name })
+}
+
+func (n *Notifier) sink(name string) (Sink, bool) {
+	for _, ch := range n.channels {
+		if ch.cfg.Name == name {
+			return &notifierSink{channel: ch, client: n.client}, true
+		}
+	}
+	return nil, false
+}
+
+// notifierSink lets a notifier be used as a sink in routes. It posts when an
+// alert starts firing and when it resolves.
+type notifierSink struct {
+	channel notifyChannel
+	client  *http.Client
+}
+
+func (s *notifierSink) Name() string {
+	return s.channel.cfg.Name
+}
+
+func (s *notifierSink) Create(ctx context.Context, a *SinkAlert) (string, error) {
+	return a.Fingerprint, s.channel.send(s.client, sinkNotification("firing", a))
+}
+
+func (s *notifierSink) Update(ctx context.Context, id string, a *SinkAlert) error {
+	return nil
+}
+
+func (s *notifierSink) Resolve(ctx context.Context, id string, a *SinkAlert) error {
+	return s.channel.send(s.client, sinkNotification("resolved", a))
+}
+
+func sinkNotification(event string, a *SinkAlert) Notification {
+	severity := a.Alert.Labels["severity"]
+	if severity == "" {
+		severity = strconv.Itoa(a.SeverityID)
+	}
+	return Notification{
+		Event:       event,
+		Title:       a.Title,
+		Severity:    severity,
+		Fingerprint: a.Fingerprint,
+		CustomerID:  a.CustomerID,
+		Link:        a.SourceLink,
+	}
+}
+
+// slackEscaper escapes the characters Slack mrkdwn uses for links,
+// mentions and entities, so alert titles and labels stay plain text.
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// markdownEscaper backslash-escapes the Markdown control characters that
+// would let alert titles and labels format a Mattermost message or add
+// links and images to it.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "~", `\~`, "#", `\#`, "|", `\|`,
+	"[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`, "<", `\<`, ">", `\>`, "!", `\!`,
+)
+
+func (cfg NotifierConfig) sendSlack(client *http.Client, n Notification) error {
+	link := strings.ReplaceAll(slackEscaper.Replace(n.Link), "|", "%7C")
+	return postJSON(client, cfg.URL, nil, map[string]string{
+		"text": fmt.Sprintf("%s%s\n<%s|%s>", slackEscaper.Replace(n.headline()), slackEscaper.Replace(n.details()), link, n.linkText()),
+	})
+}
+
+func (cfg NotifierConfig) sendMattermost(client *http.Client, n Notification) error {
+	link := strings.NewReplacer("(", "%28", ")", "%29", " ", "%20").Replace(n.Link)
+	return postJSON(client, cfg.URL, nil, map[string]string{
+		"text": fmt.Sprintf("%s%s\n[%s](%s)", markdownEscaper.Replace(n.headline()), markdownEscaper.Replace(n.details()), n.linkText(), link),
+	})
+}
+
+func (cfg NotifierConfig) sendTeams(client *http.Client, n Notification) error {
+	return postJSON(client, cfg.URL, nil, map[string]any{
+		"@type":    "MessageCard",
+		"@context": "https://schema.org/extensions",
+		"summary":  n.headline(),
+		"title":    n.headline(),
+		"text":     "Fingerprint: " + n.Fingerprint + strings.ReplaceAll(n.details(), "\n", "\n\n"),
+		"potentialAction": []map[string]any{{
+			"@type":   "OpenUri",
+			"name":    n.linkText(),
+			"targets": []map[string]string{{"os": "default", "uri": n.Link}},
+		}},
+	})
+}
+
+func (cfg NotifierConfig) sendMatrix(client *http.Client, n Notification) error {
+	txnID := strconv.FormatInt(time.Now().UnixNano(), 10)
+	u := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		strings.TrimRight(cfg.Homeserver, "/"), url.PathEscape(cfg.RoomID), txnID)
+	headers := map[string]string{"Authorization": "Bearer " + cfg.AccessToken}
+	return doJSON(client, http.MethodPut, u, headers, map[string]string{
+		"msgtype":        "m.text",
+		"body":           n.headline() + n.details() + "\n" + n.Link,
+		"format":         "org.matrix.custom.html",
+		"formatted_body": fmt.Sprintf(`%s%s<br><a href="%s">%s</a>`, html.EscapeString(n.headline()), strings.ReplaceAll(html.EscapeString(n.details()), "\n", "<br>"), html.EscapeString(n.Link), n.linkText()),
+	})
+}
+
+func postJSON(client *http.Client, u string, headers map[string]string, body any) error {
+	return doJSON(client, http.MethodPost, u, headers, body)
+}
+
+func doJSON(client *http.Client, method, u string, headers map[string]string, body any) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("marshal request: %w", err)
+	}
+	req, err := http.NewRequest(method, u, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("returned %d: %s", resp.StatusCode, string(msg))
+	}
+	return nil
+}
+
+func (h *Handler) notifyIRIS(event, alertID string, sa *SinkAlert) {
+	severity := sa.Alert.Labels["severity"]
+	if severity == "" {
+		severity = strconv.Itoa(sa.SeverityID)
+	}
+	h.notifier.Notify(Notification{
+		Event:       event,
+		Title:       sa.Title,
+		Severity:    severity,
+		Fingerprint: sa.Fingerprint,
+		CustomerID:  sa.CustomerID,
+		AlertID:     alertID,
+		Link:        h.notifier.AlertLink(alertID, sa.CustomerID),
+	})
+}
+
+// trackSeverity records the severity sent to IRIS and reports whether it
+// increased since the previous delivery.
+func (h *Handler) trackSeverity(fingerprint string, customerID, severityID int) (bool, error) {
+	key := []byte("sev:" + fingerprint + ":" + strconv.Itoa(customerID))
+	escalated := false
+	err := h.db.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err != nil && err != badger.ErrKeyNotFound {
+			return err
+		}
+		if err == nil {
+			if err := item.Value(func(val []byte) error {
+				prev, err := strconv.Atoi(string(val))
+				if err != nil {
+					return err
+				}
+				escalated = severityID > prev
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+		return txn.Set(key, []byte(strconv.Itoa(severityID)))
+	})
+	return escalated, err
+}
+
+func (h *Handler) clearSeverity(fingerprint string, customerID int) error {
+	return h.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete([]byte("sev:" + fingerprint + ":" + strconv.Itoa(customerID)))
+	})
+}
@@ -0,0 +1,186 @@
+package alertiris
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type NVDConfig struct {
+	Enabled bool   `koanf:"enabled"`
+	URL     string `koanf:"url"`
+	// APIKey is optional and raises NVD's rate limit.
+	APIKey string `koanf:"api_key"`
+	// ClassificationID is set on alerts mentioning a CVE, e.g. the ID of
+	// "Vulnerability exploitation". Zero keeps the configured
+	// classification.
+	ClassificationID int           `koanf:"classification_id"`
+	RateLimit        int           `koanf:"rate_limit"`
+	CacheTTL         time.Duration `koanf:"cache_ttl"`
+	MaxLookups       int           `koanf:"max_lookups"`
+	Timeout          time.Duration `koanf:"timeout"`
+	// MaxSummary truncates CVE descriptions. Zero keeps them whole.
+	MaxSummary int `koanf:"max_summary"`
+}
+
+// nvd adds the summary and CVSS score of CVEs mentioned in an alert to its
+// description and tags.
+type nvd struct {
+	cfg     NVDConfig
+	client  *http.Client
+	cache   *enrichmentCache
+	limiter *lookupLimiter
+}
+
+type nvdCVE struct {
+	Found    bool    `json:"found"`
+	Summary  string  `json:"summary"`
+	Score    float64 `json:"score"`
+	Severity string  `json:"severity"`
+}
+
+func newNVD(cfg NVDConfig, cache *enrichmentCache) *nvd {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &nvd{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: cfg.Timeout},
+		cache:   cache,
+		limiter: &lookupLimiter{limit: cfg.RateLimit},
+	}
+}
+
+func (n *nvd) name() string { return "nvd" }
+
+func (n *nvd) enrich(ctx context.Context, sa *SinkAlert, iocs []IOC) string {
+	var lines []string
+	found := false
+	lookups := 0
+	for _, ioc := range iocs {
+		if ioc.Type != IOCCVE {
+			continue
+		}
+		found = true
+		sa.Tags = append(sa.Tags, ioc.Value)
+		if n.cfg.MaxLookups > 0 && lookups >= n.cfg.MaxLookups {
+			continue
+		}
+		lookups++
+		cve, err := n.lookup(ctx, ioc.Value)
+		if err != nil {
+			slog.Warn("nvd lookup failed", "fingerprint", sa.Fingerprint, "cve", ioc.Value, "error", err)
+			continue
+		}
+		if !cve.Found {
+			lines = append(lines, fmt.Sprintf("- %s: not found in NVD", ioc.Value))
+			continue
+		}
+		summary := cve.Summary
+		if n.cfg.MaxSummary > 0 && len(summary) > n.cfg.MaxSummary {
+			summary = strings.ToValidUTF8(summary[:n.cfg.MaxSummary], "") + "..."
+		}
+		score := "no CVSS score"
+		if cve.Severity != "" {
+			score = fmt.Sprintf("CVSS %s %s", strconv.FormatFloat(cve.Score, 'f', 1, 64), cve.Severity)
+			sa.Tags = append(sa.Tags, "cvss:"+strings.ToLower(cve.Severity))
+		}
+		lines = append(lines, fmt.Sprintf("- %s (%s): %s https://nvd.nist.gov/vuln/detail/%s", ioc.Value, score, summary, ioc.Value))
+	}
+	if found && n.cfg.ClassificationID > 0 {
+		sa.ClassificationID = n.cfg.ClassificationID
+	}
+	if len(lines) > 0 {
+		sa.Description = strings.TrimRight(sa.Description, "\n") + "\n\nVulnerabilities:\n" + strings.Join(lines, "\n")
+	}
+	return ""
+}
+
+func (n *nvd) lookup(ctx context.Context, id string) (nvdCVE, error) {
+	var cve nvdCVE
+	if n.cache.get("nvd", id, &cve) {
+		enrichmentLookups("nvd", "cached").Inc()
+		return cve, nil
+	}
+	if !n.limiter.allow() {
+		enrichmentLookups("nvd", "rate_limited").Inc()
+		return cve, fmt.Errorf("rate limit of %d lookups per minute reached", n.cfg.RateLimit)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, n.cfg.URL+"?"+url.Values{"cveId": {id}}.Encode(), nil)
+	if err != nil {
+		return cve, fmt.Errorf("create request: %w", err)
+	}
+	if n.cfg.APIKey != "" {
+		req.Header.Set("apiKey", n.cfg.APIKey)
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		enrichmentFailed("nvd")
+		return cve, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		enrichmentFailed("nvd")
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return cve, fmt.Errorf("nvd returned %s: %s", resp.Status, msg)
+	}
+
+	type cvssMetric struct {
+		BaseSeverity string `json:"baseSeverity"`
+		CVSSData     struct {
+			BaseScore    float64 `json:"baseScore"`
+			BaseSeverity string  `json:"baseSeverity"`
+		} `json:"cvssData"`
+	}
+	var body struct {
+		Vulnerabilities []struct {
+			CVE struct {
+				Descriptions []struct {
+					Lang  string `json:"lang"`
+					Value string `json:"value"`
+				} `json:"descriptions"`
+				Metrics struct {
+					V40 []cvssMetric `json:"cvssMetricV40"`
+					V31 []cvssMetric `json:"cvssMetricV31"`
+					V30 []cvssMetric `json:"cvssMetricV30"`
+					V2  []cvssMetric `json:"cvssMetricV2"`
+				} `json:"metrics"`
+			} `json:"cve"`
+		} `json:"vulnerabilities"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		enrichmentFailed("nvd")
+		return cve, fmt.Errorf("decode response: %w", err)
+	}
+	if len(body.Vulnerabilities) > 0 {
+		v := body.Vulnerabilities[0].CVE
+		cve.Found = true
+		for _, d := range v.Descriptions {
+			if d.Lang == "en" {
+				cve.Summary = d.Value
+				break
+			}
+		}
+		for _, m := range [][]cvssMetric{v.Metrics.V40, v.Metrics.V31, v.Metrics.V30, v.Metrics.V2} {
+			if len(m) == 0 {
+				continue
+			}
+			cve.Score = m[0].CVSSData.BaseScore
+			// CVSS v2 has the severity next to the data.
+			cve.Severity = cmp.Or(m[0].CVSSData.BaseSeverity, m[0].BaseSeverity)
+			break
+		}
+	}
+	enrichmentLookups("nvd", "ok").Inc()
+	n.cache.set("nvd", id, cve, n.cfg.CacheTTL)
+	return cve, nil
+}
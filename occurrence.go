@@ -0,0 +1,71 @@
+package alertiris
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+type occurrence struct {
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+}
+
+func (h *Handler) recordOccurrence(fingerprint string, customerID int) (int, bool, error) {
+	threshold := h.config.OccurrenceThreshold
+	if threshold <= 1 {
+		return 1, true, nil
+	}
+	window := h.config.OccurrenceWindow
+
+	var occ occurrence
+	err := h.db.Update(func(txn *badger.Txn) error {
+		key := occurrenceKey(fingerprint, customerID)
+		item, err := txn.Get(key)
+		if err != nil && err != badger.ErrKeyNotFound {
+			return err
+		}
+		if err == nil {
+			if err := item.Value(func(val []byte) error {
+				return json.Unmarshal(val, &occ)
+			}); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		if occ.Count == 0 || (window > 0 && now.Sub(occ.FirstSeen) > window) {
+			occ = occurrence{FirstSeen: now}
+		}
+		occ.Count++
+
+		val, err := json.Marshal(occ)
+		if err != nil {
+			return err
+		}
+		entry := badger.NewEntry(key, val)
+		if window > 0 {
+			entry = entry.WithTTL(window - now.Sub(occ.FirstSeen))
+		}
+		return txn.SetEntry(entry)
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	return occ.Count, occ.Count >= threshold, nil
+}
+
+func (h *Handler) clearOccurrences(fingerprint string, customerID int) error {
+	if h.config.OccurrenceThreshold <= 1 {
+		return nil
+	}
+	return h.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(occurrenceKey(fingerprint, customerID))
+	})
+}
+
+func occurrenceKey(fingerprint string, customerID int) []byte {
+	return []byte("occ:" + fingerprint + ":" + strconv.Itoa(customerID))
+}
@@ -0,0 +1,112 @@
+package alertiris
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"sync"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	orderingWaits   = metrics.NewCounter(`alertiris_ordering_waits_total`)
+	coalescedAlerts = metrics.NewCounter(`alertiris_coalesced_alerts_total`)
+)
+
+// fingerprintOrder makes alerts with the same fingerprint take turns in
+// the order they arrived, so a resolve cannot race ahead of the create it
+// depends on when webhooks are processed concurrently or by several queue
+// workers. Turns are reserved on arrival and taken when processing starts.
+// Alerts take turns whatever customer they came in for, as routing may
+// still send them to the same IRIS customer.
+//
+// An alert arriving while the last one with its fingerprint is still
+// pending and identical to it, for the same group and customer, as when
+// both Alertmanagers of an HA pair deliver the same group, is coalesced
+// with it: it is not processed again but shares the result, so IRIS sees
+// one call. An alert that differs in anything, such as a changed annotation
+// or another customer, takes its own turn.
+type fingerprintOrder struct {
+	mu    sync.Mutex
+	tails map[string]*turn
+}
+
+func newFingerprintOrder() *fingerprintOrder {
+	return &fingerprintOrder{tails: make(map[string]*turn)}
+}
+
+// turn is one alert's place in the line of its fingerprint. A coalesced
+// alert has no place of its own and only shares the turn it joined.
+type turn struct {
+	fingerprint string
+	payload     [sha256.Size]byte
+	prev        *turn
+	done        chan struct{}
+	err         error
+
+	shared *turn
+}
+
+// reserve takes a turn for each alert, in order. group and customerID are
+// those the alerts arrived with.
+func (o *fingerprintOrder) reserve(alerts []Alert, group string, customerID int) []*turn {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	turns := make([]*turn, len(alerts))
+	for i, a := range alerts {
+		payload := alertDigest(a, group, customerID)
+		tail := o.tails[a.Fingerprint]
+		if tail != nil && tail.payload == payload {
+			turns[i] = &turn{shared: tail}
+			continue
+		}
+		t := &turn{fingerprint: a.Fingerprint, payload: payload, prev: tail, done: make(chan struct{})}
+		o.tails[a.Fingerprint] = t
+		turns[i] = t
+	}
+	return turns
+}
+
+// alertDigest identifies the content of an alert and what it is routed by.
+// Labels and annotations are maps, which encoding/json writes sorted.
+func alertDigest(a Alert, group string, customerID int) [sha256.Size]byte {
+	b, _ := json.Marshal(struct {
+		Alert      Alert
+		Group      string
+		CustomerID int
+	}{a, group, customerID})
+	return sha256.Sum256(b)
+}
+
+// wait blocks until the alerts reserved before t are processed.
+func (t *turn) wait() {
+	if t.prev == nil {
+		return
+	}
+	select {
+	case <-t.prev.done:
+	default:
+		orderingWaits.Inc()
+		<-t.prev.done
+	}
+}
+
+// result waits for the turn a coalesced alert joined and returns its
+// error.
+func (t *turn) result() error {
+	coalescedAlerts.Inc()
+	<-t.shared.done
+	return t.shared.err
+}
+
+// release records the result of t and lets the next alert with the same
+// fingerprint proceed.
+func (o *fingerprintOrder) release(t *turn, err error) {
+	o.mu.Lock()
+	t.err = err
+	if o.tails[t.fingerprint] == t {
+		delete(o.tails, t.fingerprint)
+	}
+	o.mu.Unlock()
+	close(t.done)
+}
@@ -0,0 +1,224 @@
+package alertiris
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/dgraph-io/badger/v4"
+)
+
+// newTestHandler returns a Handler whose pipeline is the single stage fn,
+// with an in-memory state store and no sinks.
+func newTestHandler(t *testing.T, fn StageFunc) *Handler {
+	t.Helper()
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	redactor, err := NewRedactor(RedactionConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &Handler{db: db, redactor: redactor, order: newFingerprintOrder()}
+	h.pipeline = &Pipeline{stages: []*stage{{
+		name:      "test",
+		run:       fn,
+		processed: metrics.GetOrCreateCounter(`alertiris_stage_processed_total{stage="test"}`),
+		stopped:   metrics.GetOrCreateCounter(`alertiris_stage_stopped_total{stage="test"}`),
+		errors:    metrics.GetOrCreateCounter(`alertiris_stage_errors_total{stage="test"}`),
+		duration:  metrics.GetOrCreateHistogram(`alertiris_stage_duration_seconds{stage="test"}`),
+	}}}
+	return h
+}
+
+// eventLog records the alerts a test stage saw, in order.
+type eventLog struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *eventLog) add(ev *Event) {
+	l.mu.Lock()
+	l.events = append(l.events, ev.Alert.Fingerprint+" "+ev.Alert.Status)
+	l.mu.Unlock()
+}
+
+func (l *eventLog) get() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return slices.Clone(l.events)
+}
+
+func testAlert(fingerprint, status string) Alert {
+	return Alert{
+		Status:      status,
+		Labels:      map[string]string{"alertname": "Test"},
+		Annotations: map[string]string{"summary": "test"},
+		Fingerprint: fingerprint,
+	}
+}
+
+func TestResolveWaitsForCreate(t *testing.T) {
+	var log eventLog
+	h := newTestHandler(t, func(ctx context.Context, ev *Event, next Next) error {
+		if ev.Alert.Status == "firing" {
+			// A slow create gives the resolve every chance to overtake it.
+			time.Sleep(50 * time.Millisecond)
+		}
+		log.add(ev)
+		return nil
+	})
+
+	// The webhooks arrive create first, but the resolve starts processing
+	// first.
+	fire := []Alert{testAlert("fp1", "firing")}
+	resolve := []Alert{testAlert("fp1", "resolved")}
+	fireTurns := h.order.reserve(fire, "", 1)
+	resolveTurns := h.order.reserve(resolve, "", 1)
+
+	var wg sync.WaitGroup
+	wg.Go(func() { h.processInOrder(context.Background(), resolve, resolveTurns, "alertmanager", "", 1) })
+	time.Sleep(10 * time.Millisecond)
+	wg.Go(func() { h.processInOrder(context.Background(), fire, fireTurns, "alertmanager", "", 1) })
+	wg.Wait()
+
+	want := []string{"fp1 firing", "fp1 resolved"}
+	if got := log.get(); !slices.Equal(got, want) {
+		t.Fatalf("processed %v, want %v", got, want)
+	}
+}
+
+func TestConcurrentWebhooksKeepOrderPerFingerprint(t *testing.T) {
+	var log eventLog
+	h := newTestHandler(t, func(ctx context.Context, ev *Event, next Next) error {
+		if ev.Alert.Status == "firing" {
+			time.Sleep(time.Duration(len(ev.Alert.Fingerprint)%3) * 5 * time.Millisecond)
+		}
+		log.add(ev)
+		return nil
+	})
+
+	// Each fingerprint fires and resolves in separate webhooks, sent
+	// concurrently with those of the others.
+	var wg sync.WaitGroup
+	for i := range 20 {
+		fp := fmt.Sprintf("fp%0*d", i%3+1, i)
+		fire := []Alert{testAlert(fp, "firing")}
+		resolve := []Alert{testAlert(fp, "resolved")}
+		fireTurns := h.order.reserve(fire, "", 1)
+		resolveTurns := h.order.reserve(resolve, "", 1)
+		wg.Go(func() { h.processInOrder(context.Background(), resolve, resolveTurns, "alertmanager", "", 1) })
+		wg.Go(func() { h.processInOrder(context.Background(), fire, fireTurns, "alertmanager", "", 1) })
+	}
+	wg.Wait()
+
+	checkFiredBeforeResolved(t, log.get(), 20)
+}
+
+// checkFiredBeforeResolved checks that each of n fingerprints was processed
+// firing, then resolved.
+func checkFiredBeforeResolved(t *testing.T, events []string, n int) {
+	t.Helper()
+	seen := map[string][]string{}
+	for _, e := range events {
+		var fp, status string
+		fmt.Sscan(e, &fp, &status)
+		seen[fp] = append(seen[fp], status)
+	}
+	if len(seen) != n {
+		t.Fatalf("processed %d fingerprints, want %d", len(seen), n)
+	}
+	for fp, statuses := range seen {
+		if !slices.Equal(statuses, []string{"firing", "resolved"}) {
+			t.Errorf("%s processed %v, want [firing resolved]", fp, statuses)
+		}
+	}
+}
+
+func TestReserveCoalescing(t *testing.T) {
+	changed := testAlert("fp1", "firing")
+	changed.Annotations = map[string]string{"summary": "changed"}
+
+	tests := []struct {
+		name       string
+		alert      Alert
+		group      string
+		customerID int
+		coalesced  bool
+	}{
+		{"identical", testAlert("fp1", "firing"), "", 1, true},
+		{"changed annotation", changed, "", 1, false},
+		{"other status", testAlert("fp1", "resolved"), "", 1, false},
+		{"other group", testAlert("fp1", "firing"), "ops", 1, false},
+		{"other customer", testAlert("fp1", "firing"), "", 2, false},
+		{"other fingerprint", testAlert("fp2", "firing"), "", 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newFingerprintOrder()
+			first := o.reserve([]Alert{testAlert("fp1", "firing")}, "", 1)[0]
+			second := o.reserve([]Alert{tt.alert}, tt.group, tt.customerID)[0]
+			if coalesced := second.shared == first; coalesced != tt.coalesced {
+				t.Fatalf("coalesced = %v, want %v", coalesced, tt.coalesced)
+			}
+			if !tt.coalesced && tt.alert.Fingerprint == "fp1" && second.prev != first {
+				t.Fatal("alert with the same fingerprint does not wait for the first")
+			}
+		})
+	}
+}
+
+func TestReserveCoalescesOnlyWhilePending(t *testing.T) {
+	o := newFingerprintOrder()
+	alerts := []Alert{testAlert("fp1", "firing")}
+	first := o.reserve(alerts, "", 1)[0]
+	o.release(first, nil)
+	second := o.reserve(alerts, "", 1)[0]
+	if second.shared != nil || second.prev != nil {
+		t.Fatal("alert arriving after the first was released did not get a turn of its own")
+	}
+}
+
+func TestCoalescedAlertsShareResult(t *testing.T) {
+	var calls int
+	var mu sync.Mutex
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	h := newTestHandler(t, func(ctx context.Context, ev *Event, next Next) error {
+		mu.Lock()
+		calls++
+		if calls == 1 {
+			close(started)
+		}
+		mu.Unlock()
+		<-unblock
+		return errors.New("iris unavailable")
+	})
+
+	// Both Alertmanagers of an HA pair deliver the same group.
+	alerts := []Alert{testAlert("fp1", "firing")}
+	errs := make([]error, 2)
+	var wg sync.WaitGroup
+	wg.Go(func() { errs[0] = h.processAlerts(context.Background(), alerts, "alertmanager", "", 1) })
+	<-started
+	turns := h.order.reserve(alerts, "", 1)
+	wg.Go(func() { errs[1] = h.processInOrder(context.Background(), alerts, turns, "alertmanager", "", 1) })
+	close(unblock)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Fatalf("pipeline ran %d times, want 1", calls)
+	}
+	for i, err := range errs {
+		if err == nil {
+			t.Errorf("webhook %d got no error, want the shared one", i)
+		}
+	}
+}
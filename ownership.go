@@ -0,0 +1,99 @@
+package alertiris
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// OwnershipConfig routes alerts by the team owning them, as named by an
+// annotation such as "owner" or "team" in the alerting rule.
+type OwnershipConfig struct {
+	// Annotations are tried in order, then labels of the same names. Values
+	// that are not a configured team fall through to the next one and
+	// finally to Default.
+	Annotations []string              `koanf:"annotations"`
+	Default     string                `koanf:"default"`
+	Teams       map[string]TeamConfig `koanf:"teams"`
+}
+
+// TeamConfig is what an owning team changes about its alerts. Route names a
+// routes entry used instead of the matching one.
+type TeamConfig struct {
+	CustomerID int      `koanf:"customer_id"`
+	Tags       []string `koanf:"tags"`
+	OwnerID    int      `koanf:"owner_id"`
+	Notifiers  []string `koanf:"notifiers"`
+	Route      string   `koanf:"route"`
+}
+
+func validateOwnership(cfg OwnershipConfig, routes []*Route, notifier *Notifier) error {
+	if cfg.Default != "" {
+		if _, ok := cfg.Teams[cfg.Default]; !ok {
+			return fmt.Errorf("default team %q is not configured", cfg.Default)
+		}
+	}
+	for name, t := range cfg.Teams {
+		if t.Route != "" && findRoute(routes, t.Route) == nil {
+			return fmt.Errorf("team %q: unknown route %q", name, t.Route)
+		}
+		for _, n := range t.Notifiers {
+			if !notifier.has(n) {
+				return fmt.Errorf("team %q: unknown notifier %q", name, n)
+			}
+		}
+	}
+	return nil
+}
+
+func findRoute(routes []*Route, name string) *Route {
+	for _, r := range routes {
+		if r.Name == name {
+			return r
+		}
+	}
+	return nil
+}
+
+// owningTeam returns the name of the team owning an alert, or "".
+func (c OwnershipConfig) owningTeam(alert Alert) string {
+	if len(c.Teams) == 0 {
+		return ""
+	}
+	for _, src := range []map[string]string{alert.Annotations, alert.Labels} {
+		for _, name := range c.Annotations {
+			team := strings.ToLower(strings.TrimSpace(src[name]))
+			if team == "" {
+				continue
+			}
+			if _, ok := c.Teams[team]; ok {
+				return team
+			}
+			slog.Debug("unknown owning team", "fingerprint", alert.Fingerprint, "field", name, "team", team)
+		}
+	}
+	return c.Default
+}
+
+// notifyTeam sends a notification for a new IRIS alert to the notifiers of
+// its owning team.
+func (h *Handler) notifyTeam(alertID string, sa *SinkAlert) {
+	team, ok := h.config.Ownership.Teams[sa.Team]
+	if !ok || len(team.Notifiers) == 0 {
+		return
+	}
+	severity := sa.Alert.Labels["severity"]
+	if severity == "" {
+		severity = strconv.Itoa(sa.SeverityID)
+	}
+	h.notifier.NotifyChannels(team.Notifiers, Notification{
+		Event:       "created",
+		Title:       sa.Title,
+		Severity:    severity,
+		Fingerprint: sa.Fingerprint,
+		CustomerID:  sa.CustomerID,
+		AlertID:     alertID,
+		Link:        h.notifier.AlertLink(alertID, sa.CustomerID),
+	})
+}
@@ -0,0 +1,83 @@
+package alertiris
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// Webhook payload versions the bridge understands. Alertmanager bumps its
+// version on incompatible changes; Grafana sends the same format as
+// version 1.
+const (
+	alertmanagerPayloadVersion = "4"
+	grafanaPayloadVersion      = "1"
+)
+
+func invalidPayloads(reason string) *metrics.Counter {
+	return metrics.GetOrCreateCounter(`alertiris_invalid_payloads_total{reason="` + reason + `"}`)
+}
+
+// PayloadError is an Alertmanager payload rejected as a whole. Reason is
+// "decode", "version" or "structure".
+type PayloadError struct {
+	Reason string
+	Err    error
+}
+
+func (e *PayloadError) Error() string { return e.Err.Error() }
+
+func (e *PayloadError) Unwrap() error { return e.Err }
+
+// readPayload decodes and validates an Alertmanager style payload of the
+// given version, answering invalid ones with a 400.
+func readPayload(w http.ResponseWriter, r *http.Request, version string) (AlertmanagerPayload, bool) {
+	var payload AlertmanagerPayload
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		err = &PayloadError{"decode", fmt.Errorf("decode payload: %w", err)}
+	} else {
+		err = validatePayload(payload, version)
+	}
+	if err != nil {
+		var perr *PayloadError
+		errors.As(err, &perr)
+		invalidPayloads(perr.Reason).Inc()
+		slog.Error("invalid payload", "source", r.PathValue("source"), "reason", perr.Reason, "error", err, "error_category", countError(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return payload, false
+	}
+	return payload, true
+}
+
+// validatePayload checks the version and the fields the bridge relies on,
+// so a malformed payload is rejected before any of its alerts is processed.
+// A missing version is accepted for senders imitating Alertmanager.
+func validatePayload(p AlertmanagerPayload, version string) error {
+	if p.Version != "" && p.Version != version {
+		return &PayloadError{"version", fmt.Errorf("unsupported payload version %q, expected %q", p.Version, version)}
+	}
+	if len(p.Alerts) == 0 {
+		return &PayloadError{"structure", errors.New("payload has no alerts")}
+	}
+	var errs []error
+	for i, a := range p.Alerts {
+		if a.Status != "firing" && a.Status != "resolved" {
+			errs = append(errs, fmt.Errorf("alert %d: status must be firing or resolved, got %q", i, a.Status))
+		}
+		if a.Fingerprint == "" {
+			errs = append(errs, fmt.Errorf("alert %d: missing fingerprint", i))
+		}
+		if len(a.Labels) == 0 {
+			errs = append(errs, fmt.Errorf("alert %d: missing labels", i))
+		}
+	}
+	if len(errs) > 0 {
+		return &PayloadError{"structure", errors.Join(errs...)}
+	}
+	return nil
+}
@@ -0,0 +1,338 @@
+package alertiris
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var maintenanceSuppressed = metrics.NewCounter(`alertiris_maintenance_suppressed_total`)
+
+// defaultPipeline lists every stage. Authentication and payload parsing
+// happen before the pipeline, in the source handlers, and enrichment when
+// deliverToSink creates an IRIS alert, so they are not stages and cannot
+// be reordered.
+var defaultPipeline = []string{"kubernetes", "route", "redact", "wasm", "transform", "dedup", "sink"}
+
+// Event is a single alert travelling through the pipeline together with
+// the state the stages attach to it.
+type Event struct {
+	Alert      Alert
+	Source     string
+	Group      string
+	CustomerID int
+	ReceivedAt time.Time
+
+	// RequestID is the ID of the webhook request the alert came in with, or
+	// of its processing when there was none, for tracing it in the logs.
+	RequestID string
+
+	// Force bypasses the occurrence threshold, maintenance mode and
+	// maintenance windows, for operator initiated syncs.
+	Force bool
+
+	// Route is the first routing rule matching the alert, if any, and Sinks
+	// the sinks the alert is delivered to.
+	Route *Route
+	Sinks []string
+
+	// Tags are added to the tags of the sink alert, e.g. those of the URL
+	// token the alert came in through.
+	Tags []string
+
+	// Team is the team owning the alert, if ownership routing is
+	// configured.
+	Team string
+
+	// TimeRule is the first time rule matching the alert when it was
+	// routed. It may have replaced Route and adjusts the severity.
+	TimeRule *TimeRule
+
+	// SinkIDs holds the existing alert IDs per sink once looked up by the
+	// dedup stage. nil means the lookup has not happened yet.
+	SinkIDs map[string]string
+}
+
+type Next func(ctx context.Context, ev *Event) error
+
+type StageFunc func(ctx context.Context, ev *Event, next Next) error
+
+type stage struct {
+	name string
+	run  StageFunc
+
+	processed *metrics.Counter
+	stopped   *metrics.Counter
+	errors    *metrics.Counter
+	duration  *metrics.Histogram
+}
+
+type Pipeline struct {
+	stages []*stage
+}
+
+func (h *Handler) stageFuncs() map[string]StageFunc {
+	return map[string]StageFunc{
+		"kubernetes": h.kubernetesStage,
+		"route":      h.routeStage,
+		"redact":     h.redactStage,
+		"wasm":       h.wasmStage,
+		"transform":  h.transformStage,
+		"dedup":      h.dedupStage,
+		"sink":       h.sinkStage,
+	}
+}
+
+func (h *Handler) buildPipeline(names []string) (*Pipeline, error) {
+	if len(names) == 0 {
+		names = defaultPipeline
+	}
+	if names[len(names)-1] != "sink" {
+		return nil, fmt.Errorf(`the last stage must be "sink"`)
+	}
+
+	funcs := h.stageFuncs()
+	p := &Pipeline{}
+	for i, name := range names {
+		fn, ok := funcs[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown stage %q", name)
+		}
+		if slices.Contains(names[:i], name) {
+			return nil, fmt.Errorf("stage %q listed twice", name)
+		}
+		p.stages = append(p.stages, &stage{
+			name:      name,
+			run:       fn,
+			processed: metrics.GetOrCreateCounter(fmt.Sprintf(`alertiris_stage_processed_total{stage=%q}`, name)),
+			stopped:   metrics.GetOrCreateCounter(fmt.Sprintf(`alertiris_stage_stopped_total{stage=%q}`, name)),
+			errors:    metrics.GetOrCreateCounter(fmt.Sprintf(`alertiris_stage_errors_total{stage=%q}`, name)),
+			duration:  metrics.GetOrCreateHistogram(fmt.Sprintf(`alertiris_stage_duration_seconds{stage=%q}`, name)),
+		})
+	}
+	return p, nil
+}
+
+func (p *Pipeline) Run(ctx context.Context, ev *Event) error {
+	return p.next(0)(ctx, ev)
+}
+
+func (p *Pipeline) next(i int) Next {
+	if i >= len(p.stages) {
+		return func(context.Context, *Event) error { return nil }
+	}
+	s := p.stages[i]
+	return func(ctx context.Context, ev *Event) error {
+		var (
+			called bool
+			inNext time.Duration
+		)
+		start := time.Now()
+		err := s.run(ctx, ev, func(ctx context.Context, ev *Event) error {
+			called = true
+			t := time.Now()
+			err := p.next(i+1)(ctx, ev)
+			inNext += time.Since(t)
+			return err
+		})
+
+		// Only the stage's own time is recorded, not that of later stages.
+		s.duration.Update((time.Since(start) - inNext).Seconds())
+		s.processed.Inc()
+		if !called {
+			if err != nil {
+				s.errors.Inc()
+			} else {
+				s.stopped.Inc()
+			}
+		}
+		return err
+	}
+}
+
+func (h *Handler) routeStage(ctx context.Context, ev *Event, next Next) error {
+	if id, ok := h.settings().GroupCustomerMap[ev.Group]; ok && ev.Group != "" {
+		ev.CustomerID = id
+	} else if id, ok := matchCustomerRule(h.customerRules, ev.Alert.Labels); ok {
+		ev.CustomerID = id
+	} else if ev.Group != "" {
+		slog.Warn("unknown group, using default customer", "group", ev.Group, "request_id", ev.RequestID)
+	}
+
+	ev.Route = matchRoute(h.routes, ev.Alert.Labels)
+	ev.Team = h.config.Ownership.owningTeam(ev.Alert)
+	team := h.config.Ownership.Teams[ev.Team]
+	if team.Route != "" {
+		ev.Route = findRoute(h.routes, team.Route)
+	}
+	ev.TimeRule = matchTimeRule(h.timeRules, ev.Alert.Labels, time.Now())
+	if ev.TimeRule != nil {
+		slog.Debug("matched time rule", "rule", ev.TimeRule.Name, "fingerprint", ev.Alert.Fingerprint, "request_id", ev.RequestID)
+		if ev.TimeRule.route != nil {
+			ev.Route = ev.TimeRule.route
+		}
+	}
+	if ev.Route != nil {
+		if ev.Route.CustomerID > 0 {
+			ev.CustomerID = ev.Route.CustomerID
+		}
+		ev.Sinks = ev.Route.Sinks
+		slog.Debug("matched route", "route", ev.Route.Name, "fingerprint", ev.Alert.Fingerprint, "request_id", ev.RequestID)
+	}
+	if ev.Team != "" {
+		if team.CustomerID > 0 {
+			ev.CustomerID = team.CustomerID
+		}
+		slog.Debug("routed to owning team", "team", ev.Team, "fingerprint", ev.Alert.Fingerprint, "request_id", ev.RequestID)
+	}
+	if !h.checkSeverity(ev) {
+		return nil
+	}
+	return next(ctx, ev)
+}
+
+func (h *Handler) redactStage(ctx context.Context, ev *Event, next Next) error {
+	ev.Alert = h.redactor.Apply(ev.Alert)
+	return next(ctx, ev)
+}
+
+func (h *Handler) wasmStage(ctx context.Context, ev *Event, next Next) error {
+	alert, err := h.wasm.Apply(ev.Alert)
+	if err != nil {
+		return categorize(ErrorRouting, fmt.Errorf("wasm transform: %w", err))
+	}
+	ev.Alert = alert
+	return next(ctx, ev)
+}
+
+func (h *Handler) transformStage(ctx context.Context, ev *Event, next Next) error {
+	alert, err := h.transformer.DeriveLabels(ev.Alert)
+	if err != nil {
+		return categorize(ErrorRouting, fmt.Errorf("derive labels: %w", err))
+	}
+	ev.Alert = alert
+
+	drop, err := h.transformer.Drop(ev.Alert)
+	if err != nil {
+		return categorize(ErrorRouting, fmt.Errorf("evaluate drop expression: %w", err))
+	}
+	if drop && ev.Alert.Status == "firing" {
+		slog.Info("alert dropped by transform", "fingerprint", ev.Alert.Fingerprint, "request_id", ev.RequestID)
+		h.recordHistory(HistoryEvent{Fingerprint: ev.Alert.Fingerprint, Event: "dropped", CustomerID: ev.CustomerID, Detail: "drop expression"})
+		return nil
+	}
+	rule, err := h.settings().dropRule(ev.Alert)
+	if err != nil {
+		return categorize(ErrorRouting, fmt.Errorf("evaluate drop rules: %w", err))
+	}
+	if rule != "" && ev.Alert.Status == "firing" {
+		slog.Info("alert dropped by drop rule", "fingerprint", ev.Alert.Fingerprint, "request_id", ev.RequestID, "rule", rule)
+		h.recordHistory(HistoryEvent{Fingerprint: ev.Alert.Fingerprint, Event: "dropped", CustomerID: ev.CustomerID, Detail: "drop rule " + rule})
+		return nil
+	}
+	return next(ctx, ev)
+}
+
+func (h *Handler) dedupStage(ctx context.Context, ev *Event, next Next) error {
+	fp := ev.Alert.Fingerprint
+	ids, err := h.sinkIDs(fp, ev.CustomerID)
+	if err != nil {
+		return categorize(ErrorStore, fmt.Errorf("db lookup: %w", err))
+	}
+	ev.SinkIDs = ids
+
+	if len(ids) > 0 {
+		return next(ctx, ev)
+	}
+
+	switch ev.Alert.Status {
+	case "firing":
+		count, reached, err := h.recordOccurrence(fp, ev.CustomerID)
+		if err != nil {
+			return categorize(ErrorStore, fmt.Errorf("record occurrence: %w", err))
+		}
+		if !reached && !ev.Force {
+			slog.Info("occurrence threshold not reached, skipping", "fingerprint", fp, "request_id", ev.RequestID, "count", count, "threshold", h.config.OccurrenceThreshold)
+			h.recordHistory(HistoryEvent{Fingerprint: fp, Event: "suppressed", CustomerID: ev.CustomerID, Detail: fmt.Sprintf("occurrence %d of %d", count, h.config.OccurrenceThreshold)})
+			return nil
+		}
+	case "resolved":
+		if err := h.clearOccurrences(fp, ev.CustomerID); err != nil {
+			return categorize(ErrorStore, fmt.Errorf("clear occurrences: %w", err))
+		}
+	}
+	return next(ctx, ev)
+}
+
+func (h *Handler) sinkStage(ctx context.Context, ev *Event, next Next) error {
+	fp := ev.Alert.Fingerprint
+	if ev.SinkIDs == nil {
+		ids, err := h.sinkIDs(fp, ev.CustomerID)
+		if err != nil {
+			return categorize(ErrorStore, fmt.Errorf("db lookup: %w", err))
+		}
+		ev.SinkIDs = ids
+	}
+
+	base := h.sinkAlert(ev.Alert, ev.CustomerID)
+	base.Origin, base.ReceivedAt, base.RequestID = ev.Source, ev.ReceivedAt, ev.RequestID
+	base.Tags = h.config.Tags.prefix(ev.Source, base.Tags)
+	if ev.Route != nil {
+		base.Route = ev.Route.Name
+		base.EscalationPolicy = ev.Route.EscalationPolicy
+		base.ResolvedAction = ev.Route.ResolvedAction
+		base.ResolutionStatusID = ev.Route.ResolutionStatusID
+	}
+	if team, ok := h.config.Ownership.Teams[ev.Team]; ok {
+		base.Team = ev.Team
+		base.OwnerID = team.OwnerID
+		base.Tags = append(base.Tags, team.Tags...)
+	}
+	base.Tags = append(base.Tags, ev.Tags...)
+	if ev.TimeRule != nil {
+		base.SeverityID = ev.TimeRule.AdjustSeverity(base.SeverityID)
+	}
+	switch ev.Alert.Status {
+	case "firing":
+		if len(ev.SinkIDs) == 0 && h.maintenance.Load() && !ev.Force {
+			slog.Info("maintenance mode enabled, not creating alert", "fingerprint", fp, "request_id", ev.RequestID)
+			h.recordHistory(HistoryEvent{Fingerprint: fp, Event: "suppressed", CustomerID: ev.CustomerID, Detail: "maintenance mode"})
+			maintenanceSuppressed.Inc()
+			return nil
+		}
+		if w := activeWindow(h.windows, ev.Alert.Labels, time.Now()); w != nil && !ev.Force {
+			if w.Action == "tag" {
+				base.Tags = append(base.Tags, w.Tag)
+			} else if len(ev.SinkIDs) == 0 {
+				slog.Info("maintenance window open, not creating alert", "window", w.Name, "fingerprint", fp, "request_id", ev.RequestID)
+				h.recordHistory(HistoryEvent{Fingerprint: fp, Event: "suppressed", CustomerID: ev.CustomerID, Detail: "maintenance window " + w.Name})
+				maintenanceSuppressed.Inc()
+				return nil
+			}
+		}
+		base.Tags = h.config.Tags.finish(base.Tags)
+		sinks := ev.Sinks
+		if len(sinks) == 0 {
+			sinks = h.config.Sinks
+		}
+		if err := h.deliverAlert(ctx, ev.SinkIDs, sinks, base); err != nil {
+			return err
+		}
+	case "resolved":
+		if err := h.resolveAlert(ctx, ev.SinkIDs, base); err != nil {
+			return err
+		}
+		if len(ev.SinkIDs) == 0 {
+			slog.Warn("resolved alert not found in db, skipping", "fingerprint", fp, "request_id", ev.RequestID)
+			return nil
+		}
+	default:
+		slog.Warn("unknown alert status", "status", ev.Alert.Status, "fingerprint", fp, "request_id", ev.RequestID)
+		return nil
+	}
+	return next(ctx, ev)
+}
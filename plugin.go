@@ -0,0 +1,493 @@
+package alertiris
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os/exec"
+	"sort"
+	"sync"
+	"time"
+)
+
+type PluginConfig struct {
+	Name       string         `koanf:"name"`
+	Command    string         `koanf:"command"`
+	Args       []string       `koanf:"args"`
+	URL        string         `koanf:"url"`
+	CustomerID int            `koanf:"customer_id"`
+	Timeout    time.Duration  `koanf:"timeout"`
+	Config     map[string]any `koanf:"config"`
+
+	// Schema is a JSON Schema file requests must match before they are
+	// handed to the plugin; others are answered with a 422 and, with
+	// RejectsRetention set, kept for that long.
+	Schema           string        `koanf:"schema"`
+	RejectsRetention time.Duration `koanf:"rejects_retention"`
+}
+
+// pluginMessage is exchanged with plugins as newline-delimited JSON over
+// stdio, or as the request/response body of an HTTP sidecar.
+type pluginMessage struct {
+	Type    string              `json:"type"`
+	ID      uint64              `json:"id,omitempty"`
+	Config  map[string]any      `json:"config,omitempty"`
+	Method  string              `json:"method,omitempty"`
+	Path    string              `json:"path,omitempty"`
+	Query   string              `json:"query,omitempty"`
+	Headers map[string][]string `json:"headers,omitempty"`
+	Body    []byte              `json:"body,omitempty"`
+	Alerts  []Alert             `json:"alerts,omitempty"`
+	Error   string              `json:"error,omitempty"`
+}
+
+type plugin interface {
+	Convert(ctx context.Context, req pluginMessage) ([]Alert, error)
+}
+
+type PluginManager struct {
+	handler *Handler
+	configs map[string]PluginConfig
+	plugins map[string]plugin
+	schemas map[string]*jsonSchema
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func NewPluginManager(configs []PluginConfig, handler *Handler) (*PluginManager, error) {
+	m := &PluginManager{
+		handler: handler,
+		configs: make(map[string]PluginConfig),
+		plugins: make(map[string]plugin),
+		schemas: make(map[string]*jsonSchema),
+	}
+	for _, cfg := range configs {
+		if cfg.Name == "" {
+			return nil, errors.New("plugin name is required")
+		}
+		if _, ok := m.plugins[cfg.Name]; ok {
+			return nil, fmt.Errorf("duplicate plugin %q", cfg.Name)
+		}
+		if cfg.Timeout <= 0 {
+			cfg.Timeout = 30 * time.Second
+		}
+
+		switch {
+		case cfg.Command != "" && cfg.URL != "":
+			return nil, fmt.Errorf("plugin %q: command and url are mutually exclusive", cfg.Name)
+		case cfg.Command != "":
+			m.plugins[cfg.Name] = &execPlugin{
+				cfg:      cfg,
+				pending:  make(map[uint64]chan pluginMessage),
+				onAlerts: func(alerts []Alert) { m.process(context.Background(), cfg, alerts, "") },
+			}
+		case cfg.URL != "":
+			m.plugins[cfg.Name] = &httpPlugin{cfg: cfg, client: &http.Client{Timeout: cfg.Timeout}}
+		default:
+			return nil, fmt.Errorf("plugin %q: one of command or url is required", cfg.Name)
+		}
+		if cfg.Schema != "" {
+			schema, err := loadJSONSchema(cfg.Schema)
+			if err != nil {
+				return nil, fmt.Errorf("plugin %q: schema: %w", cfg.Name, err)
+			}
+			m.schemas[cfg.Name] = schema
+		}
+		m.configs[cfg.Name] = cfg
+	}
+	return m, nil
+}
+
+func (m *PluginManager) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	for _, p := range m.plugins {
+		if p, ok := p.(*execPlugin); ok {
+			m.wg.Add(1)
+			go func() {
+				defer m.wg.Done()
+				p.run(ctx)
+			}()
+		}
+	}
+}
+
+func (m *PluginManager) Stop() {
+	if m.cancel == nil {
+		return
+	}
+	m.cancel()
+	m.wg.Wait()
+}
+
+// Register serves every plugin under its name.
+func (m *PluginManager) Register(sources *SourceRegistry) error {
+	for name := range m.plugins {
+		if err := sources.Register(name, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *PluginManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.PathValue("source")
+	p, ok := m.plugins[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	cfg := m.configs[name]
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		errorsTotal(ErrorPayload).Inc()
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if schema, ok := m.schemas[name]; ok && !m.checkSchema(w, r, cfg, schema, body) {
+		return
+	}
+
+	alerts, err := p.Convert(r.Context(), pluginMessage{
+		Type:    "request",
+		Config:  cfg.Config,
+		Method:  r.Method,
+		Path:    r.URL.Path,
+		Query:   r.URL.RawQuery,
+		Headers: r.Header,
+		Body:    body,
+	})
+	if err != nil {
+		errorsTotal(ErrorPayload).Inc()
+		slog.Error("plugin failed to convert payload", "plugin", name, "error", err, "error_category", ErrorPayload)
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+		return
+	}
+
+	customerID := m.prepare(cfg, alerts)
+	m.handler.accept(w, r, alerts, cfg.Name, r.URL.Query().Get("group"), customerID)
+}
+
+// checkSchema validates body against the plugin's schema, answering a
+// mismatch with a 422 listing the violations.
+func (m *PluginManager) checkSchema(w http.ResponseWriter, r *http.Request, cfg PluginConfig, schema *jsonSchema, body []byte) bool {
+	var errs []string
+	var payload any
+	if err := json.Unmarshal(body, &payload); err != nil {
+		errs = append(errs, "invalid JSON: "+err.Error())
+	} else {
+		schema.validate(payload, "", &errs)
+	}
+	if len(errs) == 0 {
+		return true
+	}
+
+	schemaRejected(cfg.Name).Inc()
+	errorsTotal(ErrorPayload).Inc()
+	slog.Warn("payload does not match the schema", "plugin", cfg.Name, "errors", len(errs), "first_error", errs[0], "error_category", ErrorPayload)
+	if cfg.RejectsRetention > 0 {
+		headers := r.Header.Clone()
+		headers.Del("Authorization")
+		headers.Del("Cookie")
+		reject := RejectedPayload{
+			Recording: Recording{Time: time.Now(), Method: r.Method, Path: r.URL.Path, Query: r.URL.RawQuery, Headers: headers, Body: body},
+			Source:    cfg.Name,
+			Errors:    errs,
+		}
+		if info := requestInfoFrom(r.Context()); info != nil {
+			reject.RequestID = info.id
+		}
+		if err := storeReject(m.handler.db, reject, cfg.RejectsRetention); err != nil {
+			slog.Error("failed to store rejected payload", "plugin", cfg.Name, "error", err)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(map[string]any{"error": "payload does not match the schema", "details": errs})
+	return false
+}
+
+func (m *PluginManager) process(ctx context.Context, cfg PluginConfig, alerts []Alert, group string) {
+	m.handler.processAlerts(ctx, alerts, cfg.Name, group, m.prepare(cfg, alerts))
+}
+
+// prepare fills in the status and fingerprint of alerts that lack them and
+// returns the customer they start with.
+func (m *PluginManager) prepare(cfg PluginConfig, alerts []Alert) int {
+	customerID := cfg.CustomerID
+	if customerID == 0 {
+		customerID = m.handler.config.CustomerID
+	}
+	for i := range alerts {
+		if alerts[i].Status == "" {
+			alerts[i].Status = "firing"
+		}
+		if alerts[i].Fingerprint == "" {
+			alerts[i].Fingerprint = labelsFingerprint(alerts[i].Labels)
+		}
+	}
+	slog.Debug("processing plugin alerts", "plugin", cfg.Name, "count", len(alerts))
+	return customerID
+}
+
+type httpPlugin struct {
+	cfg    PluginConfig
+	client *http.Client
+}
+
+func (p *httpPlugin) Convert(ctx context.Context, req pluginMessage) ([]Alert, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshal plugin request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("call plugin: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("plugin returned %d: %s", resp.StatusCode, string(msg))
+	}
+
+	var out pluginMessage
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode plugin response: %w", err)
+	}
+	if out.Error != "" {
+		return nil, errors.New(out.Error)
+	}
+	return out.Alerts, nil
+}
+
+type execPlugin struct {
+	cfg      PluginConfig
+	onAlerts func([]Alert)
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	stdin   io.WriteCloser
+	pending map[uint64]chan pluginMessage
+	nextID  uint64
+}
+
+func (p *execPlugin) run(ctx context.Context) {
+	backoff := time.Second
+	for {
+		started := time.Now()
+		err := p.runOnce(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Error("plugin exited, restarting", "plugin", p.cfg.Name, "error", err, "backoff", backoff)
+
+		if time.Since(started) > time.Minute {
+			backoff = time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, time.Minute)
+	}
+}
+
+func (p *execPlugin) runOnce(ctx context.Context) error {
+	cmd := exec.Command(p.cfg.Command, p.cfg.Args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start plugin: %w", err)
+	}
+	slog.Info("started plugin", "plugin", p.cfg.Name, "pid", cmd.Process.Pid)
+
+	p.mu.Lock()
+	p.stdin = stdin
+	p.mu.Unlock()
+
+	if err := p.send(pluginMessage{Type: "init", Config: p.cfg.Config}); err != nil {
+		slog.Error("failed to initialize plugin", "plugin", p.cfg.Name, "error", err)
+	}
+
+	stderrDone := make(chan struct{})
+	go func() {
+		defer close(stderrDone)
+		sc := bufio.NewScanner(stderr)
+		for sc.Scan() {
+			slog.Info("plugin log", "plugin", p.cfg.Name, "line", sc.Text())
+		}
+	}()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			stdin.Close()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				cmd.Process.Kill()
+			}
+		case <-done:
+		}
+	}()
+
+	sc := bufio.NewScanner(stdout)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		var msg pluginMessage
+		if err := json.Unmarshal(sc.Bytes(), &msg); err != nil {
+			slog.Warn("invalid message from plugin", "plugin", p.cfg.Name, "error", err)
+			continue
+		}
+		p.dispatch(msg)
+	}
+	readErr := sc.Err()
+	<-stderrDone
+
+	p.mu.Lock()
+	p.stdin = nil
+	for id, ch := range p.pending {
+		ch <- pluginMessage{Type: "response", ID: id, Error: "plugin exited"}
+		delete(p.pending, id)
+	}
+	p.mu.Unlock()
+
+	if err := cmd.Wait(); err != nil {
+		return err
+	}
+	return readErr
+}
+
+func (p *execPlugin) dispatch(msg pluginMessage) {
+	switch msg.Type {
+	case "response":
+		p.mu.Lock()
+		ch, ok := p.pending[msg.ID]
+		delete(p.pending, msg.ID)
+		p.mu.Unlock()
+		if ok {
+			ch <- msg
+		}
+	case "alerts":
+		go p.onAlerts(msg.Alerts)
+	default:
+		slog.Warn("unknown message type from plugin", "plugin", p.cfg.Name, "type", msg.Type)
+	}
+}
+
+func (p *execPlugin) send(msg pluginMessage) error {
+	line, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	p.mu.Lock()
+	stdin := p.stdin
+	p.mu.Unlock()
+	if stdin == nil {
+		return errors.New("plugin is not running")
+	}
+
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	_, err = stdin.Write(line)
+	return err
+}
+
+func (p *execPlugin) Convert(ctx context.Context, req pluginMessage) ([]Alert, error) {
+	ch := make(chan pluginMessage, 1)
+
+	p.mu.Lock()
+	p.nextID++
+	req.ID = p.nextID
+	p.pending[req.ID] = ch
+	p.mu.Unlock()
+
+	if err := p.send(req); err != nil {
+		p.mu.Lock()
+		delete(p.pending, req.ID)
+		p.mu.Unlock()
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.Timeout)
+	defer cancel()
+
+	select {
+	case resp := <-ch:
+		if resp.Error != "" {
+			return nil, errors.New(resp.Error)
+		}
+		return resp.Alerts, nil
+	case <-ctx.Done():
+		p.mu.Lock()
+		delete(p.pending, req.ID)
+		p.mu.Unlock()
+		return nil, fmt.Errorf("waiting for plugin: %w", ctx.Err())
+	}
+}
+
+// labelsFingerprint hashes a label set the same way Alertmanager does so
+// plugin alerts without a fingerprint still deduplicate across deliveries.
+func labelsFingerprint(labels map[string]string) string {
+	const (
+		offset64  = 14695981039346656037
+		prime64   = 1099511628211
+		separator = 255
+	)
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sum uint64 = offset64
+	add := func(s string) {
+		for i := 0; i < len(s); i++ {
+			sum ^= uint64(s[i])
+			sum *= prime64
+		}
+		sum ^= separator
+		sum *= prime64
+	}
+	for _, name := range names {
+		add(name)
+		add(labels[name])
+	}
+	return fmt.Sprintf("%016x", sum)
+}
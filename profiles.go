@@ -0,0 +1,171 @@
+package alertiris
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// ProfilingConfig captures a CPU and heap profile into Dir when the average
+// delivery latency stays above Latency, or the processing queue holds at
+// least QueueDepth alerts, for For. Captures are at least MinInterval
+// apart, so a long incident does not fill the disk.
+type ProfilingConfig struct {
+	Dir         string        `koanf:"dir"`
+	Latency     time.Duration `koanf:"latency"`
+	QueueDepth  int           `koanf:"queue_depth"`
+	For         time.Duration `koanf:"for"`
+	CPUDuration time.Duration `koanf:"cpu_duration"`
+	MinInterval time.Duration `koanf:"min_interval"`
+}
+
+// profileCheckInterval is how often the thresholds are checked. The
+// latency compared is the average over the last interval.
+const profileCheckInterval = 10 * time.Second
+
+var profilesCaptured = metrics.NewCounter(`alertiris_profiles_captured_total`)
+
+func validateProfiling(cfg ProfilingConfig) error {
+	switch {
+	case cfg.Latency <= 0 && cfg.QueueDepth <= 0:
+		return fmt.Errorf("latency or queue_depth is required")
+	case cfg.For < profileCheckInterval:
+		return fmt.Errorf("for must be at least %s", profileCheckInterval)
+	case cfg.CPUDuration < time.Second:
+		return fmt.Errorf("cpu_duration must be at least 1s")
+	case cfg.MinInterval < cfg.CPUDuration:
+		return fmt.Errorf("min_interval must be at least cpu_duration")
+	}
+	return os.MkdirAll(cfg.Dir, 0o755)
+}
+
+type profiler struct {
+	cfg     ProfilingConfig
+	handler *Handler
+
+	// latencySum and latencyCount add up delivery latencies, in
+	// nanoseconds, since the last check.
+	latencySum   atomic.Int64
+	latencyCount atomic.Int64
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newProfiler(cfg ProfilingConfig, h *Handler) (*profiler, error) {
+	if err := validateProfiling(cfg); err != nil {
+		return nil, err
+	}
+	return &profiler{cfg: cfg, handler: h}, nil
+}
+
+// observe records the delivery latency of an alert. It is safe on a nil
+// profiler.
+func (p *profiler) observe(d time.Duration) {
+	if p == nil {
+		return
+	}
+	p.latencySum.Add(int64(d))
+	p.latencyCount.Add(1)
+}
+
+func (p *profiler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	p.wg.Go(func() {
+		ticker := time.NewTicker(profileCheckInterval)
+		defer ticker.Stop()
+		var highSince, lastCapture time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			now := time.Now()
+			reason := p.check()
+			if reason == "" {
+				highSince = time.Time{}
+				continue
+			}
+			if highSince.IsZero() {
+				highSince = now
+			}
+			if now.Sub(highSince) < p.cfg.For || (!lastCapture.IsZero() && now.Sub(lastCapture) < p.cfg.MinInterval) {
+				continue
+			}
+			lastCapture = now
+			highSince = time.Time{}
+			slog.Warn("sustained high load, capturing profiles", "reason", reason, "for", p.cfg.For, "dir", p.cfg.Dir)
+			if err := p.capture(ctx, now); err != nil {
+				slog.Error("failed to capture profiles", "error", err)
+			}
+		}
+	})
+}
+
+func (p *profiler) Close() {
+	if p.cancel != nil {
+		p.cancel()
+		p.wg.Wait()
+	}
+}
+
+// check returns why the load is over a threshold, or "" if it is not.
+func (p *profiler) check() string {
+	sum, count := p.latencySum.Swap(0), p.latencyCount.Swap(0)
+	if p.cfg.Latency > 0 && count > 0 {
+		if avg := time.Duration(sum / count); avg > p.cfg.Latency {
+			return fmt.Sprintf("average delivery latency %s", avg.Round(time.Millisecond))
+		}
+	}
+	if p.cfg.QueueDepth > 0 {
+		if depth := p.handler.queueDepth(); depth >= p.cfg.QueueDepth {
+			return fmt.Sprintf("%d alerts queued", depth)
+		}
+	}
+	return ""
+}
+
+// capture writes alertiris-<time>-cpu.pprof, profiling for CPUDuration, and
+// alertiris-<time>-heap.pprof into Dir.
+func (p *profiler) capture(ctx context.Context, now time.Time) error {
+	base := filepath.Join(p.cfg.Dir, "alertiris-"+now.UTC().Format("20060102T150405Z"))
+
+	cpu, err := os.Create(base + "-cpu.pprof")
+	if err != nil {
+		return err
+	}
+	defer cpu.Close()
+	if err := pprof.StartCPUProfile(cpu); err != nil {
+		os.Remove(cpu.Name())
+		return fmt.Errorf("cpu profile: %w", err)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(p.cfg.CPUDuration):
+	}
+	pprof.StopCPUProfile()
+
+	heap, err := os.Create(base + "-heap.pprof")
+	if err != nil {
+		return err
+	}
+	defer heap.Close()
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(heap); err != nil {
+		return fmt.Errorf("heap profile: %w", err)
+	}
+	profilesCaptured.Inc()
+	slog.Info("captured profiles", "cpu", cpu.Name(), "heap", heap.Name())
+	return nil
+}
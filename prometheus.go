@@ -0,0 +1,216 @@
+package alertiris
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// PrometheusConfig is the Prometheus queried when an IRIS alert is created,
+// with the queries of the matched route or else Queries.
+type PrometheusConfig struct {
+	URL       string        `koanf:"url"`
+	Token     string        `koanf:"token"`
+	Timeout   time.Duration `koanf:"timeout"`
+	MaxSeries int           `koanf:"max_series"`
+	Queries   []QueryConfig `koanf:"queries"`
+}
+
+// QueryConfig is a PromQL query templated with the alert, e.g.
+// 'rate(http_requests_total{instance="{{ .Labels.instance }}"}[5m])'. Its
+// result goes to the "description" or the "source_content" of the alert.
+type QueryConfig struct {
+	Name   string `koanf:"name"`
+	Query  string `koanf:"query"`
+	Target string `koanf:"target"`
+}
+
+type alertQuery struct {
+	QueryConfig
+	tmpl *template.Template
+}
+
+// queryResult is a query result as added to the source content.
+type queryResult struct {
+	Name   string   `json:"name"`
+	Query  string   `json:"query"`
+	Result []string `json:"result,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+func newAlertQueries(cfgs []QueryConfig) ([]*alertQuery, error) {
+	var out []*alertQuery
+	for i, cfg := range cfgs {
+		if cfg.Name == "" {
+			cfg.Name = fmt.Sprintf("query-%d", i)
+		}
+		switch cfg.Target {
+		case "":
+			cfg.Target = "description"
+		case "description", "source_content":
+		default:
+			return nil, fmt.Errorf("query %q: target must be description or source_content, got %q", cfg.Name, cfg.Target)
+		}
+		tmpl, err := template.New(cfg.Name).Option("missingkey=zero").Parse(cfg.Query)
+		if err != nil {
+			return nil, fmt.Errorf("query %q: %w", cfg.Name, err)
+		}
+		out = append(out, &alertQuery{QueryConfig: cfg, tmpl: tmpl})
+	}
+	return out, nil
+}
+
+type prometheus struct {
+	cfg    PrometheusConfig
+	client *http.Client
+}
+
+func newPrometheus(cfg PrometheusConfig) *prometheus {
+	if cfg.URL == "" {
+		return nil
+	}
+	return &prometheus{cfg: cfg, client: &http.Client{Timeout: cfg.Timeout}}
+}
+
+// query runs an instant query and returns one line per series.
+func (p *prometheus) query(ctx context.Context, q string) ([]string, error) {
+	u := strings.TrimRight(p.cfg.URL, "/") + "/api/v1/query?" + url.Values{"query": {q}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	if p.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.cfg.Token)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+		Data   struct {
+			ResultType string          `json:"resultType"`
+			Result     json.RawMessage `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("prometheus returned %s: %s", resp.Status, body)
+	}
+	if result.Status != "success" {
+		return nil, fmt.Errorf("query failed: %s", result.Error)
+	}
+
+	switch result.Data.ResultType {
+	case "vector":
+		var series []struct {
+			Metric map[string]string `json:"metric"`
+			Value  [2]any            `json:"value"`
+		}
+		if err := json.Unmarshal(result.Data.Result, &series); err != nil {
+			return nil, fmt.Errorf("decode vector: %w", err)
+		}
+		var lines []string
+		for i, s := range series {
+			if p.cfg.MaxSeries > 0 && i >= p.cfg.MaxSeries {
+				lines = append(lines, fmt.Sprintf("... %d more series", len(series)-i))
+				break
+			}
+			lines = append(lines, fmt.Sprintf("%s %v", formatMetric(s.Metric), s.Value[1]))
+		}
+		return lines, nil
+	case "scalar", "string":
+		var v [2]any
+		if err := json.Unmarshal(result.Data.Result, &v); err != nil {
+			return nil, fmt.Errorf("decode %s: %w", result.Data.ResultType, err)
+		}
+		return []string{fmt.Sprint(v[1])}, nil
+	}
+	return nil, fmt.Errorf("unsupported result type %q", result.Data.ResultType)
+}
+
+func formatMetric(m map[string]string) string {
+	name := m["__name__"]
+	var pairs []string
+	for _, k := range slices.Sorted(maps.Keys(m)) {
+		if k != "__name__" {
+			pairs = append(pairs, fmt.Sprintf("%s=%q", k, m[k]))
+		}
+	}
+	return name + "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// runQueries runs the queries of an alert's route and adds their results
+// to the alert about to be created.
+func (h *Handler) runQueries(ctx context.Context, sa *SinkAlert) {
+	if h.prometheus == nil {
+		return
+	}
+	queries := h.queries
+	if r := findRoute(h.routes, sa.Route); r != nil && len(r.queries) > 0 {
+		queries = r.queries
+	}
+	if len(queries) == 0 {
+		return
+	}
+
+	var lines []string
+	var results []queryResult
+	for _, q := range queries {
+		var b strings.Builder
+		if err := q.tmpl.Execute(&b, sa.Alert); err != nil {
+			slog.Warn("failed to render query", "query", q.Name, "fingerprint", sa.Fingerprint, "error", err)
+			continue
+		}
+		res := queryResult{Name: q.Name, Query: b.String()}
+		series, err := h.prometheus.query(ctx, res.Query)
+		if err != nil {
+			errorsTotal(ErrorEnrichment).Inc()
+			slog.Warn("prometheus query failed", "query", q.Name, "fingerprint", sa.Fingerprint, "error", err, "error_category", ErrorEnrichment)
+			res.Error = err.Error()
+		}
+		res.Result = series
+		if q.Target == "source_content" {
+			results = append(results, res)
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("- %s: %s", res.Name, res.Query))
+		if res.Error != "" {
+			lines = append(lines, "  error: "+res.Error)
+		} else if len(series) == 0 {
+			lines = append(lines, "  no data")
+		}
+		for _, s := range series {
+			lines = append(lines, "  "+s)
+		}
+	}
+
+	if len(lines) > 0 {
+		sa.Description = strings.TrimRight(sa.Description, "\n") + "\n\nQueries at " + time.Now().In(h.location).Format(h.config.TimeFormat) + ":\n" + strings.Join(lines, "\n")
+	}
+	if len(results) > 0 {
+		var content map[string]any
+		if err := json.Unmarshal(sa.SourceContent, &content); err != nil {
+			slog.Warn("failed to add query results to source content", "fingerprint", sa.Fingerprint, "error", err)
+			return
+		}
+		content["alertiris_queries"] = results
+		if c, err := json.Marshal(content); err == nil {
+			sa.SourceContent = c
+		}
+	}
+}
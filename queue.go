@@ -0,0 +1,207 @@
+package alertiris
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// QueueConfig makes webhooks asynchronous. With Depth set, a webhook is
+// answered with a 202 once its alerts are queued and Workers process them
+// in the background. Once Depth alerts are waiting, further webhooks are
+// answered with a 429 and Retry-After so the sender retries later instead
+// of the bridge buffering without bound.
+type QueueConfig struct {
+	Depth      int           `koanf:"depth"`
+	Workers    int           `koanf:"workers"`
+	RetryAfter time.Duration `koanf:"retry_after"`
+
+	// Concurrency limits the webhooks of a source or URL token, by name,
+	// that are queued or being processed at once.
+	Concurrency map[string]int `koanf:"concurrency"`
+}
+
+var (
+	queueAlerts      = metrics.GetOrCreateGauge(`alertiris_queue_alerts`, nil)
+	queueCapacity    = metrics.GetOrCreateGauge(`alertiris_queue_capacity`, nil)
+	queueBusyWorkers = metrics.GetOrCreateGauge(`alertiris_queue_busy_workers`, nil)
+	queueWait        = metrics.GetOrCreateHistogram(`alertiris_queue_wait_seconds`)
+)
+
+func queueRejected(source string) *metrics.Counter {
+	return metrics.GetOrCreateCounter(`alertiris_queue_rejected_total{source="` + source + `"}`)
+}
+
+func validateQueue(cfg QueueConfig) error {
+	switch {
+	case cfg.Depth < 0:
+		return fmt.Errorf("depth must not be negative")
+	case cfg.Depth > 0 && cfg.Workers < 1:
+		return fmt.Errorf("workers must be at least 1")
+	case (cfg.Depth > 0 || len(cfg.Concurrency) > 0) && cfg.RetryAfter < time.Second:
+		return fmt.Errorf("retry_after must be at least 1s")
+	}
+	for name, limit := range cfg.Concurrency {
+		if limit < 1 {
+			return fmt.Errorf("concurrency %s: must be at least 1", name)
+		}
+	}
+	return nil
+}
+
+// queuedAlerts are the alerts of one webhook waiting to be processed. ctx
+// keeps the request's values, such as its ID and URL token, but not its
+// cancellation.
+type queuedAlerts struct {
+	ctx        context.Context
+	alerts     []Alert
+	source     string
+	group      string
+	customerID int
+	queuedAt   time.Time
+	release    func()
+	turns      []*turn
+}
+
+type workQueue struct {
+	cfg   QueueConfig
+	jobs  chan queuedAlerts
+	order *fingerprintOrder
+
+	mu     sync.Mutex
+	alerts int
+	closed bool
+	busy   int
+}
+
+func newWorkQueue(cfg QueueConfig, order *fingerprintOrder) *workQueue {
+	queueCapacity.Set(float64(cfg.Depth))
+	queueAlerts.Set(0)
+	queueBusyWorkers.Set(0)
+	// Every job holds at least one alert, so at most Depth jobs wait.
+	return &workQueue{cfg: cfg, jobs: make(chan queuedAlerts, cfg.Depth), order: order}
+}
+
+// push queues job unless that would put more than Depth alerts in the
+// queue. A payload larger than Depth is still taken when the queue is
+// empty, or it could never be delivered. Turns are reserved with the lock
+// held, so workers taking jobs in queue order take them in turn order.
+func (q *workQueue) push(job queuedAlerts) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed || (q.alerts > 0 && q.alerts+len(job.alerts) > q.cfg.Depth) {
+		return false
+	}
+	q.alerts += len(job.alerts)
+	queueAlerts.Set(float64(q.alerts))
+	job.turns = q.order.reserve(job.alerts, job.group, tokenCustomer(job.ctx, job.customerID))
+	q.jobs <- job
+	return true
+}
+
+// taken marks job as picked up by a worker.
+func (q *workQueue) taken(job queuedAlerts) {
+	q.mu.Lock()
+	q.alerts -= len(job.alerts)
+	q.busy++
+	queueAlerts.Set(float64(q.alerts))
+	queueBusyWorkers.Set(float64(q.busy))
+	q.mu.Unlock()
+	queueWait.UpdateDuration(job.queuedAt)
+}
+
+func (q *workQueue) done() {
+	q.mu.Lock()
+	q.busy--
+	queueBusyWorkers.Set(float64(q.busy))
+	q.mu.Unlock()
+}
+
+// close stops taking jobs. Workers finish the ones already queued.
+func (q *workQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.closed {
+		q.closed = true
+		close(q.jobs)
+	}
+}
+
+func (h *Handler) runQueueWorker() {
+	for job := range h.queue.jobs {
+		h.queue.taken(job)
+		h.processInOrder(job.ctx, job.alerts, job.turns, job.source, job.group, job.customerID)
+		job.release()
+		h.queue.done()
+	}
+}
+
+// accept processes the alerts of a webhook, or queues them when
+// alerts.queue.depth is set, and answers the request. Webhooks over the
+// concurrency limit of their source or URL token get a 429.
+func (h *Handler) accept(w http.ResponseWriter, r *http.Request, alerts []Alert, source, group string, customerID int) {
+	release, limited := h.limits.acquire(r.Context(), source)
+	if limited != "" {
+		sourceLimited(limited).Inc()
+		slog.Warn("source concurrency limit reached, asking sender to retry", "endpoint", limited, "source", source, "alerts", len(alerts))
+		h.retryLater(w)
+		return
+	}
+	if h.queue == nil || len(alerts) == 0 {
+		err := h.processAlerts(r.Context(), alerts, source, group, customerID)
+		release()
+		if err != nil {
+			// Failed deliveries are already queued for retry, so the sender
+			// is not asked to send the payload again; the errors are only
+			// reported for its logs.
+			var details []string
+			if joined, ok := err.(interface{ Unwrap() []error }); ok {
+				for _, e := range joined.Unwrap() {
+					details = append(details, e.Error())
+				}
+			}
+			writeJSON(w, http.StatusOK, map[string]any{"error": fmt.Sprintf("%d of %d alerts failed", len(details), len(alerts)), "details": details})
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	job := queuedAlerts{
+		ctx:        context.WithoutCancel(r.Context()),
+		alerts:     alerts,
+		source:     source,
+		group:      group,
+		customerID: customerID,
+		queuedAt:   time.Now(),
+		release:    release,
+	}
+	if !h.queue.push(job) {
+		release()
+		queueRejected(source).Inc()
+		slog.Warn("processing queue is full, asking sender to retry", "source", source, "alerts", len(alerts))
+		h.retryLater(w)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// queueDepth is the number of alerts waiting in the processing queue.
+func (h *Handler) queueDepth() int {
+	if h.queue == nil {
+		return 0
+	}
+	h.queue.mu.Lock()
+	defer h.queue.mu.Unlock()
+	return h.queue.alerts
+}
+
+func (h *Handler) retryLater(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(h.config.Queue.RetryAfter.Seconds())))
+	http.Error(w, "too many requests", http.StatusTooManyRequests)
+}
@@ -0,0 +1,85 @@
+package alertiris
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQueueWorkersKeepOrderPerFingerprint(t *testing.T) {
+	var log eventLog
+	h := newTestHandler(t, func(ctx context.Context, ev *Event, next Next) error {
+		if ev.Alert.Status == "firing" {
+			time.Sleep(5 * time.Millisecond)
+		}
+		log.add(ev)
+		return nil
+	})
+	h.config.Queue = QueueConfig{Depth: 100, Workers: 4, RetryAfter: time.Second}
+	h.queue = newWorkQueue(h.config.Queue, h.order)
+	var workers sync.WaitGroup
+	for range h.config.Queue.Workers {
+		workers.Go(h.runQueueWorker)
+	}
+
+	// Creates and resolves are queued as separate webhooks, so idle workers
+	// pick up resolves while the creates are still being processed.
+	for i := range 10 {
+		fp := fmt.Sprintf("fp%d", i)
+		for _, status := range []string{"firing", "resolved"} {
+			w := httptest.NewRecorder()
+			h.accept(w, httptest.NewRequest(http.MethodPost, "/webhook", nil), []Alert{testAlert(fp, status)}, "alertmanager", "", 1)
+			if w.Code != http.StatusAccepted {
+				t.Fatalf("%s %s: status %d, want %d", fp, status, w.Code, http.StatusAccepted)
+			}
+		}
+	}
+	h.queue.close()
+	workers.Wait()
+
+	checkFiredBeforeResolved(t, log.get(), 10)
+}
+
+func TestFullQueueAsksToRetry(t *testing.T) {
+	h := newTestHandler(t, func(ctx context.Context, ev *Event, next Next) error { return nil })
+	h.config.Queue = QueueConfig{Depth: 2, Workers: 1, RetryAfter: 7 * time.Second}
+	// No workers run, so queued alerts stay queued.
+	h.queue = newWorkQueue(h.config.Queue, h.order)
+	defer h.queue.close()
+
+	send := func(alerts ...Alert) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.accept(w, httptest.NewRequest(http.MethodPost, "/webhook", nil), alerts, "alertmanager", "", 1)
+		return w
+	}
+	if w := send(testAlert("fp1", "firing")); w.Code != http.StatusAccepted {
+		t.Fatalf("first webhook: status %d, want %d", w.Code, http.StatusAccepted)
+	}
+	w := send(testAlert("fp2", "firing"), testAlert("fp3", "firing"))
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("webhook over the depth: status %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if got := w.Header().Get("Retry-After"); got != "7" {
+		t.Fatalf("Retry-After = %q, want 7", got)
+	}
+	if w := send(testAlert("fp2", "firing")); w.Code != http.StatusAccepted {
+		t.Fatalf("webhook filling the queue: status %d, want %d", w.Code, http.StatusAccepted)
+	}
+}
+
+func TestOversizedPayloadIsTakenWhenQueueIsEmpty(t *testing.T) {
+	h := newTestHandler(t, func(ctx context.Context, ev *Event, next Next) error { return nil })
+	h.config.Queue = QueueConfig{Depth: 1, Workers: 1, RetryAfter: time.Second}
+	h.queue = newWorkQueue(h.config.Queue, h.order)
+	defer h.queue.close()
+
+	w := httptest.NewRecorder()
+	h.accept(w, httptest.NewRequest(http.MethodPost, "/webhook", nil), []Alert{testAlert("fp1", "firing"), testAlert("fp2", "firing")}, "alertmanager", "", 1)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status %d, want %d", w.Code, http.StatusAccepted)
+	}
+}
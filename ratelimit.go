@@ -0,0 +1,92 @@
+package alertiris
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var irisRateLimited = metrics.NewCounter(`alertiris_iris_rate_limited_total`)
+
+// observeRateLimit pauses requests to IRIS when it asks for it: by answering
+// 429 or 503 with Retry-After, or by reporting an exhausted rate limit in
+// X-RateLimit-Remaining and X-RateLimit-Reset. It returns the pause.
+func (c *IRISClient) observeRateLimit(resp *http.Response) time.Duration {
+	now := time.Now()
+	var wait time.Duration
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		if resp.StatusCode == http.StatusTooManyRequests {
+			irisRateLimited.Inc()
+		}
+		wait, _ = parseRetryAfter(resp.Header.Get("Retry-After"), now)
+	}
+	if strings.TrimSpace(resp.Header.Get("X-RateLimit-Remaining")) == "0" {
+		if reset, ok := parseRateLimitReset(resp.Header.Get("X-RateLimit-Reset"), now); ok {
+			wait = max(wait, reset)
+		}
+	}
+	if wait <= 0 {
+		return 0
+	}
+
+	until := now.Add(wait).UnixNano()
+	for {
+		cur := c.pausedUntil.Load()
+		if cur >= until || c.pausedUntil.CompareAndSwap(cur, until) {
+			return wait
+		}
+	}
+}
+
+// waitRateLimit blocks while IRIS asked for a pause. Pauses longer than the
+// maximum retry backoff are not waited out; the returned error lets the
+// caller queue the request instead.
+func (c *IRISClient) waitRateLimit(ctx context.Context, method, path string) error {
+	wait := time.Until(time.Unix(0, c.pausedUntil.Load()))
+	if wait <= 0 {
+		return nil
+	}
+	if wait > c.retry.MaxBackoff {
+		return &IRISError{Method: method, Path: path, StatusCode: http.StatusTooManyRequests, Message: "rate limited, not sending", RetryAfter: wait}
+	}
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// parseRetryAfter parses a Retry-After header in seconds or as an HTTP date.
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(max(secs, 0)) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// parseRateLimitReset parses X-RateLimit-Reset, which is sent either as
+// seconds until the reset or as a Unix timestamp.
+func parseRateLimitReset(v string, now time.Time) (time.Duration, bool) {
+	secs, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	if err != nil || secs < 0 {
+		return 0, false
+	}
+	if secs > 1e9 {
+		return max(time.Unix(secs, 0).Sub(now), 0), true
+	}
+	return time.Duration(secs) * time.Second, true
+}
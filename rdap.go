@@ -0,0 +1,230 @@
+package alertiris
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type RDAPConfig struct {
+	Enabled bool   `koanf:"enabled"`
+	URL     string `koanf:"url"`
+	// NewDomainAge flags domains registered more recently than this with
+	// the NewDomainTag tag.
+	NewDomainAge time.Duration `koanf:"new_domain_age"`
+	NewDomainTag string        `koanf:"new_domain_tag"`
+	RateLimit    int           `koanf:"rate_limit"`
+	CacheTTL     time.Duration `koanf:"cache_ttl"`
+	MaxLookups   int           `koanf:"max_lookups"`
+	Timeout      time.Duration `koanf:"timeout"`
+}
+
+// rdap adds the registrar, creation date and registrant country of domain
+// IOCs to the alert note.
+type rdap struct {
+	cfg     RDAPConfig
+	client  *http.Client
+	cache   *enrichmentCache
+	limiter *lookupLimiter
+}
+
+type rdapDomain struct {
+	Found     bool      `json:"found"`
+	Registrar string    `json:"registrar"`
+	Created   time.Time `json:"created"`
+	Country   string    `json:"country"`
+}
+
+func newRDAP(cfg RDAPConfig, cache *enrichmentCache) *rdap {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &rdap{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: cfg.Timeout},
+		cache:   cache,
+		limiter: &lookupLimiter{limit: cfg.RateLimit},
+	}
+}
+
+func (r *rdap) name() string { return "rdap" }
+
+func (r *rdap) enrich(ctx context.Context, sa *SinkAlert, iocs []IOC) string {
+	var lines []string
+	seen := map[string]bool{}
+	tagged := false
+	for _, ioc := range iocs {
+		if ioc.Type != IOCDomain {
+			continue
+		}
+		domain := registeredDomain(ioc.Value)
+		if seen[domain] {
+			continue
+		}
+		if r.cfg.MaxLookups > 0 && len(seen) >= r.cfg.MaxLookups {
+			break
+		}
+		seen[domain] = true
+		d, err := r.lookup(ctx, domain)
+		if err != nil {
+			slog.Warn("rdap lookup failed", "fingerprint", sa.Fingerprint, "domain", domain, "error", err)
+			continue
+		}
+		if !d.Found {
+			lines = append(lines, fmt.Sprintf("- %s: not found", domain))
+			continue
+		}
+		line := fmt.Sprintf("- %s: registrar %s", domain, orUnknown(d.Registrar))
+		if !d.Created.IsZero() {
+			line += ", created " + d.Created.Format(time.DateOnly)
+			if r.cfg.NewDomainAge > 0 && time.Since(d.Created) < r.cfg.NewDomainAge {
+				line += " (newly registered)"
+				if !tagged && r.cfg.NewDomainTag != "" {
+					sa.Tags = append(sa.Tags, r.cfg.NewDomainTag)
+					tagged = true
+				}
+			}
+		}
+		line += ", registrant country " + orUnknown(d.Country)
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return "RDAP:\n" + strings.Join(lines, "\n")
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
+
+// registeredDomain strips subdomains, keeping three labels under common
+// second level domains such as co.uk.
+func registeredDomain(domain string) string {
+	labels := strings.Split(domain, ".")
+	n := 2
+	if len(labels) > 2 && len(labels[len(labels)-1]) == 2 {
+		switch labels[len(labels)-2] {
+		case "co", "com", "net", "org", "gov", "ac", "edu", "ne", "or":
+			n = 3
+		}
+	}
+	if len(labels) <= n {
+		return domain
+	}
+	return strings.Join(labels[len(labels)-n:], ".")
+}
+
+func (r *rdap) lookup(ctx context.Context, domain string) (rdapDomain, error) {
+	var d rdapDomain
+	if r.cache.get("rdap", domain, &d) {
+		enrichmentLookups("rdap", "cached").Inc()
+		return d, nil
+	}
+	if !r.limiter.allow() {
+		enrichmentLookups("rdap", "rate_limited").Inc()
+		return d, fmt.Errorf("rate limit of %d lookups per minute reached", r.cfg.RateLimit)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(r.cfg.URL, "/")+"/domain/"+url.PathEscape(domain), nil)
+	if err != nil {
+		return d, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/rdap+json")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		enrichmentFailed("rdap")
+		return d, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var body struct {
+			Events []struct {
+				Action string    `json:"eventAction"`
+				Date   time.Time `json:"eventDate"`
+			} `json:"events"`
+			Entities []struct {
+				Roles []string          `json:"roles"`
+				VCard []json.RawMessage `json:"vcardArray"`
+			} `json:"entities"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			enrichmentFailed("rdap")
+			return d, fmt.Errorf("decode response: %w", err)
+		}
+		d.Found = true
+		for _, e := range body.Events {
+			if e.Action == "registration" {
+				d.Created = e.Date
+			}
+		}
+		for _, e := range body.Entities {
+			for _, role := range e.Roles {
+				switch role {
+				case "registrar":
+					d.Registrar = vcardField(e.VCard, "fn")
+				case "registrant":
+					d.Country = vcardField(e.VCard, "adr")
+				}
+			}
+		}
+	case http.StatusNotFound:
+	default:
+		enrichmentFailed("rdap")
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return d, fmt.Errorf("rdap returned %s: %s", resp.Status, msg)
+	}
+	enrichmentLookups("rdap", "ok").Inc()
+	r.cache.set("rdap", domain, d, r.cfg.CacheTTL)
+	return d, nil
+}
+
+// vcardField returns a property of a jCard ["vcard", [[name, params, type,
+// value], ...]]. For "adr" it returns the country, from the "cc" parameter
+// or the last address component.
+func vcardField(vcard []json.RawMessage, name string) string {
+	if len(vcard) < 2 {
+		return ""
+	}
+	var props [][]json.RawMessage
+	if err := json.Unmarshal(vcard[1], &props); err != nil {
+		return ""
+	}
+	for _, p := range props {
+		var prop string
+		if len(p) < 4 || json.Unmarshal(p[0], &prop) != nil || prop != name {
+			continue
+		}
+		if name != "adr" {
+			var value string
+			json.Unmarshal(p[3], &value)
+			return value
+		}
+		var params struct {
+			CC string `json:"cc"`
+		}
+		json.Unmarshal(p[1], &params)
+		if params.CC != "" {
+			return params.CC
+		}
+		var adr []any
+		json.Unmarshal(p[3], &adr)
+		if len(adr) == 7 {
+			if country, ok := adr[6].(string); ok {
+				return country
+			}
+		}
+	}
+	return ""
+}
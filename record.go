@@ -0,0 +1,156 @@
+package alertiris
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+type RecordConfig struct {
+	Path string `koanf:"path"`
+}
+
+// Recording is an inbound webhook request as received.
+type Recording struct {
+	Time    time.Time   `json:"time"`
+	Method  string      `json:"method"`
+	Path    string      `json:"path"`
+	Query   string      `json:"query"`
+	Headers http.Header `json:"headers"`
+	Body    []byte      `json:"body"`
+	// Token is the name of the URL token the request came in through. The
+	// token itself is not kept; Path is the source's.
+	Token string `json:"token,omitempty"`
+}
+
+// Request rebuilds the recorded request so it can be served again.
+func (rec Recording) Request() *http.Request {
+	r, _ := http.NewRequest(rec.Method, rec.Path, bytes.NewReader(rec.Body))
+	r.URL.RawQuery = rec.Query
+	r.Header = rec.Headers.Clone()
+	if r.Header == nil {
+		r.Header = http.Header{}
+	}
+	return r
+}
+
+// ReadRecordings calls fn for every recording in a file written by the
+// recorder, in order.
+func ReadRecordings(r io.Reader, fn func(Recording) error) error {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var rec Recording
+		if err := dec.Decode(&rec); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("decode recording: %w", err)
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+}
+
+// requestScrubber turns authenticated webhooks into recordings fit to be
+// kept: headers carrying credentials are dropped, URL tokens are replaced by
+// their source and the body, headers and query are redacted.
+type requestScrubber struct {
+	redactor *Redactor
+	headers  []string
+}
+
+func newRequestScrubber(redactor *Redactor, auth map[string]EndpointAuthConfig) *requestScrubber {
+	headers := []string{"Authorization", "Proxy-Authorization", "Cookie"}
+	for _, cfg := range auth {
+		if cfg.Type == "hmac" {
+			headers = append(headers, cfg.signatureHeader())
+		}
+	}
+	return &requestScrubber{redactor: redactor, headers: headers}
+}
+
+// record reads the body of r, puts it back for the source and returns the
+// scrubbed recording. Bodies over the registry's limit are answered with a
+// 413 and ok is false.
+func (sc *requestScrubber) record(w http.ResponseWriter, r *http.Request) (rec Recording, body []byte, ok bool) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		} else {
+			http.Error(w, "bad request", http.StatusBadRequest)
+		}
+		return Recording{}, nil, false
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	headers := r.Header.Clone()
+	for _, name := range sc.headers {
+		headers.Del(name)
+	}
+	rec = Recording{
+		Time:    time.Now(),
+		Method:  r.Method,
+		Path:    r.URL.Path,
+		Query:   sc.redactor.RedactQuery(r.URL.RawQuery),
+		Headers: sc.redactor.RedactHeaders(headers),
+		Body:    sc.redactor.RedactBody(body),
+	}
+	if t := tokenFrom(r.Context()); t != nil {
+		rec.Token = t.Name
+	}
+	return rec, body, true
+}
+
+// recorder appends every authenticated request to a JSON lines file. It is
+// used as source middleware and records requests scrubbed.
+type recorder struct {
+	mu       sync.Mutex
+	file     *os.File
+	scrubber *requestScrubber
+}
+
+func newRecorder(cfg RecordConfig, scrubber *requestScrubber) (*recorder, error) {
+	f, err := os.OpenFile(cfg.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &recorder{file: f, scrubber: scrubber}, nil
+}
+
+func (rc *recorder) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec, _, ok := rc.scrubber.record(w, r)
+		if !ok {
+			return
+		}
+		if err := rc.write(rec); err != nil {
+			slog.Error("failed to record request", "path", rec.Path, "error", err)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (rc *recorder) write(rec Recording) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	_, err = rc.file.Write(append(line, '\n'))
+	return err
+}
+
+func (rc *recorder) Close() error {
+	return rc.file.Close()
+}
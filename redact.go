@@ -0,0 +1,159 @@
+package alertiris
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+)
+
+type RedactionConfig struct {
+	Replacement   string   `koanf:"replacement"`
+	NamePatterns  []string `koanf:"name_patterns"`
+	ValuePatterns []string `koanf:"value_patterns"`
+}
+
+type Redactor struct {
+	replacement string
+	names       []*regexp.Regexp
+	values      []*regexp.Regexp
+}
+
+func NewRedactor(cfg RedactionConfig) (*Redactor, error) {
+	r := &Redactor{replacement: cfg.Replacement}
+	for _, p := range cfg.NamePatterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("compile name pattern %q: %w", p, err)
+		}
+		r.names = append(r.names, re)
+	}
+	for _, p := range cfg.ValuePatterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("compile value pattern %q: %w", p, err)
+		}
+		r.values = append(r.values, re)
+	}
+	return r, nil
+}
+
+func (r *Redactor) Apply(alert Alert) Alert {
+	if len(r.names) == 0 && len(r.values) == 0 {
+		return alert
+	}
+	alert.Labels = r.redactMap(alert.Labels)
+	alert.Annotations = r.redactMap(alert.Annotations)
+	alert.GeneratorURL = r.redactValue(alert.GeneratorURL)
+	return alert
+}
+
+func (r *Redactor) redactMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		if r.matchesName(k) {
+			out[k] = r.replacement
+			continue
+		}
+		out[k] = r.redactValue(v)
+	}
+	return out
+}
+
+func (r *Redactor) matchesName(name string) bool {
+	for _, re := range r.names {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Redactor) redactValue(v string) string {
+	for _, re := range r.values {
+		v = re.ReplaceAllLiteralString(v, r.replacement)
+	}
+	return v
+}
+
+// RedactBody redacts a webhook body as it is stored. In a JSON body values
+// under matching names and matching substrings of strings are replaced, at
+// any depth; any other body is redacted as one string.
+func (r *Redactor) RedactBody(body []byte) []byte {
+	if len(r.names) == 0 && len(r.values) == 0 {
+		return body
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return []byte(r.redactValue(string(body)))
+	}
+	out, err := json.Marshal(r.redactJSON(v))
+	if err != nil {
+		return []byte(r.redactValue(string(body)))
+	}
+	return out
+}
+
+func (r *Redactor) redactJSON(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, val := range v {
+			if r.matchesName(k) {
+				v[k] = r.replacement
+			} else {
+				v[k] = r.redactJSON(val)
+			}
+		}
+	case []any:
+		for i := range v {
+			v[i] = r.redactJSON(v[i])
+		}
+	case string:
+		return r.redactValue(v)
+	}
+	return v
+}
+
+// RedactHeaders redacts header values like label values.
+func (r *Redactor) RedactHeaders(h http.Header) http.Header {
+	out := make(http.Header, len(h))
+	for k, vals := range h {
+		for _, v := range vals {
+			if r.matchesName(k) {
+				v = r.replacement
+			} else {
+				v = r.redactValue(v)
+			}
+			out[k] = append(out[k], v)
+		}
+	}
+	return out
+}
+
+// RedactQuery redacts the values of a raw URL query like label values.
+func (r *Redactor) RedactQuery(raw string) string {
+	if raw == "" || (len(r.names) == 0 && len(r.values) == 0) {
+		return raw
+	}
+	q, err := url.ParseQuery(raw)
+	if err != nil {
+		return r.redactValue(raw)
+	}
+	for k, vals := range q {
+		for i, v := range vals {
+			if r.matchesName(k) {
+				vals[i] = r.replacement
+			} else {
+				vals[i] = r.redactValue(v)
+			}
+		}
+	}
+	return q.Encode()
+}
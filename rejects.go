@@ -0,0 +1,74 @@
+package alertiris
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/dgraph-io/badger/v4"
+)
+
+// RejectedPayload is a webhook refused because it failed its source's JSON
+// Schema, kept so a misbehaving producer can be debugged.
+type RejectedPayload struct {
+	Recording
+	Source    string   `json:"source"`
+	RequestID string   `json:"request_id,omitempty"`
+	Errors    []string `json:"errors"`
+}
+
+func schemaRejected(source string) *metrics.Counter {
+	return metrics.GetOrCreateCounter(`alertiris_schema_rejected_total{source="` + source + `"}`)
+}
+
+// rejectSeq keeps keys of payloads rejected in the same nanosecond apart.
+var rejectSeq atomic.Uint32
+
+// storeReject keeps p under "reject:<time>:<seq>" for ttl.
+func storeReject(db *badger.DB, p RejectedPayload, ttl time.Duration) error {
+	val, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("reject:%020d:%05d", p.Time.UnixNano(), rejectSeq.Add(1)%100000)
+	return db.Update(func(txn *badger.Txn) error {
+		return txn.SetEntry(badger.NewEntry([]byte(key), val).WithTTL(ttl))
+	})
+}
+
+// ListRejects returns the rejected payloads, of one source if set, oldest
+// first.
+func ListRejects(db *badger.DB, source string) ([]RejectedPayload, error) {
+	out := []RejectedPayload{}
+	err := db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte("reject:")
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			var p RejectedPayload
+			if err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &p)
+			}); err != nil {
+				return err
+			}
+			if source == "" || p.Source == source {
+				out = append(out, p)
+			}
+		}
+		return nil
+	})
+	return out, err
+}
+
+func (h *Handler) adminListRejects(w http.ResponseWriter, r *http.Request) {
+	rejects, err := ListRejects(h.db, r.URL.Query().Get("source"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rejects)
+}
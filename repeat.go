@@ -0,0 +1,130 @@
+package alertiris
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// RepeatEscalationConfig raises the IRIS severity of alerts that keep
+// firing: one level for every Duration the alert has been firing, and one
+// level whenever Count notifications arrive within Window. The severity is
+// never raised above MaxSeverityID.
+type RepeatEscalationConfig struct {
+	Duration      time.Duration `koanf:"duration"`
+	Count         int           `koanf:"count"`
+	Window        time.Duration `koanf:"window"`
+	MaxSeverityID int           `koanf:"max_severity_id"`
+}
+
+type repeatState struct {
+	Raised         int       `json:"raised"`
+	DurationLevels int       `json:"duration_levels"`
+	Count          int       `json:"count"`
+	WindowStart    time.Time `json:"window_start"`
+}
+
+func repeatKey(fingerprint string, customerID int) []byte {
+	return []byte("rep:" + fingerprint + ":" + strconv.Itoa(customerID))
+}
+
+// repeatEscalation counts a firing notification of an existing IRIS alert
+// and raises sa.SeverityID by the levels gained so far. It returns the new
+// state, to be stored once the update succeeded, and the reason when the
+// severity was raised by this notification.
+func (h *Handler) repeatEscalation(sa *SinkAlert) (*repeatState, string, error) {
+	cfg := h.config.RepeatEscalation
+	if cfg.Duration <= 0 && cfg.Count <= 0 {
+		return nil, "", nil
+	}
+
+	var st repeatState
+	err := h.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(repeatKey(sa.Fingerprint, sa.CustomerID))
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &st)
+		})
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	capped := func(raised int) int {
+		return max(min(sa.SeverityID+raised, cfg.MaxSeverityID), sa.SeverityID)
+	}
+	before := capped(st.Raised)
+
+	now := time.Now()
+	var reasons []string
+	if cfg.Duration > 0 && !sa.Alert.StartsAt.IsZero() {
+		firing := now.Sub(sa.Alert.StartsAt)
+		if levels := int(firing / cfg.Duration); levels > st.DurationLevels {
+			st.Raised += levels - st.DurationLevels
+			st.DurationLevels = levels
+			reasons = append(reasons, fmt.Sprintf("firing for %s", firing.Round(time.Minute)))
+		}
+	}
+	if cfg.Count > 0 {
+		if st.WindowStart.IsZero() || (cfg.Window > 0 && now.Sub(st.WindowStart) > cfg.Window) {
+			st.WindowStart, st.Count = now, 0
+		}
+		st.Count++
+		if st.Count >= cfg.Count {
+			st.Raised++
+			reasons = append(reasons, fmt.Sprintf("%d notifications since %s", st.Count, h.formatTime(st.WindowStart)))
+			st.WindowStart, st.Count = now, 0
+		}
+	}
+
+	sa.SeverityID = capped(st.Raised)
+	if sa.SeverityID <= before {
+		return &st, "", nil
+	}
+	return &st, strings.Join(reasons, ", "), nil
+}
+
+// noteRepeatEscalation records why the severity was raised on the alert.
+func (h *Handler) noteRepeatEscalation(ctx context.Context, s Sink, alertID string, sa *SinkAlert, reason string) {
+	slog.Info("raised severity of repeatedly firing alert", "fingerprint", sa.Fingerprint, "alert_id", alertID, "severity_id", sa.SeverityID, "reason", reason)
+	h.recordHistory(HistoryEvent{Fingerprint: sa.Fingerprint, Event: "escalated", Sink: s.Name(), CustomerID: sa.CustomerID, AlertID: alertID, Detail: fmt.Sprintf("severity %d: %s", sa.SeverityID, reason)})
+	is, ok := s.(*irisSink)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(alertID)
+	if err != nil {
+		return
+	}
+	line := fmt.Sprintf("[%s] Severity raised to %d by alertiris: %s", h.formatTime(time.Now()), sa.SeverityID, reason)
+	if err := appendNote(ctx, is.client, id, sa.CustomerID, line); err != nil {
+		slog.Warn("failed to note severity escalation", "fingerprint", sa.Fingerprint, "alert_id", alertID, "error", err)
+	}
+}
+
+func (h *Handler) storeRepeat(fingerprint string, customerID int, st *repeatState) error {
+	val, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return h.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(repeatKey(fingerprint, customerID), val)
+	})
+}
+
+func (h *Handler) clearRepeat(fingerprint string, customerID int) error {
+	return h.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(repeatKey(fingerprint, customerID))
+	})
+}
@@ -0,0 +1,100 @@
+package alertiris
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// requestInfo travels in the request context. The source registry fills in
+// the source, and the token name for URL tokens, for the request log.
+type requestInfo struct {
+	id     string
+	source string
+	token  string
+}
+
+type requestInfoKey struct{}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID limits request IDs taken from the X-Request-ID header to
+// something safe to log and store.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+func requestInfoFrom(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*requestInfo)
+	return info
+}
+
+// processingID returns the request ID of ctx, or a new ID for alerts that
+// did not arrive with a request, such as those pushed by exec plugins.
+func processingID(ctx context.Context) string {
+	if info := requestInfoFrom(ctx); info != nil {
+		return info.id
+	}
+	return newRequestID()
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// logRequests assigns every request an ID, taken from X-Request-ID when the
+// client sent a usable one, returns it in X-Request-ID and logs the request
+// once it is answered. Webhooks are logged at info, everything else, such
+// as metric scrapes, at debug.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		info := &requestInfo{id: r.Header.Get("X-Request-ID")}
+		if !validRequestID.MatchString(info.id) {
+			info.id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", info.id)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info)))
+
+		// URL tokens are secrets and stay out of the log.
+		path := r.URL.Path
+		if info.token != "" {
+			path = "/webhook/{token}"
+		}
+		level := slog.LevelDebug
+		if strings.HasPrefix(r.URL.Path, "/webhook") {
+			level = slog.LevelInfo
+		}
+		attrs := []any{
+			"request_id", info.id,
+			"method", r.Method,
+			"path", path,
+			"status", rec.status,
+			"duration", time.Since(start),
+			"remote_addr", r.RemoteAddr,
+		}
+		if info.source != "" {
+			attrs = append(attrs, "source", info.source)
+		}
+		if info.token != "" {
+			attrs = append(attrs, "token", info.token)
+		}
+		slog.Log(r.Context(), level, "http request", attrs...)
+	})
+}
@@ -0,0 +1,322 @@
+package alertiris
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+type RetryConfig struct {
+	MaxAttempts    int           `koanf:"max_attempts"`
+	InitialBackoff time.Duration `koanf:"initial_backoff"`
+	MaxBackoff     time.Duration `koanf:"max_backoff"`
+	Interval       time.Duration `koanf:"interval"`
+}
+
+// retryEntry is the retry state of one sink for one alert. Sinks retry
+// independently, so a failing sink does not hold back the others. Entries
+// that exhaust their attempts are moved to the dead letter queue.
+type retryEntry struct {
+	Sink        string     `json:"sink"`
+	Status      string     `json:"status"`
+	Alert       *SinkAlert `json:"alert"`
+	Attempts    int        `json:"attempts"`
+	NextAttempt time.Time  `json:"next_attempt"`
+	LastError   string     `json:"last_error"`
+	FailedAt    time.Time  `json:"failed_at,omitempty"`
+}
+
+func retryKey(sink, fingerprint string, customerID int) []byte {
+	return []byte("retry:" + sink + ":" + fingerprint + ":" + strconv.Itoa(customerID))
+}
+
+func dlqKey(sink, fingerprint string, customerID int, t time.Time) []byte {
+	return []byte("dlq:" + sink + ":" + fingerprint + ":" + strconv.Itoa(customerID) + ":" + strconv.FormatInt(t.UnixNano(), 10))
+}
+
+func (h *Handler) backoff(attempts int) time.Duration {
+	d := h.config.Retry.InitialBackoff
+	for i := 1; i < attempts && d < h.config.Retry.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, h.config.Retry.MaxBackoff)
+}
+
+func (h *Handler) scheduleRetry(sink, status string, sa *SinkAlert, cause error) {
+	key := retryKey(sink, sa.Fingerprint, sa.CustomerID)
+	var deadLettered *retryEntry
+	err := h.db.Update(func(txn *badger.Txn) error {
+		entry := retryEntry{Sink: sink, Status: status}
+		item, err := txn.Get(key)
+		if err != nil && err != badger.ErrKeyNotFound {
+			return err
+		}
+		if err == nil {
+			var prev retryEntry
+			if err := item.Value(func(val []byte) error {
+				return json.Unmarshal(val, &prev)
+			}); err != nil {
+				return err
+			}
+			if prev.Status == status {
+				entry.Attempts = prev.Attempts
+			}
+		}
+
+		now := time.Now()
+		entry.Alert = sa
+		entry.Attempts++
+		entry.LastError = cause.Error()
+
+		// Requests IRIS rejected are not retried, they would fail again.
+		if permanent := isPermanent(cause); permanent || entry.Attempts >= h.config.Retry.MaxAttempts {
+			entry.FailedAt = now
+			val, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			slog.Error("giving up on sink, moved to dead letter queue", "sink", sink, "fingerprint", sa.Fingerprint, "request_id", sa.RequestID, "attempts", entry.Attempts, "permanent", permanent, "error", cause)
+			if err := txn.Set(dlqKey(sink, sa.Fingerprint, sa.CustomerID, now), val); err != nil {
+				return err
+			}
+			deadLettered = &entry
+			return txn.Delete(key)
+		}
+
+		wait := h.backoff(entry.Attempts)
+		var ierr *IRISError
+		if errors.As(cause, &ierr) {
+			wait = max(wait, ierr.RetryAfter)
+		}
+		entry.NextAttempt = now.Add(wait)
+		val, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		return txn.Set(key, val)
+	})
+	if err != nil {
+		slog.Error("failed to store retry state", "sink", sink, "fingerprint", sa.Fingerprint, "request_id", sa.RequestID, "error", err)
+	} else if deadLettered != nil {
+		h.recordHistory(HistoryEvent{Fingerprint: sa.Fingerprint, Event: "dead-lettered", Sink: sink, CustomerID: sa.CustomerID, Detail: fmt.Sprintf("%s after %d attempts", status, deadLettered.Attempts), Error: cause.Error()})
+	}
+}
+
+func (h *Handler) clearRetry(sink, fingerprint string, customerID int) {
+	err := h.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(retryKey(sink, fingerprint, customerID))
+	})
+	if err != nil {
+		slog.Warn("failed to clear retry state", "sink", sink, "fingerprint", fingerprint, "error", err)
+	}
+}
+
+func (h *Handler) runRetries(ctx context.Context) {
+	ticker := time.NewTicker(h.config.Retry.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-h.retryNow:
+		}
+		if err := h.processRetries(ctx, false); err != nil {
+			slog.Error("failed to process retries", "error", err)
+		}
+	}
+}
+
+// processRetries attempts the retry entries that are due, or all of them when
+// force is set. IRIS entries wait while hold mode is enabled.
+func (h *Handler) processRetries(ctx context.Context, force bool) error {
+	var due []retryEntry
+	now := time.Now()
+	err := h.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte("retry:")
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			var entry retryEntry
+			if err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &entry)
+			}); err != nil {
+				return err
+			}
+			if entry.Sink == "iris" && h.held() {
+				continue
+			}
+			if force || !entry.NextAttempt.After(now) {
+				due = append(due, entry)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range due {
+		sa := entry.Alert
+		s, ok := h.sinks[entry.Sink]
+		if !ok {
+			h.scheduleRetry(entry.Sink, entry.Status, sa, fmt.Errorf("sink %q is no longer configured", entry.Sink))
+			continue
+		}
+
+		ids, err := h.sinkIDs(sa.Fingerprint, sa.CustomerID)
+		if err != nil {
+			return categorize(ErrorStore, fmt.Errorf("db lookup: %w", err))
+		}
+		id, exists := ids[entry.Sink]
+
+		switch entry.Status {
+		case "firing":
+			_, err = h.deliverToSink(ctx, s, id, sa)
+		case "resolved":
+			if !exists {
+				h.clearRetry(entry.Sink, sa.Fingerprint, sa.CustomerID)
+				continue
+			}
+			err = h.resolveInSink(ctx, s, id, sa)
+		}
+		if err != nil {
+			slog.Warn("retry failed", "sink", entry.Sink, "fingerprint", sa.Fingerprint, "request_id", sa.RequestID, "attempt", entry.Attempts+1, "error", err, "error_category", countError(err))
+			h.scheduleRetry(entry.Sink, entry.Status, sa, err)
+			continue
+		}
+		slog.Info("retry succeeded", "sink", entry.Sink, "fingerprint", sa.Fingerprint, "request_id", sa.RequestID, "attempt", entry.Attempts+1)
+		h.clearRetry(entry.Sink, sa.Fingerprint, sa.CustomerID)
+	}
+	return nil
+}
+
+// QueueEntry is a delivery waiting in the retry queue or parked in the dead
+// letter queue.
+type QueueEntry struct {
+	Queue       string    `json:"queue"`
+	ID          string    `json:"id"`
+	Sink        string    `json:"sink"`
+	Status      string    `json:"status"`
+	Fingerprint string    `json:"fingerprint"`
+	CustomerID  int       `json:"customer_id"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error"`
+	FailedAt    time.Time `json:"failed_at,omitzero"`
+}
+
+// ListQueue returns the entries of the retry and dead letter queues, limited
+// to fingerprint unless it is empty.
+func ListQueue(db *badger.DB, fingerprint string) ([]QueueEntry, error) {
+	out := []QueueEntry{}
+	err := db.View(func(txn *badger.Txn) error {
+		for _, queue := range []string{"retry", "dlq"} {
+			opts := badger.DefaultIteratorOptions
+			opts.Prefix = []byte(queue + ":")
+			it := txn.NewIterator(opts)
+			for it.Rewind(); it.Valid(); it.Next() {
+				var entry retryEntry
+				if err := it.Item().Value(func(val []byte) error {
+					return json.Unmarshal(val, &entry)
+				}); err != nil {
+					it.Close()
+					return err
+				}
+				q := QueueEntry{
+					Queue:       queue,
+					ID:          strings.TrimPrefix(string(it.Item().Key()), queue+":"),
+					Sink:        entry.Sink,
+					Status:      entry.Status,
+					Attempts:    entry.Attempts,
+					NextAttempt: entry.NextAttempt,
+					LastError:   entry.LastError,
+					FailedAt:    entry.FailedAt,
+				}
+				if entry.Alert != nil {
+					q.Fingerprint, q.CustomerID = entry.Alert.Fingerprint, entry.Alert.CustomerID
+				}
+				if fingerprint != "" && q.Fingerprint != fingerprint {
+					continue
+				}
+				out = append(out, q)
+			}
+			it.Close()
+		}
+		return nil
+	})
+	return out, err
+}
+
+type dlqEntry struct {
+	ID string `json:"id"`
+	retryEntry
+}
+
+func (h *Handler) listDLQ() ([]dlqEntry, error) {
+	out := []dlqEntry{}
+	err := h.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte("dlq:")
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			entry := dlqEntry{ID: strings.TrimPrefix(string(it.Item().Key()), "dlq:")}
+			if err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &entry.retryEntry)
+			}); err != nil {
+				return err
+			}
+			out = append(out, entry)
+		}
+		return nil
+	})
+	return out, err
+}
+
+// requeueDLQ moves a dead letter entry back to the retry queue with its
+// attempts reset, to be retried on the next tick.
+func (h *Handler) requeueDLQ(id string) error {
+	key := []byte("dlq:" + id)
+	return h.db.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+		var entry retryEntry
+		if err := item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &entry)
+		}); err != nil {
+			return err
+		}
+		entry.Attempts = 0
+		entry.NextAttempt = time.Now()
+		entry.FailedAt = time.Time{}
+		val, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		if err := txn.Set(retryKey(entry.Sink, entry.Alert.Fingerprint, entry.Alert.CustomerID), val); err != nil {
+			return err
+		}
+		return txn.Delete(key)
+	})
+}
+
+func (h *Handler) deleteDLQ(id string) error {
+	key := []byte("dlq:" + id)
+	return h.db.Update(func(txn *badger.Txn) error {
+		if _, err := txn.Get(key); err != nil {
+			return err
+		}
+		return txn.Delete(key)
+	})
+}
@@ -0,0 +1,102 @@
+package alertiris
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+type RouteConfig struct {
+	Name       string            `koanf:"name"`
+	Matchers   map[string]string `koanf:"matchers"`
+	CustomerID int               `koanf:"customer_id"`
+	Sinks      []string          `koanf:"sinks"`
+
+	// EscalationPolicy names the policy applied to IRIS alerts created
+	// through this route instead of alerts.escalation.rules.
+	EscalationPolicy string `koanf:"escalation_policy"`
+
+	// ResolvedAction overrides alerts.resolved_action for alerts matching
+	// this route.
+	ResolvedAction string `koanf:"resolved_action"`
+	// ResolutionStatusID overrides alerts.resolution_status_id.
+	ResolutionStatusID int `koanf:"resolution_status_id"`
+
+	// Queries replace alerts.prometheus.queries for this route.
+	Queries []QueryConfig `koanf:"queries"`
+}
+
+// Matchers match alert labels against anchored regular expressions. All
+// matchers must match.
+type Matchers []labelMatcher
+
+type labelMatcher struct {
+	label string
+	re    *regexp.Regexp
+}
+
+func NewMatchers(m map[string]string) (Matchers, error) {
+	labels := make([]string, 0, len(m))
+	for label := range m {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	var out Matchers
+	for _, label := range labels {
+		re, err := regexp.Compile("^(?:" + m[label] + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("matcher %s: %w", label, err)
+		}
+		out = append(out, labelMatcher{label: label, re: re})
+	}
+	return out, nil
+}
+
+func (m Matchers) Match(labels map[string]string) bool {
+	for _, lm := range m {
+		if !lm.re.MatchString(labels[lm.label]) {
+			return false
+		}
+	}
+	return true
+}
+
+type Route struct {
+	RouteConfig
+	matchers Matchers
+	queries  []*alertQuery
+}
+
+func NewRoutes(cfgs []RouteConfig) ([]*Route, error) {
+	var routes []*Route
+	for i, cfg := range cfgs {
+		if cfg.Name == "" {
+			cfg.Name = fmt.Sprintf("route-%d", i)
+		}
+		m, err := NewMatchers(cfg.Matchers)
+		if err != nil {
+			return nil, fmt.Errorf("route %q: %w", cfg.Name, err)
+		}
+		if cfg.ResolvedAction != "" {
+			if err := validateResolvedAction(cfg.ResolvedAction); err != nil {
+				return nil, fmt.Errorf("route %q: %w", cfg.Name, err)
+			}
+		}
+		queries, err := newAlertQueries(cfg.Queries)
+		if err != nil {
+			return nil, fmt.Errorf("route %q: %w", cfg.Name, err)
+		}
+		routes = append(routes, &Route{RouteConfig: cfg, matchers: m, queries: queries})
+	}
+	return routes, nil
+}
+
+func matchRoute(routes []*Route, labels map[string]string) *Route {
+	for _, r := range routes {
+		if r.matchers.Match(labels) {
+			return r
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package alertiris
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+)
+
+type RunbookConfig struct {
+	Annotation  string `koanf:"annotation"`
+	Description bool   `koanf:"description"`
+	Tag         bool   `koanf:"tag"`
+	// SourceLink is "auto" (use the runbook when the generator URL is
+	// unhelpful), "always" or "never".
+	SourceLink string `koanf:"source_link"`
+	// GeneratorURLPattern marks matching generator URLs as unhelpful, e.g.
+	// Prometheus hosts analysts cannot reach.
+	GeneratorURLPattern string `koanf:"generator_url_pattern"`
+}
+
+type runbook struct {
+	cfg       RunbookConfig
+	unhelpful *regexp.Regexp
+}
+
+func newRunbook(cfg RunbookConfig) (*runbook, error) {
+	if !slices.Contains([]string{"auto", "always", "never"}, cfg.SourceLink) {
+		return nil, fmt.Errorf("source_link must be auto, always or never, got %q", cfg.SourceLink)
+	}
+	r := &runbook{cfg: cfg}
+	if cfg.GeneratorURLPattern != "" {
+		re, err := regexp.Compile(cfg.GeneratorURLPattern)
+		if err != nil {
+			return nil, fmt.Errorf("generator_url_pattern: %w", err)
+		}
+		r.unhelpful = re
+	}
+	return r, nil
+}
+
+func (r *runbook) url(alert Alert) string {
+	if r.cfg.Annotation == "" {
+		return ""
+	}
+	return alert.Annotations[r.cfg.Annotation]
+}
+
+// sourceLink picks the link shown on the alert: the generator URL unless it
+// is missing or unhelpful and a runbook is available.
+func (r *runbook) sourceLink(alert Alert) string {
+	rb := r.url(alert)
+	if rb == "" {
+		return alert.GeneratorURL
+	}
+	switch r.cfg.SourceLink {
+	case "always":
+		return rb
+	case "never":
+		return alert.GeneratorURL
+	}
+	if r.helpful(alert.GeneratorURL) {
+		return alert.GeneratorURL
+	}
+	return rb
+}
+
+func (r *runbook) helpful(generatorURL string) bool {
+	u, err := url.Parse(generatorURL)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	return r.unhelpful == nil || !r.unhelpful.MatchString(generatorURL)
+}
+
+// apply adds the runbook to the description and tags of a sink alert.
+func (r *runbook) apply(sa *SinkAlert, fields []DescriptionField) {
+	rb := r.url(sa.Alert)
+	if rb == "" {
+		return
+	}
+	listed := slices.ContainsFunc(fields, func(f DescriptionField) bool {
+		return f.Annotation == r.cfg.Annotation
+	})
+	if r.cfg.Description && !listed {
+		line := "Runbook: " + rb
+		if sa.Description != "" {
+			line += "\n"
+		}
+		sa.Description = line + sa.Description
+	}
+	if r.cfg.Tag {
+		sa.Tags = append(sa.Tags, "runbook:"+rb)
+	}
+}
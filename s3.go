@@ -0,0 +1,320 @@
+package alertiris
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/dgraph-io/badger/v4"
+)
+
+// S3Config ships archived payloads and alert history to an S3 compatible
+// bucket. Entries are queued in the state store under "s3q:" and uploaded
+// in batches as JSON lines objects partitioned by date:
+// <prefix><kind>/<yyyy>/<mm>/<dd>/<first entry>.jsonl.
+type S3Config struct {
+	Endpoint      string        `koanf:"endpoint"`
+	Region        string        `koanf:"region"`
+	Bucket        string        `koanf:"bucket"`
+	AccessKey     string        `koanf:"access_key"`
+	SecretKey     string        `koanf:"secret_key"`
+	Prefix        string        `koanf:"prefix"`
+	PathStyle     bool          `koanf:"path_style"`
+	SkipTLSVerify bool          `koanf:"skip_tls_verify"`
+	Interval      time.Duration `koanf:"interval"`
+	BatchSize     int           `koanf:"batch_size"`
+	Timeout       time.Duration `koanf:"timeout"`
+}
+
+var (
+	s3UploadedObjects = metrics.NewCounter(`alertiris_s3_uploaded_objects_total`)
+	s3UploadErrors    = metrics.NewCounter(`alertiris_s3_upload_errors_total`)
+)
+
+// s3Kinds are the kinds of entries shipped, in the "s3q:<kind>:" keys.
+var s3Kinds = []string{"payloads", "history"}
+
+// s3Enqueue queues a JSON line for shipping in txn.
+func s3Enqueue(txn *badger.Txn, kind string, t time.Time, seq uint32, line []byte) error {
+	key := fmt.Sprintf("s3q:%s:%020d:%05d", kind, t.UnixNano(), seq%100000)
+	return txn.Set([]byte(key), line)
+}
+
+type s3Shipper struct {
+	cfg    S3Config
+	db     *badger.DB
+	client *http.Client
+	base   *url.URL
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newS3Shipper(cfg S3Config, db *badger.DB) (*s3Shipper, error) {
+	if cfg.Region == "" {
+		return nil, fmt.Errorf("region is required")
+	}
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	base, err := url.Parse(strings.TrimRight(endpoint, "/"))
+	if err != nil || base.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint %q", endpoint)
+	}
+	if cfg.PathStyle {
+		base.Path += "/" + cfg.Bucket
+	} else {
+		base.Host = cfg.Bucket + "." + base.Host
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.SkipTLSVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	s := &s3Shipper{
+		cfg:    cfg,
+		db:     db,
+		client: &http.Client{Transport: transport, Timeout: cfg.Timeout},
+		base:   base,
+	}
+	if err := s.dropUnscrubbed(); err != nil {
+		return nil, fmt.Errorf("drop unscrubbed payloads: %w", err)
+	}
+	return s, nil
+}
+
+// dropUnscrubbed removes payloads queued by releases that archived them
+// before authentication and redaction, so their credentials never leave the
+// host.
+func (s *s3Shipper) dropUnscrubbed() error {
+	var keys [][]byte
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte("s3q:payloads:")
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			var p ArchivedPayload
+			if err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &p)
+			}); err != nil || !p.Scrubbed {
+				keys = append(keys, it.Item().KeyCopy(nil))
+			}
+		}
+		return nil
+	})
+	if err != nil || len(keys) == 0 {
+		return err
+	}
+	wb := s.db.NewWriteBatch()
+	for _, key := range keys {
+		if err := wb.Delete(key); err != nil {
+			wb.Cancel()
+			return err
+		}
+	}
+	if err := wb.Flush(); err != nil {
+		return err
+	}
+	slog.Warn("dropped queued payloads archived before authentication and redaction, they are not shipped", "payloads", len(keys))
+	return nil
+}
+
+func (s *s3Shipper) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.cfg.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				for _, kind := range s3Kinds {
+					if err := s.ship(ctx, kind); err != nil {
+						s3UploadErrors.Inc()
+						slog.Error("failed to ship to s3", "kind", kind, "error", err)
+					}
+				}
+			}
+		}
+	}()
+}
+
+// Close stops shipping. Queued entries are shipped after the next start.
+func (s *s3Shipper) Close() {
+	if s.cancel != nil {
+		s.cancel()
+		s.wg.Wait()
+	}
+}
+
+// ship uploads the queued entries of kind, one object per day, until the
+// queue is empty.
+func (s *s3Shipper) ship(ctx context.Context, kind string) error {
+	for {
+		var keys [][]byte
+		var day string
+		var body bytes.Buffer
+		err := s.db.View(func(txn *badger.Txn) error {
+			opts := badger.DefaultIteratorOptions
+			opts.Prefix = []byte("s3q:" + kind + ":")
+			it := txn.NewIterator(opts)
+			defer it.Close()
+			for it.Rewind(); it.Valid() && len(keys) < s.cfg.BatchSize; it.Next() {
+				key := it.Item().KeyCopy(nil)
+				d := s3Day(key)
+				if day == "" {
+					day = d
+				} else if d != day {
+					break
+				}
+				if err := it.Item().Value(func(val []byte) error {
+					body.Write(val)
+					body.WriteByte('\n')
+					return nil
+				}); err != nil {
+					return err
+				}
+				keys = append(keys, key)
+			}
+			return nil
+		})
+		if err != nil || len(keys) == 0 {
+			return err
+		}
+
+		// The first queue key makes the object name unique and sortable.
+		first := strings.TrimPrefix(string(keys[0]), "s3q:"+kind+":")
+		object := fmt.Sprintf("%s%s/%s/%s.jsonl", s.cfg.Prefix, kind, day, strings.ReplaceAll(first, ":", "-"))
+		if err := s.put(ctx, object, body.Bytes()); err != nil {
+			return fmt.Errorf("put %s: %w", object, err)
+		}
+		s3UploadedObjects.Inc()
+		slog.Debug("shipped to s3", "object", object, "entries", len(keys))
+
+		wb := s.db.NewWriteBatch()
+		for _, key := range keys {
+			if err := wb.Delete(key); err != nil {
+				wb.Cancel()
+				return err
+			}
+		}
+		if err := wb.Flush(); err != nil {
+			return err
+		}
+	}
+}
+
+// s3Day returns the yyyy/mm/dd partition of a queue key.
+func s3Day(key []byte) string {
+	parts := strings.Split(string(key), ":")
+	if len(parts) < 3 {
+		return "unknown"
+	}
+	var nanos int64
+	fmt.Sscanf(parts[2], "%d", &nanos)
+	return time.Unix(0, nanos).UTC().Format("2006/01/02")
+}
+
+func (s *s3Shipper) put(ctx context.Context, object string, body []byte) error {
+	u := *s.base
+	u.Path += "/" + object
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	signS3(req, body, s.cfg.Region, s.cfg.AccessKey, s.cfg.SecretKey, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("returned %d: %s", resp.StatusCode, string(msg))
+	}
+	return nil
+}
+
+// signS3 signs req with AWS Signature Version 4 for the s3 service, signing
+// the host and x-amz-* headers.
+func signS3(req *http.Request, body []byte, region, accessKey, secretKey string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	for _, part := range []string{region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKey, scope, signedHeaders, signature))
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
@@ -0,0 +1,302 @@
+package alertiris
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// jsonSchema is a compiled JSON Schema. It supports the keywords needed to
+// describe webhook payloads: type, enum, const, properties, required,
+// additionalProperties, items, minItems, maxItems, minLength, maxLength,
+// pattern, minimum, maximum, allOf and anyOf. Schemas using other
+// validation keywords, such as $ref, are refused rather than half applied.
+type jsonSchema struct {
+	types      []string
+	enum       []any
+	constant   any
+	hasConst   bool
+	properties map[string]*jsonSchema
+	required   []string
+	additional *jsonSchema
+	noExtra    bool
+	items      *jsonSchema
+	minItems   *float64
+	maxItems   *float64
+	minLength  *float64
+	maxLength  *float64
+	pattern    *regexp.Regexp
+	minimum    *float64
+	maximum    *float64
+	allOf      []*jsonSchema
+	anyOf      []*jsonSchema
+}
+
+// annotationKeywords do not affect validation.
+var annotationKeywords = []string{"$schema", "$id", "$comment", "title", "description", "default", "examples", "format", "deprecated", "readOnly", "writeOnly"}
+
+func loadJSONSchema(path string) (*jsonSchema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	s, err := compileSchema(raw, "#")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+func compileSchema(raw any, at string) (*jsonSchema, error) {
+	if b, ok := raw.(bool); ok {
+		if b {
+			return &jsonSchema{}, nil
+		}
+		return &jsonSchema{anyOf: []*jsonSchema{}}, nil
+	}
+	m, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: schema must be an object or boolean", at)
+	}
+
+	s := &jsonSchema{}
+	number := func(key string) (*float64, error) {
+		f, ok := m[key].(float64)
+		if !ok {
+			return nil, fmt.Errorf("%s/%s: must be a number", at, key)
+		}
+		return &f, nil
+	}
+	schemas := func(key string) ([]*jsonSchema, error) {
+		list, ok := m[key].([]any)
+		if !ok {
+			return nil, fmt.Errorf("%s/%s: must be an array", at, key)
+		}
+		var out []*jsonSchema
+		for i, item := range list {
+			sub, err := compileSchema(item, fmt.Sprintf("%s/%s/%d", at, key, i))
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, sub)
+		}
+		return out, nil
+	}
+
+	var err error
+	for key, v := range m {
+		switch key {
+		case "type":
+			switch t := v.(type) {
+			case string:
+				s.types = []string{t}
+			case []any:
+				for _, e := range t {
+					name, ok := e.(string)
+					if !ok {
+						return nil, fmt.Errorf("%s/type: must be a string or an array of strings", at)
+					}
+					s.types = append(s.types, name)
+				}
+			default:
+				return nil, fmt.Errorf("%s/type: must be a string or an array of strings", at)
+			}
+		case "enum":
+			if s.enum, ok = v.([]any); !ok {
+				return nil, fmt.Errorf("%s/enum: must be an array", at)
+			}
+		case "const":
+			s.constant, s.hasConst = v, true
+		case "properties":
+			props, ok := v.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("%s/properties: must be an object", at)
+			}
+			s.properties = make(map[string]*jsonSchema)
+			for name, p := range props {
+				if s.properties[name], err = compileSchema(p, at+"/properties/"+name); err != nil {
+					return nil, err
+				}
+			}
+		case "required":
+			list, ok := v.([]any)
+			if !ok {
+				return nil, fmt.Errorf("%s/required: must be an array", at)
+			}
+			for _, e := range list {
+				name, ok := e.(string)
+				if !ok {
+					return nil, fmt.Errorf("%s/required: must hold strings", at)
+				}
+				s.required = append(s.required, name)
+			}
+		case "additionalProperties":
+			if b, ok := v.(bool); ok {
+				s.noExtra = !b
+			} else if s.additional, err = compileSchema(v, at+"/additionalProperties"); err != nil {
+				return nil, err
+			}
+		case "items":
+			if s.items, err = compileSchema(v, at+"/items"); err != nil {
+				return nil, err
+			}
+		case "minItems":
+			s.minItems, err = number(key)
+		case "maxItems":
+			s.maxItems, err = number(key)
+		case "minLength":
+			s.minLength, err = number(key)
+		case "maxLength":
+			s.maxLength, err = number(key)
+		case "minimum":
+			s.minimum, err = number(key)
+		case "maximum":
+			s.maximum, err = number(key)
+		case "pattern":
+			p, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s/pattern: must be a string", at)
+			}
+			if s.pattern, err = regexp.Compile(p); err != nil {
+				return nil, fmt.Errorf("%s/pattern: %w", at, err)
+			}
+		case "allOf":
+			s.allOf, err = schemas(key)
+		case "anyOf":
+			s.anyOf, err = schemas(key)
+		default:
+			if !slices.Contains(annotationKeywords, key) {
+				return nil, fmt.Errorf("%s: unsupported keyword %q", at, key)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// validate appends a message per violation to errs, each prefixed with the
+// JSON pointer of the offending value.
+func (s *jsonSchema) validate(v any, at string, errs *[]string) {
+	fail := func(format string, args ...any) {
+		where := at
+		if where == "" {
+			where = "/"
+		}
+		*errs = append(*errs, where+": "+fmt.Sprintf(format, args...))
+	}
+
+	if len(s.types) > 0 && !slices.ContainsFunc(s.types, func(t string) bool { return jsonTypeIs(v, t) }) {
+		fail("expected %s, got %s", strings.Join(s.types, " or "), jsonTypeOf(v))
+		return
+	}
+	if s.enum != nil && !slices.ContainsFunc(s.enum, func(e any) bool { return reflect.DeepEqual(e, v) }) {
+		fail("value is not one of the allowed values")
+	}
+	if s.hasConst && !reflect.DeepEqual(s.constant, v) {
+		fail("value must be %v", s.constant)
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		for _, name := range s.required {
+			if _, ok := v[name]; !ok {
+				fail("missing required property %q", name)
+			}
+		}
+		for _, name := range slices.Sorted(maps.Keys(v)) {
+			child := at + "/" + escapePointer(name)
+			if p, ok := s.properties[name]; ok {
+				p.validate(v[name], child, errs)
+			} else if s.noExtra {
+				fail("unexpected property %q", name)
+			} else if s.additional != nil {
+				s.additional.validate(v[name], child, errs)
+			}
+		}
+	case []any:
+		if s.minItems != nil && float64(len(v)) < *s.minItems {
+			fail("expected at least %v items, got %d", *s.minItems, len(v))
+		}
+		if s.maxItems != nil && float64(len(v)) > *s.maxItems {
+			fail("expected at most %v items, got %d", *s.maxItems, len(v))
+		}
+		if s.items != nil {
+			for i, item := range v {
+				s.items.validate(item, at+"/"+strconv.Itoa(i), errs)
+			}
+		}
+	case string:
+		n := float64(utf8.RuneCountInString(v))
+		if s.minLength != nil && n < *s.minLength {
+			fail("expected at least %v characters", *s.minLength)
+		}
+		if s.maxLength != nil && n > *s.maxLength {
+			fail("expected at most %v characters", *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail("does not match pattern %q", s.pattern.String())
+		}
+	case float64:
+		if s.minimum != nil && v < *s.minimum {
+			fail("must be at least %v", *s.minimum)
+		}
+		if s.maximum != nil && v > *s.maximum {
+			fail("must be at most %v", *s.maximum)
+		}
+	}
+
+	for _, sub := range s.allOf {
+		sub.validate(v, at, errs)
+	}
+	if s.anyOf != nil && !slices.ContainsFunc(s.anyOf, func(sub *jsonSchema) bool {
+		var subErrs []string
+		sub.validate(v, at, &subErrs)
+		return len(subErrs) == 0
+	}) {
+		fail("value matches none of anyOf")
+	}
+}
+
+func jsonTypeIs(v any, t string) bool {
+	if t == "integer" {
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	}
+	return jsonTypeOf(v) == t
+}
+
+func jsonTypeOf(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func escapePointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
@@ -0,0 +1,210 @@
+package alertiris
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SelfTestCheck is the outcome of one self-test check.
+type SelfTestCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// SelfTestReport lists the checks run against IRIS. OK is set when all of
+// them passed.
+type SelfTestReport struct {
+	OK       bool            `json:"ok"`
+	Duration string          `json:"duration"`
+	Checks   []SelfTestCheck `json:"checks"`
+}
+
+// add records a check, failed when err is set.
+func (r *SelfTestReport) add(name string, err error, detail string) {
+	c := SelfTestCheck{Name: name, OK: err == nil, Detail: detail}
+	if err != nil {
+		c.Detail = err.Error()
+		r.OK = false
+	}
+	r.Checks = append(r.Checks, c)
+}
+
+// irisIDKind is a kind of IRIS object configured by ID and the management
+// endpoint listing them.
+type irisIDKind struct {
+	name      string
+	path      string
+	idField   string
+	nameField string
+}
+
+var (
+	irisCustomers       = irisIDKind{"customer", "/manage/customers/list", "customer_id", "customer_name"}
+	irisAlertStatuses   = irisIDKind{"alert status", "/manage/alert-status/list", "status_id", "status_name"}
+	irisSeverities      = irisIDKind{"severity", "/manage/severities/list", "severity_id", "severity_name"}
+	irisClassifications = irisIDKind{"classification", "/manage/case-classifications/list", "id", "name"}
+	irisResolutions     = irisIDKind{"resolution status", "/manage/alert-resolutions/list", "resolution_status_id", "resolution_status_name"}
+)
+
+// configuredIDs returns the IRIS IDs used by the configuration, each with
+// the settings it comes from.
+func (h *Handler) configuredIDs() map[irisIDKind]map[int][]string {
+	ids := map[irisIDKind]map[int][]string{}
+	add := func(kind irisIDKind, id int, setting string) {
+		if id <= 0 {
+			return
+		}
+		if ids[kind] == nil {
+			ids[kind] = map[int][]string{}
+		}
+		ids[kind][id] = append(ids[kind][id], setting)
+	}
+
+	cfg := h.config
+	add(irisCustomers, cfg.CustomerID, "alerts.customer_id")
+	for group, id := range h.settings().GroupCustomerMap {
+		add(irisCustomers, id, "alerts.group_customer_map."+group)
+	}
+	for i, rule := range cfg.CustomerRules {
+		add(irisCustomers, rule.CustomerID, fmt.Sprintf("alerts.customer_rules[%d]", i))
+		for value, id := range rule.Lookup {
+			add(irisCustomers, id, fmt.Sprintf("alerts.customer_rules[%d].lookup.%s", i, value))
+		}
+	}
+	for name, team := range cfg.Ownership.Teams {
+		add(irisCustomers, team.CustomerID, "alerts.ownership.teams."+name)
+	}
+	for _, r := range h.routes {
+		add(irisCustomers, r.CustomerID, "routes."+r.Name)
+		add(irisResolutions, r.ResolutionStatusID, "routes."+r.Name)
+	}
+
+	add(irisAlertStatuses, cfg.StatusIDNew, "alerts.status_id_new")
+	add(irisAlertStatuses, cfg.StatusIDResolved, "alerts.status_id_resolved")
+	for sev, id := range cfg.StatusIDMap {
+		add(irisAlertStatuses, id, "alerts.status_id_map."+sev)
+	}
+
+	add(irisSeverities, cfg.DefaultSeverityID, "alerts.default_severity_id")
+	for name, id := range h.settings().SeverityMap {
+		add(irisSeverities, id, "alerts.severity_map."+name)
+	}
+	for i, o := range cfg.SeverityOverrides {
+		setting := fmt.Sprintf("alerts.severity_overrides[%d]", i)
+		add(irisSeverities, o.SeverityID, setting)
+		add(irisSeverities, o.MinSeverityID, setting)
+		add(irisSeverities, o.MaxSeverityID, setting)
+	}
+
+	add(irisClassifications, cfg.ClassificationID, "alerts.classification_id")
+	add(irisClassifications, cfg.Enrichment.NVD.ClassificationID, "alerts.enrichment.nvd.classification_id")
+	add(irisResolutions, cfg.ResolutionStatusID, "alerts.resolution_status_id")
+	return ids
+}
+
+// SelfTest checks that IRIS is reachable, accepts the API key and knows the
+// customer, status, severity, classification and resolution status IDs the
+// configuration uses.
+func (h *Handler) SelfTest(ctx context.Context) SelfTestReport {
+	start := time.Now()
+	report := SelfTestReport{OK: true}
+	check := report.add
+
+	s, ok := h.sinks["iris"].(*irisSink)
+	if !ok {
+		check("iris", errors.New("the iris sink is not configured"), "")
+		report.Duration = time.Since(start).String()
+		return report
+	}
+
+	err := s.client.Ping(ctx)
+	var ierr *IRISError
+	switch {
+	case err == nil:
+		check("connectivity", nil, "")
+		check("authentication", nil, "")
+	case errors.As(err, &ierr) && (ierr.StatusCode == http.StatusUnauthorized || ierr.StatusCode == http.StatusForbidden):
+		check("connectivity", nil, "")
+		check("authentication", err, "")
+	default:
+		check("connectivity", err, "")
+	}
+	if err != nil {
+		report.Duration = time.Since(start).String()
+		return report
+	}
+
+	ids := h.configuredIDs()
+	for _, kind := range []irisIDKind{irisCustomers, irisAlertStatuses, irisSeverities, irisClassifications, irisResolutions} {
+		wanted := ids[kind]
+		if len(wanted) == 0 {
+			continue
+		}
+		known, err := s.client.ListIDs(ctx, kind.path, kind.idField, kind.nameField)
+		if err != nil {
+			check(kind.name+" ids", fmt.Errorf("list: %w", err), "")
+			continue
+		}
+		for _, id := range slices.Sorted(maps.Keys(wanted)) {
+			name := kind.name + " " + strconv.Itoa(id)
+			if n, ok := known[id]; ok {
+				check(name, nil, n)
+				continue
+			}
+			check(name, fmt.Errorf("does not exist in IRIS, used by %s", strings.Join(slices.Sorted(slices.Values(wanted[id])), ", ")), "")
+		}
+	}
+	report.Duration = time.Since(start).String()
+	return report
+}
+
+// startupCheck runs the self-test as configured by iris.startup_check. In
+// strict mode a failed check is returned as an error, in lenient mode it is
+// only logged.
+func (h *Handler) startupCheck(ctx context.Context, mode string) error {
+	switch mode {
+	case "off":
+		return nil
+	case "lenient", "strict":
+	default:
+		return fmt.Errorf("unknown iris.startup_check %q", mode)
+	}
+	if _, ok := h.sinks["iris"]; !ok {
+		return nil
+	}
+
+	report := h.SelfTest(ctx)
+	if report.OK {
+		slog.Info("iris startup check passed", "checks", len(report.Checks), "duration", report.Duration)
+		return nil
+	}
+	var failed []string
+	for _, c := range report.Checks {
+		if !c.OK {
+			slog.Error("iris startup check failed", "check", c.Name, "error", c.Detail)
+			failed = append(failed, c.Name+": "+c.Detail)
+		}
+	}
+	if mode == "strict" {
+		return fmt.Errorf("iris startup check failed: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+func (h *Handler) adminSelfTest(w http.ResponseWriter, r *http.Request) {
+	report := h.SelfTest(r.Context())
+	status := http.StatusOK
+	if !report.OK {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, report)
+}
@@ -0,0 +1,250 @@
+package alertiris
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+// settingsPrefix stores the settings changed through the admin API, one key
+// per setting. A stored setting replaces the configured one, also after a
+// restart, until it is reset.
+const settingsPrefix = "admin:settings:"
+
+// Settings are the routing settings that can be changed at runtime.
+type Settings struct {
+	SeverityMap      map[string]int `json:"severity_map"`
+	GroupCustomerMap map[string]int `json:"group_customer_map"`
+	DropRules        []string       `json:"drop_rules"`
+
+	// Changed lists the settings changed at runtime rather than configured.
+	Changed []string `json:"changed"`
+}
+
+var settingNames = []string{"severity_map", "group_customer_map", "drop_rules"}
+
+// settings are the effective runtime settings with the drop rules compiled.
+// They are replaced as a whole, never modified.
+type settings struct {
+	Settings
+	drop []*vm.Program
+}
+
+// settings returns the effective runtime settings.
+func (h *Handler) settings() *settings {
+	return h.runtime.Load()
+}
+
+var errInvalidSetting = errors.New("invalid setting")
+
+func (h *Handler) configuredSettings() Settings {
+	return Settings{
+		SeverityMap:      h.config.SeverityMap,
+		GroupCustomerMap: h.config.GroupCustomerMap,
+		DropRules:        h.config.Transform.DropRules,
+		Changed:          []string{},
+	}
+}
+
+// loadSettings applies the configured settings overridden by those stored.
+func (h *Handler) loadSettings() error {
+	s := h.configuredSettings()
+	err := h.db.View(func(txn *badger.Txn) error {
+		for _, name := range settingNames {
+			item, err := txn.Get([]byte(settingsPrefix + name))
+			if err == badger.ErrKeyNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := item.Value(func(val []byte) error {
+				return s.decode(name, val)
+			}); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			s.Changed = append(s.Changed, name)
+			slog.Info("using setting changed at runtime", "setting", name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	compiled, err := compileSettings(s)
+	if err != nil {
+		return err
+	}
+	h.runtime.Store(compiled)
+	return nil
+}
+
+// decode sets the setting name from its JSON value.
+func (s *Settings) decode(name string, val []byte) error {
+	switch name {
+	case "severity_map":
+		s.SeverityMap = nil
+		return json.Unmarshal(val, &s.SeverityMap)
+	case "group_customer_map":
+		s.GroupCustomerMap = nil
+		return json.Unmarshal(val, &s.GroupCustomerMap)
+	case "drop_rules":
+		s.DropRules = nil
+		return json.Unmarshal(val, &s.DropRules)
+	}
+	return fmt.Errorf("unknown setting %q", name)
+}
+
+func (s *Settings) value(name string) any {
+	switch name {
+	case "severity_map":
+		return s.SeverityMap
+	case "group_customer_map":
+		return s.GroupCustomerMap
+	}
+	return s.DropRules
+}
+
+func compileSettings(s Settings) (*settings, error) {
+	compiled := &settings{Settings: s}
+	for i, rule := range s.DropRules {
+		program, err := compileExpr(rule, expr.AsBool())
+		if err != nil {
+			return nil, fmt.Errorf("%w: drop_rules[%d]: %w", errInvalidSetting, i, err)
+		}
+		if program != nil {
+			compiled.drop = append(compiled.drop, program)
+		}
+	}
+	return compiled, nil
+}
+
+// dropRule returns the first drop rule matching alert, or "".
+func (s *settings) dropRule(alert Alert) (string, error) {
+	if len(s.drop) == 0 {
+		return "", nil
+	}
+	env := newTransformEnv(alert)
+	for i, program := range s.drop {
+		out, err := expr.Run(program, env)
+		if err != nil {
+			return "", fmt.Errorf("drop rule %d: %w", i, err)
+		}
+		if out.(bool) {
+			return program.Source().String(), nil
+		}
+	}
+	return "", nil
+}
+
+// setSetting validates and stores a setting given as JSON, or with a nil
+// val resets it to the configured value.
+func (h *Handler) setSetting(name string, val []byte) error {
+	h.settingsMu.Lock()
+	defer h.settingsMu.Unlock()
+
+	s := h.settings().Settings
+	changed := slices.DeleteFunc(slices.Clone(s.Changed), func(n string) bool { return n == name })
+	if val == nil {
+		configured := h.configuredSettings()
+		switch name {
+		case "severity_map":
+			s.SeverityMap = configured.SeverityMap
+		case "group_customer_map":
+			s.GroupCustomerMap = configured.GroupCustomerMap
+		case "drop_rules":
+			s.DropRules = configured.DropRules
+		}
+	} else {
+		if err := s.decode(name, val); err != nil {
+			return fmt.Errorf("%w: decode %s: %w", errInvalidSetting, name, err)
+		}
+		for key, id := range s.SeverityMap {
+			if id < 1 {
+				return fmt.Errorf("%w: severity_map: %s: id must be at least 1", errInvalidSetting, key)
+			}
+		}
+		for key, id := range s.GroupCustomerMap {
+			if id < 1 {
+				return fmt.Errorf("%w: group_customer_map: %s: id must be at least 1", errInvalidSetting, key)
+			}
+		}
+		changed = append(changed, name)
+	}
+	s.Changed = changed
+	compiled, err := compileSettings(s)
+	if err != nil {
+		return err
+	}
+
+	err = h.db.Update(func(txn *badger.Txn) error {
+		key := []byte(settingsPrefix + name)
+		if val == nil {
+			return txn.Delete(key)
+		}
+		stored, err := json.Marshal(s.value(name))
+		if err != nil {
+			return err
+		}
+		return txn.Set(key, stored)
+	})
+	if err != nil {
+		return err
+	}
+	h.runtime.Store(compiled)
+	slog.Info("setting changed", "setting", name, "reset", val == nil)
+	return nil
+}
+
+func (h *Handler) adminGetSettings(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.settings().Settings)
+}
+
+func (h *Handler) adminGetSetting(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !slices.Contains(settingNames, name) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown setting %q, want one of %s", name, strings.Join(settingNames, ", ")))
+		return
+	}
+	s := h.settings().Settings
+	writeJSON(w, http.StatusOK, s.value(name))
+}
+
+func (h *Handler) adminSetSetting(w http.ResponseWriter, r *http.Request) {
+	var val json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&val); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("decode request: %w", err))
+		return
+	}
+	h.changeSetting(w, r, val)
+}
+
+func (h *Handler) adminResetSetting(w http.ResponseWriter, r *http.Request) {
+	h.changeSetting(w, r, nil)
+}
+
+func (h *Handler) changeSetting(w http.ResponseWriter, r *http.Request, val []byte) {
+	name := r.PathValue("name")
+	if !slices.Contains(settingNames, name) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown setting %q, want one of %s", name, strings.Join(settingNames, ", ")))
+		return
+	}
+	err := h.setSetting(name, val)
+	if errors.Is(err, errInvalidSetting) {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.adminGetSetting(w, r)
+}
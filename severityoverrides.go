@@ -0,0 +1,56 @@
+package alertiris
+
+import "fmt"
+
+// SeverityOverrideConfig changes the IRIS severity of alerts matching
+// Matchers after the severity map and transform have been applied, e.g. to
+// cap everything from a staging environment. SeverityID replaces the
+// severity, MinSeverityID and MaxSeverityID clamp it.
+type SeverityOverrideConfig struct {
+	Matchers      map[string]string `koanf:"matchers"`
+	SeverityID    int               `koanf:"severity_id"`
+	MinSeverityID int               `koanf:"min_severity_id"`
+	MaxSeverityID int               `koanf:"max_severity_id"`
+}
+
+type severityOverride struct {
+	SeverityOverrideConfig
+	matchers Matchers
+}
+
+func newSeverityOverrides(cfgs []SeverityOverrideConfig) ([]*severityOverride, error) {
+	var out []*severityOverride
+	for i, cfg := range cfgs {
+		if len(cfg.Matchers) == 0 {
+			return nil, fmt.Errorf("severity override %d: matchers are required", i)
+		}
+		if cfg.SeverityID == 0 && cfg.MinSeverityID == 0 && cfg.MaxSeverityID == 0 {
+			return nil, fmt.Errorf("severity override %d: severity_id, min_severity_id or max_severity_id is required", i)
+		}
+		m, err := NewMatchers(cfg.Matchers)
+		if err != nil {
+			return nil, fmt.Errorf("severity override %d: %w", i, err)
+		}
+		out = append(out, &severityOverride{SeverityOverrideConfig: cfg, matchers: m})
+	}
+	return out, nil
+}
+
+// overrideSeverity applies every matching override in order.
+func overrideSeverity(overrides []*severityOverride, labels map[string]string, sev int) int {
+	for _, o := range overrides {
+		if !o.matchers.Match(labels) {
+			continue
+		}
+		if o.SeverityID > 0 {
+			sev = o.SeverityID
+		}
+		if o.MinSeverityID > 0 {
+			sev = max(sev, o.MinSeverityID)
+		}
+		if o.MaxSeverityID > 0 {
+			sev = min(sev, o.MaxSeverityID)
+		}
+	}
+	return sev
+}
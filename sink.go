@@ -0,0 +1,332 @@
+package alertiris
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// SinkAlert is the platform independent form of an alert handed to sinks.
+// SeverityID uses the IRIS severity scale; other sinks map it to their own.
+type SinkAlert struct {
+	Fingerprint   string          `json:"fingerprint"`
+	Title         string          `json:"title"`
+	Description   string          `json:"description"`
+	Source        string          `json:"source"`
+	SourceLink    string          `json:"source_link"`
+	EventTime     time.Time       `json:"event_time"`
+	SourceContent json.RawMessage `json:"source_content"`
+	SeverityID    int             `json:"severity_id"`
+	CustomerID    int             `json:"customer_id"`
+	Tags          []string        `json:"tags"`
+	Alert         Alert           `json:"alert"`
+
+	// Origin is the webhook source the alert arrived through, "alertmanager"
+	// or a plugin name, and ReceivedAt when.
+	Origin     string    `json:"origin,omitempty"`
+	ReceivedAt time.Time `json:"received_at,omitzero"`
+	// RequestID ties the alert to the bridge's logs of the webhook request
+	// it came in with.
+	RequestID string `json:"request_id,omitempty"`
+
+	// IOCs are the indicators found in the alert when IOC extraction is
+	// enabled.
+	IOCs []IOC `json:"iocs,omitempty"`
+	// Assets are created along with the IRIS alert.
+	Assets []IRISAssetRequest `json:"-"`
+
+	// Route is the name of the matched route.
+	Route string `json:"route,omitempty"`
+	// EscalationPolicy is the escalation policy of the matched route.
+	EscalationPolicy string `json:"escalation_policy,omitempty"`
+
+	// Team is the team owning the alert and OwnerID the IRIS user new
+	// alerts are assigned to.
+	Team    string `json:"team,omitempty"`
+	OwnerID int    `json:"owner_id,omitempty"`
+
+	// ClassificationID overrides the configured IRIS classification when
+	// set.
+	ClassificationID int `json:"classification_id,omitempty"`
+
+	// ResolvedAction is the resolved action of the matched route, if set.
+	ResolvedAction string `json:"resolved_action,omitempty"`
+	// ResolutionStatusID is the resolution status of the matched route, if
+	// set.
+	ResolutionStatusID int `json:"resolution_status_id,omitempty"`
+
+	// Note is the IRIS alert note on create and replaces it on update when
+	// set.
+	Note string `json:"-"`
+}
+
+// validateResolvedAction checks a resolved_action value. "update" sets the
+// resolved status, "close" does so and notes the resolution on the alert,
+// "delete" deletes the alert and "none" leaves it open.
+func validateResolvedAction(action string) error {
+	switch action {
+	case "update", "close", "delete", "none":
+		return nil
+	}
+	return fmt.Errorf(`resolved_action must be "update", "close", "delete" or "none", got %q`, action)
+}
+
+type Sink interface {
+	Name() string
+	Create(ctx context.Context, a *SinkAlert) (string, error)
+	Update(ctx context.Context, id string, a *SinkAlert) error
+	Resolve(ctx context.Context, id string, a *SinkAlert) error
+}
+
+// NewSinks builds every sink referenced by alerts.sinks or a route. Names
+// other than the built-in sinks refer to notifiers.
+func NewSinks(cfg Config, notifier *Notifier) (map[string]Sink, error) {
+	if len(cfg.Alerts.Sinks) == 0 {
+		return nil, fmt.Errorf("no sinks configured")
+	}
+	names := slices.Clone(cfg.Alerts.Sinks)
+	for _, r := range cfg.Routes {
+		names = append(names, r.Sinks...)
+	}
+
+	sinks := make(map[string]Sink)
+	for _, name := range names {
+		if _, ok := sinks[name]; ok {
+			continue
+		}
+
+		switch name {
+		case "iris":
+			if err := validateFaults(cfg.IRIS.Faults); err != nil {
+				return nil, fmt.Errorf("iris faults: %w", err)
+			}
+			sinks[name] = newIRISSink(NewIRISClient(cfg.IRIS), cfg.Alerts)
+		case "thehive":
+			s, err := newTheHiveSink(cfg.TheHive)
+			if err != nil {
+				return nil, fmt.Errorf("thehive: %w", err)
+			}
+			sinks[name] = s
+		case "file":
+			s, err := newFileSink(cfg.FileSink)
+			if err != nil {
+				return nil, fmt.Errorf("file sink: %w", err)
+			}
+			sinks[name] = s
+		default:
+			s, ok := notifier.sink(name)
+			if !ok {
+				return nil, fmt.Errorf("unknown sink %q", name)
+			}
+			sinks[name] = s
+		}
+	}
+	return sinks, nil
+}
+
+type irisSink struct {
+	client *IRISClient
+	config AlertConfig
+}
+
+func newIRISSink(client *IRISClient, config AlertConfig) *irisSink {
+	return &irisSink{client: client, config: config}
+}
+
+func (s *irisSink) Name() string {
+	return "iris"
+}
+
+func (s *irisSink) Create(ctx context.Context, a *SinkAlert) (string, error) {
+	req := IRISAlertRequest{
+		Title:            a.Title,
+		Description:      a.Description,
+		Source:           a.Source,
+		SourceRef:        a.Fingerprint,
+		SourceLink:       a.SourceLink,
+		SourceEventTime:  a.EventTime.Format(time.RFC3339),
+		SourceContent:    a.SourceContent,
+		SeverityID:       a.SeverityID,
+		StatusID:         s.statusID(a.SeverityID),
+		CustomerID:       a.CustomerID,
+		ClassificationID: cmp.Or(a.ClassificationID, s.config.ClassificationID),
+		Tags:             strings.Join(a.Tags, ","),
+		IOCs:             s.config.IOCs.iocRequests(a.IOCs),
+		Note:             a.Note,
+		Assets:           a.Assets,
+		OwnerID:          a.OwnerID,
+	}
+
+	alertID, err := s.client.CreateAlert(ctx, req, a.CustomerID)
+	if err != nil {
+		return "", err
+	}
+	return strconv.Itoa(alertID), nil
+}
+
+func (s *irisSink) statusID(severityID int) int {
+	if id, ok := s.config.StatusIDMap[strconv.Itoa(severityID)]; ok {
+		return id
+	}
+	return s.config.StatusIDNew
+}
+
+func (s *irisSink) Update(ctx context.Context, id string, a *SinkAlert) error {
+	alertID, err := strconv.Atoi(id)
+	if err != nil {
+		return fmt.Errorf("invalid iris alert id %q: %w", id, err)
+	}
+
+	desc := a.Description
+	eventTime := a.EventTime.Format(time.RFC3339)
+	sevID := a.SeverityID
+	tags := strings.Join(a.Tags, ",")
+
+	req := IRISAlertUpdateRequest{
+		Description:     &desc,
+		SourceEventTime: &eventTime,
+		SourceContent:   a.SourceContent,
+		SeverityID:      &sevID,
+		Tags:            &tags,
+	}
+	if a.Note != "" {
+		req.Note = &a.Note
+	}
+	return s.client.UpdateAlert(ctx, alertID, req, a.CustomerID)
+}
+
+func (s *irisSink) Resolve(ctx context.Context, id string, a *SinkAlert) error {
+	alertID, err := strconv.Atoi(id)
+	if err != nil {
+		return fmt.Errorf("invalid iris alert id %q: %w", id, err)
+	}
+
+	action := s.config.ResolvedAction
+	if a.ResolvedAction != "" {
+		action = a.ResolvedAction
+	}
+	switch action {
+	case "delete":
+		return s.client.DeleteAlert(ctx, alertID, a.CustomerID)
+	case "none":
+		return nil
+	}
+
+	statusID := s.config.StatusIDResolved
+	req := IRISAlertUpdateRequest{
+		StatusID: &statusID,
+	}
+	resolutionID := s.config.ResolutionStatusID
+	if a.ResolutionStatusID > 0 {
+		resolutionID = a.ResolutionStatusID
+	}
+	if resolutionID > 0 {
+		req.ResolutionStatusID = &resolutionID
+	}
+	if err := s.client.UpdateAlert(ctx, alertID, req, a.CustomerID); err != nil {
+		return err
+	}
+	if action == "close" {
+		resolvedAt := a.Alert.EndsAt
+		if resolvedAt.IsZero() {
+			resolvedAt = time.Now()
+		}
+		line := fmt.Sprintf("[%s] Resolved in %s", resolvedAt.UTC().Format(time.RFC3339), a.Source)
+		if err := appendNote(ctx, s.client, alertID, a.CustomerID, line); err != nil {
+			return fmt.Errorf("note resolution: %w", err)
+		}
+	}
+	return nil
+}
+
+func (h *Handler) sinkIDs(fingerprint string, customerID int) (map[string]string, error) {
+	states, err := h.alertStates(fingerprint, customerID)
+	ids := make(map[string]string, len(states))
+	for name, st := range states {
+		ids[name] = st.AlertID
+	}
+	return ids, err
+}
+
+func (h *Handler) deleteSinkID(sink, fingerprint string, customerID int) error {
+	return h.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(mappingKey(sink, fingerprint, customerID))
+	})
+}
+
+// mappingKey keeps the original "fp:" keys for IRIS so existing databases
+// continue to work.
+func mappingKey(sink, fingerprint string, customerID int) []byte {
+	if sink == "iris" {
+		return dbKey(fingerprint, customerID)
+	}
+	return []byte("sink:" + sink + ":" + fingerprint + ":" + strconv.Itoa(customerID))
+}
+
+func dbKey(fingerprint string, customerID int) []byte {
+	return []byte("fp:" + fingerprint + ":" + strconv.Itoa(customerID))
+}
+
+type FileSinkConfig struct {
+	Path string `koanf:"path"`
+}
+
+// fileSink appends every action as a JSON line, keeping a local archive of
+// what was delivered.
+type fileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+type fileSinkRecord struct {
+	Time   time.Time  `json:"time"`
+	Action string     `json:"action"`
+	Alert  *SinkAlert `json:"alert"`
+}
+
+func newFileSink(cfg FileSinkConfig) (*fileSink, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("path is required")
+	}
+	f, err := os.OpenFile(cfg.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSink{file: f}, nil
+}
+
+func (s *fileSink) Name() string {
+	return "file"
+}
+
+func (s *fileSink) Create(ctx context.Context, a *SinkAlert) (string, error) {
+	return a.Fingerprint, s.write("create", a)
+}
+
+func (s *fileSink) Update(ctx context.Context, id string, a *SinkAlert) error {
+	return s.write("update", a)
+}
+
+func (s *fileSink) Resolve(ctx context.Context, id string, a *SinkAlert) error {
+	return s.write("resolve", a)
+}
+
+func (s *fileSink) write(action string, a *SinkAlert) error {
+	line, err := json.Marshal(fileSinkRecord{Time: time.Now(), Action: action, Alert: a})
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.file.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,127 @@
+package alertiris
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// SmokeTest sends a synthetic alert through the pipeline, firing and then
+// resolved, and checks in IRIS that it was created and closed as
+// alerts.resolved_action says. The alert and its mappings are deleted
+// afterwards, pass or fail.
+func (a *App) SmokeTest(ctx context.Context) SelfTestReport {
+	return a.handler.smokeTest(ctx)
+}
+
+func (h *Handler) smokeTest(ctx context.Context) (report SelfTestReport) {
+	start := time.Now()
+	report = SelfTestReport{OK: true}
+	s, ok := h.sinks["iris"].(*irisSink)
+	if !ok {
+		report.add("iris", errors.New("the iris sink is not configured"), "")
+		report.Duration = time.Since(start).String()
+		return report
+	}
+
+	req := testAlertRequest{
+		Labels:      map[string]string{"alertname": "AlertirisSelfTest", "alertiris_selftest": newRequestID()},
+		Annotations: map[string]string{"summary": "End-to-end self-test of alertiris, deleted once it completes"},
+	}
+	firing := testPayload(req, time.Now())
+	fp := firing.Alerts[0].Fingerprint
+	slog.Info("running end-to-end self-test", "fingerprint", fp)
+
+	var alertID, customerID int
+	defer func() {
+		report.add("cleanup", h.smokeCleanup(ctx, s, fp, alertID, customerID), "")
+		report.Duration = time.Since(start).String()
+	}()
+
+	if err := h.processAlerts(ctx, firing.Alerts, "alertmanager", "", h.config.CustomerID); err != nil {
+		report.add("create", err, "")
+		return report
+	}
+	mappings, err := ListMappings(h.db, fp)
+	if err != nil {
+		report.add("create", err, "")
+		return report
+	}
+	for _, m := range mappings {
+		if m.Sink == "iris" {
+			alertID, _ = strconv.Atoi(m.AlertID)
+			customerID = m.CustomerID
+		}
+	}
+	if alertID == 0 {
+		report.add("create", errors.New("no iris alert was created, check the routes, filters and occurrence settings"), "")
+		return report
+	}
+	alert, err := s.client.GetAlert(ctx, alertID, customerID)
+	if err != nil {
+		report.add("create", fmt.Errorf("get alert %d: %w", alertID, err), "")
+		return report
+	}
+	report.add("create", nil, fmt.Sprintf("alert %d: %s", alertID, alert.Title))
+
+	req.Status = "resolved"
+	resolved := testPayload(req, time.Now())
+	if err := h.processAlerts(ctx, resolved.Alerts, "alertmanager", "", h.config.CustomerID); err != nil {
+		report.add("resolve", err, "")
+		return report
+	}
+	switch s.config.ResolvedAction {
+	case "none":
+		report.add("resolve", nil, "not checked, alerts.resolved_action is none")
+	case "delete":
+		_, err := s.client.GetAlert(ctx, alertID, customerID)
+		var ierr *IRISError
+		switch {
+		case errors.As(err, &ierr) && ierr.StatusCode == http.StatusNotFound:
+			report.add("resolve", nil, fmt.Sprintf("alert %d deleted", alertID))
+			alertID = 0
+		case err != nil:
+			report.add("resolve", fmt.Errorf("get alert %d: %w", alertID, err), "")
+		default:
+			report.add("resolve", fmt.Errorf("alert %d was not deleted", alertID), "")
+		}
+	default:
+		alert, err := s.client.GetAlert(ctx, alertID, customerID)
+		switch {
+		case err != nil:
+			report.add("resolve", fmt.Errorf("get alert %d: %w", alertID, err), "")
+		case alert.StatusID != s.config.StatusIDResolved:
+			report.add("resolve", fmt.Errorf("alert %d has status %d, want %d", alertID, alert.StatusID, s.config.StatusIDResolved), "")
+		default:
+			report.add("resolve", nil, fmt.Sprintf("alert %d has status %d", alertID, alert.StatusID))
+		}
+	}
+	return report
+}
+
+// smokeCleanup deletes the self-test alert from IRIS, if one was created
+// and is still there, and forgets its mappings and retries.
+func (h *Handler) smokeCleanup(ctx context.Context, s *irisSink, fp string, alertID, customerID int) error {
+	var errs []error
+	if alertID != 0 {
+		err := s.client.DeleteAlert(ctx, alertID, customerID)
+		var ierr *IRISError
+		if err != nil && !(errors.As(err, &ierr) && ierr.StatusCode == http.StatusNotFound) {
+			errs = append(errs, fmt.Errorf("delete alert %d: %w", alertID, err))
+		}
+	}
+	if _, err := DeleteMappings(h.db, fp, "", 0); err != nil {
+		errs = append(errs, fmt.Errorf("delete mappings: %w", err))
+	}
+	if customerID == 0 {
+		customerID = h.config.CustomerID
+	}
+	for name := range h.sinks {
+		h.clearRetry(name, fp, customerID)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,134 @@
+package alertiris
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+)
+
+// SourceRegistry serves each ingestion format under its own path,
+// /webhook/<name>. Built-in formats and plugins register with it.
+type SourceRegistry struct {
+	sources map[string]http.Handler
+	tokens  map[[32]byte]*URLTokenConfig
+	auth    map[string]EndpointAuthConfig
+
+	// middleware wraps the sources inside authentication; maxBody limits
+	// request bodies.
+	middleware []func(http.Handler) http.Handler
+	maxBody    int64
+}
+
+func NewSourceRegistry() *SourceRegistry {
+	return &SourceRegistry{sources: make(map[string]http.Handler), tokens: make(map[[32]byte]*URLTokenConfig)}
+}
+
+// Register serves h at /webhook/<name>. Names are unique.
+func (s *SourceRegistry) Register(name string, h http.Handler) error {
+	if _, ok := s.sources[name]; ok {
+		return fmt.Errorf("source %q is already registered", name)
+	}
+	s.sources[name] = h
+	return nil
+}
+
+// Names returns the registered sources in order.
+func (s *SourceRegistry) Names() []string {
+	return slices.Sorted(maps.Keys(s.sources))
+}
+
+// Has reports whether name is a registered source or URL token name.
+func (s *SourceRegistry) Has(name string) bool {
+	if s.sources[name] != nil {
+		return true
+	}
+	for _, t := range s.tokens {
+		if t.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// SetAuth requires authentication of the sources and URL tokens named in
+// auth, which must be registered first.
+func (s *SourceRegistry) SetAuth(auth map[string]EndpointAuthConfig, server ServerConfig) error {
+	for name, cfg := range auth {
+		if !s.Has(name) {
+			return fmt.Errorf("%s: unknown source or token", name)
+		}
+		if err := validateEndpointAuth(cfg, server); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	s.auth = auth
+	return nil
+}
+
+// Use wraps every source in mw. Middleware runs after authentication, so it
+// only sees requests that passed it, with URL tokens resolved to their
+// source. The first added runs first.
+func (s *SourceRegistry) Use(mw func(http.Handler) http.Handler) {
+	s.middleware = append(s.middleware, mw)
+}
+
+// SetBodyLimit refuses webhook bodies larger than n bytes. Zero is
+// unlimited.
+func (s *SourceRegistry) SetBodyLimit(n int64) {
+	s.maxBody = n
+}
+
+// serve passes r to the source name through the middleware.
+func (s *SourceRegistry) serve(name string, w http.ResponseWriter, r *http.Request) {
+	h := s.sources[name]
+	for i := len(s.middleware) - 1; i >= 0; i-- {
+		h = s.middleware[i](h)
+	}
+	h.ServeHTTP(w, r)
+}
+
+// ServeHTTP dispatches on the {source} path value, which is a source name
+// or a URL token.
+func (s *SourceRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.maxBody > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, s.maxBody)
+	}
+	name := r.PathValue("source")
+	if _, ok := s.sources[name]; ok {
+		if info := requestInfoFrom(r.Context()); info != nil {
+			info.source = name
+		}
+		if auth, ok := s.auth[name]; ok && !requireAuth(name, auth, w, r) {
+			return
+		}
+		s.serve(name, w, r)
+		return
+	}
+	if !s.serveToken(w, r) {
+		http.NotFound(w, r)
+	}
+}
+
+// sourceAlias serves a fixed source through h, for /webhook which predates
+// the registry and stays the Alertmanager endpoint.
+func sourceAlias(name string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.SetPathValue("source", name)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// HandleGrafanaWebhook serves Grafana's webhook contact point, which sends
+// Alertmanager's payload format with its own version.
+func (h *Handler) HandleGrafanaWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	payload, ok := readPayload(w, r, grafanaPayloadVersion)
+	if !ok {
+		return
+	}
+	h.accept(w, r, payload.Alerts, "grafana", r.URL.Query().Get("group"), h.config.CustomerID)
+}
@@ -0,0 +1,101 @@
+package alertiris
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// SourceContentConfig limits the size of the alert_source_content sent to
+// IRIS. Values longer than MaxValueBytes are truncated and DropAnnotations
+// are left out. Content still larger than MaxBytes is gzip compressed with
+// Compress, or else loses its largest annotations until it fits.
+type SourceContentConfig struct {
+	MaxValueBytes   int      `koanf:"max_value_bytes"`
+	MaxBytes        int      `koanf:"max_bytes"`
+	DropAnnotations []string `koanf:"drop_annotations"`
+	Compress        bool     `koanf:"compress"`
+}
+
+// droppedAnnotation lists the annotations left out to fit MaxBytes.
+const droppedAnnotation = "alertiris_dropped_annotations"
+
+// compressedContent replaces source content that was compressed to fit.
+type compressedContent struct {
+	Encoding string `json:"encoding"`
+	Content  string `json:"content"`
+}
+
+func (h *Handler) sourceContent(alert Alert) json.RawMessage {
+	cfg := h.config.SourceContent
+	alert.Labels = maps.Clone(alert.Labels)
+	alert.Annotations = maps.Clone(alert.Annotations)
+	for _, name := range cfg.DropAnnotations {
+		delete(alert.Annotations, name)
+	}
+	if cfg.MaxValueBytes > 0 {
+		truncateValues(alert.Labels, cfg.MaxValueBytes)
+		truncateValues(alert.Annotations, cfg.MaxValueBytes)
+	}
+
+	content, _ := json.Marshal(alert)
+	if cfg.MaxBytes <= 0 || len(content) <= cfg.MaxBytes {
+		return content
+	}
+	if cfg.Compress {
+		if c, err := compressContent(content); err == nil && len(c) <= cfg.MaxBytes {
+			return c
+		}
+	}
+
+	// Drop the largest annotations first.
+	names := slices.Collect(maps.Keys(alert.Annotations))
+	slices.SortFunc(names, func(a, b string) int {
+		return len(alert.Annotations[b]) - len(alert.Annotations[a])
+	})
+	var dropped []string
+	for _, name := range names {
+		delete(alert.Annotations, name)
+		dropped = append(dropped, name)
+		alert.Annotations[droppedAnnotation] = strings.Join(dropped, ",")
+		content, _ = json.Marshal(alert)
+		if len(content) <= cfg.MaxBytes {
+			break
+		}
+	}
+	return content
+}
+
+func truncateValues(m map[string]string, limit int) {
+	for k, v := range m {
+		if len(v) <= limit {
+			continue
+		}
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(v[cut]) {
+			cut--
+		}
+		m[k] = v[:cut] + fmt.Sprintf("...[truncated %d bytes]", len(v)-cut)
+	}
+}
+
+func compressContent(content []byte) (json.RawMessage, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(content); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(compressedContent{
+		Encoding: "gzip+base64",
+		Content:  base64.StdEncoding.EncodeToString(buf.Bytes()),
+	})
+}
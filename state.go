@@ -0,0 +1,113 @@
+package alertiris
+
+import (
+	"bytes"
+	"encoding/json"
+	"maps"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// AlertState is what was last delivered to a sink for a fingerprint. It is
+// the value of the mapping keys, so it lives as long as the sink's alert is
+// open.
+type AlertState struct {
+	AlertID     string            `json:"alert_id"`
+	Source      string            `json:"source,omitempty"`
+	Status      string            `json:"status,omitempty"`
+	SeverityID  int               `json:"severity_id,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	StartsAt    time.Time         `json:"starts_at,omitzero"`
+	EndsAt      time.Time         `json:"ends_at,omitzero"`
+
+	// CreatedAt is when the sink's alert was created and UpdatedAt when it
+	// was last updated, Updates times since.
+	CreatedAt time.Time `json:"created_at,omitzero"`
+	UpdatedAt time.Time `json:"updated_at,omitzero"`
+	Updates   int       `json:"updates"`
+}
+
+// parseAlertState decodes a mapping value. Schema version 1 stored the bare
+// alert ID, which is still accepted.
+func parseAlertState(val []byte) (AlertState, error) {
+	if !bytes.HasPrefix(val, []byte("{")) {
+		return AlertState{AlertID: string(val)}, nil
+	}
+	var st AlertState
+	err := json.Unmarshal(val, &st)
+	return st, err
+}
+
+// alertStateFromID upgrades bare alert IDs to AlertState values.
+func alertStateFromID(key, val []byte) ([]byte, []byte, error) {
+	st, err := parseAlertState(val)
+	if err != nil {
+		return nil, nil, err
+	}
+	val, err = json.Marshal(st)
+	return key, val, err
+}
+
+func (h *Handler) alertStates(fingerprint string, customerID int) (map[string]AlertState, error) {
+	states := make(map[string]AlertState)
+	err := h.db.View(func(txn *badger.Txn) error {
+		for _, name := range h.sinkNames {
+			item, err := txn.Get(mappingKey(name, fingerprint, customerID))
+			if err == badger.ErrKeyNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := item.Value(func(val []byte) error {
+				st, err := parseAlertState(val)
+				states[name] = st
+				return err
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return states, err
+}
+
+// storeAlertState records that sa was delivered to the sink's alert id,
+// keeping the creation time and counting updates of an existing alert.
+func (h *Handler) storeAlertState(sink, fingerprint string, customerID int, id string, sa *SinkAlert) error {
+	key := mappingKey(sink, fingerprint, customerID)
+	now := time.Now()
+	return h.db.Update(func(txn *badger.Txn) error {
+		st := AlertState{AlertID: id, CreatedAt: now}
+		item, err := txn.Get(key)
+		if err != nil && err != badger.ErrKeyNotFound {
+			return err
+		}
+		if err == nil {
+			if err := item.Value(func(val []byte) error {
+				prev, err := parseAlertState(val)
+				if err != nil {
+					return err
+				}
+				st.CreatedAt, st.Updates, st.UpdatedAt = prev.CreatedAt, prev.Updates+1, now
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+		st.Source = sa.Origin
+		st.Status = sa.Alert.Status
+		st.SeverityID = sa.SeverityID
+		st.Labels = maps.Clone(sa.Alert.Labels)
+		st.Annotations = maps.Clone(sa.Alert.Annotations)
+		st.StartsAt = sa.Alert.StartsAt
+		st.EndsAt = sa.Alert.EndsAt
+		val, err := json.Marshal(st)
+		if err != nil {
+			return err
+		}
+		return txn.Set(key, val)
+	})
+}
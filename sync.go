@@ -0,0 +1,169 @@
+package alertiris
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+var (
+	ErrNoPayload       = errors.New("no payload stored for fingerprint")
+	ErrSeveralPayloads = errors.New("payloads stored for several customers, pick one with customer")
+)
+
+// lastPayload is the most recent alert received for a fingerprint, as it
+// entered the pipeline.
+type lastPayload struct {
+	Alert      Alert     `json:"alert"`
+	Source     string    `json:"source"`
+	Group      string    `json:"group"`
+	CustomerID int       `json:"customer_id"`
+	Tags       []string  `json:"tags,omitempty"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// lastPayloadKey is keyed by customer like mappingKey, so the same alert
+// sent for two customers keeps a payload for each.
+func lastPayloadKey(fingerprint string, customerID int) []byte {
+	return []byte("last:" + fingerprint + ":" + strconv.Itoa(customerID))
+}
+
+// encodeLastPayload encodes the alert of ev as it enters the pipeline,
+// redacted so the store holds no secrets. A sync runs it through the
+// pipeline, redaction included, again.
+func (h *Handler) encodeLastPayload(ev *Event) ([]byte, error) {
+	return json.Marshal(lastPayload{
+		Alert:      h.redactor.Apply(ev.Alert),
+		Source:     ev.Source,
+		Group:      ev.Group,
+		CustomerID: ev.CustomerID,
+		Tags:       ev.Tags,
+		ReceivedAt: ev.ReceivedAt,
+	})
+}
+
+// storeLastPayload keeps an encoded payload under the customer routing
+// resolved for it, which its mappings are stored under too, so that a
+// recreating sync drops them.
+func (h *Handler) storeLastPayload(fingerprint string, customerID int, val []byte) error {
+	return h.db.Update(func(txn *badger.Txn) error {
+		e := badger.NewEntry(lastPayloadKey(fingerprint, customerID), val)
+		if h.config.LastPayloadTTL > 0 {
+			e = e.WithTTL(h.config.LastPayloadTTL)
+		}
+		return txn.SetEntry(e)
+	})
+}
+
+// loadLastPayload returns the last payload of a fingerprint for a customer
+// and the customer it is stored under. With customerID zero, it returns the
+// only payload stored for the fingerprint.
+func (h *Handler) loadLastPayload(fingerprint string, customerID int) (lastPayload, int, error) {
+	var p lastPayload
+	err := h.db.View(func(txn *badger.Txn) error {
+		if customerID == 0 {
+			opts := badger.DefaultIteratorOptions
+			opts.PrefetchValues = false
+			opts.Prefix = []byte("last:" + fingerprint + ":")
+			it := txn.NewIterator(opts)
+			defer it.Close()
+			found := false
+			for it.Rewind(); it.Valid(); it.Next() {
+				id, err := strconv.Atoi(strings.TrimPrefix(string(it.Item().Key()), string(opts.Prefix)))
+				if err != nil {
+					continue
+				}
+				if found {
+					return ErrSeveralPayloads
+				}
+				customerID, found = id, true
+			}
+		}
+		item, err := txn.Get(lastPayloadKey(fingerprint, customerID))
+		if err == badger.ErrKeyNotFound {
+			return ErrNoPayload
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &p)
+		})
+	})
+	return p, customerID, err
+}
+
+// forceSync runs the last payload of a fingerprint through the pipeline
+// again, bypassing the occurrence threshold and maintenance mode. customerID
+// picks the payload when the fingerprint has one for several customers. With
+// recreate set, the customer's existing mappings (of one sink, or all when
+// sink is empty) are dropped first so the alert is created anew.
+func (h *Handler) forceSync(ctx context.Context, fingerprint, sink string, customerID int, recreate bool) ([]Mapping, error) {
+	p, customerID, err := h.loadLastPayload(fingerprint, customerID)
+	if err != nil {
+		return nil, err
+	}
+	if recreate {
+		deleted, err := DeleteMappings(h.db, fingerprint, sink, customerID)
+		if err != nil {
+			return nil, fmt.Errorf("delete mappings: %w", err)
+		}
+		slog.Info("dropped mappings for recreate", "fingerprint", fingerprint, "count", len(deleted))
+	}
+
+	slog.Info("force syncing alert", "fingerprint", fingerprint, "customer_id", customerID, "status", p.Alert.Status, "recreate", recreate)
+	ev := &Event{
+		Alert:      p.Alert,
+		Source:     p.Source,
+		Group:      p.Group,
+		CustomerID: p.CustomerID,
+		Tags:       p.Tags,
+		ReceivedAt: time.Now(),
+		RequestID:  processingID(ctx),
+		Force:      true,
+	}
+	if err := h.pipeline.Run(ctx, ev); err != nil {
+		return nil, err
+	}
+	return ListMappings(h.db, fingerprint)
+}
+
+func (h *Handler) adminSync(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var customerID int
+	if c := q.Get("customer"); c != "" {
+		var err error
+		if customerID, err = strconv.Atoi(c); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid customer: %w", err))
+			return
+		}
+	}
+	mappings, err := h.forceSync(r.Context(), r.PathValue("fingerprint"), q.Get("sink"), customerID, q.Get("recreate") == "true")
+	if errors.Is(err, ErrNoPayload) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if errors.Is(err, ErrSeveralPayloads) {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, mappings)
+}
+
+// Sync forces the last known payload of a fingerprint through the pipeline.
+// See the sync admin endpoint.
+func (a *App) Sync(ctx context.Context, fingerprint, sink string, customerID int, recreate bool) ([]Mapping, error) {
+	return a.handler.forceSync(ctx, fingerprint, sink, customerID, recreate)
+}
@@ -0,0 +1,136 @@
+package alertiris
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// TagsConfig controls how alerts become IRIS tags. Labels lists the labels
+// added as tags, as "name=value" or, with Format "value", the value alone.
+// Prefixes maps a webhook source, "alertmanager" or a plugin name, to a
+// prefix for the tags derived from its alerts, e.g. "am:". Max caps the tags
+// of an alert, keeping the first; zero is unlimited.
+//
+// Tags are then normalized: Lowercase lowercases them, Sanitize replaces
+// whitespace and characters other than ASCII letters, digits and "-_.:=/"
+// with Replacement, and MaxLength truncates them. Tags that end up the same
+// are sent once.
+type TagsConfig struct {
+	Labels   []string          `koanf:"labels"`
+	Format   string            `koanf:"format"`
+	Prefixes map[string]string `koanf:"prefixes"`
+	Max      int               `koanf:"max"`
+
+	Lowercase   bool   `koanf:"lowercase"`
+	Sanitize    bool   `koanf:"sanitize"`
+	Replacement string `koanf:"replacement"`
+	MaxLength   int    `koanf:"max_length"`
+}
+
+func validateTags(cfg TagsConfig) error {
+	switch cfg.Format {
+	case "key=value", "value":
+	default:
+		return fmt.Errorf("format must be key=value or value, got %q", cfg.Format)
+	}
+	switch {
+	case cfg.Max < 0:
+		return fmt.Errorf("max must not be negative")
+	case cfg.MaxLength < 0:
+		return fmt.Errorf("max_length must not be negative")
+	case strings.ContainsFunc(cfg.Replacement, func(r rune) bool { return !tagRune(r) }):
+		return fmt.Errorf("replacement %q contains characters a sanitized tag may not", cfg.Replacement)
+	}
+	return nil
+}
+
+// labelTags returns the tags for the configured labels of alert, skipping
+// labels it does not have.
+func (c TagsConfig) labelTags(alert Alert) []string {
+	var tags []string
+	for _, name := range c.Labels {
+		val := alert.Labels[name]
+		if val == "" {
+			continue
+		}
+		if c.Format == "value" {
+			tags = append(tags, val)
+		} else {
+			tags = append(tags, name+"="+val)
+		}
+	}
+	return tags
+}
+
+// prefix prefixes the tags of an alert from source, leaving those already
+// prefixed alone.
+func (c TagsConfig) prefix(source string, tags []string) []string {
+	p := c.Prefixes[source]
+	if p == "" {
+		return tags
+	}
+	out := make([]string, len(tags))
+	for i, tag := range tags {
+		if !strings.HasPrefix(tag, p) {
+			tag = p + tag
+		}
+		out[i] = tag
+	}
+	return out
+}
+
+// finish normalizes tags, then drops duplicates and those over Max.
+func (c TagsConfig) finish(tags []string) []string {
+	var out []string
+	for _, tag := range tags {
+		tag = c.normalize(tag)
+		if tag != "" && !slices.Contains(out, tag) {
+			out = append(out, tag)
+		}
+	}
+	if c.Max > 0 && len(out) > c.Max {
+		out = out[:c.Max]
+	}
+	return out
+}
+
+// tagRune reports whether r may appear in a sanitized tag. Commas never
+// may, as IRIS stores tags comma separated.
+func tagRune(r rune) bool {
+	return r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("-_.:=/", r))
+}
+
+func (c TagsConfig) normalize(tag string) string {
+	tag = strings.TrimSpace(tag)
+	if c.Lowercase {
+		tag = strings.ToLower(tag)
+	}
+	if c.Sanitize {
+		var b strings.Builder
+		replaced := false
+		for _, r := range tag {
+			if tagRune(r) {
+				b.WriteRune(r)
+				replaced = false
+				continue
+			}
+			// A run of replaced characters, such as ", ", is replaced once.
+			if !replaced {
+				b.WriteString(c.Replacement)
+				replaced = true
+			}
+		}
+		tag = b.String()
+	}
+	if c.MaxLength > 0 {
+		if r := []rune(tag); len(r) > c.MaxLength {
+			tag = string(r[:c.MaxLength])
+		}
+	}
+	if c.Sanitize && c.Replacement != "" {
+		tag = strings.TrimSuffix(strings.TrimPrefix(tag, c.Replacement), c.Replacement)
+	}
+	return tag
+}
@@ -0,0 +1,422 @@
+package alertiris
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+)
+
+// templateFuncs returns the functions available in the alert templates: the
+// commonly used part of the Sprig library (https://masterminds.github.io/sprig/)
+// with the same names and argument order, so the value being worked on comes
+// last and can be piped in, e.g. {{ .Labels.instance | trimSuffix ":9100" }}.
+func templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		// Strings
+		"upper":      strings.ToUpper,
+		"lower":      strings.ToLower,
+		"title":      titleCase,
+		"trim":       strings.TrimSpace,
+		"trimAll":    func(cutset, s string) string { return strings.Trim(s, cutset) },
+		"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+		"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+		"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+		"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+		"repeat":     func(n int, s string) string { return strings.Repeat(s, max(n, 0)) },
+		"substr":     substr,
+		"trunc":      trunc,
+		"abbrev":     abbrev,
+		"quote":      func(v ...any) string { return joinFormatted(v, "%q") },
+		"squote":     func(v ...any) string { return joinFormatted(v, "'%v'") },
+		"cat":        func(v ...any) string { return joinFormatted(v, "%v") },
+		"indent":     indent,
+		"nindent":    func(n int, s string) string { return "\n" + indent(n, s) },
+		"splitList":  func(sep, s string) []string { return strings.Split(s, sep) },
+		"join":       join,
+		"toString":   func(v any) string { return fmt.Sprint(v) },
+
+		// Regular expressions
+		"regexMatch":      func(re, s string) (bool, error) { return regexp.MatchString(re, s) },
+		"regexFind":       regexFind,
+		"regexReplaceAll": regexReplaceAll,
+
+		// Defaults and conditions
+		"default":  defaultValue,
+		"empty":    empty,
+		"coalesce": coalesce,
+		"ternary": func(vtrue, vfalse any, cond bool) any {
+			if cond {
+				return vtrue
+			}
+			return vfalse
+		},
+
+		// Dates
+		"now":        time.Now,
+		"date":       func(layout string, t any) string { return toTime(t).Format(layout) },
+		"dateInZone": dateInZone,
+		"unixEpoch":  func(t any) string { return strconv.FormatInt(toTime(t).Unix(), 10) },
+		"ago":        func(t any) string { return time.Since(toTime(t)).Round(time.Second).String() },
+		"duration":   func(sec any) string { return (time.Duration(toInt(sec)) * time.Second).String() },
+		"dateModify": dateModify,
+		"toDate":     func(layout, s string) time.Time { t, _ := time.Parse(layout, s); return t },
+
+		// Dictionaries and lists
+		"dict":      dict,
+		"get":       dictGet,
+		"set":       dictSet,
+		"unset":     dictUnset,
+		"hasKey":    func(d any, key string) bool { return mapValue(d, key).IsValid() },
+		"keys":      dictKeys,
+		"pick":      func(d any, keys ...string) map[string]any { return filterDict(d, keys, true) },
+		"omit":      func(d any, keys ...string) map[string]any { return filterDict(d, keys, false) },
+		"list":      func(v ...any) []any { return v },
+		"first":     func(l any) any { return listIndex(l, 0) },
+		"last":      func(l any) any { return listIndex(l, -1) },
+		"has":       func(needle, l any) bool { return contains(toList(l), needle) },
+		"uniq":      uniq,
+		"compact":   compact,
+		"sortAlpha": sortAlpha,
+
+		// Conversion and encoding
+		"int":          toInt,
+		"atoi":         func(s string) int { n, _ := strconv.Atoi(s); return n },
+		"toJson":       func(v any) string { b, _ := json.Marshal(v); return string(b) },
+		"toPrettyJson": func(v any) string { b, _ := json.MarshalIndent(v, "", "  "); return string(b) },
+		"b64enc":       func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+		"b64dec": func(s string) string {
+			b, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return err.Error()
+			}
+			return string(b)
+		},
+
+		// Arithmetic
+		"add": func(a, b any) int64 { return toInt(a) + toInt(b) },
+		"sub": func(a, b any) int64 { return toInt(a) - toInt(b) },
+		"mul": func(a, b any) int64 { return toInt(a) * toInt(b) },
+		"div": func(a, b any) int64 {
+			if toInt(b) == 0 {
+				return 0
+			}
+			return toInt(a) / toInt(b)
+		},
+		"max": func(a any, rest ...any) int64 {
+			m := toInt(a)
+			for _, v := range rest {
+				m = max(m, toInt(v))
+			}
+			return m
+		},
+		"min": func(a any, rest ...any) int64 {
+			m := toInt(a)
+			for _, v := range rest {
+				m = min(m, toInt(v))
+			}
+			return m
+		},
+	}
+}
+
+// titleCase upper-cases the first letter of each word.
+func titleCase(s string) string {
+	r := []rune(s)
+	for i := range r {
+		if i == 0 || unicode.IsSpace(r[i-1]) {
+			r[i] = unicode.ToTitle(r[i])
+		}
+	}
+	return string(r)
+}
+
+// substr returns s[start:end] in runes; a negative end means the rest.
+func substr(start, end int, s string) string {
+	r := []rune(s)
+	start = min(max(start, 0), len(r))
+	if end < 0 || end > len(r) {
+		end = len(r)
+	}
+	if end < start {
+		return ""
+	}
+	return string(r[start:end])
+}
+
+// trunc keeps the first n runes of s, or with a negative n the last -n.
+func trunc(n int, s string) string {
+	r := []rune(s)
+	switch {
+	case n >= 0 && len(r) > n:
+		return string(r[:n])
+	case n < 0 && len(r) > -n:
+		return string(r[len(r)+n:])
+	}
+	return s
+}
+
+// abbrev truncates s to width runes, ending in "...".
+func abbrev(width int, s string) string {
+	r := []rune(s)
+	if width < 4 || len(r) <= width {
+		return s
+	}
+	return string(r[:width-3]) + "..."
+}
+
+func indent(n int, s string) string {
+	pad := strings.Repeat(" ", max(n, 0))
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+}
+
+func joinFormatted(v []any, format string) string {
+	parts := make([]string, 0, len(v))
+	for _, item := range v {
+		if item != nil {
+			parts = append(parts, fmt.Sprintf(format, item))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func join(sep string, l any) string {
+	parts := make([]string, 0)
+	for _, item := range toList(l) {
+		if item != nil {
+			parts = append(parts, fmt.Sprint(item))
+		}
+	}
+	return strings.Join(parts, sep)
+}
+
+func regexFind(re, s string) (string, error) {
+	r, err := regexp.Compile(re)
+	if err != nil {
+		return "", err
+	}
+	return r.FindString(s), nil
+}
+
+func regexReplaceAll(re, s, repl string) (string, error) {
+	r, err := regexp.Compile(re)
+	if err != nil {
+		return "", err
+	}
+	return r.ReplaceAllString(s, repl), nil
+}
+
+// empty reports whether v is nil or the zero value of its type, or an
+// empty map, slice or string.
+func empty(v any) bool {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return true
+	}
+	switch rv.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.String:
+		return rv.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return rv.IsNil()
+	}
+	return rv.IsZero()
+}
+
+func defaultValue(def, v any) any {
+	if empty(v) {
+		return def
+	}
+	return v
+}
+
+func coalesce(v ...any) any {
+	for _, item := range v {
+		if !empty(item) {
+			return item
+		}
+	}
+	return nil
+}
+
+// toTime accepts a time, a Unix timestamp in seconds or an RFC 3339 string.
+func toTime(v any) time.Time {
+	switch t := v.(type) {
+	case time.Time:
+		return t
+	case *time.Time:
+		if t != nil {
+			return *t
+		}
+	case string:
+		parsed, _ := time.Parse(time.RFC3339, t)
+		return parsed
+	case int, int32, int64, uint, uint32, uint64, float64:
+		return time.Unix(toInt(t), 0)
+	}
+	return time.Time{}
+}
+
+func dateInZone(layout string, t any, zone string) (string, error) {
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return "", err
+	}
+	return toTime(t).In(loc).Format(layout), nil
+}
+
+func dateModify(d string, t any) (time.Time, error) {
+	dur, err := time.ParseDuration(d)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return toTime(t).Add(dur), nil
+}
+
+func toInt(v any) int64 {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return int64(rv.Float())
+	case reflect.Bool:
+		if rv.Bool() {
+			return 1
+		}
+	case reflect.String:
+		n, _ := strconv.ParseFloat(strings.TrimSpace(rv.String()), 64)
+		return int64(n)
+	}
+	return 0
+}
+
+func dict(v ...any) map[string]any {
+	d := make(map[string]any, len(v)/2)
+	for i := 0; i+1 < len(v); i += 2 {
+		d[fmt.Sprint(v[i])] = v[i+1]
+	}
+	return d
+}
+
+// mapValue returns the value of key in a map with string keys, such as
+// .Labels, or an invalid value.
+func mapValue(d any, key string) reflect.Value {
+	rv := reflect.ValueOf(d)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return reflect.Value{}
+	}
+	return rv.MapIndex(reflect.ValueOf(key).Convert(rv.Type().Key()))
+}
+
+func dictGet(d any, key string) any {
+	if v := mapValue(d, key); v.IsValid() {
+		return v.Interface()
+	}
+	return ""
+}
+
+func dictSet(d map[string]any, key string, v any) map[string]any {
+	d[key] = v
+	return d
+}
+
+func dictUnset(d map[string]any, key string) map[string]any {
+	delete(d, key)
+	return d
+}
+
+// dictKeys returns the keys of a map with string keys, sorted.
+func dictKeys(d any) []string {
+	rv := reflect.ValueOf(d)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil
+	}
+	keys := make([]string, 0, rv.Len())
+	for _, k := range rv.MapKeys() {
+		keys = append(keys, k.String())
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// filterDict copies the entries of a map with string keys that are, or with
+// keep false are not, in keys.
+func filterDict(d any, keys []string, keep bool) map[string]any {
+	out := map[string]any{}
+	for _, k := range dictKeys(d) {
+		if slices.Contains(keys, k) == keep {
+			out[k] = dictGet(d, k)
+		}
+	}
+	return out
+}
+
+func toList(l any) []any {
+	rv := reflect.ValueOf(l)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil
+	}
+	list := make([]any, rv.Len())
+	for i := range list {
+		list[i] = rv.Index(i).Interface()
+	}
+	return list
+}
+
+// contains compares with reflect.DeepEqual, as list items may be maps or
+// slices.
+func contains(list []any, item any) bool {
+	return slices.ContainsFunc(list, func(v any) bool { return reflect.DeepEqual(v, item) })
+}
+
+func listIndex(l any, i int) any {
+	list := toList(l)
+	if len(list) == 0 {
+		return nil
+	}
+	if i < 0 {
+		i += len(list)
+	}
+	return list[i]
+}
+
+func uniq(l any) []any {
+	var out []any
+	for _, item := range toList(l) {
+		if !contains(out, item) {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func compact(l any) []any {
+	var out []any
+	for _, item := range toList(l) {
+		if !empty(item) {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func sortAlpha(l any) []string {
+	list := toList(l)
+	out := make([]string, len(list))
+	for i, item := range list {
+		out[i] = fmt.Sprint(item)
+	}
+	slices.Sort(out)
+	return out
+}
@@ -0,0 +1,291 @@
+package alertiris
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// TemplatesConfig renders the title, description, tags and note of IRIS
+// alerts with Go templates rather than the title and tags expressions and
+// the description fields, with the functions of templateFuncs. Each
+// template is given inline or as a file; files are checked for changes every
+// Reload and reloaded once the new version parses and renders, so a broken
+// edit keeps the previous version.
+type TemplatesConfig struct {
+	Title           string        `koanf:"title"`
+	TitleFile       string        `koanf:"title_file"`
+	Description     string        `koanf:"description"`
+	DescriptionFile string        `koanf:"description_file"`
+	Note            string        `koanf:"note"`
+	NoteFile        string        `koanf:"note_file"`
+	Tags            string        `koanf:"tags"`
+	TagsFile        string        `koanf:"tags_file"`
+	Reload          time.Duration `koanf:"reload"`
+}
+
+var (
+	templateReloads      = metrics.NewCounter(`alertiris_template_reloads_total`)
+	templateReloadErrors = metrics.NewCounter(`alertiris_template_reload_errors_total`)
+)
+
+// templateSource is one of the templates and where it comes from.
+type templateSource struct {
+	name   string
+	inline string
+	file   string
+}
+
+func (c TemplatesConfig) sources() []templateSource {
+	return []templateSource{
+		{"title", c.Title, c.TitleFile},
+		{"description", c.Description, c.DescriptionFile},
+		{"note", c.Note, c.NoteFile},
+		{"tags", c.Tags, c.TagsFile},
+	}
+}
+
+// parsedTemplates are replaced as a whole on reload. A nil template is not
+// configured.
+type parsedTemplates struct {
+	title       *template.Template
+	description *template.Template
+	note        *template.Template
+	tags        *template.Template
+}
+
+// templateFile is the state of a template file when it was last read.
+type templateFile struct {
+	modTime time.Time
+	size    int64
+}
+
+type alertTemplates struct {
+	cfg     TemplatesConfig
+	funcs   template.FuncMap
+	current atomic.Pointer[parsedTemplates]
+	files   map[string]templateFile
+}
+
+// templateSamples are the alerts templates are rendered with before they
+// are used: a bare alert, a typical one and one from Kubernetes, so that
+// sections depending on labels being present are rendered too.
+var templateSamples = []Alert{
+	{
+		Status:      "resolved",
+		Labels:      map[string]string{"alertname": "TemplateCheck"},
+		Annotations: map[string]string{},
+		Fingerprint: "0000000000000000",
+	},
+	{
+		Status:       "firing",
+		Labels:       map[string]string{"alertname": "TemplateCheck", "severity": "warning", "instance": "host:9100", "job": "node"},
+		Annotations:  map[string]string{"summary": "Template check", "description": "Rendered to validate the template"},
+		StartsAt:     time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		GeneratorURL: "http://prometheus/graph",
+		Fingerprint:  "0000000000000001",
+	},
+	{
+		Status: "firing",
+		Labels: map[string]string{
+			"alertname": "TemplateCheck", "severity": "critical", "namespace": "default",
+			"pod": "web-0", "container": "web", "node": "node-1", "cluster": "prod",
+		},
+		Annotations: map[string]string{"summary": "Template check", "runbook_url": "http://runbooks/check"},
+		StartsAt:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndsAt:      time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC),
+		Fingerprint: "0000000000000002",
+	},
+}
+
+// newAlertTemplates loads the configured templates. It returns nil when
+// none are configured.
+func newAlertTemplates(cfg TemplatesConfig, funcs template.FuncMap) (*alertTemplates, error) {
+	configured := false
+	for _, src := range cfg.sources() {
+		if src.inline != "" && src.file != "" {
+			return nil, fmt.Errorf("%s: set only one of %s and %s_file", src.name, src.name, src.name)
+		}
+		configured = configured || src.inline != "" || src.file != ""
+	}
+	if !configured {
+		return nil, nil
+	}
+	if cfg.Reload < time.Second {
+		return nil, fmt.Errorf("reload must be at least 1s")
+	}
+	t := &alertTemplates{cfg: cfg, funcs: funcs, files: map[string]templateFile{}}
+	parsed, err := t.load()
+	if err != nil {
+		return nil, err
+	}
+	t.current.Store(parsed)
+	return t, nil
+}
+
+// load reads, parses and renders every template with the sample alerts.
+func (t *alertTemplates) load() (*parsedTemplates, error) {
+	parsed := &parsedTemplates{}
+	for _, src := range t.cfg.sources() {
+		text := src.inline
+		if src.file != "" {
+			fi, err := os.Stat(src.file)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", src.name, err)
+			}
+			b, err := os.ReadFile(src.file)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", src.name, err)
+			}
+			t.files[src.file] = templateFile{modTime: fi.ModTime(), size: fi.Size()}
+			text = string(b)
+		}
+		if text == "" {
+			continue
+		}
+		tmpl, err := template.New(src.name).Option("missingkey=zero").Funcs(t.funcs).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", src.name, err)
+		}
+		for _, sample := range templateSamples {
+			if err := tmpl.Execute(&bytes.Buffer{}, newTransformEnv(sample)); err != nil {
+				return nil, fmt.Errorf("%s: %w", src.name, err)
+			}
+		}
+		switch src.name {
+		case "title":
+			parsed.title = tmpl
+		case "description":
+			parsed.description = tmpl
+		case "note":
+			parsed.note = tmpl
+		case "tags":
+			parsed.tags = tmpl
+		}
+	}
+	return parsed, nil
+}
+
+// changed reports whether a template file was modified since it was read.
+func (t *alertTemplates) changed() bool {
+	for path, prev := range t.files {
+		fi, err := os.Stat(path)
+		if err != nil || !fi.ModTime().Equal(prev.modTime) || fi.Size() != prev.size {
+			return true
+		}
+	}
+	return false
+}
+
+// watch reloads the template files when they change.
+func (t *alertTemplates) watch(ctx context.Context) {
+	ticker := time.NewTicker(t.cfg.Reload)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !t.changed() {
+			continue
+		}
+		parsed, err := t.load()
+		if err != nil {
+			templateReloadErrors.Inc()
+			slog.Error("failed to reload templates, keeping the previous version", "error", err)
+			continue
+		}
+		t.current.Store(parsed)
+		templateReloads.Inc()
+		slog.Info("reloaded templates")
+	}
+}
+
+// render executes tmpl for alert. ok is false when tmpl is not configured
+// or failed, so the caller falls back to its default.
+func render(tmpl *template.Template, alert Alert) (string, bool) {
+	if tmpl == nil {
+		return "", false
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, newTransformEnv(alert)); err != nil {
+		slog.Warn("template failed, using the default", "template", tmpl.Name(), "fingerprint", alert.Fingerprint, "error", err)
+		return "", false
+	}
+	return buf.String(), true
+}
+
+// title renders the title template. An empty title falls back like a failed
+// one, as IRIS requires a title.
+func (t *alertTemplates) title(alert Alert) (string, bool) {
+	if t == nil {
+		return "", false
+	}
+	title, ok := render(t.current.Load().title, alert)
+	title = strings.TrimSpace(title)
+	return title, ok && title != ""
+}
+
+func (t *alertTemplates) description(alert Alert) (string, bool) {
+	if t == nil {
+		return "", false
+	}
+	desc, ok := render(t.current.Load().description, alert)
+	return collapseBlankLines(desc), ok
+}
+
+// collapseBlankLines removes leading and trailing blank lines and reduces
+// runs of them to one, so sections left out by a conditional do not leave
+// gaps and need no whitespace trimming in the template.
+func collapseBlankLines(s string) string {
+	var lines []string
+	blank := true
+	for line := range strings.Lines(s) {
+		line = strings.TrimRight(line, " \t\r\n")
+		if line == "" {
+			if !blank {
+				lines = append(lines, line)
+			}
+			blank = true
+			continue
+		}
+		lines = append(lines, line)
+		blank = false
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
+
+func (t *alertTemplates) note(alert Alert) string {
+	if t == nil {
+		return ""
+	}
+	note, _ := render(t.current.Load().note, alert)
+	return strings.TrimSpace(note)
+}
+
+// tags renders the tags template, one tag per line or separated by commas.
+func (t *alertTemplates) tags(alert Alert) ([]string, bool) {
+	if t == nil {
+		return nil, false
+	}
+	out, ok := render(t.current.Load().tags, alert)
+	if !ok {
+		return nil, false
+	}
+	var tags []string
+	for _, tag := range strings.FieldsFunc(out, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, true
+}
@@ -0,0 +1,96 @@
+package alertiris
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type testAlertRequest struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	Status      string            `json:"status"`
+	Group       string            `json:"group"`
+}
+
+type testAlertResponse struct {
+	Payload  AlertmanagerPayload `json:"payload"`
+	Mappings []Mapping           `json:"mappings"`
+	Error    string              `json:"error,omitempty"`
+}
+
+// testPayload builds the payload Alertmanager would send for a single alert
+// with the given labels.
+func testPayload(req testAlertRequest, now time.Time) AlertmanagerPayload {
+	labels := map[string]string{"alertname": "AlertirisTest", "severity": "warning"}
+	for k, v := range req.Labels {
+		labels[k] = v
+	}
+	annotations := map[string]string{"summary": "Test alert sent through the alertiris admin API"}
+	for k, v := range req.Annotations {
+		annotations[k] = v
+	}
+	status := req.Status
+	if status == "" {
+		status = "firing"
+	}
+
+	alert := Alert{
+		Status:       status,
+		Labels:       labels,
+		Annotations:  annotations,
+		StartsAt:     now,
+		GeneratorURL: "http://alertiris/api/test-alert",
+		Fingerprint:  labelsFingerprint(labels),
+	}
+	if status == "resolved" {
+		alert.EndsAt = now
+	}
+	return AlertmanagerPayload{
+		Receiver:          "alertiris-test",
+		Status:            status,
+		Alerts:            []Alert{alert},
+		GroupLabels:       map[string]string{"alertname": labels["alertname"]},
+		CommonLabels:      labels,
+		CommonAnnotations: annotations,
+		ExternalURL:       "http://alertiris",
+		Version:           "4",
+		GroupKey:          fmt.Sprintf(`{}:{alertname=%q}`, labels["alertname"]),
+	}
+}
+
+// adminTestAlert runs a synthetic alert through the full pipeline and
+// reports the resulting mappings, so a configuration can be checked end to
+// end. Sending the same labels with status "resolved" resolves it again.
+func (h *Handler) adminTestAlert(w http.ResponseWriter, r *http.Request) {
+	var req testAlertRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("decode request: %w", err))
+		return
+	}
+	if req.Status != "" && req.Status != "firing" && req.Status != "resolved" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("status must be firing or resolved"))
+		return
+	}
+
+	payload := testPayload(req, time.Now())
+	fp := payload.Alerts[0].Fingerprint
+	slog.Info("processing test alert", "fingerprint", fp, "status", payload.Status)
+
+	resp := testAlertResponse{Payload: payload}
+	status := http.StatusOK
+	if err := h.processAlerts(r.Context(), payload.Alerts, "alertmanager", req.Group, h.config.CustomerID); err != nil {
+		resp.Error = err.Error()
+		status = http.StatusBadGateway
+	}
+
+	mappings, err := ListMappings(h.db, fp)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	resp.Mappings = mappings
+	writeJSON(w, status, resp)
+}
@@ -0,0 +1,172 @@
+package alertiris
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type TheHiveConfig struct {
+	URL            string         `koanf:"url"`
+	APIKey         string         `koanf:"api_key"`
+	Organisation   string         `koanf:"organisation"`
+	SkipTLSVerify  bool           `koanf:"skip_tls_verify"`
+	Type           string         `koanf:"type"`
+	ResolvedAction string         `koanf:"resolved_action"`
+	ResolvedStatus string         `koanf:"resolved_status"`
+	SeverityMap    map[string]int `koanf:"severity_map"`
+}
+
+type theHiveAlert struct {
+	Type         string   `json:"type,omitempty"`
+	Source       string   `json:"source,omitempty"`
+	SourceRef    string   `json:"sourceRef,omitempty"`
+	Title        string   `json:"title,omitempty"`
+	Description  string   `json:"description,omitempty"`
+	Severity     int      `json:"severity,omitempty"`
+	Date         int64    `json:"date,omitempty"`
+	Tags         []string `json:"tags,omitempty"`
+	ExternalLink string   `json:"externalLink,omitempty"`
+	Status       string   `json:"status,omitempty"`
+}
+
+type theHiveSink struct {
+	baseURL    string
+	apiKey     string
+	config     TheHiveConfig
+	httpClient *http.Client
+}
+
+func newTheHiveSink(cfg TheHiveConfig) (*theHiveSink, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("url is required")
+	}
+	transport := &http.Transport{}
+	if cfg.SkipTLSVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &theHiveSink{
+		baseURL: strings.TrimRight(cfg.URL, "/"),
+		apiKey:  cfg.APIKey,
+		config:  cfg,
+		httpClient: &http.Client{
+			Transport: transport,
+		},
+	}, nil
+}
+
+func (s *theHiveSink) Name() string {
+	return "thehive"
+}
+
+func (s *theHiveSink) Create(ctx context.Context, a *SinkAlert) (string, error) {
+	req := theHiveAlert{
+		Type:         s.config.Type,
+		Source:       a.Source,
+		SourceRef:    fmt.Sprintf("%s-%d", a.Fingerprint, a.EventTime.Unix()),
+		Title:        a.Title,
+		Description:  a.Description,
+		Severity:     s.severity(a.SeverityID),
+		Date:         a.EventTime.UnixMilli(),
+		Tags:         a.Tags,
+		ExternalLink: a.SourceLink,
+	}
+
+	var created struct {
+		ID string `json:"_id"`
+	}
+	if err := s.do(ctx, http.MethodPost, "/api/v1/alert", req, &created); err != nil {
+		return "", err
+	}
+	return created.ID, nil
+}
+
+func (s *theHiveSink) Update(ctx context.Context, id string, a *SinkAlert) error {
+	req := theHiveAlert{
+		Description: a.Description,
+		Severity:    s.severity(a.SeverityID),
+		Tags:        a.Tags,
+	}
+	return s.do(ctx, http.MethodPatch, "/api/v1/alert/"+id, req, nil)
+}
+
+func (s *theHiveSink) Resolve(ctx context.Context, id string, a *SinkAlert) error {
+	action := s.config.ResolvedAction
+	if a.ResolvedAction != "" {
+		action = a.ResolvedAction
+	}
+	switch action {
+	case "delete":
+		return s.do(ctx, http.MethodDelete, "/api/v1/alert/"+id, nil, nil)
+	case "none":
+		return nil
+	}
+	return s.do(ctx, http.MethodPatch, "/api/v1/alert/"+id, theHiveAlert{Status: s.config.ResolvedStatus}, nil)
+}
+
+// severity converts an IRIS severity ID to TheHive's 1 (low) to 4 (critical)
+// scale, using the default IRIS severities unless overridden.
+func (s *theHiveSink) severity(irisSeverityID int) int {
+	if sev, ok := s.config.SeverityMap[strconv.Itoa(irisSeverityID)]; ok {
+		return sev
+	}
+	switch {
+	case irisSeverityID >= 6:
+		return 4
+	case irisSeverityID == 5:
+		return 3
+	case irisSeverityID == 4:
+		return 2
+	default:
+		return 1
+	}
+}
+
+func (s *theHiveSink) do(ctx context.Context, method, path string, body any, out any) error {
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("marshal request: %w", err)
+		}
+		reqBody = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+path, reqBody)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+	if s.config.Organisation != "" {
+		req.Header.Set("X-Organisation", s.config.Organisation)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("http %s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("thehive api %s %s returned %d: %s", method, path, resp.StatusCode, string(respBody))
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return fmt.Errorf("unmarshal response: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package alertiris
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// TimeRuleConfig changes the severity or route of matching alerts during, or
+// with Outside set outside of, the given days and hours.
+type TimeRuleConfig struct {
+	Name     string            `koanf:"name"`
+	Matchers map[string]string `koanf:"matchers"`
+	Days     []string          `koanf:"days"`
+	Hours    []string          `koanf:"hours"`
+	Timezone string            `koanf:"timezone"`
+	Outside  bool              `koanf:"outside"`
+
+	SeverityID     int    `koanf:"severity_id"`
+	SeverityOffset int    `koanf:"severity_offset"`
+	Route          string `koanf:"route"`
+}
+
+type TimeRule struct {
+	TimeRuleConfig
+	matchers Matchers
+	days     []time.Weekday
+	hours    []clockRange
+	location *time.Location
+	route    *Route
+}
+
+// clockRange is a time of day range in minutes since midnight. Ranges
+// ending before they start wrap around midnight.
+type clockRange struct {
+	start, end int
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func NewTimeRules(cfgs []TimeRuleConfig, routes []*Route) ([]*TimeRule, error) {
+	var out []*TimeRule
+	for i, cfg := range cfgs {
+		if cfg.Name == "" {
+			cfg.Name = fmt.Sprintf("time-rule-%d", i)
+		}
+		r := &TimeRule{TimeRuleConfig: cfg, location: time.UTC}
+
+		var err error
+		if r.matchers, err = NewMatchers(cfg.Matchers); err != nil {
+			return nil, fmt.Errorf("time rule %q: %w", cfg.Name, err)
+		}
+		if cfg.Timezone != "" {
+			if r.location, err = time.LoadLocation(cfg.Timezone); err != nil {
+				return nil, fmt.Errorf("time rule %q: load timezone: %w", cfg.Name, err)
+			}
+		}
+		for _, d := range cfg.Days {
+			wd, ok := weekdays[strings.ToLower(d)[:min(3, len(d))]]
+			if !ok {
+				return nil, fmt.Errorf("time rule %q: unknown day %q", cfg.Name, d)
+			}
+			r.days = append(r.days, wd)
+		}
+		for _, h := range cfg.Hours {
+			cr, err := parseClockRange(h)
+			if err != nil {
+				return nil, fmt.Errorf("time rule %q: %w", cfg.Name, err)
+			}
+			r.hours = append(r.hours, cr)
+		}
+
+		if cfg.Route != "" {
+			i := slices.IndexFunc(routes, func(rt *Route) bool { return rt.Name == cfg.Route })
+			if i < 0 {
+				return nil, fmt.Errorf("time rule %q: unknown route %q", cfg.Name, cfg.Route)
+			}
+			r.route = routes[i]
+		}
+		if cfg.SeverityID == 0 && cfg.SeverityOffset == 0 && r.route == nil {
+			return nil, fmt.Errorf("time rule %q: severity_id, severity_offset or route is required", cfg.Name)
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+func parseClockRange(s string) (clockRange, error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return clockRange{}, fmt.Errorf("hours %q: expected HH:MM-HH:MM", s)
+	}
+	start, err := time.Parse("15:04", strings.TrimSpace(from))
+	if err != nil {
+		return clockRange{}, fmt.Errorf("hours %q: %w", s, err)
+	}
+	end, err := time.Parse("15:04", strings.TrimSpace(to))
+	if err != nil {
+		return clockRange{}, fmt.Errorf("hours %q: %w", s, err)
+	}
+	return clockRange{start.Hour()*60 + start.Minute(), end.Hour()*60 + end.Minute()}, nil
+}
+
+func (c clockRange) contains(minute int) bool {
+	if c.end <= c.start {
+		return minute >= c.start || minute < c.end
+	}
+	return minute >= c.start && minute < c.end
+}
+
+// inSchedule reports whether t falls on the rule's days and hours, before
+// Outside is applied.
+func (r *TimeRule) inSchedule(t time.Time) bool {
+	t = t.In(r.location)
+	if len(r.days) > 0 && !slices.Contains(r.days, t.Weekday()) {
+		return false
+	}
+	if len(r.hours) == 0 {
+		return true
+	}
+	minute := t.Hour()*60 + t.Minute()
+	return slices.ContainsFunc(r.hours, func(c clockRange) bool { return c.contains(minute) })
+}
+
+func (r *TimeRule) Match(labels map[string]string, t time.Time) bool {
+	return r.matchers.Match(labels) && r.inSchedule(t) != r.Outside
+}
+
+// AdjustSeverity applies the rule to an IRIS severity ID, keeping offsets
+// within the default IRIS range of 1 (unspecified) to 6 (critical).
+func (r *TimeRule) AdjustSeverity(id int) int {
+	if r.SeverityID != 0 {
+		return r.SeverityID
+	}
+	if r.SeverityOffset != 0 {
+		return min(max(id+r.SeverityOffset, 1), 6)
+	}
+	return id
+}
+
+func matchTimeRule(rules []*TimeRule, labels map[string]string, t time.Time) *TimeRule {
+	for _, r := range rules {
+		if r.Match(labels, t) {
+			return r
+		}
+	}
+	return nil
+}
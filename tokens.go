@@ -0,0 +1,118 @@
+package alertiris
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// URLTokenConfig gives one producer its own secret URL, /webhook/<token>,
+// bound to a source, the customer its alerts start with and tags added to
+// them. Revoking the producer means removing its entry.
+type URLTokenConfig struct {
+	Name       string   `koanf:"name"`
+	Token      string   `koanf:"token"`
+	Source     string   `koanf:"source"`
+	CustomerID int      `koanf:"customer_id"`
+	Tags       []string `koanf:"tags"`
+}
+
+// minTokenLength keeps URL tokens from being guessable.
+const minTokenLength = 16
+
+type tokenKey struct{}
+
+// tokenFrom returns the URL token a request came in through, if any.
+func tokenFrom(ctx context.Context) *URLTokenConfig {
+	t, _ := ctx.Value(tokenKey{}).(*URLTokenConfig)
+	return t
+}
+
+// tokenCustomer returns the customer of the URL token a request came in
+// through, if it sets one, or customerID.
+func tokenCustomer(ctx context.Context, customerID int) int {
+	if t := tokenFrom(ctx); t != nil && t.CustomerID > 0 {
+		return t.CustomerID
+	}
+	return customerID
+}
+
+func tokenRequests(name string) *metrics.Counter {
+	return metrics.GetOrCreateCounter(`alertiris_token_requests_total{token="` + name + `"}`)
+}
+
+// RegisterTokens serves each token's source at /webhook/<token>. Sources
+// must be registered first. Tokens are looked up by hash so the lookup does
+// not leak them through timing.
+func (s *SourceRegistry) RegisterTokens(tokens []URLTokenConfig) error {
+	var names []string
+	for i := range tokens {
+		t := &tokens[i]
+		switch {
+		case t.Name == "":
+			return fmt.Errorf("token %d: name is required", i)
+		case slices.Contains(names, t.Name):
+			return fmt.Errorf("token %q: duplicate name", t.Name)
+		case len(t.Token) < minTokenLength:
+			return fmt.Errorf("token %q: token must be at least %d characters", t.Name, minTokenLength)
+		case s.sources[t.Source] == nil:
+			return fmt.Errorf("token %q: unknown source %q", t.Name, t.Source)
+		case s.sources[t.Token] != nil:
+			return fmt.Errorf("token %q: token is a source name", t.Name)
+		case s.sources[t.Name] != nil:
+			return fmt.Errorf("token %q: name is a source name", t.Name)
+		}
+		key := sha256.Sum256([]byte(t.Token))
+		if _, ok := s.tokens[key]; ok {
+			return fmt.Errorf("token %q: token is used twice", t.Name)
+		}
+		s.tokens[key] = t
+		names = append(names, t.Name)
+	}
+	return nil
+}
+
+func (s *SourceRegistry) serveToken(w http.ResponseWriter, r *http.Request) bool {
+	t, ok := s.tokens[sha256.Sum256([]byte(r.PathValue("source")))]
+	if !ok {
+		return false
+	}
+	if info := requestInfoFrom(r.Context()); info != nil {
+		info.source, info.token = t.Source, t.Name
+	}
+	r = withSourcePath(r, t)
+	// A token's own authentication replaces its source's. Without one, the
+	// source's applies, so a token cannot be used to get around it.
+	endpoint := t.Name
+	auth, ok := s.auth[t.Name]
+	if !ok {
+		endpoint = t.Source
+		auth, ok = s.auth[t.Source]
+	}
+	if ok && !requireAuth(endpoint, auth, w, r) {
+		return true
+	}
+	tokenRequests(t.Name).Inc()
+	slog.Debug("webhook through url token", "token", t.Name, "source", t.Source)
+	s.serve(t.Source, w, r)
+	return true
+}
+
+// withSourcePath returns r as if it had been sent to the token's source,
+// /webhook/<source>, with the token in its context, so that nothing past
+// the lookup, such as the archive, the recorder or plugin rejects, sees the
+// token. The URL is copied, as r shares it with the request being logged.
+func withSourcePath(r *http.Request, t *URLTokenConfig) *http.Request {
+	r = r.WithContext(context.WithValue(r.Context(), tokenKey{}, t))
+	u := *r.URL
+	u.Path, u.RawPath = "/webhook/"+t.Source, ""
+	r.URL = &u
+	r.RequestURI = u.RequestURI()
+	r.SetPathValue("source", t.Source)
+	return r
+}
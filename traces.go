@@ -0,0 +1,138 @@
+package alertiris
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+)
+
+// TracesConfig links alerts carrying trace and span IDs, e.g. from
+// exemplar based alerting, to tracing backends.
+type TracesConfig struct {
+	TraceLabels []string             `koanf:"trace_labels"`
+	SpanLabels  []string             `koanf:"span_labels"`
+	Backends    []TraceBackendConfig `koanf:"backends"`
+}
+
+// TraceBackendConfig is a tracing UI. Type "jaeger" links to the Jaeger UI
+// at URL, "tempo" to Grafana Explore at URL with the Tempo data source
+// Datasource. Link, a template with .TraceID and .SpanID, replaces the
+// generated link.
+type TraceBackendConfig struct {
+	Name       string `koanf:"name"`
+	Type       string `koanf:"type"`
+	URL        string `koanf:"url"`
+	Datasource string `koanf:"datasource"`
+	Link       string `koanf:"link"`
+}
+
+type traceBackend struct {
+	TraceBackendConfig
+	link *template.Template
+}
+
+type traceLinker struct {
+	cfg      TracesConfig
+	backends []*traceBackend
+}
+
+func newTraceLinker(cfg TracesConfig) (*traceLinker, error) {
+	if len(cfg.Backends) == 0 {
+		return nil, nil
+	}
+	t := &traceLinker{cfg: cfg}
+	for i, b := range cfg.Backends {
+		if b.Name == "" {
+			b.Name = cmp.Or(b.Type, fmt.Sprintf("backend-%d", i))
+		}
+		tb := &traceBackend{TraceBackendConfig: b}
+		switch {
+		case b.Link != "":
+			tmpl, err := template.New(b.Name).Parse(b.Link)
+			if err != nil {
+				return nil, fmt.Errorf("backend %q: %w", b.Name, err)
+			}
+			tb.link = tmpl
+		case b.Type == "jaeger" || b.Type == "tempo":
+			if b.URL == "" {
+				return nil, fmt.Errorf("backend %q: url is required", b.Name)
+			}
+		default:
+			return nil, fmt.Errorf("backend %q: type must be jaeger or tempo, or link must be set", b.Name)
+		}
+		t.backends = append(t.backends, tb)
+	}
+	return t, nil
+}
+
+func firstLabel(labels map[string]string, names []string) string {
+	for _, name := range names {
+		if v := labels[name]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// links returns a description section linking the alert's trace, or "".
+func (t *traceLinker) links(alert Alert) string {
+	if t == nil {
+		return ""
+	}
+	traceID := firstLabel(alert.Labels, t.cfg.TraceLabels)
+	if traceID == "" {
+		traceID = firstLabel(alert.Annotations, t.cfg.TraceLabels)
+	}
+	if traceID == "" {
+		return ""
+	}
+	spanID := firstLabel(alert.Labels, t.cfg.SpanLabels)
+	if spanID == "" {
+		spanID = firstLabel(alert.Annotations, t.cfg.SpanLabels)
+	}
+
+	lines := []string{"Trace " + traceID + ":"}
+	for _, b := range t.backends {
+		link, err := b.url(traceID, spanID)
+		if err != nil {
+			continue
+		}
+		lines = append(lines, "- "+b.Name+": "+link)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (b *traceBackend) url(traceID, spanID string) (string, error) {
+	base := strings.TrimRight(b.URL, "/")
+	switch {
+	case b.link != nil:
+		var s strings.Builder
+		err := b.link.Execute(&s, struct{ TraceID, SpanID string }{url.QueryEscape(traceID), url.QueryEscape(spanID)})
+		return s.String(), err
+	case b.Type == "jaeger":
+		link := base + "/trace/" + url.PathEscape(traceID)
+		if spanID != "" {
+			link += "?uiFind=" + url.QueryEscape(spanID)
+		}
+		return link, nil
+	default:
+		ds := map[string]string{"type": "tempo", "uid": b.Datasource}
+		panes, err := json.Marshal(map[string]any{"trace": map[string]any{
+			"datasource": b.Datasource,
+			"queries": []map[string]any{{
+				"refId":      "A",
+				"datasource": ds,
+				"queryType":  "traceql",
+				"query":      traceID,
+			}},
+			"range": map[string]string{"from": "now-1h", "to": "now"},
+		}})
+		if err != nil {
+			return "", err
+		}
+		return base + "/explore?" + url.Values{"schemaVersion": {"1"}, "panes": {string(panes)}}.Encode(), nil
+	}
+}
@@ -0,0 +1,255 @@
+package alertiris
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+type TransformConfig struct {
+	Title    string            `koanf:"title"`
+	Severity string            `koanf:"severity"`
+	Tags     string            `koanf:"tags"`
+	Drop     string            `koanf:"drop"`
+	Labels   map[string]string `koanf:"labels"`
+
+	// DropRules are further drop expressions, which can be changed at
+	// runtime through the admin API.
+	DropRules []string `koanf:"drop_rules"`
+}
+
+type transformEnv struct {
+	Labels       map[string]string `expr:"labels"`
+	Annotations  map[string]string `expr:"annotations"`
+	Status       string            `expr:"status"`
+	Fingerprint  string            `expr:"fingerprint"`
+	StartsAt     time.Time         `expr:"startsAt"`
+	EndsAt       time.Time         `expr:"endsAt"`
+	GeneratorURL string            `expr:"generatorURL"`
+}
+
+type derivedLabel struct {
+	name    string
+	program *vm.Program
+}
+
+type Transformer struct {
+	title    *vm.Program
+	severity *vm.Program
+	tags     *vm.Program
+	drop     *vm.Program
+	labels   []derivedLabel
+}
+
+func NewTransformer(cfg TransformConfig) (*Transformer, error) {
+	t := &Transformer{}
+
+	var err error
+	if t.title, err = compileExpr(cfg.Title, expr.AsKind(reflect.String)); err != nil {
+		return nil, fmt.Errorf("title: %w", err)
+	}
+	if t.severity, err = compileExpr(cfg.Severity); err != nil {
+		return nil, fmt.Errorf("severity: %w", err)
+	}
+	if t.tags, err = compileExpr(cfg.Tags); err != nil {
+		return nil, fmt.Errorf("tags: %w", err)
+	}
+	if t.drop, err = compileExpr(cfg.Drop, expr.AsBool()); err != nil {
+		return nil, fmt.Errorf("drop: %w", err)
+	}
+
+	names := make([]string, 0, len(cfg.Labels))
+	for name := range cfg.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p, err := compileExpr(cfg.Labels[name], expr.AsKind(reflect.String))
+		if err != nil {
+			return nil, fmt.Errorf("label %q: %w", name, err)
+		}
+		t.labels = append(t.labels, derivedLabel{name: name, program: p})
+	}
+	return t, nil
+}
+
+func compileExpr(code string, opts ...expr.Option) (*vm.Program, error) {
+	if strings.TrimSpace(code) == "" {
+		return nil, nil
+	}
+	opts = append([]expr.Option{expr.Env(transformEnv{})}, opts...)
+	opts = append(opts, iocFunctions...)
+	return expr.Compile(code, opts...)
+}
+
+// iocFunctions are available in expressions: iocs(...) returns the IOCs in
+// its string or map arguments, refang and defang convert a string.
+var iocFunctions = []expr.Option{
+	expr.Function("iocs", func(params ...any) (any, error) {
+		var texts []string
+		for _, p := range params {
+			switch v := p.(type) {
+			case string:
+				texts = append(texts, v)
+			case map[string]string:
+				for _, k := range slices.Sorted(maps.Keys(v)) {
+					texts = append(texts, v[k])
+				}
+			default:
+				return nil, fmt.Errorf("iocs: unsupported argument %T", p)
+			}
+		}
+		return ExtractIOCs(texts...), nil
+	}),
+	expr.Function("refang", func(params ...any) (any, error) {
+		return Refang(params[0].(string)), nil
+	}, Refang),
+	expr.Function("defang", func(params ...any) (any, error) {
+		return Defang(params[0].(string)), nil
+	}, Defang),
+}
+
+func newTransformEnv(alert Alert) transformEnv {
+	labels := alert.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	annotations := alert.Annotations
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	return transformEnv{
+		Labels:       labels,
+		Annotations:  annotations,
+		Status:       alert.Status,
+		Fingerprint:  alert.Fingerprint,
+		StartsAt:     alert.StartsAt,
+		EndsAt:       alert.EndsAt,
+		GeneratorURL: alert.GeneratorURL,
+	}
+}
+
+func (t *Transformer) DeriveLabels(alert Alert) (Alert, error) {
+	if len(t.labels) == 0 {
+		return alert, nil
+	}
+	labels := make(map[string]string, len(alert.Labels)+len(t.labels))
+	for k, v := range alert.Labels {
+		labels[k] = v
+	}
+	alert.Labels = labels
+
+	for _, l := range t.labels {
+		out, err := expr.Run(l.program, newTransformEnv(alert))
+		if err != nil {
+			return alert, fmt.Errorf("label %q: %w", l.name, err)
+		}
+		v, ok := out.(string)
+		if !ok {
+			return alert, fmt.Errorf("label %q: expression returned %T, want string", l.name, out)
+		}
+		if v != "" {
+			labels[l.name] = v
+		}
+	}
+	return alert, nil
+}
+
+func (t *Transformer) Drop(alert Alert) (bool, error) {
+	if t.drop == nil {
+		return false, nil
+	}
+	out, err := expr.Run(t.drop, newTransformEnv(alert))
+	if err != nil {
+		return false, err
+	}
+	drop, ok := out.(bool)
+	if !ok {
+		return false, fmt.Errorf("drop expression returned %T, want bool", out)
+	}
+	return drop, nil
+}
+
+func (t *Transformer) Title(alert Alert) (string, bool, error) {
+	if t.title == nil {
+		return "", false, nil
+	}
+	out, err := expr.Run(t.title, newTransformEnv(alert))
+	if err != nil {
+		return "", false, err
+	}
+	title, ok := out.(string)
+	if !ok {
+		return "", false, fmt.Errorf("title expression returned %T, want string", out)
+	}
+	return title, title != "", nil
+}
+
+// Severity returns either an IRIS severity ID or a severity name that is
+// looked up in the severity map by the caller.
+func (t *Transformer) Severity(alert Alert) (any, bool, error) {
+	if t.severity == nil {
+		return nil, false, nil
+	}
+	out, err := expr.Run(t.severity, newTransformEnv(alert))
+	if err != nil {
+		return nil, false, err
+	}
+	switch v := out.(type) {
+	case int, string:
+		return v, true, nil
+	case float64:
+		return int(v), true, nil
+	case nil:
+		return nil, false, nil
+	default:
+		return nil, false, fmt.Errorf("severity must be a string or int, got %T", out)
+	}
+}
+
+func (t *Transformer) Tags(alert Alert) ([]string, bool, error) {
+	if t.tags == nil {
+		return nil, false, nil
+	}
+	out, err := expr.Run(t.tags, newTransformEnv(alert))
+	if err != nil {
+		return nil, false, err
+	}
+	switch v := out.(type) {
+	case string:
+		var tags []string
+		for _, tag := range strings.Split(v, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+		return tags, true, nil
+	case []any:
+		tags := make([]string, 0, len(v))
+		for _, tag := range v {
+			switch tag := tag.(type) {
+			case string:
+				if tag != "" {
+					tags = append(tags, tag)
+				}
+			case int:
+				tags = append(tags, strconv.Itoa(tag))
+			default:
+				return nil, false, fmt.Errorf("tag must be a string, got %T", tag)
+			}
+		}
+		return tags, true, nil
+	case nil:
+		return nil, false, nil
+	default:
+		return nil, false, fmt.Errorf("tags must be a string or list, got %T", out)
+	}
+}
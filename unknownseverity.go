@@ -0,0 +1,101 @@
+package alertiris
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// UnknownSeverityConfig decides what happens to alerts whose severity is
+// not in the severity map, which usually means an alerting rule drifted
+// from the naming convention. Action "default" files them at
+// default_severity_id, "reject" drops them and "review" sends them to Route.
+type UnknownSeverityConfig struct {
+	Action string `koanf:"action"`
+	Route  string `koanf:"route"`
+}
+
+func validateUnknownSeverity(cfg UnknownSeverityConfig, routes []*Route) error {
+	switch cfg.Action {
+	case "", "default", "reject":
+		if cfg.Route != "" {
+			return fmt.Errorf("route is only used with action \"review\"")
+		}
+	case "review":
+		if cfg.Route == "" {
+			return fmt.Errorf("action \"review\" requires a route")
+		}
+		if findRoute(routes, cfg.Route) == nil {
+			return fmt.Errorf("unknown route %q", cfg.Route)
+		}
+	default:
+		return fmt.Errorf("unknown action %q", cfg.Action)
+	}
+	return nil
+}
+
+func unknownSeverityTotal(action string) *metrics.Counter {
+	return metrics.GetOrCreateCounter(`alertiris_unknown_severity_total{action="` + action + `"}`)
+}
+
+// unknownSeverity returns the severity label of an alert the severity map
+// and expression do not resolve, and whether that is the case.
+func (h *Handler) unknownSeverity(alert Alert) (string, bool) {
+	if sev, ok, err := h.transformer.Severity(alert); err == nil && ok {
+		switch sev := sev.(type) {
+		case int:
+			return "", false
+		case string:
+			if _, ok := h.settings().SeverityMap[sev]; ok {
+				return "", false
+			}
+		}
+	}
+	sev := alert.Labels["severity"]
+	_, ok := h.settings().SeverityMap[sev]
+	return sev, !ok
+}
+
+// checkSeverity applies alerts.unknown_severity to an alert and reports
+// whether it should be processed further. Only firing alerts are rejected,
+// so alerts created before the setting changed still resolve, while review
+// applies to both so resolving finds the alert filed for review.
+func (h *Handler) checkSeverity(ev *Event) bool {
+	sev, unknown := h.unknownSeverity(ev.Alert)
+	if !unknown {
+		return true
+	}
+	cfg := h.config.UnknownSeverity
+	action := cfg.Action
+	if action == "" {
+		action = "default"
+	}
+	fp := ev.Alert.Fingerprint
+	firing := ev.Alert.Status == "firing"
+	if firing {
+		unknownSeverityTotal(action).Inc()
+	}
+
+	switch action {
+	case "reject":
+		if !firing {
+			return true
+		}
+		slog.Warn("alert with unknown severity rejected", "fingerprint", fp, "request_id", ev.RequestID, "severity", sev)
+		h.recordHistory(HistoryEvent{Fingerprint: fp, Event: "rejected", CustomerID: ev.CustomerID, Detail: fmt.Sprintf("unknown severity %q", sev)})
+		return false
+	case "review":
+		if firing {
+			slog.Warn("alert with unknown severity sent for review", "fingerprint", fp, "request_id", ev.RequestID, "severity", sev, "route", cfg.Route)
+		}
+		ev.Route = findRoute(h.routes, cfg.Route)
+		ev.Sinks = ev.Route.Sinks
+		if ev.Route.CustomerID > 0 {
+			ev.CustomerID = ev.Route.CustomerID
+		}
+	default:
+		slog.Debug("alert with unknown severity, using default severity", "fingerprint", fp, "request_id", ev.RequestID, "severity", sev)
+	}
+	return true
+}
@@ -0,0 +1,123 @@
+package alertiris
+
+import (
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"slices"
+)
+
+// Set at build time with
+// -ldflags "-X github.com/cvhariharan/alertiris.Version=... -X ...Commit=... -X ...BuildDate=...".
+var (
+	Version   = ""
+	Commit    = ""
+	BuildDate = ""
+)
+
+type BuildInfo struct {
+	Version   string   `json:"version"`
+	Commit    string   `json:"commit"`
+	BuildDate string   `json:"build_date"`
+	GoVersion string   `json:"go_version"`
+	Sources   []string `json:"sources,omitempty"`
+	Sinks     []string `json:"sinks,omitempty"`
+	Features  []string `json:"features,omitempty"`
+}
+
+// GetBuildInfo returns the version information, falling back to what the Go
+// toolchain embedded when no ldflags were given.
+func GetBuildInfo() BuildInfo {
+	info := BuildInfo{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				// The commit time, the closest to a build date available.
+				if info.BuildDate == "" {
+					info.BuildDate = s.Value
+				}
+			}
+		}
+	}
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	return info
+}
+
+// BuildInfo adds the sources, sinks and optional features enabled by the
+// configuration to the version information.
+func (a *App) BuildInfo() BuildInfo {
+	info := GetBuildInfo()
+	info.Sources = []string{"alertmanager"}
+	for _, p := range a.cfg.Plugins {
+		info.Sources = append(info.Sources, p.Name)
+	}
+
+	sinks := slices.Clone(a.cfg.Alerts.Sinks)
+	for _, r := range a.cfg.Routes {
+		sinks = append(sinks, r.Sinks...)
+	}
+	slices.Sort(sinks)
+	info.Sinks = slices.Compact(sinks)
+
+	alerts := a.cfg.Alerts
+	for _, f := range []struct {
+		name    string
+		enabled bool
+	}{
+		{"routes", len(a.cfg.Routes) > 0},
+		{"redaction", len(alerts.Redaction.NamePatterns)+len(alerts.Redaction.ValuePatterns) > 0},
+		{"transform", alerts.Transform.Title+alerts.Transform.Severity+alerts.Transform.Tags+alerts.Transform.Drop != "" || len(alerts.Transform.Labels) > 0},
+		{"wasm", len(alerts.Wasm) > 0},
+		{"lua", alerts.Lua.Script != ""},
+		{"notifiers", len(a.cfg.Notifiers) > 0},
+		{"admin", a.cfg.Admin.Listen != ""},
+		{"record", a.cfg.Record.Path != ""},
+		{"grafana", a.cfg.Grafana.URL != ""},
+		{"escalation", len(alerts.Escalation.Rules)+len(alerts.Escalation.Policies) > 0},
+		{"maintenance_windows", len(alerts.MaintenanceWindows) > 0},
+		{"time_rules", len(alerts.TimeRules) > 0},
+		{"correlation", len(alerts.Correlation.Labels) > 0},
+		{"acknowledgement", alerts.Ack.Interval > 0},
+		{"comments", alerts.Comments.Interval > 0},
+		{"history", alerts.HistoryTTL > 0},
+		{"iocs", alerts.IOCs.Enabled},
+		{"assets", alerts.Assets.Enabled},
+		{"ownership", len(alerts.Ownership.Teams) > 0},
+		{"kubernetes", alerts.Kubernetes.Enabled},
+		{"prometheus_queries", alerts.Prometheus.URL != ""},
+		{"loki", alerts.Loki.URL != ""},
+		{"traces", len(alerts.Traces.Backends) > 0},
+		{"virustotal", alerts.Enrichment.VirusTotal.APIKey != ""},
+		{"abuseipdb", alerts.Enrichment.AbuseIPDB.APIKey != ""},
+		{"internetdb", alerts.Enrichment.InternetDB.Enabled},
+		{"misp", alerts.Enrichment.MISP.URL != ""},
+		{"nvd", alerts.Enrichment.NVD.Enabled},
+		{"rdap", alerts.Enrichment.RDAP.Enabled},
+		{"netbox", alerts.Enrichment.NetBox.URL != ""},
+		{"repeat_escalation", alerts.RepeatEscalation.Duration > 0 || alerts.RepeatEscalation.Count > 0},
+	} {
+		if f.enabled {
+			info.Features = append(info.Features, f.name)
+		}
+	}
+	return info
+}
+
+func (a *App) handleVersion(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.BuildInfo())
+}
@@ -0,0 +1,150 @@
+package alertiris
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type VirusTotalConfig struct {
+	APIKey string `koanf:"api_key"`
+	URL    string `koanf:"url"`
+	// RateLimit is the number of lookups per minute, 4 on the public API.
+	RateLimit  int           `koanf:"rate_limit"`
+	CacheTTL   time.Duration `koanf:"cache_ttl"`
+	MaxLookups int           `koanf:"max_lookups"`
+	Timeout    time.Duration `koanf:"timeout"`
+}
+
+// virusTotal looks up hashes, domains and public IPs in VirusTotal.
+type virusTotal struct {
+	cfg     VirusTotalConfig
+	client  *http.Client
+	cache   *enrichmentCache
+	limiter *lookupLimiter
+}
+
+// vtVerdict is the last analysis of an object, cached per IOC.
+type vtVerdict struct {
+	Found      bool `json:"found"`
+	Malicious  int  `json:"malicious"`
+	Suspicious int  `json:"suspicious"`
+	Harmless   int  `json:"harmless"`
+	Undetected int  `json:"undetected"`
+}
+
+func newVirusTotal(cfg VirusTotalConfig, cache *enrichmentCache) *virusTotal {
+	if cfg.APIKey == "" {
+		return nil
+	}
+	return &virusTotal{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: cfg.Timeout},
+		cache:   cache,
+		limiter: &lookupLimiter{limit: cfg.RateLimit},
+	}
+}
+
+func (v *virusTotal) name() string { return "virustotal" }
+
+// vtObject returns the API collection and GUI path of an IOC.
+func vtObject(ioc IOC) (string, string, bool) {
+	switch ioc.Type {
+	case IOCMD5, IOCSHA1, IOCSHA256:
+		return "files", "file", true
+	case IOCDomain:
+		return "domains", "domain", true
+	case IOCIPv4, IOCIPv6:
+		if publicIP(ioc.Value) {
+			return "ip_addresses", "ip-address", true
+		}
+	}
+	return "", "", false
+}
+
+func (v *virusTotal) enrich(ctx context.Context, sa *SinkAlert, iocs []IOC) string {
+	var lines []string
+	lookups := 0
+	for _, ioc := range iocs {
+		collection, gui, ok := vtObject(ioc)
+		if !ok {
+			continue
+		}
+		if v.cfg.MaxLookups > 0 && lookups >= v.cfg.MaxLookups {
+			break
+		}
+		lookups++
+		verdict, err := v.lookup(ctx, collection, ioc.Value)
+		if err != nil {
+			slog.Warn("virustotal lookup failed", "fingerprint", sa.Fingerprint, "ioc", ioc.Value, "error", err)
+			continue
+		}
+		if !verdict.Found {
+			lines = append(lines, fmt.Sprintf("- %s (%s): not found", ioc.Value, ioc.Type))
+			continue
+		}
+		total := verdict.Malicious + verdict.Suspicious + verdict.Harmless + verdict.Undetected
+		lines = append(lines, fmt.Sprintf("- %s (%s): %d/%d malicious, %d suspicious https://www.virustotal.com/gui/%s/%s",
+			ioc.Value, ioc.Type, verdict.Malicious, total, verdict.Suspicious, gui, url.PathEscape(ioc.Value)))
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return "VirusTotal:\n" + strings.Join(lines, "\n")
+}
+
+func (v *virusTotal) lookup(ctx context.Context, collection, id string) (vtVerdict, error) {
+	var verdict vtVerdict
+	if v.cache.get("virustotal", id, &verdict) {
+		enrichmentLookups("virustotal", "cached").Inc()
+		return verdict, nil
+	}
+	if !v.limiter.allow() {
+		enrichmentLookups("virustotal", "rate_limited").Inc()
+		return verdict, fmt.Errorf("rate limit of %d lookups per minute reached", v.cfg.RateLimit)
+	}
+
+	u := fmt.Sprintf("%s/%s/%s", strings.TrimRight(v.cfg.URL, "/"), collection, url.PathEscape(id))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return verdict, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("x-apikey", v.cfg.APIKey)
+	resp, err := v.client.Do(req)
+	if err != nil {
+		enrichmentFailed("virustotal")
+		return verdict, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var body struct {
+			Data struct {
+				Attributes struct {
+					Stats vtVerdict `json:"last_analysis_stats"`
+				} `json:"attributes"`
+			} `json:"data"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			enrichmentFailed("virustotal")
+			return verdict, fmt.Errorf("decode response: %w", err)
+		}
+		verdict = body.Data.Attributes.Stats
+		verdict.Found = true
+	case http.StatusNotFound:
+	default:
+		enrichmentFailed("virustotal")
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return verdict, fmt.Errorf("virustotal returned %s: %s", resp.Status, msg)
+	}
+	enrichmentLookups("virustotal", "ok").Inc()
+	v.cache.set("virustotal", id, verdict, v.cfg.CacheTTL)
+	return verdict, nil
+}
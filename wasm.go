@@ -0,0 +1,149 @@
+package alertiris
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+type WasmConfig struct {
+	Path    string        `koanf:"path"`
+	Timeout time.Duration `koanf:"timeout"`
+}
+
+type wasmModule struct {
+	path     string
+	timeout  time.Duration
+	compiled wazero.CompiledModule
+}
+
+// WasmTransformer runs alerts through WebAssembly modules. A module must
+// export "memory", "alloc(size i32) i32" and
+// "transform(ptr i32, len i32) i64". transform receives the alert as JSON and
+// returns the modified alert JSON packed as ptr<<32|len, or 0 to leave the
+// alert unchanged. Each call gets a fresh module instance.
+type WasmTransformer struct {
+	runtime wazero.Runtime
+	modules []wasmModule
+}
+
+func NewWasmTransformer(cfgs []WasmConfig) (*WasmTransformer, error) {
+	if len(cfgs) == 0 {
+		return &WasmTransformer{}, nil
+	}
+
+	ctx := context.Background()
+	rt := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithCloseOnContextDone(true).
+		WithMemoryLimitPages(512))
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, rt); err != nil {
+		rt.Close(ctx)
+		return nil, fmt.Errorf("instantiate wasi: %w", err)
+	}
+
+	t := &WasmTransformer{runtime: rt}
+	for _, cfg := range cfgs {
+		code, err := os.ReadFile(cfg.Path)
+		if err != nil {
+			rt.Close(ctx)
+			return nil, fmt.Errorf("read wasm module: %w", err)
+		}
+		compiled, err := rt.CompileModule(ctx, code)
+		if err != nil {
+			rt.Close(ctx)
+			return nil, fmt.Errorf("compile wasm module %s: %w", cfg.Path, err)
+		}
+		for _, fn := range []string{"alloc", "transform"} {
+			if _, ok := compiled.ExportedFunctions()[fn]; !ok {
+				rt.Close(ctx)
+				return nil, fmt.Errorf("wasm module %s does not export %q", cfg.Path, fn)
+			}
+		}
+
+		timeout := cfg.Timeout
+		if timeout <= 0 {
+			timeout = time.Second
+		}
+		t.modules = append(t.modules, wasmModule{path: cfg.Path, timeout: timeout, compiled: compiled})
+	}
+	return t, nil
+}
+
+func (t *WasmTransformer) Apply(alert Alert) (Alert, error) {
+	for _, m := range t.modules {
+		out, err := t.run(m, alert)
+		if err != nil {
+			return alert, fmt.Errorf("wasm module %s: %w", m.path, err)
+		}
+		alert = out
+	}
+	return alert, nil
+}
+
+func (t *WasmTransformer) run(m wasmModule, alert Alert) (Alert, error) {
+	in, err := json.Marshal(alert)
+	if err != nil {
+		return alert, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+
+	mod, err := t.runtime.InstantiateModule(ctx, m.compiled, wazero.NewModuleConfig().
+		WithName("").
+		WithStartFunctions("_initialize"))
+	if err != nil {
+		return alert, fmt.Errorf("instantiate: %w", err)
+	}
+	defer mod.Close(ctx)
+
+	mem := mod.Memory()
+	if mem == nil {
+		return alert, errors.New("module does not export memory")
+	}
+
+	res, err := mod.ExportedFunction("alloc").Call(ctx, uint64(len(in)))
+	if err != nil {
+		return alert, fmt.Errorf("alloc: %w", err)
+	}
+	ptr := uint32(res[0])
+	if !mem.Write(ptr, in) {
+		return alert, errors.New("input out of module memory range")
+	}
+
+	res, err = mod.ExportedFunction("transform").Call(ctx, uint64(ptr), uint64(len(in)))
+	if err != nil {
+		return alert, fmt.Errorf("transform: %w", err)
+	}
+	if res[0] == 0 {
+		return alert, nil
+	}
+
+	outPtr, outLen := uint32(res[0]>>32), uint32(res[0])
+	buf, ok := mem.Read(outPtr, outLen)
+	if !ok {
+		return alert, errors.New("output out of module memory range")
+	}
+
+	var out Alert
+	if err := json.Unmarshal(buf, &out); err != nil {
+		return alert, fmt.Errorf("decode output: %w", err)
+	}
+	if out.Fingerprint == "" {
+		out.Fingerprint = alert.Fingerprint
+	}
+	return out, nil
+}
+
+func (t *WasmTransformer) Close() error {
+	if t.runtime == nil {
+		return nil
+	}
+	return t.runtime.Close(context.Background())
+}